@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// How long updates are paused for when the pause request doesn't say
+const DEFAULT_PAUSE_DURATION = time.Hour
+
+// Authenticated HTTP API for controlling a running daemon
+type ControlAPI struct {
+	// Bearer token every request must present
+	Token  string
+	Daemon *Daemon
+}
+
+// Method to add the control API's routes to the provided mux
+func (a *ControlAPI) Register(mux *http.ServeMux) {
+	mux.Handle("POST /api/check", a.authenticate(a.handleCheck))
+	mux.Handle("GET /api/status", a.authenticate(a.handleStatus))
+	mux.Handle("GET /api/history", a.authenticate(a.handleHistory))
+	mux.Handle("POST /api/pause", a.authenticate(a.handlePause))
+	mux.Handle("POST /api/resume", a.authenticate(a.handleResume))
+}
+
+// Helper method to reject requests that don't carry the expected bearer token
+func (a *ControlAPI) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Handler for POST /api/check, the check runs asynchronously in the daemon loop
+func (a *ControlAPI) handleCheck(w http.ResponseWriter, r *http.Request) {
+	if pausedUntil := a.Daemon.Status.PausedUntil(time.Now()); !pausedUntil.IsZero() {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "updates are paused until " + pausedUntil.Format(time.RFC3339)})
+		return
+	}
+	log.Info("Check requested through the control API")
+	a.Daemon.TriggerCheck()
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "check scheduled"})
+}
+
+// Handler for GET /api/status
+func (a *ControlAPI) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.Daemon.Status.Snapshot())
+}
+
+// Handler for GET /api/history, returns the most recent check results oldest first
+func (a *ControlAPI) handleHistory(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.Daemon.Status.History())
+}
+
+// Handler for POST /api/pause?duration=2h, defaults to DEFAULT_PAUSE_DURATION
+func (a *ControlAPI) handlePause(w http.ResponseWriter, r *http.Request) {
+	duration := DEFAULT_PAUSE_DURATION
+	if value := r.URL.Query().Get("duration"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid duration " + value})
+			return
+		}
+		duration = parsed
+	}
+	until := time.Now().Add(duration)
+	a.Daemon.Status.Pause(until)
+	log.Infof("Updates paused through the control API until %v", until.Format(time.RFC3339))
+	writeJSON(w, http.StatusOK, a.Daemon.Status.Snapshot())
+}
+
+// Handler for POST /api/resume
+func (a *ControlAPI) handleResume(w http.ResponseWriter, r *http.Request) {
+	a.Daemon.Status.Pause(time.Time{})
+	log.Info("Updates resumed through the control API")
+	writeJSON(w, http.StatusOK, a.Daemon.Status.Snapshot())
+}
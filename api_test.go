@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestControlServer(t *testing.T) (*Daemon, *httptest.Server) {
+	t.Helper()
+	daemon := &Daemon{
+		ControlToken: "secret",
+		Status:       &DaemonStatus{},
+		trigger:      make(chan struct{}, 1),
+	}
+	ts := httptest.NewServer(daemon.Handler())
+	t.Cleanup(ts.Close)
+	return daemon, ts
+}
+
+func doControlRequest(t *testing.T, method string, url string, token string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestControlAPI_Unauthorized(t *testing.T) {
+	_, ts := newTestControlServer(t)
+
+	for _, token := range []string{"", "wrong"} {
+		resp := doControlRequest(t, http.MethodGet, ts.URL+"/api/status", token)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for token %q, got %d", token, resp.StatusCode)
+		}
+	}
+
+	// Health endpoints stay open
+	resp := doControlRequest(t, http.MethodGet, ts.URL+"/livez", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 from /livez, got %d", resp.StatusCode)
+	}
+}
+
+func TestControlAPI_Check(t *testing.T) {
+	daemon, ts := newTestControlServer(t)
+
+	resp := doControlRequest(t, http.MethodPost, ts.URL+"/api/check", "secret")
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", resp.StatusCode)
+	}
+	select {
+	case <-daemon.trigger:
+	default:
+		t.Error("Expected a check to be triggered")
+	}
+}
+
+func TestControlAPI_PauseResume(t *testing.T) {
+	daemon, ts := newTestControlServer(t)
+
+	resp := doControlRequest(t, http.MethodPost, ts.URL+"/api/pause?duration=bogus", "secret")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a bad duration, got %d", resp.StatusCode)
+	}
+
+	resp = doControlRequest(t, http.MethodPost, ts.URL+"/api/pause?duration=30m", "secret")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if daemon.Status.PausedUntil(time.Now()).IsZero() {
+		t.Fatal("Expected updates to be paused")
+	}
+
+	// Checks can't be forced while paused
+	resp = doControlRequest(t, http.MethodPost, ts.URL+"/api/check", "secret")
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected 409 while paused, got %d", resp.StatusCode)
+	}
+
+	resp = doControlRequest(t, http.MethodPost, ts.URL+"/api/resume", "secret")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if !daemon.Status.PausedUntil(time.Now()).IsZero() {
+		t.Error("Expected updates to be resumed")
+	}
+}
+
+func TestControlAPI_History(t *testing.T) {
+	daemon, ts := newTestControlServer(t)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	daemon.Status.Record(now, CheckReport{}, nil)
+	daemon.Status.Record(now.Add(time.Minute), CheckReport{}, errors.New("could not retrieve initial values"))
+
+	resp := doControlRequest(t, http.MethodGet, ts.URL+"/api/history", "secret")
+	var history []CheckResult
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		t.Fatalf("Unexpected error decoding body: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(history))
+	}
+	if history[0].Error != "" || history[1].Error != "could not retrieve initial values" {
+		t.Errorf("Unexpected history: %+v", history)
+	}
+}
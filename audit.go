@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Name of the command querying the audit log
+const HISTORY_COMMAND = "history"
+
+// Outcome of a record in an audit log entry
+const AUDIT_CHANGED = "changed"
+const AUDIT_UNCHANGED = "unchanged"
+const AUDIT_FAILED = "failed"
+
+// Ways the history command prints the entries
+const HISTORY_OUTPUT_TABLE = "table"
+const HISTORY_OUTPUT_JSON = "json"
+
+// A line of the audit log, what a check did to a single record
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Name of the record, empty for a check that failed before getting to any
+	Record string `json:"record,omitempty"`
+	// AUDIT_CHANGED, AUDIT_UNCHANGED or AUDIT_FAILED
+	Result   string `json:"result"`
+	IP       string `json:"ip,omitempty"`
+	Previous string `json:"previous,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Code     string `json:"code,omitempty"`
+	// Ray ID of the Cloudflare response the record failed with
+	RayID string `json:"rayId,omitempty"`
+	// ID of the check, shared by its entries and log lines
+	CheckID string `json:"checkId,omitempty"`
+}
+
+// Method to turn a finished check into audit log entries, one per record
+func AuditEntries(at time.Time, report CheckReport, err error) []AuditEntry {
+	var entries []AuditEntry
+	for _, record := range report.Records {
+		entry := AuditEntry{Time: at, Record: record.Name, Result: AUDIT_UNCHANGED, IP: record.IP, Previous: record.Previous, CheckID: report.CheckID}
+		switch {
+		case record.Error != "":
+			entry.Result, entry.Error, entry.Code, entry.RayID = AUDIT_FAILED, record.Error, record.Code, record.RayID
+		case record.Changed:
+			entry.Result = AUDIT_CHANGED
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 && err != nil {
+		entries = append(entries, AuditEntry{Time: at, Result: AUDIT_FAILED, Error: err.Error(), Code: ErrorCode(err), RayID: RayID(err), CheckID: report.CheckID})
+	}
+	return entries
+}
+
+// Method to append a finished check to the audit log, a file of JSON lines that only ever grows
+// An SQLite audit log drops the entries older than retention instead, when it's set
+func AppendAudit(path string, at time.Time, report CheckReport, err error, retention time.Duration) error {
+	if IsSQLitePath(path) {
+		if sqlErr := appendAuditSQLite(path, AuditEntries(at, report, err), at, retention); sqlErr != nil {
+			return fmt.Errorf("writing audit log failed: %w", sqlErr)
+		}
+		return nil
+	}
+	file, openErr := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if openErr != nil {
+		return fmt.Errorf("writing audit log failed: %w", openErr)
+	}
+	defer file.Close()
+	encoder := json.NewEncoder(file)
+	for _, entry := range AuditEntries(at, report, err) {
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("writing audit log failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// Method to read every entry of the audit log, oldest first
+func ReadAudit(path string) ([]AuditEntry, error) {
+	return QueryAudit(path, AuditFilter{})
+}
+
+// Method to read the entries of the audit log the filter wants, oldest first
+// An SQLite audit log is queried for them, a file of JSON lines is read whole and filtered
+func QueryAudit(path string, filter AuditFilter) ([]AuditEntry, error) {
+	if IsSQLitePath(path) {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		entries, err := queryAuditSQLite(path, filter)
+		if err != nil {
+			return nil, fmt.Errorf("reading audit log failed: %w", err)
+		}
+		return entries, nil
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading audit log failed: %w", err)
+	}
+	defer file.Close()
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("audit log %v line %d: %w", path, line, err)
+		}
+		if filter.Matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading audit log failed: %w", err)
+	}
+	return entries, nil
+}
+
+// Which audit log entries the history command prints, zero values match everything
+type AuditFilter struct {
+	Record string
+	Since  time.Time
+	Until  time.Time
+	Result string
+}
+
+// Method to report whether the filter wants the entry
+func (f AuditFilter) Matches(entry AuditEntry) bool {
+	if f.Record != "" && !strings.EqualFold(f.Record, entry.Record) {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && entry.Time.After(f.Until) {
+		return false
+	}
+	return f.Result == "" || f.Result == entry.Result
+}
+
+// Helper method to read a point in time given to the history command, a time like 2024-05-01T12:00:00Z or a duration before now like 24h
+func parseHistoryTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if ago, err := time.ParseDuration(value); err == nil {
+		return now.Add(-ago), nil
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a time like 2024-05-01T12:00:00Z nor a duration like 24h", value)
+	}
+	return at, nil
+}
+
+// Method to run the history command, printing the audit log entries matching the filters given in args
+func RunHistory(path string, args []string, now time.Time, out io.Writer) error {
+	flags := flag.NewFlagSet(HISTORY_COMMAND, flag.ContinueOnError)
+	record := flags.String("record", "", "Optional. Only show this record, e.g. home.example.com. Defaults to every record.")
+	since := flags.String("since", "", "Optional. Only show entries from this time on, e.g. 2024-05-01T12:00:00Z, or this long ago, e.g. 24h. Defaults to the start of the log.")
+	until := flags.String("until", "", "Optional. Only show entries up to this time, given like since. Defaults to now.")
+	result := flags.String("result", "", "Optional. Only show entries with this result, changed, unchanged or failed. Defaults to every result.")
+	output := flags.String("output", HISTORY_OUTPUT_TABLE, "Optional. Print a table or json, one entry per line. Defaults to table.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	filter := AuditFilter{Record: strings.TrimSuffix(*record, "."), Result: *result}
+	if filter.Result != "" && filter.Result != AUDIT_CHANGED && filter.Result != AUDIT_UNCHANGED && filter.Result != AUDIT_FAILED {
+		return fmt.Errorf("result must be %v, %v or %v, got %q", AUDIT_CHANGED, AUDIT_UNCHANGED, AUDIT_FAILED, filter.Result)
+	}
+	if *output != HISTORY_OUTPUT_TABLE && *output != HISTORY_OUTPUT_JSON {
+		return fmt.Errorf("output must be %v or %v, got %q", HISTORY_OUTPUT_TABLE, HISTORY_OUTPUT_JSON, *output)
+	}
+	var err error
+	if filter.Since, err = parseHistoryTime(*since, now); err != nil {
+		return fmt.Errorf("since: %w", err)
+	}
+	if filter.Until, err = parseHistoryTime(*until, now); err != nil {
+		return fmt.Errorf("until: %w", err)
+	}
+
+	entries, err := QueryAudit(path, filter)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(out)
+	for _, entry := range entries {
+		if *output == HISTORY_OUTPUT_JSON {
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprintln(out, formatAuditEntry(entry, out))
+	}
+	return nil
+}
+
+// Helper method to print an entry as a table row, e.g. "2024-05-01T12:00:00Z  home.example.com  changed  203.0.113.1 -> 198.51.100.7"
+func formatAuditEntry(entry AuditEntry, out io.Writer) string {
+	record := entry.Record
+	if record == "" {
+		record = "(check)"
+	}
+	detail := entry.IP
+	color := ""
+	switch entry.Result {
+	case AUDIT_CHANGED:
+		detail = fmt.Sprintf("%v -> %v", entry.Previous, entry.IP)
+		color = ANSI_GREEN
+	case AUDIT_FAILED:
+		detail = entry.Error
+		if entry.Code != "" {
+			detail = entry.Code + ": " + entry.Error
+		}
+		color = ANSI_RED
+	}
+	return fmt.Sprintf("%v  %-40s %v  %v", entry.Time.Format(time.RFC3339), record, Colorize(out, color, fmt.Sprintf("%-9s", entry.Result)), detail)
+}
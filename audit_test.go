@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendAudit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	first := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	report := CheckReport{PublicIP: "198.51.100.7", Records: []RecordState{
+		{Name: "example.com", IP: "198.51.100.7", Previous: "203.0.113.1", Changed: true},
+		{Name: "www.example.com", IP: "198.51.100.7"},
+		{Name: "gone.example.com", Error: "couldn't obtain A Record ID", Code: E_RECORD_NOT_FOUND},
+	}}
+	if err := AppendAudit(path, first, report, errors.New("gone.example.com: couldn't obtain A Record ID"), 0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// A check failing before getting to the records still leaves a line
+	if err := AppendAudit(path, first.Add(time.Hour), CheckReport{}, WithCode(E_DETECT_TIMEOUT, errors.New("could not retrieve initial values")), 0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	entries, err := ReadAudit(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []AuditEntry{
+		{Time: first, Record: "example.com", Result: AUDIT_CHANGED, IP: "198.51.100.7", Previous: "203.0.113.1"},
+		{Time: first, Record: "www.example.com", Result: AUDIT_UNCHANGED, IP: "198.51.100.7"},
+		{Time: first, Record: "gone.example.com", Result: AUDIT_FAILED, Error: "couldn't obtain A Record ID", Code: E_RECORD_NOT_FOUND},
+		{Time: first.Add(time.Hour), Result: AUDIT_FAILED, Error: "could not retrieve initial values", Code: E_DETECT_TIMEOUT},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %+v", len(expected), entries)
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, expected[i], entries[i])
+		}
+	}
+
+	if entries, err := ReadAudit(filepath.Join(t.TempDir(), "missing.log")); err != nil || len(entries) != 0 {
+		t.Errorf("Expected no entries for a missing log, got %v, %v", entries, err)
+	}
+}
+
+func TestRunHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	now := time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC)
+	for i, ip := range []string{"203.0.113.1", "198.51.100.7", "198.51.100.8"} {
+		report := CheckReport{Records: []RecordState{
+			{Name: "example.com", IP: ip, Previous: "192.0.2.1", Changed: true},
+			{Name: "lab.example.com", Error: "updating failed", Code: E_RATE_LIMITED},
+		}}
+		if err := AppendAudit(path, now.Add(time.Duration(i-2)*24*time.Hour), report, nil, 0); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{nil, []string{"203.0.113.1", "updating failed", "198.51.100.7", "updating failed", "198.51.100.8", "updating failed"}},
+		{[]string{"-record", "example.com", "-since", "36h"}, []string{"192.0.2.1 -> 198.51.100.7", "192.0.2.1 -> 198.51.100.8"}},
+		{[]string{"-result", "failed", "-until", "2024-05-01T12:00:00Z"}, []string{"E_RATE_LIMITED: updating failed"}},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		if err := RunHistory(path, tt.args, now, &out); err != nil {
+			t.Fatalf("%v: unexpected error: %v", tt.args, err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != len(tt.expected) {
+			t.Errorf("%v: expected %d lines, got %q", tt.args, len(tt.expected), out.String())
+			continue
+		}
+		for i, line := range lines {
+			if !strings.Contains(line, tt.expected[i]) {
+				t.Errorf("%v: expected line %d to contain %q, got %q", tt.args, i, tt.expected[i], line)
+			}
+		}
+	}
+
+	var out strings.Builder
+	if err := RunHistory(path, []string{"-output", "json", "-result", "changed", "-since", "2024-05-03T00:00:00Z"}, now, &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var entry AuditEntry
+	if err := json.Unmarshal([]byte(out.String()), &entry); err != nil || entry.IP != "198.51.100.8" || entry.Result != AUDIT_CHANGED {
+		t.Errorf("Expected a single JSON entry for the last change, got %q (%v)", out.String(), err)
+	}
+
+	for _, args := range [][]string{{"-result", "skipped"}, {"-output", "yaml"}, {"-since", "yesterday"}} {
+		if err := RunHistory(path, args, now, &strings.Builder{}); err == nil {
+			t.Errorf("%v: expected error but got none", args)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v4/shared"
+)
+
+// Name of the command checking Cloudflare's audit log for changes to the managed records made outside this program
+const AUDIT_COMMAND = "audit"
+
+// How far back the audit command looks when not told
+const AUDIT_DEFAULT_SINCE = 7 * 24 * time.Hour
+
+// How far apart a change in Cloudflare's audit log and a local audit entry may be to be the same change
+// The local entry is written once the whole check is done, so it's usually a little after Cloudflare's
+const AUDIT_MATCH_WINDOW = 5 * time.Minute
+
+// An entry of Cloudflare's audit log
+type CloudflareChange struct {
+	When time.Time
+	// e.g. rec_set, rec_add or rec_del for records
+	Action string
+	// Whether the change was made, failed attempts are logged too
+	Succeeded bool
+	// ID of what was changed, the record's ID for records
+	ResourceID string
+	// Name of the record, when the entry says
+	Name string
+	// Email of whoever made the change, or their ID when there's no email
+	Actor string
+	// Where the change was made from, e.g. API or UI
+	Interface string
+}
+
+// Helper method to convert an audit log entry returned by the Cloudflare API
+func NewCloudflareChange(entry shared.AuditLog) CloudflareChange {
+	change := CloudflareChange{
+		When:       entry.When,
+		Action:     entry.Action.Type,
+		Succeeded:  entry.Action.Result,
+		ResourceID: entry.Resource.ID,
+		Actor:      entry.Actor.Email,
+		Interface:  entry.Interface,
+	}
+	if change.Actor == "" {
+		change.Actor = entry.Actor.ID
+	}
+	if metadata, ok := entry.Metadata.(map[string]any); ok {
+		change.Name, _ = metadata["name"].(string)
+	}
+	return change
+}
+
+// A change Cloudflare logged to a managed record, and whether this program made it
+type AuditCheck struct {
+	Record string
+	Change CloudflareChange
+	// Whether the local audit log has a change to the record at about the same time
+	Ours bool
+}
+
+// Method to go through Cloudflare's audit log for every account's managed records, the www ones included, and match its changes up with the local one
+// Zones that couldn't be looked up are returned as errors after the changes of the rest
+func AuditChecks(accounts []Account, local []AuditEntry, since time.Time) ([]AuditCheck, error) {
+	var checks []AuditCheck
+	var errs []error
+	for _, account := range accounts {
+		groups, err := ResolveZones(account.Client, account.Targets)
+		if err != nil {
+			errs = append(errs, account.wrapError(err))
+		}
+		for _, group := range groups {
+			zoneChecks, err := auditZone(account.Client, group, local, since)
+			if err != nil {
+				errs = append(errs, account.wrapError(fmt.Errorf("zone %v: %w", group.Zone.Name, err)))
+				continue
+			}
+			checks = append(checks, zoneChecks...)
+		}
+	}
+	slices.SortStableFunc(checks, func(a AuditCheck, b AuditCheck) int { return a.Change.When.Compare(b.Change.When) })
+	return checks, errors.Join(errs...)
+}
+
+// Helper method to match the changes Cloudflare logged to the zone's managed records up with the local audit log
+func auditZone(cfClient CloudflareAPI, group ZoneGroup, local []AuditEntry, since time.Time) ([]AuditCheck, error) {
+	// A zone given by its ID in the config wasn't listed, so its name and account aren't known yet
+	zone := group.Zone
+	if zone.AccountID == "" {
+		zoneList, err := cfClient.Zones()
+		if err != nil {
+			return nil, fmt.Errorf("listing zones failed: %w", err)
+		}
+		i := slices.IndexFunc(zoneList, func(listed Zone) bool { return listed.ID == zone.ID })
+		if i < 0 || zoneList[i].AccountID == "" {
+			return nil, fmt.Errorf("could not find the account the zone is in")
+		}
+		zone = zoneList[i]
+	}
+
+	records, err := ListFilteredRecords(cfClient, zone.ID, group.Filter(""))
+	if err != nil {
+		return nil, err
+	}
+	// Records are matched by ID, and by name for those deleted since, whose IDs aren't listed anymore
+	managed := map[string]string{}
+	var names []string
+	for _, target := range group.Records {
+		domainRecord, wwwRecord := FindDNSRecords(records, target)
+		names = append(names, strings.ToLower(target.Name))
+		if domainRecord.ID != "" {
+			managed[domainRecord.ID] = domainRecord.Name
+		}
+		if target.WWW {
+			names = append(names, "www."+strings.ToLower(target.Name))
+			if wwwRecord.ID != "" {
+				managed[wwwRecord.ID] = wwwRecord.Name
+			}
+		}
+	}
+
+	changes, err := cfClient.AuditLogs(zone.AccountID, zone.Name, since)
+	if err != nil {
+		return nil, fmt.Errorf("reading audit log failed: %w", err)
+	}
+	var checks []AuditCheck
+	for _, change := range changes {
+		if !change.Succeeded {
+			continue
+		}
+		name, ok := managed[change.ResourceID]
+		if !ok && slices.Contains(names, strings.ToLower(strings.TrimSuffix(change.Name, "."))) {
+			name, ok = strings.TrimSuffix(change.Name, "."), true
+		}
+		if !ok {
+			continue
+		}
+		checks = append(checks, AuditCheck{Record: name, Change: change, Ours: madeLocally(local, name, change.When)})
+	}
+	return checks, nil
+}
+
+// Helper method to report whether the local audit log has a change to the record close enough to the time given to be the same one
+// Failed entries count too, a record rolled back or failing after the edit was still edited
+func madeLocally(local []AuditEntry, name string, at time.Time) bool {
+	return slices.ContainsFunc(local, func(entry AuditEntry) bool {
+		return entry.Result != AUDIT_UNCHANGED && strings.EqualFold(entry.Record, name) && entry.Time.Sub(at).Abs() <= AUDIT_MATCH_WINDOW
+	})
+}
+
+// Method to run the audit command, printing the changes Cloudflare logged to the managed records, the ones made outside this program marked
+// The command fails when there are any of those, so it can be run from cron or CI to be told about them
+func RunAuditCheck(accounts []Account, auditPath string, args []string, now time.Time, out io.Writer) error {
+	flags := flag.NewFlagSet(AUDIT_COMMAND, flag.ContinueOnError)
+	since := flags.String("since", "", "Optional. Only look at changes from this time on, e.g. 2024-05-01T12:00:00Z, or this long ago, e.g. 24h. Defaults to 7 days ago.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	from := now.Add(-AUDIT_DEFAULT_SINCE)
+	if *since != "" {
+		var err error
+		if from, err = parseHistoryTime(*since, now); err != nil {
+			return fmt.Errorf("since: %w", err)
+		}
+	}
+
+	// Local entries a little before the start still match the first changes
+	local, err := QueryAudit(auditPath, AuditFilter{Since: from.Add(-AUDIT_MATCH_WINDOW)})
+	if err != nil {
+		return err
+	}
+	checks, checkErr := AuditChecks(accounts, local, from)
+	outside := 0
+	for _, check := range checks {
+		by := check.Change.Actor
+		if check.Change.Interface != "" {
+			by += " (" + check.Change.Interface + ")"
+		}
+		origin := Colorize(out, ANSI_DIM, "go-dns-update")
+		if !check.Ours {
+			origin = Colorize(out, ANSI_RED, "OUTSIDE")
+			outside++
+		}
+		fmt.Fprintf(out, "%v  %-40s %-8s %-40s %v\n", check.Change.When.UTC().Format(time.RFC3339), check.Record, check.Change.Action, by, origin)
+	}
+	if len(checks) == 0 && checkErr == nil {
+		fmt.Fprintf(out, "No changes to the managed records since %v\n", from.UTC().Format(time.RFC3339))
+	}
+	if outside > 0 {
+		checkErr = errors.Join(checkErr, fmt.Errorf("%d changes to managed records were made outside go-dns-update", outside))
+	}
+	return checkErr
+}
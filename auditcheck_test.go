@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunAuditCheck(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com", "account": map[string]any{"id": "a1"}}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "home.example.com", "type": "A", "content": "198.51.100.7", "ttl": 1},
+				{"id": "r2", "name": "other.example.com", "type": "A", "content": "198.51.100.7", "ttl": 1},
+			},
+		},
+		auditLogs: []map[string]any{
+			// Made by this program, a local entry follows it within seconds
+			{"id": "l1", "when": "2026-10-15T08:00:00Z", "action": map[string]any{"type": "rec_set", "result": true}, "actor": map[string]any{"id": "u1"}, "interface": "API", "resource": map[string]any{"id": "r1", "type": "DNS_record"}},
+			// Edited in the dashboard
+			{"id": "l2", "when": "2026-10-16T09:30:00Z", "action": map[string]any{"type": "rec_set", "result": true}, "actor": map[string]any{"id": "u2", "email": "alice@example.com"}, "interface": "UI", "resource": map[string]any{"id": "r1", "type": "DNS_record"}},
+			// Failed attempts and unmanaged records are left out
+			{"id": "l3", "when": "2026-10-16T10:00:00Z", "action": map[string]any{"type": "rec_set", "result": false}, "actor": map[string]any{"id": "u2"}, "resource": map[string]any{"id": "r1", "type": "DNS_record"}},
+			{"id": "l4", "when": "2026-10-16T10:00:00Z", "action": map[string]any{"type": "rec_set", "result": true}, "actor": map[string]any{"id": "u2"}, "resource": map[string]any{"id": "r2", "type": "DNS_record"}},
+			// A deleted www record is matched by its name
+			{"id": "l5", "when": "2026-10-16T11:00:00Z", "action": map[string]any{"type": "rec_del", "result": true}, "actor": map[string]any{"id": "u2"}, "interface": "API", "resource": map[string]any{"id": "r9", "type": "DNS_record"}, "metadata": map[string]any{"name": "www.home.example.com"}},
+		},
+	}
+	accounts := []Account{{Client: newTestCloudflareAPI(t, fake), Targets: []RecordConfig{{Name: "home.example.com", WWW: true}}}}
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	local := `{"time":"2026-10-15T08:00:12Z","record":"home.example.com","result":"changed","ip":"198.51.100.7","previous":"203.0.113.1"}` + "\n" +
+		`{"time":"2026-10-16T09:31:00Z","record":"home.example.com","result":"unchanged","ip":"198.51.100.7"}` + "\n"
+	if err := os.WriteFile(auditPath, []byte(local), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var out strings.Builder
+	err := RunAuditCheck(accounts, auditPath, []string{"-since", "2026-10-01T00:00:00Z"}, time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC), &out)
+	if err == nil || !strings.Contains(err.Error(), "2 changes to managed records were made outside go-dns-update") {
+		t.Errorf("Expected error for 2 outside changes, got %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 changes, got %q", out.String())
+	}
+	if !strings.Contains(lines[0], "u1 (API)") || !strings.HasSuffix(lines[0], "go-dns-update") {
+		t.Errorf("Expected the first change to be the program's, got %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "alice@example.com (UI)") || !strings.HasSuffix(lines[1], "OUTSIDE") {
+		t.Errorf("Expected the dashboard edit to be flagged, got %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "www.home.example.com") || !strings.Contains(lines[2], "rec_del") || !strings.HasSuffix(lines[2], "OUTSIDE") {
+		t.Errorf("Expected the www record's deletion to be flagged, got %q", lines[2])
+	}
+}
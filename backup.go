@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Layout of the timestamp in backup file names, sortable and free of characters some filesystems reject
+const BACKUP_TIME_LAYOUT = "20060102T150405Z"
+
+// A snapshot of a zone's records taken by the backup command
+type Backup struct {
+	Zone    string    `json:"zone"`
+	TakenAt time.Time `json:"taken_at"`
+	// The records as a sync file would declare them, so restoring is a sync to the snapshot
+	Records []SyncRecord `json:"records"`
+}
+
+// Method to snapshot the records of the zone holding domainName to a timestamped JSON file in dir, returning the file's path
+// Only the record types the sync command manages are kept, use the export command for a full zone file
+func BackupZone(cfClient CloudflareAPI, domainName string, dir string, now time.Time) (string, error) {
+	zoneList, err := ListZones(cfClient)
+	if err != nil {
+		return "", err
+	}
+	zone, ok := MatchZone(zoneList, domainName)
+	if !ok {
+		return "", fmt.Errorf("could not match a Zone ID to the provided domain name")
+	}
+	live, err := ListDNSRecords(cfClient, zone.ID)
+	if err != nil {
+		return "", err
+	}
+	backup := Backup{Zone: zone.Name, TakenAt: now.UTC()}
+	for _, record := range live {
+		if !IsSyncType(record.Type) {
+			continue
+		}
+		proxied := record.Proxied
+		backup.Records = append(backup.Records, SyncRecord{
+			Name:    record.Name,
+			Type:    record.Type,
+			Content: RecordPresentation(record),
+			TTL:     record.TTL,
+			Proxied: &proxied,
+		})
+	}
+	contents, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encoding backup failed: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%v-%v.json", zone.Name, backup.TakenAt.Format(BACKUP_TIME_LAYOUT)))
+	if err := os.WriteFile(path, append(contents, '\n'), 0o600); err != nil {
+		return "", fmt.Errorf("writing backup failed: %w", err)
+	}
+	return path, nil
+}
+
+// Method to read a snapshot written by the backup command
+func LoadBackup(path string) (*Backup, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading backup failed: %w", err)
+	}
+	var backup Backup
+	if err := json.Unmarshal(contents, &backup); err != nil {
+		return nil, fmt.Errorf("parsing backup %v failed: %w", path, err)
+	}
+	if backup.Zone == "" {
+		return nil, fmt.Errorf("backup %v names no zone", path)
+	}
+	return &backup, nil
+}
+
+// Method to put a zone back the way a snapshot recorded it
+// The changes are printed first, then made only once confirmed on in, unless yes is set; dryRun stops after printing them
+func RestoreZone(cfClient CloudflareAPI, path string, dryRun bool, yes bool, in io.Reader, out io.Writer) error {
+	backup, err := LoadBackup(path)
+	if err != nil {
+		return err
+	}
+	zoneID, err := GetZoneID(cfClient, backup.Zone)
+	if err != nil {
+		return err
+	}
+	live, err := ListDNSRecords(cfClient, zoneID)
+	if err != nil {
+		return err
+	}
+	changes := PlanSync(live, backup.Records)
+	if len(changes) == 0 {
+		fmt.Fprintf(out, "Zone %v already matches the backup taken %v, nothing to do\n", backup.Zone, backup.TakenAt.Format(time.RFC3339))
+		return nil
+	}
+	for _, change := range changes {
+		PrintDiffLine(out, change)
+	}
+	fmt.Fprintf(out, "\n%v\n", ChangeCounts(changes))
+	if dryRun {
+		return nil
+	}
+	if !yes {
+		confirmed, err := Confirm(in, out, fmt.Sprintf("Restore %v to the backup taken %v?", backup.Zone, backup.TakenAt.Format(time.RFC3339)))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			fmt.Fprintln(out, "Restore cancelled")
+			return nil
+		}
+	}
+	return ApplySync(cfClient, zoneID, changes, out)
+}
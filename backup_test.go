@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupAndRestoreZone(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "example.com", "type": "A", "content": "203.0.113.1", "ttl": 1, "proxied": true},
+				{"id": "r2", "name": "example.com", "type": "MX", "content": "mx1.example.com", "priority": 10, "ttl": 3600},
+				{"id": "r3", "name": "sub.example.com", "type": "NS", "content": "ns1.example.net", "ttl": 3600},
+			},
+		},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+	dir := t.TempDir()
+	path, err := BackupZone(cfClient, "home.example.com", dir, time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := filepath.Join(dir, "example.com-20261017T093000Z.json"); path != expected {
+		t.Errorf("Expected %v, got %v", expected, path)
+	}
+	backup, err := LoadBackup(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if backup.Zone != "example.com" || len(backup.Records) != 2 || backup.Records[1].Content != "10 mx1.example.com" || !*backup.Records[0].Proxied {
+		t.Errorf("Expected the A and MX records to be backed up, got %+v", backup)
+	}
+
+	// A botched edit changes the A record and removes the MX one
+	fake.records["z1"][0]["content"] = "198.51.100.7"
+	fake.records["z1"] = fake.records["z1"][:1]
+
+	var out strings.Builder
+	if err := RestoreZone(cfClient, path, true, false, nil, &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "~ update A example.com: 198.51.100.7 -> 203.0.113.1") || !strings.Contains(out.String(), "+ create MX example.com: 10 mx1.example.com") {
+		t.Errorf("Expected the changes to be printed, got %q", out.String())
+	}
+	if len(fake.edits) != 0 || len(fake.records["z1"]) != 1 {
+		t.Error("Expected a dry run to change nothing")
+	}
+
+	out.Reset()
+	if err := RestoreZone(cfClient, path, false, false, strings.NewReader("n\n"), &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "Restore cancelled") || len(fake.edits) != 0 {
+		t.Errorf("Expected the restore to be cancelled, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := RunZoneCommand(cfClient, nil, "restore", []string{path}, "", strings.NewReader("y\n"), &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	records := fake.records["z1"]
+	if len(records) != 2 || records[0]["content"] != "203.0.113.1" || records[1]["type"] != "MX" {
+		t.Errorf("Expected the zone to be restored, got %v", records)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+// CloudflareAPI keeping the zones and records it listed for TTL, so a daemon's checks don't list them again every time
+// Records it edits are kept up to date, and what it creates or deletes has their zone listed again
+// A 404 or 412, e.g. from editing a record deleted and recreated since, drops what was kept of the zone so the next check lists it afresh
+type CachingClient struct {
+	CloudflareAPI
+	TTL time.Duration
+	// Clock, time.Now unless a test sets it
+	now     func() time.Time
+	mu      sync.Mutex
+	zones   []Zone
+	zonesAt time.Time
+	// The zones looked up within each domain, including domains without any
+	within map[string]cachedZones
+	// The records listed of each zone, by filter
+	records map[string]map[string]cachedRecords
+}
+
+// Zones looked up within a domain and when
+type cachedZones struct {
+	zones []Zone
+	at    time.Time
+}
+
+// Records listed with a filter and when
+type cachedRecords struct {
+	records []DNSRecord
+	at      time.Time
+}
+
+// Method to wrap a CloudflareAPI with a cache keeping what's listed for ttl
+func NewCachingClient(client CloudflareAPI, ttl time.Duration) *CachingClient {
+	return &CachingClient{CloudflareAPI: client, TTL: ttl, now: time.Now, within: map[string]cachedZones{}, records: map[string]map[string]cachedRecords{}}
+}
+
+func (c *CachingClient) Zones() ([]Zone, error) {
+	c.mu.Lock()
+	if c.zones != nil && c.now().Sub(c.zonesAt) < c.TTL {
+		defer c.mu.Unlock()
+		return slices.Clone(c.zones), nil
+	}
+	c.mu.Unlock()
+	zoneList, err := c.CloudflareAPI.Zones()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.zones, c.zonesAt = slices.Clone(zoneList), c.now()
+	c.mu.Unlock()
+	return zoneList, nil
+}
+
+func (c *CachingClient) ZonesWithin(domain string) ([]Zone, error) {
+	key := strings.ToLower(domain)
+	c.mu.Lock()
+	if cached, ok := c.within[key]; ok && c.now().Sub(cached.at) < c.TTL {
+		defer c.mu.Unlock()
+		return cached.zones, nil
+	}
+	c.mu.Unlock()
+	zoneList, err := c.CloudflareAPI.ZonesWithin(domain)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.within[key] = cachedZones{zones: zoneList, at: c.now()}
+	c.mu.Unlock()
+	return zoneList, nil
+}
+
+func (c *CachingClient) FilteredDNSRecords(zoneID string, filter RecordFilter) ([]DNSRecord, error) {
+	key := strings.Join(filter.Names, ",") + "|" + fmt.Sprint(filter.Types) + "|" + filter.Tag
+	c.mu.Lock()
+	if cached, ok := c.records[zoneID][key]; ok && c.now().Sub(cached.at) < c.TTL {
+		defer c.mu.Unlock()
+		return slices.Clone(cached.records), nil
+	}
+	c.mu.Unlock()
+	records, err := c.CloudflareAPI.FilteredDNSRecords(zoneID, filter)
+	if err != nil {
+		c.invalidate(zoneID, err)
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.records[zoneID] == nil {
+		c.records[zoneID] = map[string]cachedRecords{}
+	}
+	c.records[zoneID][key] = cachedRecords{records: slices.Clone(records), at: c.now()}
+	c.mu.Unlock()
+	return records, nil
+}
+
+func (c *CachingClient) CreateDNSRecord(zoneID string, record dns.RecordParam) error {
+	err := c.CloudflareAPI.CreateDNSRecord(zoneID, record)
+	// Whether or not it went through, the zone's records are listed again to see
+	c.forget(zoneID)
+	c.invalidate(zoneID, err)
+	return err
+}
+
+// The edited record takes the place of the one kept, so the next check sees the new content without listing the zone
+func (c *CachingClient) EditDNSRecord(zoneID string, recordID string, record dns.RecordParam) (DNSRecord, error) {
+	edited, err := c.CloudflareAPI.EditDNSRecord(zoneID, recordID, record)
+	if err != nil {
+		c.invalidate(zoneID, err)
+		return edited, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cached := range c.records[zoneID] {
+		for i := range cached.records {
+			if cached.records[i].ID == recordID {
+				cached.records[i] = edited
+			}
+		}
+	}
+	return edited, nil
+}
+
+func (c *CachingClient) DeleteDNSRecord(zoneID string, recordID string) error {
+	err := c.CloudflareAPI.DeleteDNSRecord(zoneID, recordID)
+	c.forget(zoneID)
+	c.invalidate(zoneID, err)
+	return err
+}
+
+// Helper method to drop the records kept of the zone
+func (c *CachingClient) forget(zoneID string) {
+	c.mu.Lock()
+	delete(c.records, zoneID)
+	c.mu.Unlock()
+}
+
+// Helper method to drop what's kept of the zone when Cloudflare says it's out of date
+// A 404 may also mean the zone itself is gone, so the zones are listed again too
+func (c *CachingClient) invalidate(zoneID string, err error) {
+	var apiErr *cloudflare.Error
+	if !errors.As(err, &apiErr) || (apiErr.StatusCode != http.StatusNotFound && apiErr.StatusCode != http.StatusPreconditionFailed) {
+		return
+	}
+	log.Debugf("Cloudflare answered %d for zone %v, listing its records again on the next check", apiErr.StatusCode, zoneID)
+	c.forget(zoneID)
+	if apiErr.StatusCode == http.StatusNotFound {
+		c.mu.Lock()
+		c.zones = nil
+		clear(c.within)
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/dns"
+)
+
+func TestCachingClient(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones:   []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{"z1": {{"id": "home", "name": "home.example.com", "type": "A", "content": "198.51.100.1", "ttl": 1}}},
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	client := NewCachingClient(newTestCloudflareAPI(t, fake), 10*time.Minute)
+	client.now = func() time.Time { return now }
+	filter := RecordFilter{Names: []string{"home.example.com"}}
+	list := func() []DNSRecord {
+		t.Helper()
+		if _, err := client.Zones(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if zoneList, err := client.ZonesWithin("example.com"); err != nil || len(zoneList) != 1 || zoneList[0].ID != "z1" {
+			t.Fatalf("Expected zone z1, got %+v, %v", zoneList, err)
+		}
+		records, err := client.FilteredDNSRecords("z1", filter)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return records
+	}
+
+	list()
+	requests := fake.requests
+	if records := list(); len(records) != 1 || fake.requests != requests {
+		t.Errorf("Expected the second check to be answered from the cache, got %d more requests", fake.requests-requests)
+	}
+
+	// An edit is kept, the next check sees the new content without listing again
+	if _, err := client.EditDNSRecord("z1", "home", dns.RecordParam{Name: cloudflare.F("home.example.com"), Type: cloudflare.F(dns.RecordType(RECORD_TYPE_A)), Content: cloudflare.F("203.0.113.42")}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	requests = fake.requests
+	if records := list(); records[0].Content != "203.0.113.42" || fake.requests != requests {
+		t.Errorf("Expected the edited record from the cache, got %+v after %d requests", records, fake.requests-requests)
+	}
+
+	// The record is deleted and recreated behind our back, editing the one kept fails and the zone is listed again
+	fake.records["z1"] = []map[string]any{{"id": "recreated", "name": "home.example.com", "type": "A", "content": "198.51.100.1", "ttl": 1}}
+	if _, err := client.EditDNSRecord("z1", "home", dns.RecordParam{Content: cloudflare.F("203.0.113.43")}); err == nil {
+		t.Fatalf("Expected editing the deleted record to fail")
+	}
+	listings := fake.listings
+	if records := list(); len(records) != 1 || records[0].ID != "recreated" || fake.listings != listings+1 {
+		t.Errorf("Expected the recreated record to be listed again, got %+v", records)
+	}
+
+	// Once the TTL is up everything is listed again
+	now = now.Add(10 * time.Minute)
+	requests, listings = fake.requests, fake.listings
+	list()
+	if fake.listings != listings+1 || fake.requests-requests < 2 {
+		t.Errorf("Expected the zones and records to be listed again after the TTL, got %d requests", fake.requests-requests)
+	}
+
+	// Creating a record has the zone listed again to pick it up
+	if err := client.CreateDNSRecord("z1", dns.RecordParam{Name: cloudflare.F("home.example.com"), Type: cloudflare.F(dns.RecordType(RECORD_TYPE_A)), Content: cloudflare.F("203.0.113.44")}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if records := list(); len(records) != 2 {
+		t.Errorf("Expected the created record to be listed, got %+v", records)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/audit_logs"
+	"github.com/cloudflare/cloudflare-go/v4/cache"
+	"github.com/cloudflare/cloudflare-go/v4/dns"
+	"github.com/cloudflare/cloudflare-go/v4/shared"
+	"github.com/cloudflare/cloudflare-go/v4/zones"
+)
+
+// The Cloudflare operations the DNS updates and zone commands are built on
+// Everything takes this rather than the SDK client, so tests can hand in a mock and the client can be wrapped, e.g. to count or log calls
+type CloudflareAPI interface {
+	// Every zone the API Token has access to, across all pages
+	Zones() ([]Zone, error)
+	// The zone of the domain and its sub-zones, e.g. example.com and lab.example.com, found in a single call however many zones the API Token has access to
+	ZonesWithin(domain string) ([]Zone, error)
+	// Every record in the zone, across all pages
+	DNSRecords(zoneID string) ([]DNSRecord, error)
+	// The records of the zone the filter wants, without going through the whole of a large zone
+	FilteredDNSRecords(zoneID string, filter RecordFilter) ([]DNSRecord, error)
+	CreateDNSRecord(zoneID string, record dns.RecordParam) error
+	// Returns the record as Cloudflare has it after the edit
+	EditDNSRecord(zoneID string, recordID string, record dns.RecordParam) (DNSRecord, error)
+	DeleteDNSRecord(zoneID string, recordID string) error
+	// The zone's records as a BIND zone file
+	ExportDNSRecords(zoneID string) (string, error)
+	DNSSECStatus(zoneID string) (dns.DNSSECStatus, error)
+	Purge(zoneID string, body cache.CachePurgeParamsBodyUnion) error
+	// The changes Cloudflare's audit log of the account has for the zone since the time given, of any kind, not just to records
+	AuditLogs(accountID string, zoneName string, since time.Time) ([]CloudflareChange, error)
+}
+
+// CloudflareAPI backed by the SDK client
+type SDKClient struct {
+	Client *cloudflare.Client
+	// Account the zones are looked up in, every account the API Token has access to when empty
+	AccountID string
+}
+
+func (c SDKClient) Zones() ([]Zone, error) {
+	return c.listZones(zones.ZoneListParams{})
+}
+
+// Other zones the name filter lets through, e.g. myexample.com for example.com or ones of another account when the API doesn't filter by account, are left out
+func (c SDKClient) ZonesWithin(domain string) ([]Zone, error) {
+	zoneList, err := c.listZones(zones.ZoneListParams{Name: cloudflare.F("ends_with:" + domain)})
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(zoneList, func(zone Zone) bool {
+		name := strings.ToLower(zone.Name)
+		within := name == strings.ToLower(domain) || strings.HasSuffix(name, "."+strings.ToLower(domain))
+		return !within || c.AccountID != "" && zone.AccountID != c.AccountID
+	}), nil
+}
+
+// Helper method to list the zones the params ask for in the client's account, across all pages
+func (c SDKClient) listZones(params zones.ZoneListParams) ([]Zone, error) {
+	params.PerPage = cloudflare.F(float64(ZONES_PER_PAGE))
+	if c.AccountID != "" {
+		params.Account = cloudflare.F(zones.ZoneListParamsAccount{ID: cloudflare.F(c.AccountID)})
+	}
+	page, err := c.Client.Zones.List(context.Background(), params)
+	var zoneList []Zone
+	for err == nil && page != nil {
+		for _, zone := range page.Result {
+			zoneList = append(zoneList, Zone{ID: zone.ID, Name: zone.Name, Status: string(zone.Status), AccountID: zone.Account.ID})
+		}
+		// A page that isn't full is the last, sparing the request for an empty one
+		if len(page.Result) < ZONES_PER_PAGE {
+			break
+		}
+		page, err = page.GetNextPage()
+	}
+	return zoneList, err
+}
+
+func (c SDKClient) DNSRecords(zoneID string) ([]DNSRecord, error) {
+	iter := c.Client.DNS.Records.ListAutoPaging(context.Background(), dns.RecordListParams{
+		ZoneID:  cloudflare.String(zoneID),
+		PerPage: cloudflare.F(float64(DNS_RECORDS_PER_PAGE)),
+	})
+	var records []DNSRecord
+	for iter.Next() {
+		record := NewDNSRecord(iter.Current())
+		record.ZoneID = zoneID
+		records = append(records, record)
+	}
+	return records, iter.Err()
+}
+
+// Each name is asked for on its own, of the types wanted of it, and the tag once, so a zone's other records are never fetched
+// A name with none of the wanted types is asked for again of any type, so e.g. a CNAME in the way can be reported
+func (c SDKClient) FilteredDNSRecords(zoneID string, filter RecordFilter) ([]DNSRecord, error) {
+	var records []DNSRecord
+	// Lists the records the query asks for, reporting how many the filter wants
+	list := func(query dns.RecordListParams) (int, error) {
+		query.ZoneID = cloudflare.String(zoneID)
+		query.PerPage = cloudflare.F(float64(DNS_RECORDS_PER_PAGE))
+		page, err := c.Client.DNS.Records.List(context.Background(), query)
+		wanted := 0
+		for err == nil && page != nil {
+			for _, response := range page.Result {
+				record := NewDNSRecord(response)
+				record.ZoneID = zoneID
+				if !filter.Matches(record) {
+					continue
+				}
+				wanted++
+				if !slices.ContainsFunc(records, func(existing DNSRecord) bool { return existing.ID == record.ID }) {
+					records = append(records, record)
+				}
+			}
+			// A page that isn't full is the last, sparing the request for an empty one
+			if len(page.Result) < DNS_RECORDS_PER_PAGE {
+				break
+			}
+			page, err = page.GetNextPage()
+		}
+		return wanted, err
+	}
+
+	for _, name := range filter.Names {
+		byName := dns.RecordListParams{Name: cloudflare.F(dns.RecordListParamsName{Exact: cloudflare.F(name)})}
+		found := 0
+		for _, recordType := range filter.Types[strings.ToLower(strings.TrimSuffix(name, "."))] {
+			query := byName
+			query.Type = cloudflare.F(dns.RecordListParamsType(recordType))
+			n, err := list(query)
+			if err != nil {
+				return nil, err
+			}
+			found += n
+		}
+		if found == 0 {
+			if _, err := list(byName); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if filter.Tag != "" {
+		// A bare tag name matches the tag with any value, as HasTag does
+		tag := dns.RecordListParamsTag{Present: cloudflare.F(filter.Tag)}
+		if strings.Contains(filter.Tag, ":") {
+			tag = dns.RecordListParamsTag{Exact: cloudflare.F(filter.Tag)}
+		}
+		if _, err := list(dns.RecordListParams{Tag: cloudflare.F(tag), Type: cloudflare.F(dns.RecordListParamsType(RECORD_TYPE_A))}); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+func (c SDKClient) CreateDNSRecord(zoneID string, record dns.RecordParam) error {
+	_, err := c.Client.DNS.Records.New(context.Background(), dns.RecordNewParams{ZoneID: cloudflare.F(zoneID), Record: record})
+	return err
+}
+
+func (c SDKClient) EditDNSRecord(zoneID string, recordID string, record dns.RecordParam) (DNSRecord, error) {
+	response, err := c.Client.DNS.Records.Edit(context.Background(), recordID, dns.RecordEditParams{ZoneID: cloudflare.F(zoneID), Record: record})
+	if err != nil {
+		return DNSRecord{}, err
+	}
+	edited := NewDNSRecord(*response)
+	edited.ZoneID = zoneID
+	return edited, nil
+}
+
+func (c SDKClient) DeleteDNSRecord(zoneID string, recordID string) error {
+	_, err := c.Client.DNS.Records.Delete(context.Background(), recordID, dns.RecordDeleteParams{ZoneID: cloudflare.F(zoneID)})
+	return err
+}
+
+func (c SDKClient) ExportDNSRecords(zoneID string) (string, error) {
+	zoneFile, err := c.Client.DNS.Records.Export(context.Background(), dns.RecordExportParams{ZoneID: cloudflare.F(zoneID)})
+	if err != nil {
+		return "", err
+	}
+	return *zoneFile, nil
+}
+
+func (c SDKClient) DNSSECStatus(zoneID string) (dns.DNSSECStatus, error) {
+	status, err := c.Client.DNS.DNSSEC.Get(context.Background(), dns.DNSSECGetParams{ZoneID: cloudflare.F(zoneID)})
+	if err != nil {
+		return "", err
+	}
+	return status.Status, nil
+}
+
+func (c SDKClient) Purge(zoneID string, body cache.CachePurgeParamsBodyUnion) error {
+	_, err := c.Client.Cache.Purge(context.Background(), cache.CachePurgeParams{ZoneID: cloudflare.F(zoneID), Body: body})
+	return err
+}
+
+// Cloudflare only filters by day, the entries from earlier on the day since falls on are dropped here
+func (c SDKClient) AuditLogs(accountID string, zoneName string, since time.Time) ([]CloudflareChange, error) {
+	iter := c.Client.AuditLogs.ListAutoPaging(context.Background(), audit_logs.AuditLogListParams{
+		AccountID: cloudflare.F(accountID),
+		Zone:      cloudflare.F(audit_logs.AuditLogListParamsZone{Name: cloudflare.F(zoneName)}),
+		Since:     cloudflare.F[audit_logs.AuditLogListParamsSinceUnion](shared.UnionTime(since)),
+		PerPage:   cloudflare.F(float64(AUDIT_LOGS_PER_PAGE)),
+	})
+	var changes []CloudflareChange
+	for iter.Next() {
+		if entry := iter.Current(); !entry.When.Before(since) {
+			changes = append(changes, NewCloudflareChange(entry))
+		}
+	}
+	return changes, iter.Err()
+}
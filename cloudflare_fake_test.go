@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/option"
+)
+
+// API Token the fake Cloudflare API accepts
+const TEST_API_TOKEN = "test-token"
+
+// Helper method to point a Cloudflare client at a fake API served by handler
+// Retries are off unless opts turn them back on, later options win
+func newTestCloudflareClient(t *testing.T, handler http.Handler, opts ...option.RequestOption) *cloudflare.Client {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	return cloudflare.NewClient(append([]option.RequestOption{
+		option.WithBaseURL(ts.URL),
+		option.WithAPIToken(TEST_API_TOKEN),
+		option.WithMaxRetries(0),
+	}, opts...)...)
+}
+
+// Helper method to get the CloudflareAPI for a fake API served by handler
+func newTestCloudflareAPI(t *testing.T, handler http.Handler, opts ...option.RequestOption) CloudflareAPI {
+	t.Helper()
+	return SDKClient{Client: newTestCloudflareClient(t, handler, opts...)}
+}
+
+// Helper method to serve items the way Cloudflare's paginated list endpoints do
+func writeCloudflarePage(w http.ResponseWriter, r *http.Request, items []map[string]any) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 20
+	}
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"success":     true,
+		"errors":      []any{},
+		"messages":    []any{},
+		"result":      items[start:end],
+		"result_info": map[string]any{"page": page, "per_page": perPage, "count": end - start, "total_count": len(items)},
+	})
+}
+
+// Ray ID the fake's failed responses carry
+const TEST_RAY_ID = "8f1e2d3c4b5a6978-AMS"
+
+// Helper method to answer the way Cloudflare does when a request fails
+func writeCloudflareError(w http.ResponseWriter, status int, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(CF_RAY_HEADER, TEST_RAY_ID)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"success": false, "errors": []any{map[string]any{"code": code, "message": message}}, "messages": []any{}, "result": nil})
+}
+
+// Fake of the zone and record endpoints the program uses, recording the edits made
+// Lists are paginated like the real API, and requests without the test token are refused
+type fakeCloudflare struct {
+	mu      sync.Mutex
+	zones   []map[string]any
+	records map[string][]map[string]any
+	edits   []string
+	// Record IDs whose edits fail
+	fail map[string]bool
+	// Bodies of the cache purges requested
+	purges []map[string]any
+	// How many of the coming requests are turned away as rate limited
+	rateLimited int
+	// How many requests were made, rate limited ones included
+	requests int
+	// How many pages of records were listed
+	listings int
+	// Entries of the accounts' audit logs, whatever account is asked for
+	auditLogs []map[string]any
+}
+
+func (f *fakeCloudflare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+	if r.Header.Get("Authorization") != "Bearer "+TEST_API_TOKEN {
+		writeCloudflareError(w, http.StatusForbidden, 10000, "Authentication error")
+		return
+	}
+	if f.rateLimited > 0 {
+		f.rateLimited--
+		w.Header().Set("Retry-After", "0")
+		writeCloudflareError(w, http.StatusTooManyRequests, 971, "Please wait and consider throttling your request speed")
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "zones":
+		writeCloudflarePage(w, r, FilterZoneItems(f.zones, r.URL.Query()))
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "accounts" && parts[2] == "audit_logs":
+		writeCloudflarePage(w, r, f.auditLogs)
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[2] == "dns_records":
+		f.listings++
+		writeCloudflarePage(w, r, FilterRecordItems(f.records[parts[1]], r.URL.Query()))
+	case r.Method == http.MethodPatch && len(parts) == 4 && parts[2] == "dns_records" && f.fail[parts[3]]:
+		writeCloudflareError(w, http.StatusBadRequest, 9005, "Content for A record is invalid.")
+	case r.Method == http.MethodPatch && len(parts) == 4 && parts[2] == "dns_records":
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, record := range f.records[parts[1]] {
+			if record["id"] == parts[3] {
+				record["content"] = body["content"]
+				f.edits = append(f.edits, parts[3])
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]any{"success": true, "errors": []any{}, "messages": []any{}, "result": record})
+				return
+			}
+		}
+		http.NotFound(w, r)
+	case r.Method == http.MethodDelete && len(parts) == 4 && parts[2] == "dns_records":
+		for i, record := range f.records[parts[1]] {
+			if record["id"] == parts[3] {
+				f.records[parts[1]] = append(f.records[parts[1]][:i], f.records[parts[1]][i+1:]...)
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]any{"success": true, "errors": []any{}, "messages": []any{}, "result": map[string]any{"id": parts[3]}})
+				return
+			}
+		}
+		http.NotFound(w, r)
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[2] == "purge_cache":
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		f.purges = append(f.purges, body)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "errors": []any{}, "messages": []any{}, "result": map[string]any{"id": parts[1]}})
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[2] == "dns_records":
+		var record map[string]any
+		json.NewDecoder(r.Body).Decode(&record)
+		record["id"] = fmt.Sprintf("new%d", len(f.records[parts[1]])+1)
+		f.records[parts[1]] = append(f.records[parts[1]], record)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "errors": []any{}, "messages": []any{}, "result": record})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Runs the lookups and the edit a check makes against the fake, end to end through the SDK
+func TestFakeCloudflare_EndToEnd(t *testing.T) {
+	newFake := func() *fakeCloudflare {
+		var records []map[string]any
+		for i := range DNS_RECORDS_PER_PAGE + 2 {
+			records = append(records, map[string]any{"id": strconv.Itoa(i), "name": fmt.Sprintf("host%d.example.com", i), "type": "A", "content": "198.51.100.1", "ttl": 1})
+		}
+		// The record we're after is on the second page
+		records = append(records, map[string]any{"id": "home", "name": "home.example.com", "type": "A", "content": "198.51.100.1", "ttl": 1})
+		return &fakeCloudflare{
+			zones:   []map[string]any{{"id": "z1", "name": "example.com"}},
+			records: map[string][]map[string]any{"z1": records},
+		}
+	}
+	run := func(cfClient CloudflareAPI) error {
+		zoneID, err := GetZoneID(cfClient, "home.example.com")
+		if err != nil {
+			return err
+		}
+		filter := RecordFilter{}
+		filter.Add("home.example.com", RECORD_TYPE_A)
+		records, err := cfClient.FilteredDNSRecords(zoneID, filter)
+		if err != nil {
+			return err
+		}
+		record, _ := FindDNSRecords(records, RecordConfig{Name: "home.example.com"})
+		return UpdateDNSRecord(cfClient, "203.0.113.42", record, RecordOptions{})
+	}
+
+	fake := newFake()
+	if err := run(newTestCloudflareAPI(t, fake)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(fake.edits) != 1 || fake.edits[0] != "home" {
+		t.Errorf("Expected the record on the second page to be edited, got %v", fake.edits)
+	}
+	if content := fake.records["z1"][len(fake.records["z1"])-1]["content"]; content != "203.0.113.42" {
+		t.Errorf("Expected content 203.0.113.42, got %v", content)
+	}
+
+	// Rate limited requests are retried when the client is allowed to
+	fake = newFake()
+	fake.rateLimited = 2
+	if err := run(newTestCloudflareAPI(t, fake, option.WithMaxRetries(2))); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(fake.edits) != 1 {
+		t.Errorf("Expected the edit to go through after the rate limit, got %v", fake.edits)
+	}
+
+	// And surface as an error when it isn't
+	fake = newFake()
+	fake.rateLimited = 1
+	err := run(newTestCloudflareAPI(t, fake))
+	var apiErr *cloudflare.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected a 429 error, got %v", err)
+	}
+
+	// Requests with the wrong token are refused
+	fake = newFake()
+	if err := run(newTestCloudflareAPI(t, fake, option.WithAPIToken("wrong-token"))); err == nil {
+		t.Error("Expected error for the wrong token but got none")
+	}
+	if len(fake.edits) != 0 {
+		t.Errorf("Expected no edits with the wrong token, got %v", fake.edits)
+	}
+}
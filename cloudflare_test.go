@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go/v4/dns"
+)
+
+// In memory CloudflareAPI, the operations a test doesn't set up panic through the nil embedded interface
+type mockCloudflare struct {
+	CloudflareAPI
+	zones   []Zone
+	records map[string][]DNSRecord
+	dnssec  dns.DNSSECStatus
+	edits   []string
+}
+
+func (m *mockCloudflare) Zones() ([]Zone, error) {
+	return m.zones, nil
+}
+
+func (m *mockCloudflare) ZonesWithin(domain string) ([]Zone, error) {
+	var zoneList []Zone
+	for _, zone := range m.zones {
+		if strings.EqualFold(zone.Name, domain) || strings.HasSuffix(strings.ToLower(zone.Name), "."+strings.ToLower(domain)) {
+			zoneList = append(zoneList, zone)
+		}
+	}
+	return zoneList, nil
+}
+
+func (m *mockCloudflare) DNSRecords(zoneID string) ([]DNSRecord, error) {
+	return m.records[zoneID], nil
+}
+
+func (m *mockCloudflare) FilteredDNSRecords(zoneID string, filter RecordFilter) ([]DNSRecord, error) {
+	var records []DNSRecord
+	for _, record := range m.records[zoneID] {
+		if filter.Matches(record) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (m *mockCloudflare) EditDNSRecord(zoneID string, recordID string, record dns.RecordParam) (DNSRecord, error) {
+	m.edits = append(m.edits, recordID)
+	for i, existing := range m.records[zoneID] {
+		if existing.ID == recordID {
+			m.records[zoneID][i].Content = record.Content.Value
+			return m.records[zoneID][i], nil
+		}
+	}
+	return DNSRecord{}, nil
+}
+
+func (m *mockCloudflare) DNSSECStatus(zoneID string) (dns.DNSSECStatus, error) {
+	return m.dnssec, nil
+}
+
+func TestUpdateHostname_Mock(t *testing.T) {
+	mock := &mockCloudflare{
+		zones: []Zone{{ID: "z1", Name: "example.com"}},
+		records: map[string][]DNSRecord{"z1": {
+			{ID: "r1", ZoneID: "z1", Name: "home.example.com", Type: RECORD_TYPE_A, Content: "198.51.100.1", TTL: TTL_AUTOMATIC},
+		}},
+	}
+
+	changed, err := UpdateHostname(mock, "example.com", "home.example.com", "203.0.113.42", RecordOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !changed || len(mock.edits) != 1 || mock.records["z1"][0].Content != "203.0.113.42" {
+		t.Errorf("Expected the record to be edited to 203.0.113.42, got %v %v", changed, mock.records["z1"][0])
+	}
+
+	changed, err = UpdateHostname(mock, "example.com", "home.example.com", "203.0.113.42", RecordOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if changed || len(mock.edits) != 1 {
+		t.Errorf("Expected no edit for an unchanged address, got %v", mock.edits)
+	}
+}
+
+func TestCheckDNSSEC_Mock(t *testing.T) {
+	tests := []struct {
+		status  dns.DNSSECStatus
+		warning bool
+	}{
+		{dns.DNSSECStatusActive, false},
+		{dns.DNSSECStatusDisabled, false},
+		{dns.DNSSECStatusPending, true},
+		{dns.DNSSECStatusError, true},
+	}
+
+	for _, tt := range tests {
+		warning, err := CheckDNSSEC(&mockCloudflare{dnssec: tt.status}, Zone{ID: "z1", Name: "example.com"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if (warning != "") != tt.warning {
+			t.Errorf("%v: expected warning %v, got %q", tt.status, tt.warning, warning)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+)
+
+// Stable codes for the kinds of failure, so automation can branch on them rather than on the messages, which may change
+const (
+	// Detecting the public IP took too long
+	E_DETECT_TIMEOUT = "E_DETECT_TIMEOUT"
+	// Detecting the public IP failed any other way, e.g. the service answered with an error or something that isn't an address
+	E_DETECT_FAILED = "E_DETECT_FAILED"
+	// No zone the API Token can see contains the name
+	E_ZONE_NOT_FOUND = "E_ZONE_NOT_FOUND"
+	// The zone isn't active, e.g. still pending or moved away, so its records can't be edited
+	E_ZONE_NOT_EDITABLE = "E_ZONE_NOT_EDITABLE"
+	// The zone has no record of the name and type to update
+	E_RECORD_NOT_FOUND = "E_RECORD_NOT_FOUND"
+	// The name is taken by records the program refuses to touch, e.g. a CNAME where an A record was expected
+	E_RECORD_CONFLICT = "E_RECORD_CONFLICT"
+	// The content a record would be given isn't valid for its type
+	E_INVALID_CONTENT = "E_INVALID_CONTENT"
+	// The geo check refused a move to another country or network
+	E_GEO_BLOCKED = "E_GEO_BLOCKED"
+	// The record needs updating, reported instead by -check
+	E_OUT_OF_SYNC = "E_OUT_OF_SYNC"
+	// Cloudflare is rate limiting the API Token
+	E_RATE_LIMITED = "E_RATE_LIMITED"
+	// Cloudflare rejected the API Token, or it lacks a permission
+	E_AUTH = "E_AUTH"
+	// Cloudflare failed the request for another reason
+	E_API = "E_API"
+	// A request timed out
+	E_TIMEOUT = "E_TIMEOUT"
+	// The record was updated, then put back because another record in its zone failed
+	E_ROLLED_BACK = "E_ROLLED_BACK"
+	// Putting the record back failed, it's left with the new content
+	E_ROLLBACK_FAILED = "E_ROLLBACK_FAILED"
+	// No check has succeeded for longer than allowed
+	E_STALE = "E_STALE"
+	// The config file couldn't be reloaded, the daemon carries on with the one it had
+	E_CONFIG = "E_CONFIG"
+	// The check panicked, the daemon carries on with the next one
+	E_PANIC = "E_PANIC"
+	// Anything not covered above
+	E_UNKNOWN = "E_UNKNOWN"
+)
+
+// Exit code of a single run failing because a zone can't be edited, so scripts can tell it apart from the other failures' 1
+const EXIT_ZONE_NOT_EDITABLE = 3
+
+// An error carrying one of the codes
+type CodedError struct {
+	Code string
+	Err  error
+}
+
+func (e *CodedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CodedError) Unwrap() error {
+	return e.Err
+}
+
+// Method to attach a code to an error, nil stays nil and an empty code leaves the error as is
+func WithCode(code string, err error) error {
+	if err == nil || code == "" {
+		return err
+	}
+	return &CodedError{Code: code, Err: err}
+}
+
+// Method to get the code of an error, "" for nil
+// An error without a code of its own is classed by what it wraps, e.g. a Cloudflare API error by its status
+// Of several joined errors the first one's code is used
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	var coded *CodedError
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	var apiErr *cloudflare.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests:
+			return E_RATE_LIMITED
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return E_AUTH
+		}
+		return E_API
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return E_TIMEOUT
+	}
+	return E_UNKNOWN
+}
+
+// Method to get the code a single run failing with err exits with
+func ExitCode(err error) int {
+	if ErrorCode(err) == E_ZONE_NOT_EDITABLE {
+		return EXIT_ZONE_NOT_EDITABLE
+	}
+	return 1
+}
+
+// Helper method to code a failed detection, telling timeouts apart from the other failures
+func detectionError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if ErrorCode(err) == E_TIMEOUT {
+		return WithCode(E_DETECT_TIMEOUT, err)
+	}
+	return WithCode(E_DETECT_FAILED, err)
+}
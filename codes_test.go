@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"nil", nil, ""},
+		{"coded", WithCode(E_ZONE_NOT_FOUND, errors.New("could not match a Zone ID")), E_ZONE_NOT_FOUND},
+		{"wrapped", fmt.Errorf("account client-b: %w", WithCode(E_RECORD_NOT_FOUND, errors.New("couldn't obtain A Record ID"))), E_RECORD_NOT_FOUND},
+		{"first of joined", errors.Join(WithCode(E_GEO_BLOCKED, errors.New("refusing to move")), WithCode(E_ROLLED_BACK, errors.New("rolled back"))), E_GEO_BLOCKED},
+		{"rate limited", fmt.Errorf("updating failed: %w", &cloudflare.Error{StatusCode: http.StatusTooManyRequests}), E_RATE_LIMITED},
+		{"forbidden", &cloudflare.Error{StatusCode: http.StatusForbidden}, E_AUTH},
+		{"api", &cloudflare.Error{StatusCode: http.StatusInternalServerError}, E_API},
+		{"timeout", fmt.Errorf("request failed: %w", context.DeadlineExceeded), E_TIMEOUT},
+		{"unknown", errors.New("something else"), E_UNKNOWN},
+	}
+
+	for _, tt := range tests {
+		if got := ErrorCode(tt.err); got != tt.expected {
+			t.Errorf("%v: expected %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+	if err := WithCode("", errors.New("plain")); ErrorCode(err) != E_UNKNOWN {
+		t.Errorf("Expected an empty code to leave the error as is, got %q", ErrorCode(err))
+	}
+}
+
+func TestDetectionError(t *testing.T) {
+	if err := detectionError(fmt.Errorf("request failed: %w", context.DeadlineExceeded)); ErrorCode(err) != E_DETECT_TIMEOUT {
+		t.Errorf("Expected %v, got %v", E_DETECT_TIMEOUT, ErrorCode(err))
+	}
+	if err := detectionError(errors.New("server returned status: 500")); ErrorCode(err) != E_DETECT_FAILED {
+		t.Errorf("Expected %v, got %v", E_DETECT_FAILED, ErrorCode(err))
+	}
+	if detectionError(nil) != nil {
+		t.Error("Expected nil to stay nil")
+	}
+}
+
+func TestUpdateZones_ErrorCodes(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "home.example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+				{"id": "r2", "name": "alias.example.com", "type": "CNAME", "content": "home.example.com", "ttl": 1},
+			},
+		},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+	targets := []RecordConfig{{Name: "home.example.com"}, {Name: "gone.example.com"}, {Name: "alias.example.com"}, {Name: "lab.example.net"}}
+
+	groups, err := ResolveZones(cfClient, targets)
+	if err == nil {
+		t.Fatal("Expected error for the target in no zone but got none")
+	}
+	states := TargetFailures(targets, err)
+	updated, err := UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{}, nil)
+	if err == nil {
+		t.Fatal("Expected error for the missing records but got none")
+	}
+	states = append(states, updated...)
+
+	codes := map[string]string{}
+	for _, state := range states {
+		codes[state.Name] = state.Code
+	}
+	expected := map[string]string{"lab.example.net": E_ZONE_NOT_FOUND, "home.example.com": "", "gone.example.com": E_RECORD_NOT_FOUND, "alias.example.com": E_RECORD_CONFLICT}
+	for name, code := range expected {
+		if codes[name] != code {
+			t.Errorf("%v: expected code %q, got %q", name, code, codes[name])
+		}
+	}
+	if ErrorCode(err) != E_RECORD_NOT_FOUND && ErrorCode(err) != E_RECORD_CONFLICT {
+		t.Errorf("Expected the error to carry a record's code, got %q", ErrorCode(err))
+	}
+
+	// A rate limit that outlasts the retries fails the edit with its own code
+	fake.rateLimited = 1
+	record := DNSRecord{ID: "r1", ZoneID: "z1", Name: "home.example.com", Type: "A", Content: "198.51.100.7"}
+	if err := UpdateDNSRecord(cfClient, "203.0.113.1", record, RecordOptions{}); ErrorCode(err) != E_RATE_LIMITED {
+		t.Errorf("Expected %v, got %q from %v", E_RATE_LIMITED, ErrorCode(err), err)
+	}
+}
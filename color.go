@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ANSI escape sequences used by the terminal dashboard and the colored console output
+const (
+	ANSI_CLEAR       = "\033[H\033[2J"
+	ANSI_CLEAR_LINE  = "\r\033[K"
+	ANSI_HIDE_CURSOR = "\033[?25l"
+	ANSI_SHOW_CURSOR = "\033[?25h"
+	ANSI_BOLD        = "\033[1m"
+	ANSI_GREEN       = "\033[32m"
+	ANSI_YELLOW      = "\033[33m"
+	ANSI_RED         = "\033[31m"
+	ANSI_DIM         = "\033[2m"
+	ANSI_RESET       = "\033[0m"
+)
+
+// Environment variable turning colors off, see https://no-color.org
+const NO_COLOR_ENV = "NO_COLOR"
+
+// Color each kind of change is shown in by the diff, sync and restore commands
+var DIFF_COLORS = map[string]string{SYNC_CREATE: ANSI_GREEN, SYNC_UPDATE: ANSI_YELLOW, SYNC_DELETE: ANSI_RED}
+
+// Set by the no-color flag, keeps the output plain even on a terminal
+var colorDisabled bool
+
+// Method to turn colors off for the console output and the log lines
+func DisableColor() {
+	colorDisabled = true
+	SetLogColors()
+}
+
+// Method to make the log lines follow the same rules as the rest of the console output
+// logrus colors terminals on its own, but knows nothing of NO_COLOR or the no-color flag
+func SetLogColors() {
+	log.SetFormatter(&log.TextFormatter{DisableColors: !ColorEnabled(os.Stderr)})
+}
+
+// Method to report whether output written to out should be colored
+// Only terminals are, and only while neither NO_COLOR nor the no-color flag say otherwise
+func ColorEnabled(out io.Writer) bool {
+	if colorDisabled || os.Getenv(NO_COLOR_ENV) != "" {
+		return false
+	}
+	return IsTerminal(out)
+}
+
+// Method to report whether out is a terminal rather than e.g. a file or a pipe
+func IsTerminal(out io.Writer) bool {
+	file, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Method to color text written to out, leaving it as is when out shouldn't be colored
+func Colorize(out io.Writer, color string, text string) string {
+	return colorize(ColorEnabled(out), color, text)
+}
+
+// Helper method to wrap text in a color when enabled
+func colorize(enabled bool, color string, text string) string {
+	if !enabled || color == "" {
+		return text
+	}
+	return color + text + ANSI_RESET
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestColorEnabled(t *testing.T) {
+	if ColorEnabled(&bytes.Buffer{}) {
+		t.Error("Expected no colors for output that isn't a file")
+	}
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer devNull.Close()
+
+	t.Setenv(NO_COLOR_ENV, "1")
+	if ColorEnabled(devNull) {
+		t.Error("Expected NO_COLOR to turn colors off")
+	}
+	t.Setenv(NO_COLOR_ENV, "")
+	colorDisabled = true
+	defer func() { colorDisabled = false }()
+	if ColorEnabled(devNull) {
+		t.Error("Expected the no-color flag to turn colors off")
+	}
+}
+
+func TestColorize(t *testing.T) {
+	if got := Colorize(&bytes.Buffer{}, ANSI_RED, "failed"); got != "failed" {
+		t.Errorf("Expected plain text, got %q", got)
+	}
+	if got := colorize(true, ANSI_RED, "failed"); got != ANSI_RED+"failed"+ANSI_RESET {
+		t.Errorf("Expected red text, got %q", got)
+	}
+	if got := colorize(true, "", "failed"); got != "failed" {
+		t.Errorf("Expected text without a color left alone, got %q", got)
+	}
+}
+
+func TestCheckReport_ConsoleSummary(t *testing.T) {
+	report := CheckReport{Records: []RecordState{
+		{Name: "example.com", Changed: true},
+		{Name: "gone.example.net", Error: "couldn't obtain A Record ID"},
+	}}
+	if got := report.ConsoleSummary(&bytes.Buffer{}); got != report.Summary() {
+		t.Errorf("Expected the plain summary, got %q", got)
+	}
+	colored := report.summary(true)
+	if !strings.Contains(colored, ANSI_GREEN+"1 changed"+ANSI_RESET) || !strings.Contains(colored, ANSI_RED+"1 failed"+ANSI_RESET) {
+		t.Errorf("Expected the changes in green and the failures in red, got %q", colored)
+	}
+	if unchanged := (CheckReport{Records: []RecordState{{Name: "example.com"}}}).summary(true); strings.Contains(unchanged, ANSI_RED) || strings.Contains(unchanged, ANSI_GREEN) {
+		t.Errorf("Expected no colors for zero counts, got %q", unchanged)
+	}
+}
+
+func TestPrintDiffLine(t *testing.T) {
+	var out bytes.Buffer
+	PrintDiffLine(&out, SyncChange{Action: SYNC_CREATE, Desired: SyncRecord{Name: "example.com", Type: "A", Content: "198.51.100.7"}})
+	if expected := "+ create A example.com: 198.51.100.7\n"; out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
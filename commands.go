@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Commands working on a whole zone with just the API Token, as opposed to keeping records pointed at the public IP
+var ZONE_COMMANDS = []string{"export", "sync", "diff", "backup", "restore"}
+
+// Method to run a zone command, args being what follows the command's name
+// Commands asking for confirmation read the answer from in, those detecting the public IP use detect
+func RunZoneCommand(cfClient CloudflareAPI, detect func(source string) (string, error), command string, args []string, domainName string, in io.Reader, out io.Writer) error {
+	switch command {
+	case "export":
+		if domainName == "" {
+			return fmt.Errorf("the export command needs the domainName flag")
+		}
+		if len(args) > 0 {
+			file, err := os.Create(args[0])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			out = file
+		}
+		return ExportZone(cfClient, domainName, out)
+	case "sync", "diff":
+		path, yes, err := parseSyncFileFlag(command, args)
+		if err != nil {
+			return err
+		}
+		if command == "diff" {
+			return RunDiff(cfClient, path, detect, out)
+		}
+		return RunSync(cfClient, path, detect, yes, in, out)
+	case "backup":
+		if domainName == "" {
+			return fmt.Errorf("the backup command needs the domainName flag")
+		}
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		path, err := BackupZone(cfClient, domainName, dir, time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Backed up %v to %v\n", domainName, path)
+		return nil
+	case "restore":
+		flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+		dryRun := flags.Bool("dry-run", false, "Optional. Only print the changes restoring would make. Disabled by default.")
+		yes := flags.Bool("yes", false, "Optional. Restore without asking for confirmation. Disabled by default.")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return fmt.Errorf("the restore command needs a backup file, e.g. restore example.com-%v.json", time.Now().UTC().Format(BACKUP_TIME_LAYOUT))
+		}
+		return RestoreZone(cfClient, flags.Arg(0), *dryRun, *yes, in, out)
+	}
+	return fmt.Errorf("unknown command %q", command)
+}
+
+// Helper method to get the records file given to the sync and diff commands with -f, and whether sync was given -yes
+func parseSyncFileFlag(command string, args []string) (string, bool, error) {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	path := flags.String("f", "", "Required. Path of the YAML file declaring the zone's records.")
+	yes := new(bool)
+	if command == "sync" {
+		flags.BoolVar(yes, "yes", false, "Optional. Sync without asking for confirmation. Disabled by default.")
+	}
+	if err := flags.Parse(args); err != nil {
+		return "", false, err
+	}
+	if *path == "" {
+		return "", false, fmt.Errorf("the %v command needs a file, e.g. %v -f records.yaml", command, command)
+	}
+	return *path, *yes, nil
+}
+
+// Method to ask a yes or no question on out and read the answer from in, anything but y or yes being a no
+// Input that is a file but not a terminal, e.g. under cron or from a pipe, can't be asked, so that fails asking for -yes instead
+func Confirm(in io.Reader, out io.Writer, question string) (bool, error) {
+	if file, ok := in.(*os.File); in == nil || (ok && !IsTerminal(file)) {
+		return false, fmt.Errorf("not running interactively, pass -yes to go ahead without confirmation")
+	}
+	fmt.Fprintf(out, "%v [y/N] ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		answer   string
+		expected bool
+	}{
+		{"y\n", true},
+		{" YES \n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		confirmed, err := Confirm(strings.NewReader(tt.answer), &out, "Delete everything?")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if confirmed != tt.expected {
+			t.Errorf("Answer %q: expected %v, got %v", tt.answer, tt.expected, confirmed)
+		}
+		if out.String() != "Delete everything? [y/N] " {
+			t.Errorf("Expected the question to be asked, got %q", out.String())
+		}
+	}
+
+	// A file that isn't a terminal, like a redirected stdin under cron, isn't asked
+	file, err := os.CreateTemp(t.TempDir(), "answers")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer file.Close()
+	file.WriteString("y\n")
+	file.Seek(0, 0)
+	if confirmed, err := Confirm(file, &strings.Builder{}, "Delete everything?"); err == nil || confirmed {
+		t.Errorf("Expected error for input that isn't a terminal, got %v", confirmed)
+	}
+}
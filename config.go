@@ -0,0 +1,1111 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"gopkg.in/yaml.v3"
+)
+
+// Settings read from the YAML file given with -config
+type Config struct {
+	// API Token for requests, takes the place of the token flag
+	Token string `yaml:"token"`
+	// Path of a file containing the API Token, used when token isn't provided
+	TokenFile string `yaml:"tokenFile"`
+	// ID of the Cloudflare account the token's zones are looked up in, takes the place of the accountID flag
+	AccountID string `yaml:"accountID"`
+	// The records to keep pointed at the public IP, these may live in different zones
+	Records []RecordConfig `yaml:"records"`
+	// Further Cloudflare accounts, each with its own token and records
+	Accounts []AccountConfig `yaml:"accounts"`
+	// Name of the heartbeat TXT record, takes the place of the heartbeat flag
+	Heartbeat string `yaml:"heartbeat"`
+	// Service detecting the public IP, a built-in one's name or a URL, takes the place of the ipService flag
+	IPService string `yaml:"ipService"`
+	// Base URL of the Cloudflare API, e.g. of an internal API gateway, takes the place of the apiBase flag
+	APIBase string `yaml:"apiBase"`
+	// Take the place of the detectTimeout, apiTimeout and apiRetries flags, e.g. 30s for slow links
+	DetectTimeout time.Duration `yaml:"detectTimeout"`
+	APITimeout    time.Duration `yaml:"apiTimeout"`
+	APIRetries    *int          `yaml:"apiRetries"`
+	// Load Balancer pool origins to keep pointed at the public IP
+	LoadBalancerPools []LoadBalancerPoolConfig `yaml:"loadBalancerPools"`
+	// Entries of IP Lists to keep holding the public IP
+	IPLists []IPListConfig `yaml:"ipLists"`
+	// WAF custom rules whose expression embeds the public IP
+	FirewallRules []FirewallRuleConfig `yaml:"firewallRules"`
+	// Zero Trust Access policies whose include rules let the public IP in
+	AccessPolicies []AccessPolicyConfig `yaml:"accessPolicies"`
+	// Named IP address sources records can pick with source
+	Sources map[string]SourceConfig `yaml:"sources"`
+	// Named notification channels records can send changes to
+	Notifiers map[string]NotifierConfig `yaml:"notifiers"`
+	// Channels told about changes to records that don't list their own, and about failed checks
+	Notify []string `yaml:"notify"`
+	// Most notifications sent an hour across all channels, unlimited when zero
+	NotifyMaxPerHour int `yaml:"notifyMaxPerHour"`
+	// Files, or glob patterns of them, whose records and other settings are added to this file's, relative to its directory
+	Include []string `yaml:"include"`
+
+	// Every file the config was read from, includes too, in the order they were read
+	Files []string `yaml:"-"`
+}
+
+// A way of detecting an IP address: a service reporting the public IP, a local interface's address or the Tailscale one
+type SourceConfig struct {
+	// URL of a service replying with the IP address
+	URL string `yaml:"url"`
+	// Network interface (e.g. wg0) whose address is used
+	Interface string `yaml:"interface"`
+	// Use this machine's Tailscale address, read from the local tailscaled
+	Tailscale bool `yaml:"tailscale"`
+	// Path of tailscaled's socket, /var/run/tailscale/tailscaled.sock by default
+	TailscaleSocket string `yaml:"tailscaleSocket"`
+	// Use the interface's or Tailscale's IPv6 address rather than the IPv4 one
+	IPv6 bool `yaml:"ipv6"`
+	// Headers sent to the url, e.g. an API key of a self-hosted service
+	Headers map[string]string `yaml:"headers"`
+	// Token sent to the url as "Authorization: Bearer <token>"
+	BearerToken string `yaml:"bearerToken"`
+	// Credentials sent to the url with basic auth
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Method to build the headers sent to the source's url, its custom ones and any credentials
+func (s SourceConfig) RequestHeader() http.Header {
+	header := http.Header{}
+	for name, value := range s.Headers {
+		header.Set(name, value)
+	}
+	if s.BearerToken != "" {
+		header.Set("Authorization", "Bearer "+s.BearerToken)
+	}
+	if s.Username != "" {
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(s.Username+":"+s.Password)))
+	}
+	return header
+}
+
+// An origin of a Load Balancer pool to keep pointed at the public IP
+type LoadBalancerPoolConfig struct {
+	// Name of the account from the accounts section whose token is used, the main token when empty
+	Account string `yaml:"account"`
+	// ID of the Cloudflare account the pool belongs to
+	AccountID string `yaml:"accountID"`
+	// Name or ID of the pool
+	Pool string `yaml:"pool"`
+	// Name of the origin within the pool
+	Origin string `yaml:"origin"`
+}
+
+// An entry of a Cloudflare IP List to keep holding the public IP, e.g. for firewall rules letting home in
+type IPListConfig struct {
+	// Name of the account from the accounts section whose token is used, the main token when empty
+	Account string `yaml:"account"`
+	// ID of the Cloudflare account the list belongs to
+	AccountID string `yaml:"accountID"`
+	// Name or ID of the list
+	List string `yaml:"list"`
+	// Comment marking the entry as this program's, "managed by go-dns-update" by default
+	Comment string `yaml:"comment"`
+}
+
+// A WAF custom rule to keep the expression of in line with the public IP
+type FirewallRuleConfig struct {
+	// Name of the account from the accounts section whose token is used, the main token when empty
+	Account string `yaml:"account"`
+	// Name of the zone the rule belongs to
+	Zone string `yaml:"zone"`
+	// Description or ID of the rule
+	Rule string `yaml:"rule"`
+	// Template of the rule's expression, {{.IP}} is replaced with the detected IP address
+	Expression string `yaml:"expression"`
+}
+
+// A reusable Access policy to keep letting the public IP in
+type AccessPolicyConfig struct {
+	// Name of the account from the accounts section whose token is used, the main token when empty
+	Account string `yaml:"account"`
+	// ID of the Cloudflare account the policy belongs to
+	AccountID string `yaml:"accountID"`
+	// Name or ID of the policy
+	Policy string `yaml:"policy"`
+	// IP ranges (e.g. 192.0.2.0/24) whose include rules are left in place
+	Keep []string `yaml:"keep"`
+}
+
+// A notification channel
+type NotifierConfig struct {
+	// URL to POST a JSON body describing each event to
+	Webhook string `yaml:"webhook"`
+	// Most notifications sent to the channel an hour, unlimited when zero
+	MaxPerHour int `yaml:"maxPerHour"`
+}
+
+// A Cloudflare account and the records to update with its token
+type AccountConfig struct {
+	// Name used for the account in logs and errors
+	Name      string         `yaml:"name"`
+	Token     string         `yaml:"token"`
+	TokenFile string         `yaml:"tokenFile"`
+	Records   []RecordConfig `yaml:"records"`
+	// ID of the Cloudflare account the zones are looked up in, for tokens with access to more than one
+	AccountID string `yaml:"accountID"`
+}
+
+// A record to keep pointed at the public IP
+type RecordConfig struct {
+	Name string `yaml:"name"`
+	// Update the www record of the same name as well
+	WWW bool `yaml:"www"`
+	// Record type, A (the default), AAAA, CNAME, TXT, MX, SRV or CAA
+	Type string `yaml:"type"`
+	// Content template of TXT, MX, SRV and CAA records, {{.IP}} is replaced with the detected IP address
+	Content string `yaml:"content"`
+	// Fixed address an A or AAAA record is kept pointed at in place of the detected one
+	IP string `yaml:"ip"`
+	// Hostname a CNAME record is kept pointed at, when not set the source is expected to report it
+	Target string `yaml:"target"`
+	// TTL in seconds, overriding the ttl flag
+	TTL int `yaml:"ttl"`
+	// Whether the record is proxied through Cloudflare, overriding the proxied flag
+	Proxied *bool `yaml:"proxied"`
+	// Whether the www record is proxied, overriding proxied for it alone
+	WWWProxied *bool `yaml:"wwwProxied"`
+	// Name of a source from the sources section, or the URL of a service reporting the public IP, overriding the default one
+	Source string `yaml:"source"`
+	// Notification channels told about changes to this record, overriding the global notify list
+	Notify []string `yaml:"notify"`
+	// Which record of a multi-value (round-robin) set belongs to this machine, the others are left alone
+	Member *MemberConfig `yaml:"member"`
+	// ID of the zone the record is in, saving looking it up
+	ZoneID string `yaml:"zoneID"`
+}
+
+// Picks this machine's record out of several with the same name and type, by Cloudflare tag or comment
+type MemberConfig struct {
+	// Tag the member carries, "name" or "name:value"
+	Tag string `yaml:"tag"`
+	// Text the member's comment contains
+	Comment string `yaml:"comment"`
+}
+
+// Method to report whether the record is this member, every record is when no member is configured
+func (m *MemberConfig) Matches(record DNSRecord) bool {
+	if m == nil {
+		return true
+	}
+	if m.Tag != "" {
+		return record.HasTag(m.Tag)
+	}
+	return strings.Contains(record.Comment, m.Comment)
+}
+
+// Method to describe the member for error messages
+func (m *MemberConfig) String() string {
+	if m.Tag != "" {
+		return fmt.Sprintf("tagged %v", m.Tag)
+	}
+	return fmt.Sprintf("commented %q", m.Comment)
+}
+
+// Method to get the record's type, A unless configured otherwise
+func (r RecordConfig) RecordType() string {
+	if r.Type == "" {
+		return RECORD_TYPE_A
+	}
+	return strings.ToUpper(r.Type)
+}
+
+// Method to report whether the record's content is fixed in the config, needing no detected IP address
+func (r RecordConfig) Pinned() bool {
+	return r.IP != "" || r.Target != ""
+}
+
+// Method to work out the content the record should have, from its fixed IP, its target, its content template or the detected IP address
+func (r RecordConfig) DesiredContent(publicIP string) (string, error) {
+	if r.IP != "" {
+		return r.IP, nil
+	}
+	if r.Target != "" {
+		return r.Target, nil
+	}
+	if r.Content != "" {
+		return RenderContent(r.Content, publicIP)
+	}
+	return publicIP, nil
+}
+
+// Method to read, merge and validate the files of a config in order, each one overriding the ones before it
+// The files are decrypted with the identities when they're encrypted with age, and the files they include read along with them
+func LoadConfigs(paths []string, identities []age.Identity) (*Config, error) {
+	var sources []configSource
+	for _, path := range paths {
+		read, err := readConfigSources(path, identities, nil)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, read...)
+	}
+	config, err := parseConfigs(sources)
+	if err != nil {
+		return nil, fmt.Errorf("config %v: %w", strings.Join(paths, ", "), err)
+	}
+	for _, source := range sources {
+		config.Files = append(config.Files, source.name)
+	}
+	return config, nil
+}
+
+// Helper method to read a config file followed by the files it includes, depth first
+// includedBy are the files that led to this one, so a file including itself, however indirectly, is caught
+func readConfigSources(path string, identities []age.Identity, includedBy []string) ([]configSource, error) {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		absolute = filepath.Clean(path)
+	}
+	if slices.Contains(includedBy, absolute) {
+		return nil, fmt.Errorf("config %v: includes itself", path)
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config failed: %w", err)
+	}
+	contents, err = DecryptConfig(contents, identities)
+	if err != nil {
+		return nil, fmt.Errorf("config %v: %w", path, err)
+	}
+	sources := []configSource{{name: path, contents: contents, included: len(includedBy) > 0}}
+
+	// A malformed include is reported along with the rest of the file's problems once it's parsed
+	var directives struct {
+		Include []string `yaml:"include"`
+	}
+	yaml.Unmarshal(contents, &directives)
+	for _, pattern := range directives.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("config %v: include %w", path, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("config %v: include %v matches no files", path, pattern)
+		}
+		for _, match := range matches {
+			included, err := readConfigSources(match, identities, append(slices.Clone(includedBy), absolute))
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, included...)
+		}
+	}
+	return sources, nil
+}
+
+// Flag value collecting every value of a flag given more than once
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *repeatedFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// Method to list the config files given with -config, the files in a directory taken in the order of their names
+// Only the YAML files in a directory are read, those encrypted with age included, not the ones in directories within it
+func ConfigFiles(values []string) ([]string, error) {
+	var paths []string
+	for _, value := range values {
+		info, err := os.Stat(value)
+		if err != nil || !info.IsDir() {
+			paths = append(paths, value)
+			continue
+		}
+		entries, err := os.ReadDir(value)
+		if err != nil {
+			return nil, fmt.Errorf("reading config directory failed: %w", err)
+		}
+		found := false
+		for _, entry := range entries {
+			name := strings.TrimSuffix(entry.Name(), ".age")
+			if !entry.IsDir() && (strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml")) {
+				paths = append(paths, filepath.Join(value, entry.Name()))
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("config directory %v has no .yaml or .yml files", value)
+		}
+	}
+	return paths, nil
+}
+
+// Method to parse and validate the contents of a config file
+// Unknown keys are rejected so typos don't go unnoticed, and every problem is reported at once with its line rather than only the first
+func ParseConfig(contents []byte) (*Config, error) {
+	return parseConfigs([]configSource{{contents: contents}})
+}
+
+// A config file's name and contents
+type configSource struct {
+	name     string
+	contents []byte
+	// Whether another file includes it, adding to that file rather than overriding it
+	included bool
+}
+
+// Helper method to parse, merge and validate the files of a config, later files overriding earlier ones
+// The problems of several files are reported with the file they're in, a single one's only with their line
+func parseConfigs(sources []configSource) (*Config, error) {
+	problems := &configProblems{errs: &ConfigErrors{}}
+	if len(sources) > 1 {
+		problems.files = map[*yaml.Node]string{}
+		problems.order = map[string]int{}
+	}
+	var merged *yaml.Node
+	// Values naming a variable that isn't set, only reported when they make it into the merged config
+	missing := map[*yaml.Node][]string{}
+	for i, source := range sources {
+		root := &yaml.Node{}
+		if err := yaml.Unmarshal(source.contents, root); err != nil {
+			if len(sources) > 1 {
+				return nil, fmt.Errorf("%v: parsing failed: %w", source.name, err)
+			}
+			return nil, fmt.Errorf("parsing failed: %w", err)
+		}
+		if root.Kind == 0 {
+			continue
+		}
+		if problems.files != nil {
+			markConfigFile(root, source.name, problems.files)
+			problems.order[source.name] = i
+		}
+		// Checked file by file, so unknown keys are reported with the file they're in
+		checkConfigKeys(root, CONFIG_TYPE, problems)
+		// Expanded before the values are decoded, so e.g. a TTL or a proxied flag can come from the environment too
+		expandConfigEnv(root, CONFIG_TYPE, missing)
+		var decoded Config
+		var typeErr *yaml.TypeError
+		if errors.As(root.Decode(&decoded), &typeErr) {
+			for _, message := range typeErr.Errors {
+				problems.addDecoding(source.name, message)
+			}
+		}
+		if source.included {
+			merged = IncludeConfigNodes(merged, root)
+		} else {
+			merged = MergeConfigNodes(merged, root)
+		}
+	}
+	var config Config
+	if merged != nil {
+		reportMissingEnv(merged, missing, problems)
+		// The decoding problems were found file by file above
+		merged.Decode(&config)
+	}
+	problems.root = merged
+	config.normalizeNames(problems)
+	config.validate(problems)
+	if err := problems.err(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Method to merge the parsed config file src into dst, returning the result
+// Mappings are merged key by key, while lists and plain values in src replace those in dst, so e.g. a site's file can set the token and notifiers of shared defaults
+func MergeConfigNodes(dst *yaml.Node, src *yaml.Node) *yaml.Node {
+	if dst == nil {
+		return src
+	}
+	if dst.Kind == yaml.DocumentNode && src.Kind == yaml.DocumentNode && len(dst.Content) > 0 && len(src.Content) > 0 {
+		dst.Content[0] = MergeConfigNodes(dst.Content[0], src.Content[0])
+		return dst
+	}
+	if dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		return src
+	}
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		j := -1
+		for k := 0; k+1 < len(dst.Content); k += 2 {
+			if dst.Content[k].Value == key.Value {
+				j = k
+			}
+		}
+		if j < 0 {
+			dst.Content = append(dst.Content, key, value)
+			continue
+		}
+		dst.Content[j], dst.Content[j+1] = key, MergeConfigNodes(dst.Content[j+1], value)
+	}
+	return dst
+}
+
+// Method to add the parsed config file src, included by a file already in dst, to dst, returning the result
+// Lists such as records are appended to and mappings merged key by key, while a plain value set in dst is kept, the including file winning
+func IncludeConfigNodes(dst *yaml.Node, src *yaml.Node) *yaml.Node {
+	if dst == nil {
+		return src
+	}
+	if dst.Kind == yaml.DocumentNode && src.Kind == yaml.DocumentNode && len(dst.Content) > 0 && len(src.Content) > 0 {
+		dst.Content[0] = IncludeConfigNodes(dst.Content[0], src.Content[0])
+		return dst
+	}
+	switch {
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode:
+		dst.Content = append(dst.Content, src.Content...)
+		return dst
+	case dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode:
+		return dst
+	}
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		j := -1
+		for k := 0; k+1 < len(dst.Content); k += 2 {
+			if dst.Content[k].Value == key.Value {
+				j = k
+			}
+		}
+		switch {
+		// The included file's own includes have been read already
+		case key.Value == "include" && j >= 0:
+		case j < 0:
+			dst.Content = append(dst.Content, key, value)
+		default:
+			dst.Content[j+1] = IncludeConfigNodes(dst.Content[j+1], value)
+		}
+	}
+	return dst
+}
+
+// Matches ${NAME} in config values, and $${NAME} standing for the text ${NAME}
+var CONFIG_ENV_PATTERN = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Helper method to replace ${NAME} in every value of the parsed config with the environment variable, keys are left as they are
+// typ is the type the node decodes into, an expanded value is only read as e.g. a number or a bool when it isn't decoded into a string
+// Variables that aren't set are noted in missing, a secret missing from the environment shouldn't go unnoticed as an empty value
+func expandConfigEnv(node *yaml.Node, typ reflect.Type, missing map[*yaml.Node][]string) {
+	typ = derefType(typ)
+	switch node.Kind {
+	case yaml.ScalarNode:
+		expanded := CONFIG_ENV_PATTERN.ReplaceAllStringFunc(node.Value, func(match string) string {
+			if strings.HasPrefix(match, "$$") {
+				return match[1:]
+			}
+			name := match[2 : len(match)-1]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				missing[node] = append(missing[node], name)
+			}
+			return value
+		})
+		if expanded != node.Value {
+			node.Value = expanded
+			// The tag was resolved from the placeholder, resolved again an unquoted 300 or true is a number or a bool
+			// A string keeps its tag, or a token of null or ~ would be read as no token at all
+			if node.Style&yaml.TaggedStyle == 0 && typ != nil && typ.Kind() != reflect.String {
+				node.Tag = ""
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			valueType, _ := configFieldType(typ, node.Content[i-1].Value)
+			expandConfigEnv(node.Content[i], valueType, missing)
+		}
+	case yaml.SequenceNode:
+		for _, child := range node.Content {
+			expandConfigEnv(child, elemType(typ), missing)
+		}
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			expandConfigEnv(child, typ, missing)
+		}
+	}
+}
+
+// Type the config files decode into
+var CONFIG_TYPE = reflect.TypeFor[Config]()
+
+// Helper method to note the keys of the parsed config typ has no field for, as decoding with known fields would
+// Walked on its own since the problems the decoder finds can only be told apart by their message
+func checkConfigKeys(node *yaml.Node, typ reflect.Type, problems *configProblems) {
+	typ = derefType(typ)
+	if typ == nil {
+		return
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			key := node.Content[i-1]
+			valueType, ok := configFieldType(typ, key.Value)
+			if !ok {
+				problems.addAt(key, fmt.Errorf("field %v not found in type %v", key.Value, typ)).decoding = true
+				continue
+			}
+			checkConfigKeys(node.Content[i], valueType, problems)
+		}
+	case yaml.SequenceNode:
+		for _, child := range node.Content {
+			checkConfigKeys(child, elemType(typ), problems)
+		}
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			checkConfigKeys(child, typ, problems)
+		}
+	}
+}
+
+// Helper method to get the type the value of key decodes into, within a mapping decoded into typ
+// Reports false for a key a struct has no field for, nil is returned when the type isn't known
+func configFieldType(typ reflect.Type, key string) (reflect.Type, bool) {
+	switch {
+	case typ == nil:
+		return nil, true
+	case typ.Kind() == reflect.Map:
+		return typ.Elem(), true
+	case typ.Kind() != reflect.Struct:
+		return nil, true
+	}
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if cmp.Or(name, strings.ToLower(field.Name)) == key {
+			return field.Type, true
+		}
+	}
+	return nil, false
+}
+
+// Helper method to get the type of the items of a list decoded into typ, nil when the type isn't known
+func elemType(typ reflect.Type) reflect.Type {
+	if typ == nil || (typ.Kind() != reflect.Slice && typ.Kind() != reflect.Array) {
+		return nil
+	}
+	return typ.Elem()
+}
+
+// Helper method to get the type a value pointed to is decoded into
+func derefType(typ reflect.Type) reflect.Type {
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+// Helper method to report the variables that aren't set in the values of the merged config
+// Values overridden by a later file don't need theirs
+func reportMissingEnv(node *yaml.Node, missing map[*yaml.Node][]string, problems *configProblems) {
+	for _, name := range missing[node] {
+		problems.addAt(node, fmt.Errorf("environment variable %v isn't set", name)).decoding = true
+	}
+	for _, child := range node.Content {
+		reportMissingEnv(child, missing, problems)
+	}
+}
+
+// Helper method to note the file every node of a parsed config comes from
+func markConfigFile(node *yaml.Node, name string, files map[*yaml.Node]string) {
+	files[node] = name
+	for _, child := range node.Content {
+		markConfigFile(child, name, files)
+	}
+}
+
+// A problem found in a config, on the line of the key it's about when that's known
+type ConfigError struct {
+	// The file it's in, when the config is made of several
+	File string
+	Line int
+	Err  error
+	// Whether it was found reading the file, e.g. by the YAML decoder, rather than validating the decoded config
+	decoding bool
+}
+
+func (e *ConfigError) Error() string {
+	switch {
+	case e.File != "" && e.Line != 0:
+		return fmt.Sprintf("%v line %d: %v", e.File, e.Line, e.Err)
+	case e.File != "":
+		return fmt.Sprintf("%v: %v", e.File, e.Err)
+	case e.Line != 0:
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// Every problem found in a config, so they can all be fixed in one go
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	lines := []string{fmt.Sprintf("%d problems found", len(e))}
+	for _, err := range e {
+		lines = append(lines, "  "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e ConfigErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Collects the problems found in a config, with where they are
+// within gives a collector for part of the config, whose problems are prefixed with e.g. the account they're in
+type configProblems struct {
+	// The parsed file the lines are looked up in, nil when the config didn't come from one
+	root   *yaml.Node
+	path   []any
+	prefix string
+	errs   *ConfigErrors
+	// The file each node of root comes from and the order of the files, nil unless the config is made of several
+	files map[*yaml.Node]string
+	order map[string]int
+}
+
+// Helper method to note a problem with the value at the path, relative to the collector's part of the config
+func (p *configProblems) add(err error, path ...any) {
+	if p.prefix != "" {
+		err = fmt.Errorf("%v: %w", p.prefix, err)
+	}
+	p.addAt(configNode(p.root, slices.Concat(p.path, path)...), err)
+}
+
+// Helper method to note a problem with a node of the parsed config, on its line when there is one
+func (p *configProblems) addAt(node *yaml.Node, err error) *ConfigError {
+	problem := &ConfigError{Err: err}
+	if node != nil {
+		problem.File, problem.Line = p.files[node], node.Line
+	}
+	*p.errs = append(*p.errs, problem)
+	return problem
+}
+
+// Helper method to note a problem the YAML decoder found in the file, e.g. "line 3: field tokn not found in type main.Config"
+func (p *configProblems) addDecoding(file string, message string) {
+	problem := &ConfigError{Err: errors.New(message)}
+	if rest, ok := strings.CutPrefix(message, "line "); ok {
+		if line, reason, ok := strings.Cut(rest, ": "); ok {
+			if number, err := strconv.Atoi(line); err == nil {
+				problem = &ConfigError{Line: number, Err: errors.New(reason), decoding: true}
+			}
+		}
+	}
+	if p.files != nil {
+		problem.File = file
+	}
+	*p.errs = append(*p.errs, problem)
+}
+
+// Helper method to get a collector for part of the config
+func (p *configProblems) within(prefix string, path ...any) *configProblems {
+	if p.prefix != "" && prefix != "" {
+		prefix = p.prefix + ": " + prefix
+	} else if prefix == "" {
+		prefix = p.prefix
+	}
+	return &configProblems{root: p.root, path: slices.Concat(p.path, path), prefix: prefix, errs: p.errs, files: p.files, order: p.order}
+}
+
+// Helper method to get the problems in the order of their lines, nil when there are none
+// A value the decoder couldn't read is usually left empty, so what validating then finds on the same line is left out as a knock-on
+func (p *configProblems) err() error {
+	if len(*p.errs) == 0 {
+		return nil
+	}
+	type position struct {
+		file string
+		line int
+	}
+	decoding := map[position]bool{}
+	for _, err := range *p.errs {
+		at := position{err.File, err.Line}
+		decoding[at] = decoding[at] || (err.decoding && err.Line > 0)
+	}
+	var errs ConfigErrors
+	for _, err := range *p.errs {
+		if decoding[position{err.File, err.Line}] && !err.decoding {
+			continue
+		}
+		errs = append(errs, err)
+	}
+	slices.SortStableFunc(errs, func(a, b *ConfigError) int {
+		if a.File != b.File {
+			return p.order[a.File] - p.order[b.File]
+		}
+		return a.Line - b.Line
+	})
+	return errs
+}
+
+// Helper method to find the key or list item of the value at a path of keys and indexes, e.g. "records", 2, "ttl", whose line a problem is on
+// Stops at the nearest parent when the file doesn't go as deep, nil when there's no file
+func configNode(root *yaml.Node, path ...any) *yaml.Node {
+	node := root
+	if node != nil && node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	var found *yaml.Node
+	for _, step := range path {
+		if node == nil {
+			break
+		}
+		var next *yaml.Node
+		switch step := step.(type) {
+		case string:
+			for i := 0; node.Kind == yaml.MappingNode && i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == step {
+					found, next = node.Content[i], node.Content[i+1]
+				}
+			}
+		case int:
+			if node.Kind == yaml.SequenceNode && step < len(node.Content) {
+				found, next = node.Content[step], node.Content[step]
+			}
+		}
+		node = next
+	}
+	return found
+}
+
+// Helper method to identify the record a RecordConfig manages
+// The same name may be managed once per record type, or once per member of a multi-value set
+func (r RecordConfig) key() string {
+	key := strings.ToLower(r.Name) + " " + r.RecordType()
+	if r.Member != nil {
+		key += " " + r.Member.String()
+	}
+	return key
+}
+
+// Method to check the config is usable, reporting every problem found
+func (c *Config) Validate() error {
+	problems := &configProblems{errs: &ConfigErrors{}}
+	c.validate(problems)
+	return problems.err()
+}
+
+// Helper method to check the config, noting each problem rather than stopping at the first
+func (c *Config) validate(problems *configProblems) {
+	for name, source := range c.Sources {
+		at := problems.within("", "sources", name)
+		kinds := 0
+		for _, set := range []bool{source.URL != "", source.Interface != "", source.Tailscale} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			at.add(fmt.Errorf("source %v needs exactly one of a url, an interface or tailscale", name))
+		}
+		if source.TailscaleSocket != "" && !source.Tailscale {
+			at.add(fmt.Errorf("source %v: tailscaleSocket needs tailscale", name), "tailscaleSocket")
+		}
+		if source.URL != "" {
+			if err := validateURL(source.URL); err != nil {
+				at.add(fmt.Errorf("source %v: url %w", name, err), "url")
+			}
+		}
+		if source.URL == "" && (len(source.Headers) > 0 || source.BearerToken != "" || source.Username != "" || source.Password != "") {
+			at.add(fmt.Errorf("source %v: headers and credentials need a url", name))
+		}
+		if source.BearerToken != "" && source.Username != "" {
+			at.add(fmt.Errorf("source %v can't use both a bearerToken and a username", name), "bearerToken")
+		}
+		if source.Password != "" && source.Username == "" {
+			at.add(fmt.Errorf("source %v: password needs a username", name), "password")
+		}
+	}
+	for name, notifier := range c.Notifiers {
+		if err := validateURL(notifier.Webhook); err != nil {
+			problems.add(fmt.Errorf("notifier %v: webhook %w", name, err), "notifiers", name, "webhook")
+		}
+		if notifier.MaxPerHour < 0 {
+			problems.add(fmt.Errorf("notifier %v: maxPerHour can't be negative, got %d", name, notifier.MaxPerHour), "notifiers", name, "maxPerHour")
+		}
+	}
+	c.validateNotify(problems.within("", "notify"), c.Notify)
+	if c.NotifyMaxPerHour < 0 {
+		problems.add(fmt.Errorf("notifyMaxPerHour can't be negative, got %d", c.NotifyMaxPerHour), "notifyMaxPerHour")
+	}
+	if c.Heartbeat != "" {
+		if err := CheckHostname(c.Heartbeat); err != nil {
+			problems.add(fmt.Errorf("heartbeat %w", err), "heartbeat")
+		}
+	}
+	if _, err := ResolveIPService(c.IPService); err != nil {
+		problems.add(fmt.Errorf("ipService %w", err), "ipService")
+	}
+	if c.AccountID != "" {
+		if err := CheckAccountID(c.AccountID); err != nil {
+			problems.add(fmt.Errorf("accountID %w", err), "accountID")
+		}
+	}
+	if c.APIBase != "" {
+		if err := validateURL(c.APIBase); err != nil {
+			problems.add(fmt.Errorf("apiBase %w", err), "apiBase")
+		}
+	}
+	if c.DetectTimeout < 0 {
+		problems.add(fmt.Errorf("detectTimeout can't be negative"), "detectTimeout")
+	}
+	if c.APITimeout < 0 {
+		problems.add(fmt.Errorf("apiTimeout can't be negative"), "apiTimeout")
+	}
+	if c.APIRetries != nil && *c.APIRetries < 0 {
+		problems.add(fmt.Errorf("apiRetries can't be negative, got %d", *c.APIRetries), "apiRetries")
+	}
+	c.validateRecords(problems.within("", "records"), c.Records)
+	accountNames := map[string]bool{}
+	for _, account := range c.Accounts {
+		accountNames[account.Name] = true
+	}
+	for i, pool := range c.LoadBalancerPools {
+		if pool.AccountID == "" || pool.Pool == "" || pool.Origin == "" {
+			problems.add(fmt.Errorf("load balancer pool %d needs an accountID, a pool and an origin", i+1), "loadBalancerPools", i)
+		}
+		if pool.Account != "" && !accountNames[pool.Account] {
+			problems.add(fmt.Errorf("load balancer pool %v: account %v isn't defined", pool.Pool, pool.Account), "loadBalancerPools", i, "account")
+		}
+	}
+	for i, list := range c.IPLists {
+		if list.AccountID == "" || list.List == "" {
+			problems.add(fmt.Errorf("IP list %d needs an accountID and a list", i+1), "ipLists", i)
+		}
+		if list.Account != "" && !accountNames[list.Account] {
+			problems.add(fmt.Errorf("IP list %v: account %v isn't defined", list.List, list.Account), "ipLists", i, "account")
+		}
+	}
+	for i, rule := range c.FirewallRules {
+		if rule.Zone == "" || rule.Rule == "" || rule.Expression == "" {
+			problems.add(fmt.Errorf("firewall rule %d needs a zone, a rule and an expression", i+1), "firewallRules", i)
+			continue
+		}
+		if rule.Account != "" && !accountNames[rule.Account] {
+			problems.add(fmt.Errorf("firewall rule %v: account %v isn't defined", rule.Rule, rule.Account), "firewallRules", i, "account")
+		}
+		if _, err := RenderContent(rule.Expression, EXAMPLE_IP); err != nil {
+			problems.add(fmt.Errorf("firewall rule %v: expression %w", rule.Rule, err), "firewallRules", i, "expression")
+		}
+	}
+	for i, policy := range c.AccessPolicies {
+		if policy.AccountID == "" || policy.Policy == "" {
+			problems.add(fmt.Errorf("access policy %d needs an accountID and a policy", i+1), "accessPolicies", i)
+		}
+		if policy.Account != "" && !accountNames[policy.Account] {
+			problems.add(fmt.Errorf("access policy %v: account %v isn't defined", policy.Policy, policy.Account), "accessPolicies", i, "account")
+		}
+		for j, keep := range policy.Keep {
+			if _, err := netip.ParsePrefix(keep); err != nil {
+				problems.add(fmt.Errorf("access policy %v: keep %q is not an IP range", policy.Policy, keep), "accessPolicies", i, "keep", j)
+			}
+		}
+	}
+	accountNames = map[string]bool{}
+	for i, account := range c.Accounts {
+		if account.Name == "" {
+			problems.add(fmt.Errorf("account %d has no name", i+1), "accounts", i)
+			continue
+		}
+		if accountNames[account.Name] {
+			problems.add(fmt.Errorf("account %v is listed more than once", account.Name), "accounts", i, "name")
+		}
+		accountNames[account.Name] = true
+		if account.Token == "" && account.TokenFile == "" {
+			problems.add(fmt.Errorf("account %v has neither a token nor a tokenFile", account.Name), "accounts", i)
+		}
+		if account.AccountID != "" {
+			if err := CheckAccountID(account.AccountID); err != nil {
+				problems.add(fmt.Errorf("account %v: accountID %w", account.Name, err), "accounts", i, "accountID")
+			}
+		}
+		if len(account.Records) == 0 && !c.usesAccount(account.Name) {
+			problems.add(fmt.Errorf("account %v has no records", account.Name), "accounts", i)
+		}
+		c.validateRecords(problems.within("account "+account.Name, "accounts", i, "records"), account.Records)
+	}
+}
+
+// Helper method to check a list of records
+func (c *Config) validateRecords(problems *configProblems, records []RecordConfig) {
+	seen := map[string]bool{}
+	for i, record := range records {
+		name := strings.ToLower(record.Name)
+		if name == "" {
+			problems.add(fmt.Errorf("record %d has no name", i+1), i)
+			continue
+		}
+		key := record.key()
+		if seen[key] {
+			problems.add(fmt.Errorf("record %v is listed more than once", record.Name), i, "name")
+		}
+		seen[key] = true
+		if record.Member != nil && (record.Member.Tag == "") == (record.Member.Comment == "") {
+			problems.add(fmt.Errorf("record %v: member needs either a tag or a comment", record.Name), i, "member")
+		}
+		if record.IP != "" && record.RecordType() != RECORD_TYPE_A && record.RecordType() != RECORD_TYPE_AAAA {
+			problems.add(fmt.Errorf("record %v: ip is only used by A and AAAA records", record.Name), i, "ip")
+		}
+		if record.Target != "" && record.RecordType() != RECORD_TYPE_CNAME {
+			problems.add(fmt.Errorf("record %v: target is only used by CNAME records", record.Name), i, "target")
+		}
+		if record.Content != "" && !IsTemplatedType(record.RecordType()) {
+			problems.add(fmt.Errorf("record %v: content is only used by TXT, MX, SRV and CAA records", record.Name), i, "content")
+		}
+		if record.IP != "" && record.Source != "" {
+			problems.add(fmt.Errorf("record %v: ip and source can't both be set", record.Name), i, "source")
+		}
+		if record.Proxied != nil && !IsProxiableType(record.RecordType()) {
+			problems.add(fmt.Errorf("record %v: proxied is only used by A, AAAA and CNAME records", record.Name), i, "proxied")
+		}
+		if record.WWWProxied != nil && !record.WWW {
+			problems.add(fmt.Errorf("record %v: wwwProxied is only used along with www", record.Name), i, "wwwProxied")
+		} else if record.WWWProxied != nil && !IsProxiableType(record.RecordType()) {
+			problems.add(fmt.Errorf("record %v: wwwProxied is only used by A, AAAA and CNAME records", record.Name), i, "wwwProxied")
+		}
+		switch record.RecordType() {
+		case RECORD_TYPE_A, RECORD_TYPE_AAAA:
+			if record.IP != "" {
+				if err := CheckAddress(record.RecordType(), record.IP); err != nil {
+					problems.add(fmt.Errorf("record %v: ip %w", record.Name, err), i, "ip")
+				}
+			}
+		case RECORD_TYPE_CNAME:
+			if record.Target == "" && record.Source == "" {
+				problems.add(fmt.Errorf("record %v: CNAME records need a target or a source reporting one", record.Name), i)
+			}
+			if record.Target != "" && record.Source != "" {
+				problems.add(fmt.Errorf("record %v: target and source can't both be set", record.Name), i, "source")
+			}
+			if record.Target != "" {
+				if err := CheckHostname(record.Target); err != nil {
+					problems.add(fmt.Errorf("record %v: target %w", record.Name, err), i, "target")
+				}
+			}
+		case RECORD_TYPE_TXT, RECORD_TYPE_MX, RECORD_TYPE_SRV, RECORD_TYPE_CAA:
+			if record.Content == "" {
+				problems.add(fmt.Errorf("record %v: %v records need content", record.Name, record.RecordType()), i)
+				break
+			}
+			// Tried out with an example address so mistakes show up when loading rather than on the first check
+			content, err := RenderContent(record.Content, EXAMPLE_IP)
+			if err == nil {
+				err = CheckContent(record.RecordType(), content)
+			}
+			if err != nil {
+				problems.add(fmt.Errorf("record %v: content %w", record.Name, err), i, "content")
+			}
+		default:
+			problems.add(fmt.Errorf("record %v: type must be A, AAAA, CNAME, TXT, MX, SRV or CAA, got %q", record.Name, record.Type), i, "type")
+		}
+		if err := (RecordOptions{TTL: record.TTL}).Validate(); err != nil {
+			problems.add(fmt.Errorf("record %v: %w", record.Name, err), i, "ttl")
+		}
+		if record.ZoneID != "" {
+			if err := CheckZoneID(record.ZoneID); err != nil {
+				problems.add(fmt.Errorf("record %v: zoneID %w", record.Name, err), i, "zoneID")
+			}
+		}
+		_, named := c.Sources[record.Source]
+		if _, builtIn := IP_SERVICES[record.Source]; record.Source != "" && !named && !builtIn {
+			if err := validateURL(record.Source); err != nil {
+				problems.add(fmt.Errorf("record %v: source isn't defined and %w", record.Name, err), i, "source")
+			}
+		}
+		c.validateNotify(problems.within("record "+record.Name, i, "notify"), record.Notify)
+	}
+}
+
+// Helper method to report whether anything besides records is updated with the named account's token
+func (c *Config) usesAccount(name string) bool {
+	return slices.ContainsFunc(c.LoadBalancerPools, func(pool LoadBalancerPoolConfig) bool { return pool.Account == name }) ||
+		slices.ContainsFunc(c.IPLists, func(list IPListConfig) bool { return list.Account == name }) ||
+		slices.ContainsFunc(c.FirewallRules, func(rule FirewallRuleConfig) bool { return rule.Account == name }) ||
+		slices.ContainsFunc(c.AccessPolicies, func(policy AccessPolicyConfig) bool { return policy.Account == name })
+}
+
+// Method to report whether the config lists anything besides records to keep pointed at the public IP
+func (c *Config) HasResources() bool {
+	return len(c.LoadBalancerPools) > 0 || len(c.IPLists) > 0 || len(c.FirewallRules) > 0 || len(c.AccessPolicies) > 0
+}
+
+// Helper method to check every listed notification channel is defined
+func (c *Config) validateNotify(problems *configProblems, notify []string) {
+	for i, name := range notify {
+		if _, ok := c.Notifiers[name]; !ok {
+			problems.add(fmt.Errorf("notifier %v isn't defined", name), i)
+		}
+	}
+}
+
+// Helper method to check a zone ID looks like one, 32 hexadecimal characters as shown on the zone's overview page
+func CheckZoneID(zoneID string) error {
+	if _, err := hex.DecodeString(zoneID); err != nil || len(zoneID) != 32 {
+		return fmt.Errorf("must be 32 hexadecimal characters, got %q", zoneID)
+	}
+	return nil
+}
+
+// Helper method to check an account ID looks like one, shown on the account's overview page in the same form as a zone ID
+func CheckAccountID(accountID string) error {
+	return CheckZoneID(accountID)
+}
+
+// Helper method to check a value is an absolute http(s) URL
+func validateURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("must be an http or https URL, got %q", value)
+	}
+	return nil
+}
+
+// Helper method to get the API Token, reading it from tokenFile when it isn't provided directly
+func ResolveToken(token string, tokenFile string) (string, error) {
+	if token != "" || tokenFile == "" {
+		return token, nil
+	}
+	contents, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("reading tokenFile failed: %w", err)
+	}
+	return strings.TrimSpace(string(contents)), nil
+}
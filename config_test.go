@@ -0,0 +1,484 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+token: abc123
+records:
+  - name: home.example.com
+    www: true
+  - name: lab.example.net
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.Token != "abc123" {
+		t.Errorf("Expected token abc123, got %q", config.Token)
+	}
+	expected := []RecordConfig{{Name: "home.example.com", WWW: true}, {Name: "lab.example.net"}}
+	if len(config.Records) != len(expected) {
+		t.Fatalf("Expected %d records, got %d", len(expected), len(config.Records))
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(config.Records[i], expected[i]) {
+			t.Errorf("Expected record %+v, got %+v", expected[i], config.Records[i])
+		}
+	}
+}
+
+func TestParseConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{"Unknown Key", "tokn: abc123\n"},
+		{"Wrong Type", "records: home.example.com\n"},
+		{"Missing Name", "records:\n  - www: true\n"},
+		{"Duplicate Record", "records:\n  - name: example.com\n  - name: Example.com\n"},
+		{"Bad Zone ID", "records:\n  - name: example.com\n    zoneID: example.com\n"},
+		{"Bad Account ID", "accountID: my-account\nrecords:\n  - name: example.com\n"},
+		{"Bad Account ID of an account", "accounts:\n  - name: work\n    token: abc123\n    accountID: work\n    records:\n      - name: example.com\n"},
+		{"Proxied TXT record", "records:\n  - name: example.com\n    type: TXT\n    content: ip={{.IP}}\n    proxied: true\n"},
+		{"Negative notifier limit", "notifiers:\n  ops:\n    webhook: https://hooks.example.com/ops\n    maxPerHour: -1\n"},
+		{"wwwProxied without www", "records:\n  - name: example.com\n    wwwProxied: false\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseConfig([]byte(tt.contents)); err == nil {
+				t.Error("Expected error but got none")
+			}
+		})
+	}
+}
+
+func TestParseConfig_AllProblems(t *testing.T) {
+	_, err := ParseConfig([]byte(`tokn: abc123
+records:
+  - name: home.example.com
+    ttl: fast
+  - name: lab.example.com
+    type: MX
+accounts:
+  - name: client-a
+    records:
+      - name: office.example.com
+        ip: nope
+`))
+	var problems ConfigErrors
+	if !errors.As(err, &problems) {
+		t.Fatalf("Expected config errors, got %v", err)
+	}
+	expected := []int{1, 4, 5, 8, 11}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d: %v", len(expected), len(problems), err)
+	}
+	for i, line := range expected {
+		if problems[i].Line != line {
+			t.Errorf("Expected problem %d on line %d, got %v", i+1, line, problems[i])
+		}
+	}
+	if !strings.Contains(problems[4].Error(), "account client-a: record office.example.com: ip") {
+		t.Errorf("Expected the problem to name the account and record, got %v", problems[4])
+	}
+}
+
+func TestLoadConfigs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("records:\n  - name: example.com\n"), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	config, err := LoadConfigs([]string{path}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(config.Records) != 1 || config.Records[0].Name != "example.com" {
+		t.Errorf("Unexpected records: %+v", config.Records)
+	}
+	if _, err := LoadConfigs([]string{filepath.Join(t.TempDir(), "missing.yaml")}, nil); err == nil {
+		t.Error("Expected error for a missing file but got none")
+	}
+}
+
+func TestLoadConfigs_Merge(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return path
+	}
+	defaults := write("10-defaults.yaml", `
+notify: [ops]
+notifiers:
+  ops:
+    webhook: https://hooks.example.com/ops
+    maxPerHour: 10
+records:
+  - name: shared.example.com
+`)
+	site := write("20-site.yml", `
+token: site-token
+notifiers:
+  ops:
+    webhook: https://hooks.example.com/site
+records:
+  - name: site.example.com
+    www: true
+`)
+	write("README.md", "not a config")
+
+	paths, err := ConfigFiles([]string{dir})
+	if err != nil || !reflect.DeepEqual(paths, []string{defaults, site}) {
+		t.Fatalf("Expected the YAML files in order, got %v, %v", paths, err)
+	}
+	config, err := LoadConfigs(paths, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Mappings are merged key by key, lists and plain values replaced
+	if config.Token != "site-token" || !reflect.DeepEqual(config.Notify, []string{"ops"}) {
+		t.Errorf("Unexpected token and notify: %q, %v", config.Token, config.Notify)
+	}
+	if ops := config.Notifiers["ops"]; ops.Webhook != "https://hooks.example.com/site" || ops.MaxPerHour != 10 {
+		t.Errorf("Expected the webhook overridden and the limit kept, got %+v", ops)
+	}
+	if len(config.Records) != 1 || config.Records[0].Name != "site.example.com" || !config.Records[0].WWW {
+		t.Errorf("Expected the site's records in place of the shared ones, got %+v", config.Records)
+	}
+
+	// Problems are reported with the file they're in
+	broken := write("30-broken.yaml", "notify: [pager]\nrecords:\n  - name: site.example.com\n    tll: 60\n")
+	_, err = LoadConfigs([]string{defaults, site, broken}, nil)
+	if err == nil || !strings.Contains(err.Error(), broken+" line 1: notifier pager isn't defined") || !strings.Contains(err.Error(), broken+" line 4: field tll not found") {
+		t.Errorf("Expected problems in %v, got %v", broken, err)
+	}
+
+	// A variable is only needed by values that aren't overridden
+	withEnv := write("05-env.yaml", "token: ${UNSET_DEFAULT_TOKEN}\n")
+	if _, err := LoadConfigs([]string{withEnv, defaults, site}, nil); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := LoadConfigs([]string{withEnv, defaults}, nil); err == nil || !strings.Contains(err.Error(), withEnv+" line 1: environment variable UNSET_DEFAULT_TOKEN isn't set") {
+		t.Errorf("Expected the missing variable to be reported, got %v", err)
+	}
+}
+
+func TestLoadConfig_Include(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, contents string) string {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0o700)
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return path
+	}
+	root := write("config.yaml", `
+token: main-token
+include: [zones/*.yaml]
+records:
+  - name: home.example.com
+`)
+	write("zones/a.yaml", `
+token: ignored
+records:
+  - name: a.example.com
+  - name: lab.example.com
+`)
+	write("zones/b.yaml", `
+records:
+  - name: b.example.net
+    notify: [ops]
+notifiers:
+  ops:
+    webhook: https://hooks.example.com/ops
+`)
+
+	config, err := LoadConfigs([]string{root}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var names []string
+	for _, record := range config.Records {
+		names = append(names, record.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"home.example.com", "a.example.com", "lab.example.com", "b.example.net"}) {
+		t.Errorf("Expected the included records after the file's own, got %v", names)
+	}
+	if config.Token != "main-token" || config.Notifiers["ops"].Webhook == "" {
+		t.Errorf("Expected the including file's token and the included notifier, got %q, %+v", config.Token, config.Notifiers)
+	}
+	if len(config.Files) != 3 {
+		t.Errorf("Expected 3 files read, got %v", config.Files)
+	}
+
+	// A record listed in two files is reported with the file it's repeated in
+	write("zones/c.yaml", "records:\n  - name: a.example.com\n")
+	if _, err := LoadConfigs([]string{root}, nil); err == nil || !strings.Contains(err.Error(), "c.yaml line 2: record a.example.com is listed more than once") {
+		t.Errorf("Expected the repeated record to be reported, got %v", err)
+	}
+	os.Remove(filepath.Join(dir, "zones/c.yaml"))
+
+	loop := write("loop.yaml", "include: [loop-back.yaml]\n")
+	write("loop-back.yaml", "include: [loop.yaml]\n")
+	if _, err := LoadConfigs([]string{loop}, nil); err == nil || !strings.Contains(err.Error(), "includes itself") {
+		t.Errorf("Expected an include loop to fail, got %v", err)
+	}
+	missing := write("missing.yaml", "include: [nowhere/*.yaml]\n")
+	if _, err := LoadConfigs([]string{missing}, nil); err == nil || !strings.Contains(err.Error(), "matches no files") {
+		t.Errorf("Expected an include matching nothing to fail, got %v", err)
+	}
+}
+
+func TestParseConfig_Environment(t *testing.T) {
+	t.Setenv("DNS_TOKEN", "secret-token")
+	t.Setenv("HOOK_HOST", "hooks.example.com")
+	config, err := ParseConfig([]byte(`
+token: ${DNS_TOKEN}
+notifiers:
+  ops:
+    webhook: https://${HOOK_HOST}/ops
+records:
+  - name: example.com
+    type: TXT
+    content: "literal $${DNS_TOKEN} and {{.IP}}"
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.Token != "secret-token" || config.Notifiers["ops"].Webhook != "https://hooks.example.com/ops" {
+		t.Errorf("Expected the variables expanded, got %q and %+v", config.Token, config.Notifiers)
+	}
+	if config.Records[0].Content != "literal ${DNS_TOKEN} and {{.IP}}" {
+		t.Errorf("Expected $${ to stand for ${, got %q", config.Records[0].Content)
+	}
+
+	// A variable that isn't set is reported on its own, not as the empty webhook it leaves behind
+	_, err = ParseConfig([]byte("notifiers:\n  ops:\n    webhook: ${MISSING_HOOK_URL}\nrecords:\n  - name: example.com\n"))
+	if err == nil || err.Error() != "line 3: environment variable MISSING_HOOK_URL isn't set" {
+		t.Errorf("Expected the missing variable to be reported, got %v", err)
+	}
+
+	// Numbers and bools can come from the environment too
+	t.Setenv("DNS_TTL", "300")
+	t.Setenv("DNS_PROXIED", "true")
+	t.Setenv("DNS_RETRIES", "5")
+	config, err = ParseConfig([]byte("apiRetries: ${DNS_RETRIES}\nrecords:\n  - name: example.com\n    ttl: ${DNS_TTL}\n    proxied: ${DNS_PROXIED}\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.APIRetries == nil || *config.APIRetries != 5 || config.Records[0].TTL != 300 || config.Records[0].Proxied == nil || !*config.Records[0].Proxied {
+		t.Errorf("Expected the variables decoded as numbers and bools, got %+v", config)
+	}
+	_, err = ParseConfig([]byte("records:\n  - name: example.com\n    ttl: ${DNS_PROXIED}\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3: cannot unmarshal !!bool `true` into int") {
+		t.Errorf("Expected the expanded value of the wrong type to be reported, got %v", err)
+	}
+
+	// Values decoded into strings are taken as they are, whatever they look like
+	for _, value := range []string{"null", "~", "true", "0x10"} {
+		t.Setenv("DNS_TOKEN", value)
+		config, err = ParseConfig([]byte("token: ${DNS_TOKEN}\nrecords:\n  - name: example.com\n    member:\n      comment: ${DNS_TOKEN}\n"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if config.Token != value || config.Records[0].Member.Comment != value {
+			t.Errorf("Expected the token and member comment %q, got %q and %+v", value, config.Token, config.Records[0].Member)
+		}
+	}
+}
+
+func TestParseConfig_Accounts(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+accounts:
+  - name: client-a
+    token: token-a
+    records:
+      - name: a.example.com
+  - name: client-b
+    tokenFile: /run/secrets/client-b
+    records:
+      - name: b.example.net
+        www: true
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(config.Accounts) != 2 {
+		t.Fatalf("Expected 2 accounts, got %d", len(config.Accounts))
+	}
+	if config.Accounts[1].TokenFile != "/run/secrets/client-b" || !config.Accounts[1].Records[0].WWW {
+		t.Errorf("Unexpected account: %+v", config.Accounts[1])
+	}
+
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{"Missing Name", "accounts:\n  - token: a\n    records:\n      - name: a.example.com\n"},
+		{"Missing Token", "accounts:\n  - name: a\n    records:\n      - name: a.example.com\n"},
+		{"No Records", "accounts:\n  - name: a\n    token: a\n"},
+		{"CNAME Without Target", "token: a\nrecords:\n  - name: a.example.com\n    type: CNAME\n"},
+		{"CNAME Target Not A Hostname", "token: a\nrecords:\n  - name: a.example.com\n    type: CNAME\n    target: 203.0.113.1\n"},
+		{"TXT Without Content", "token: a\nrecords:\n  - name: a.example.com\n    type: TXT\n"},
+		{"Broken Content Template", "token: a\nrecords:\n  - name: a.example.com\n    type: TXT\n    content: \"{{.Addr}}\"\n"},
+		{"Malformed MX Content", "token: a\nrecords:\n  - name: a.example.com\n    type: MX\n    content: mail.example.com\n"},
+		{"Content On A Record", "token: a\nrecords:\n  - name: a.example.com\n    content: \"{{.IP}}\"\n"},
+		{"Empty Member", "token: a\nrecords:\n  - name: a.example.com\n    member: {}\n"},
+		{"Member Tag And Comment", "token: a\nrecords:\n  - name: a.example.com\n    member:\n      tag: wan1\n      comment: wan1\n"},
+		{"Pinned IP Of Wrong Family", "token: a\nrecords:\n  - name: a.example.com\n    ip: 2001:db8::1\n"},
+		{"Pinned IP With Source", "token: a\nrecords:\n  - name: a.example.com\n    ip: 192.0.2.10\n    source: https://api.ipify.org\n"},
+		{"Pinned IP On CNAME", "token: a\nrecords:\n  - name: a.example.com\n    type: CNAME\n    target: b.example.com\n    ip: 192.0.2.10\n"},
+		{"Source Without URL Or Interface", "token: a\nsources:\n  vpn: {}\nrecords:\n  - name: a.example.com\n"},
+		{"Source Credentials Without URL", "token: a\nsources:\n  vpn:\n    interface: wg0\n    bearerToken: secret\nrecords:\n  - name: a.example.com\n"},
+		{"Source Bearer And Basic Auth", "token: a\nsources:\n  wan:\n    url: https://ip.example.com\n    bearerToken: secret\n    username: ddns\nrecords:\n  - name: a.example.com\n"},
+		{"Source Password Without Username", "token: a\nsources:\n  wan:\n    url: https://ip.example.com\n    password: secret\nrecords:\n  - name: a.example.com\n"},
+		{"Unknown IP Service", "token: a\nipService: whatismyip\nrecords:\n  - name: a.example.com\n"},
+		{"Bad API Base", "token: a\napiBase: gateway.internal\nrecords:\n  - name: a.example.com\n"},
+		{"Source With URL And Tailscale", "token: a\nsources:\n  vpn:\n    url: https://ip.example.com\n    tailscale: true\nrecords:\n  - name: a.example.com\n"},
+		{"Undefined Source Name", "token: a\nrecords:\n  - name: a.example.com\n    source: vpn\n"},
+		{"Incomplete Load Balancer Pool", "token: a\nloadBalancerPools:\n  - accountID: acc\n    pool: home\n"},
+		{"Load Balancer Pool Of Unknown Account", "token: a\nloadBalancerPools:\n  - account: b\n    accountID: acc\n    pool: home\n    origin: home-server\n"},
+		{"IP List Without List", "token: a\nipLists:\n  - accountID: acc\n"},
+		{"Firewall Rule Without Expression", "token: a\nfirewallRules:\n  - zone: example.com\n    rule: home\n"},
+		{"Broken Firewall Rule Expression", "token: a\nfirewallRules:\n  - zone: example.com\n    rule: home\n    expression: \"(ip.src eq {{.Addr}})\"\n"},
+		{"Access Policy Keep Not A Range", "token: a\naccessPolicies:\n  - accountID: acc\n    policy: home\n    keep: [office]\n"},
+		{"Negative API Timeout", "token: a\napiTimeout: -5s\nrecords:\n  - name: a.example.com\n"},
+		{"Negative API Retries", "token: a\napiRetries: -1\nrecords:\n  - name: a.example.com\n"},
+		{"Target On A Record", "token: a\nrecords:\n  - name: a.example.com\n    target: b.example.net\n"},
+		{"Duplicate Account", "accounts:\n  - name: a\n    token: a\n    records:\n      - name: a.example.com\n  - name: a\n    token: b\n    records:\n      - name: b.example.com\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseConfig([]byte(tt.contents)); err == nil {
+				t.Error("Expected error but got none")
+			}
+		})
+	}
+}
+
+func TestResolveToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if token, err := ResolveToken("direct", path); err != nil || token != "direct" {
+		t.Errorf("Expected the direct token, got %q, %v", token, err)
+	}
+	if token, err := ResolveToken("", path); err != nil || token != "from-file" {
+		t.Errorf("Expected the token from the file, got %q, %v", token, err)
+	}
+	if _, err := ResolveToken("", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected error for a missing file but got none")
+	}
+}
+
+func TestParseConfig_Overrides(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+notifiers:
+  ops:
+    webhook: https://hooks.example.com/ops
+  lab:
+    webhook: https://hooks.example.com/lab
+notify: [ops]
+records:
+  - name: example.com
+    ttl: 60
+    proxied: true
+  - name: example.com
+    type: aaaa
+    source: https://api6.ipify.org
+    notify: [lab]
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.Records[0].TTL != 60 || config.Records[0].Proxied == nil || !*config.Records[0].Proxied {
+		t.Errorf("Unexpected overrides: %+v", config.Records[0])
+	}
+	if config.Records[1].RecordType() != "AAAA" || config.Records[1].Source != "https://api6.ipify.org" {
+		t.Errorf("Unexpected overrides: %+v", config.Records[1])
+	}
+
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{"Bad Type", "records:\n  - name: example.com\n    type: MX\n"},
+		{"Bad TTL", "records:\n  - name: example.com\n    ttl: 5\n"},
+		{"Bad Source", "records:\n  - name: example.com\n    source: api.ipify.org\n"},
+		{"Unknown Notifier", "records:\n  - name: example.com\n    notify: [ops]\n"},
+		{"Bad Webhook", "notifiers:\n  ops:\n    webhook: ''\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseConfig([]byte(tt.contents)); err == nil {
+				t.Error("Expected error but got none")
+			}
+		})
+	}
+}
+
+func TestParseConfig_Timeouts(t *testing.T) {
+	config, err := ParseConfig([]byte("detectTimeout: 30s\napiTimeout: 1m\napiRetries: 0\nrecords:\n  - name: example.com\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.DetectTimeout != 30*time.Second || config.APITimeout != time.Minute || config.APIRetries == nil || *config.APIRetries != 0 {
+		t.Errorf("Unexpected timeouts: %v, %v, %v", config.DetectTimeout, config.APITimeout, config.APIRetries)
+	}
+}
+
+func TestParseConfig_LoadBalancerPools(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+loadBalancerPools:
+  - account: lb
+    accountID: 023e105f4ecef8ad9ca31a8372d0c353
+    pool: home
+    origin: home-server
+accounts:
+  - name: lb
+    token: b
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !config.HasResources() || config.LoadBalancerPools[0].Origin != "home-server" {
+		t.Errorf("Unexpected load balancer pools: %+v", config.LoadBalancerPools)
+	}
+}
+
+// Whatever the file holds, parsing must fail cleanly rather than panic, and a config it accepts must stay valid
+func FuzzParseConfig(f *testing.F) {
+	f.Add([]byte("token: abc123\nrecords:\n  - name: home.example.com\n    www: true\n"))
+	f.Add([]byte("accounts:\n  - name: client-a\n    token: token-a\n    records:\n      - name: a.example.com\n"))
+	f.Add([]byte("sources:\n  wan2:\n    url: https://ip.example.net\n    bearerToken: secret\nrecords:\n  - name: b.example.com\n    source: wan2\n"))
+	f.Add([]byte("sources:\n  wg:\n    interface: wg0\n    ipv6: true\nrecords:\n  - name: vpn.example.com\n    type: AAAA\n    source: wg\n"))
+	f.Add([]byte("records:\n  - name: example.com\n    ttl: -1\n"))
+	f.Add([]byte("records: &a [*a]\n"))
+	f.Add([]byte("\t: :\n- {"))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, contents []byte) {
+		config, err := ParseConfig(contents)
+		if err != nil {
+			return
+		}
+		if err := config.Validate(); err != nil {
+			t.Errorf("Accepted config no longer validates: %v", err)
+		}
+	})
+}
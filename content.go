@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/dns"
+)
+
+// Record types whose content comes from a template in the config rather than the detected IP
+const RECORD_TYPE_MX = "MX"
+const RECORD_TYPE_SRV = "SRV"
+const RECORD_TYPE_CAA = "CAA"
+
+// Documentation address content templates are tried out with when the config is loaded
+const EXAMPLE_IP = "192.0.2.1"
+
+// Longest content Cloudflare accepts for a TXT record
+const TXT_MAX_LENGTH = 2048
+
+// Values available to content templates, e.g. "v=spf1 ip4:{{.IP}} -all"
+type ContentData struct {
+	IP string
+}
+
+// Helper method to report whether the record type holds templated content
+func IsTemplatedType(recordType string) bool {
+	switch recordType {
+	case RECORD_TYPE_TXT, RECORD_TYPE_MX, RECORD_TYPE_SRV, RECORD_TYPE_CAA:
+		return true
+	}
+	return false
+}
+
+// Helper method to report whether Cloudflare can proxy records of the type
+func IsProxiableType(recordType string) bool {
+	return recordType == "" || recordType == RECORD_TYPE_A || recordType == RECORD_TYPE_AAAA || recordType == RECORD_TYPE_CNAME
+}
+
+// Helper method to fill in a content template with the detected IP address
+func RenderContent(text string, publicIP string) (string, error) {
+	tmpl, err := template.New("content").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parsing content template failed: %w", err)
+	}
+	var content strings.Builder
+	if err := tmpl.Execute(&content, ContentData{IP: publicIP}); err != nil {
+		return "", fmt.Errorf("rendering content template failed: %w", err)
+	}
+	return content.String(), nil
+}
+
+// Helper method to check templated content is written the way a zone file would hold it for the type
+// TXT takes the text itself, MX "priority target", SRV "priority weight port target" and CAA "flags tag value"
+func checkTemplatedContent(recordType string, content string) error {
+	fields := strings.Fields(content)
+	switch recordType {
+	case RECORD_TYPE_TXT:
+		if content == "" || len(content) > TXT_MAX_LENGTH {
+			return fmt.Errorf("TXT content must be between 1 and %d characters long", TXT_MAX_LENGTH)
+		}
+	case RECORD_TYPE_MX:
+		if len(fields) != 2 || !isUint16(fields[0]) {
+			return fmt.Errorf("%q is not MX content, expected \"priority target\"", content)
+		}
+		return CheckHostname(fields[1])
+	case RECORD_TYPE_SRV:
+		if len(fields) != 4 || !isUint16(fields[0]) || !isUint16(fields[1]) || !isUint16(fields[2]) {
+			return fmt.Errorf("%q is not SRV content, expected \"priority weight port target\"", content)
+		}
+		return CheckHostname(fields[3])
+	case RECORD_TYPE_CAA:
+		if len(fields) < 3 || !isUint8(fields[0]) {
+			return fmt.Errorf("%q is not CAA content, expected \"flags tag value\"", content)
+		}
+	}
+	return nil
+}
+
+// Helper method to write a listed record's content the way the config does, some types keep their priority apart from it
+func RecordPresentation(record DNSRecord) string {
+	switch record.Type {
+	case RECORD_TYPE_MX:
+		return fmt.Sprintf("%d %v", record.Priority, record.Content)
+	case RECORD_TYPE_SRV:
+		// Cloudflare may list SRV content with or without the priority in front
+		if len(strings.Fields(record.Content)) == 3 {
+			return fmt.Sprintf("%d %v", record.Priority, record.Content)
+		}
+	}
+	return record.Content
+}
+
+// Helper method to compare a record's presented content with the wanted content
+// Hostnames are compared without case or trailing dot and TXT/CAA values without their quotes
+func ContentMatches(recordType string, current string, wanted string) bool {
+	switch recordType {
+	case RECORD_TYPE_CNAME:
+		return strings.EqualFold(strings.TrimSuffix(current, "."), strings.TrimSuffix(wanted, "."))
+	case RECORD_TYPE_TXT:
+		return strings.Trim(current, `"`) == strings.Trim(wanted, `"`)
+	case RECORD_TYPE_MX, RECORD_TYPE_SRV, RECORD_TYPE_CAA:
+		return normalizeFields(current) == normalizeFields(wanted)
+	}
+	return current == wanted
+}
+
+// Helper method to bring space separated content to a comparable form
+func normalizeFields(content string) string {
+	fields := strings.Fields(content)
+	for i, field := range fields {
+		fields[i] = strings.ToLower(strings.TrimSuffix(strings.Trim(field, `"`), "."))
+	}
+	return strings.Join(fields, " ")
+}
+
+// Helper method to set the content of templated types on the edit parameters
+// MX carries its priority separately and SRV/CAA are sent as structured data, which Cloudflare builds the content from
+func applyTemplatedContent(param *dns.RecordParam, recordType string, content string) {
+	fields := strings.Fields(content)
+	switch recordType {
+	case RECORD_TYPE_TXT:
+		param.Content = cloudflare.F(content)
+	case RECORD_TYPE_MX:
+		if len(fields) == 2 {
+			priority, _ := strconv.Atoi(fields[0])
+			param.Priority = cloudflare.F(float64(priority))
+			param.Content = cloudflare.F(strings.TrimSuffix(fields[1], "."))
+		}
+	case RECORD_TYPE_SRV:
+		if len(fields) == 4 {
+			priority, _ := strconv.Atoi(fields[0])
+			weight, _ := strconv.Atoi(fields[1])
+			port, _ := strconv.Atoi(fields[2])
+			param.Data = cloudflare.F[any](map[string]any{"priority": priority, "weight": weight, "port": port, "target": strings.TrimSuffix(fields[3], ".")})
+		}
+	case RECORD_TYPE_CAA:
+		if len(fields) >= 3 {
+			flags, _ := strconv.Atoi(fields[0])
+			value := strings.Trim(strings.Join(fields[2:], " "), `"`)
+			param.Data = cloudflare.F[any](map[string]any{"flags": flags, "tag": fields[1], "value": value})
+		}
+	}
+}
+
+// Helper method to check a field is a number that fits in 16 bits, as priorities, weights and ports do
+func isUint16(value string) bool {
+	_, err := strconv.ParseUint(value, 10, 16)
+	return err == nil
+}
+
+// Helper method to check a field is a number that fits in 8 bits, as CAA flags do
+func isUint8(value string) bool {
+	_, err := strconv.ParseUint(value, 10, 8)
+	return err == nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenderContent(t *testing.T) {
+	content, err := RenderContent("v=spf1 ip4:{{.IP}} -all", "203.0.113.5")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if content != "v=spf1 ip4:203.0.113.5 -all" {
+		t.Errorf("Unexpected content: %q", content)
+	}
+	if _, err := RenderContent("{{.Missing}}", "203.0.113.5"); err == nil {
+		t.Error("Expected error for an unknown field but got none")
+	}
+	if _, err := RenderContent("{{.IP", "203.0.113.5"); err == nil {
+		t.Error("Expected error for a broken template but got none")
+	}
+}
+
+func TestCheckContent_Templated(t *testing.T) {
+	tests := []struct {
+		recordType string
+		content    string
+		valid      bool
+	}{
+		{"TXT", "v=spf1 ip4:203.0.113.5 -all", true},
+		{"TXT", "", false},
+		{"MX", "10 mail.example.com", true},
+		{"MX", "mail.example.com", false},
+		{"MX", "10 203.0.113.5", false},
+		{"SRV", "10 5 5060 sip.example.com", true},
+		{"SRV", "10 5 99999 sip.example.com", false},
+		{"CAA", `0 issue "letsencrypt.org"`, true},
+		{"CAA", "issue letsencrypt.org", false},
+	}
+
+	for _, tt := range tests {
+		err := CheckContent(tt.recordType, tt.content)
+		if (err == nil) != tt.valid {
+			t.Errorf("%v %q: expected valid %v, got error %v", tt.recordType, tt.content, tt.valid, err)
+		}
+	}
+}
+
+func TestContentMatches(t *testing.T) {
+	tests := []struct {
+		record  DNSRecord
+		wanted  string
+		matches bool
+	}{
+		{DNSRecord{Type: "A", Content: "203.0.113.5"}, "203.0.113.5", true},
+		{DNSRecord{Type: "TXT", Content: `"v=spf1 -all"`}, "v=spf1 -all", true},
+		{DNSRecord{Type: "TXT", Content: "v=spf1 -all"}, "v=spf1 ~all", false},
+		{DNSRecord{Type: "MX", Content: "mail.example.com", Priority: 10}, "10 Mail.example.com.", true},
+		{DNSRecord{Type: "MX", Content: "mail.example.com", Priority: 20}, "10 mail.example.com", false},
+		{DNSRecord{Type: "SRV", Content: "5 5060 sip.example.com", Priority: 10}, "10 5 5060 sip.example.com", true},
+		{DNSRecord{Type: "SRV", Content: "10 5 5060 sip.example.com", Priority: 10}, "10 5 5061 sip.example.com", false},
+		{DNSRecord{Type: "CAA", Content: `0 issue "letsencrypt.org"`}, "0 issue letsencrypt.org", true},
+	}
+
+	for _, tt := range tests {
+		if matches := ContentMatches(tt.record.Type, RecordPresentation(tt.record), tt.wanted); matches != tt.matches {
+			t.Errorf("%+v against %q: expected %v, got %v", tt.record, tt.wanted, tt.matches, matches)
+		}
+	}
+}
+
+func TestBuildRecordParam_Templated(t *testing.T) {
+	on := true
+	param := BuildRecordParam(DNSRecord{Name: "example.com", Type: "MX"}, "10 mail.example.com.", RecordOptions{Proxied: &on})
+	if param.Content.Value != "mail.example.com" || param.Priority.Value != 10 {
+		t.Errorf("Expected the MX target and priority apart, got %+v", param)
+	}
+	if param.Proxied.Present {
+		t.Error("Expected proxied not to be sent for an MX record")
+	}
+
+	param = BuildRecordParam(DNSRecord{Name: "_sip._udp.example.com", Type: "SRV"}, "10 5 5060 sip.example.com", RecordOptions{})
+	if param.Content.Present {
+		t.Error("Expected SRV content to be sent as data")
+	}
+	if data := param.Data.Value; !reflect.DeepEqual(data, map[string]any{"priority": 10, "weight": 5, "port": 5060, "target": "sip.example.com"}) {
+		t.Errorf("Unexpected SRV data: %v", data)
+	}
+
+	param = BuildRecordParam(DNSRecord{Name: "example.com", Type: "CAA"}, `0 issue "letsencrypt.org"`, RecordOptions{})
+	if data := param.Data.Value; !reflect.DeepEqual(data, map[string]any{"flags": 0, "tag": "issue", "value": "letsencrypt.org"}) {
+		t.Errorf("Unexpected CAA data: %v", data)
+	}
+}
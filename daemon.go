@@ -0,0 +1,391 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// How often the daemon looks at whether it has gone stale
+const STALE_POLL_INTERVAL = time.Minute
+
+// Longest the time until the next check is stretched to while checks keep failing, unless set otherwise
+const DEFAULT_MAX_BACKOFF = time.Hour
+
+// Watches for something that warrants an immediate check, calling trigger when it happens, until stop is closed
+type Watcher func(stop <-chan struct{}, trigger func()) error
+
+// Daemon holds everything needed to keep running checks in the background
+type Daemon struct {
+	// When to run checks
+	Schedule Schedule
+	// The check to run on every activation
+	Check func() (CheckReport, error)
+	// Optional path to write the process ID to while running
+	PIDFile string
+	// Optional address (e.g. :8080) for the daemon's HTTP server (health endpoints and control API) to listen on
+	HealthAddr string
+	// Optional bearer token enabling the control API on the HTTP server
+	ControlToken string
+	// Optional address (e.g. :9090) for the gRPC API to listen on, authenticated with ControlToken
+	GRPCAddr string
+	// Outcome of recent checks, shared with the HTTP server
+	Status *DaemonStatus
+	// Change and error events, streamed to gRPC watchers
+	Events *EventBus
+	// Optional leader election, when set only the replica holding the lease runs checks
+	Leader *LeaderElector
+	// Optional event sources which trigger a check outside of the schedule, run for as long as the daemon is
+	Watchers []Watcher
+	// Optional window after which going without a successful check raises a stale alert
+	StaleAfter time.Duration
+	// Optional cap on how far the time until the next check is stretched while checks keep failing, no backing off when zero
+	MaxBackoff time.Duration
+	// Called with each stale alert and failed reload, e.g. to send it to the notification channels
+	Alert func(Event)
+	// Optional, reads the config again on SIGHUP, keeping the current one when it returns an error
+	Reload func() error
+	// Optional, watches the config for changes, triggering a reload rather than a check
+	ConfigWatcher Watcher
+
+	// Requests for a check outside of the schedule
+	trigger chan struct{}
+	// Requests to reload the config
+	reload chan struct{}
+	// Keeps checks from the loop and the APIs from overlapping
+	checkMu sync.Mutex
+}
+
+// Method to run checks according to the schedule until the process receives SIGINT or SIGTERM
+// A failed check is logged and retried at the next activation rather than stopping the daemon, as is one that panicked
+func (d *Daemon) Run() error {
+	if d.Status == nil {
+		d.Status = &DaemonStatus{}
+	}
+	if d.Events == nil {
+		d.Events = NewEventBus()
+	}
+	d.trigger = make(chan struct{}, 1)
+	d.reload = make(chan struct{}, 1)
+	if d.PIDFile != "" {
+		if err := WritePIDFile(d.PIDFile); err != nil {
+			return err
+		}
+		defer RemovePIDFile(d.PIDFile)
+	}
+
+	if d.HealthAddr != "" {
+		server, err := StartHTTPServer(d.HealthAddr, d.Handler())
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+	}
+
+	if d.GRPCAddr != "" {
+		server, err := StartGRPCServer(d.GRPCAddr, d)
+		if err != nil {
+			return err
+		}
+		defer server.Stop()
+	}
+
+	if d.Leader != nil {
+		// Settle the first election before the first check so the leader doesn't sit out a whole interval
+		d.Leader.Elect(time.Now())
+		stopElection := make(chan struct{})
+		elected := make(chan struct{})
+		go func() {
+			d.Leader.Run(stopElection)
+			close(elected)
+		}()
+		// Wait for the lease to be released before exiting
+		defer func() {
+			close(stopElection)
+			<-elected
+		}()
+	}
+
+	if len(d.Watchers) > 0 {
+		stopWatchers := make(chan struct{})
+		defer close(stopWatchers)
+		for _, watcher := range d.Watchers {
+			go func() {
+				if err := watcher(stopWatchers, d.TriggerCheck); err != nil {
+					log.Errorf("watcher stopped: %v", err)
+				}
+			}()
+		}
+	}
+
+	if d.ConfigWatcher != nil && d.Reload != nil {
+		stopConfigWatch := make(chan struct{})
+		defer close(stopConfigWatch)
+		go func() {
+			if err := d.ConfigWatcher(stopConfigWatch, d.TriggerReload); err != nil {
+				log.Errorf("config watcher stopped: %v", err)
+			}
+		}()
+	}
+
+	if d.StaleAfter > 0 {
+		stopStaleWatch := make(chan struct{})
+		defer close(stopStaleWatch)
+		go d.watchStale(stopStaleWatch, time.Now(), STALE_POLL_INTERVAL)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	// Left nil without a config to reload, so it's never selected
+	var hangup chan os.Signal
+	if d.Reload != nil {
+		hangup = make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		defer signal.Stop(hangup)
+	}
+
+	// Checks failed in a row, skipped ones don't count either way
+	failures := 0
+	// Check once straight away so we don't wait a full interval after starting
+	for {
+		if pausedUntil := d.Status.PausedUntil(time.Now()); !pausedUntil.IsZero() {
+			log.Infof("Updates paused until %v, skipping check", pausedUntil.Format(time.RFC3339))
+		} else if d.Leader != nil && !d.Leader.IsLeader() {
+			log.Info("Not the leader, skipping check")
+		} else if report, err := d.RunCheck(); err != nil {
+			log.WithField(CHECK_ID_FIELD, report.CheckID).Error(err.Error())
+			failures++
+		} else if report.Skipped == "" {
+			if failures > 1 && d.MaxBackoff > 0 {
+				log.Infof("Check succeeded after %d failures, back on schedule", failures)
+			}
+			failures = 0
+		}
+		now := time.Now()
+		next := d.Schedule.Next(now)
+		if next.IsZero() {
+			return fmt.Errorf("schedule has no further activation times")
+		}
+		if delay := d.Backoff(next.Sub(now), failures); delay > next.Sub(now) {
+			next = now.Add(delay)
+			log.Warnf("%d checks failed in a row, backing off", failures)
+		}
+		d.Status.SetNextCheck(next)
+		log.Infof("Next check at %v", next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case sig := <-stop:
+			timer.Stop()
+			log.Infof("Received %v, shutting down", sig)
+			return nil
+		case <-timer.C:
+		case <-d.trigger:
+			timer.Stop()
+			log.Info("Check requested, running now")
+		// A check follows straight away, so new records don't wait for the next activation
+		case sig := <-hangup:
+			timer.Stop()
+			log.Infof("Received %v, reloading the config", sig)
+			d.ReloadConfig()
+		case <-d.reload:
+			timer.Stop()
+			log.Info("Config changed, reloading it")
+			d.ReloadConfig()
+		}
+	}
+}
+
+// Method to work out how long to wait for the next check given the time until the scheduled one, after failures checks failed in a row
+// The first failure is retried on schedule, each one after that doubles the wait, up to MaxBackoff but never below the scheduled time
+func (d *Daemon) Backoff(scheduled time.Duration, failures int) time.Duration {
+	if d.MaxBackoff <= 0 || failures < 2 || scheduled >= d.MaxBackoff {
+		return scheduled
+	}
+	delay := scheduled
+	for i := 1; i < failures && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.MaxBackoff)
+}
+
+// Method to run a single check right away, recording its outcome and publishing the resulting event
+func (d *Daemon) RunCheck() (CheckReport, error) {
+	if d.Leader != nil && !d.Leader.IsLeader() {
+		return CheckReport{}, ErrNotLeader
+	}
+	d.checkMu.Lock()
+	defer d.checkMu.Unlock()
+
+	d.Status.StartCheck(time.Now())
+	report, err := d.safeCheck()
+	now := time.Now()
+	d.Status.Record(now, report, err)
+	switch {
+	case err != nil:
+		d.Events.Publish(Event{Type: EVENT_ERROR, Time: now, Message: err.Error(), Code: ErrorCode(err), CheckID: report.CheckID})
+	case report.Changed():
+		d.Events.Publish(Event{Type: EVENT_CHANGE, Time: now, Message: fmt.Sprintf("DNS records updated to %v", report.PublicIP), CheckID: report.CheckID})
+	}
+	for _, warning := range report.Warnings {
+		d.Events.Publish(Event{Type: EVENT_WARNING, Time: now, Message: warning, CheckID: report.CheckID})
+	}
+	return report, err
+}
+
+// Helper method to run the check, turning a panic into a failed check so an edge case doesn't take the daemon down with it
+// The stack trace is logged and the default channels alerted, since the check never got as far as notifying them itself
+func (d *Daemon) safeCheck() (report CheckReport, err error) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		err = WithCode(E_PANIC, fmt.Errorf("check panicked: %v", recovered))
+		log.Errorf("%v\n%s", err, debug.Stack())
+		if d.Alert != nil {
+			d.Alert(Event{Type: EVENT_ERROR, Time: time.Now(), Message: err.Error(), Code: E_PANIC})
+		}
+	}()
+	return d.Check()
+}
+
+// Helper method to turn a panic into an E_PANIC error in err, deferred by a check and by every goroutine it starts
+// safeCheck can't recover a panic in another goroutine, so without this it would take the whole process down
+func recoverPanic(err *error) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	panicErr := WithCode(E_PANIC, fmt.Errorf("check panicked: %v", recovered))
+	log.Errorf("%v\n%s", panicErr, debug.Stack())
+	*err = errors.Join(*err, panicErr)
+}
+
+// Method to raise a stale alert once no check has succeeded within StaleAfter, until stop is closed
+// Only one alert is raised per stale spell, another needs a successful check in between
+func (d *Daemon) watchStale(stop <-chan struct{}, started time.Time, poll time.Duration) {
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	alerted := false
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			age, stale := d.Status.Stale(now, started, d.StaleAfter)
+			switch {
+			case !stale:
+				if alerted {
+					log.Info("Checks are succeeding again")
+				}
+				alerted = false
+			case alerted:
+			// Replicas not holding the lease and paused daemons aren't expected to be updating anything
+			case d.Leader != nil && !d.Leader.IsLeader(), !d.Status.PausedUntil(now).IsZero():
+			default:
+				alerted = true
+				event := Event{Type: EVENT_STALE, Time: now, Message: fmt.Sprintf("Updater stale, no successful check for %v", age.Round(time.Second)), Code: E_STALE}
+				log.Error(event.Message)
+				d.Events.Publish(event)
+				if d.Alert != nil {
+					d.Alert(event)
+				}
+			}
+		}
+	}
+}
+
+// Method to reload the config in between checks
+// A config that fails to load or validate is logged and alerted about, and the current one is kept
+func (d *Daemon) ReloadConfig() error {
+	d.checkMu.Lock()
+	defer d.checkMu.Unlock()
+	if err := d.Reload(); err != nil {
+		err = WithCode(E_CONFIG, fmt.Errorf("reloading config failed, keeping the current one: %w", err))
+		log.Error(err.Error())
+		event := Event{Type: EVENT_ERROR, Time: time.Now(), Message: err.Error(), Code: E_CONFIG}
+		d.Events.Publish(event)
+		if d.Alert != nil {
+			d.Alert(event)
+		}
+		return err
+	}
+	log.Info("Config reloaded")
+	return nil
+}
+
+// Method to ask the daemon loop to reload the config, collapsing requests the same way TriggerCheck does
+func (d *Daemon) TriggerReload() {
+	select {
+	case d.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Method to ask the daemon loop to check immediately
+// Requests made while a check is already pending are collapsed into that one
+func (d *Daemon) TriggerCheck() {
+	select {
+	case d.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Method to build the routes served by the daemon's HTTP server
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", HealthHandler(d.Status))
+	mux.Handle("/livez", LivenessHandler(d.Status))
+	mux.Handle("/readyz", ReadinessHandler(d.Status))
+	mux.Handle("/metrics", MetricsHandler(d.Status))
+	if d.ControlToken != "" {
+		api := ControlAPI{Token: d.ControlToken, Daemon: d}
+		api.Register(mux)
+		dashboard := Dashboard{Token: d.ControlToken, Daemon: d}
+		dashboard.Register(mux)
+	}
+	return mux
+}
+
+// Helper method to write the current process ID to the provided path
+// Refuses to overwrite a PID file that belongs to another running process
+func WritePIDFile(path string) error {
+	if contents, err := os.ReadFile(path); err == nil {
+		pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+		if err == nil && pid > 0 && pid != os.Getpid() && processRunning(pid) {
+			return fmt.Errorf("pid file %v is held by running process %d", path, pid)
+		}
+	}
+	if err := os.WriteFile(path, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644); err != nil {
+		return fmt.Errorf("writing pid file failed: %w", err)
+	}
+	return nil
+}
+
+// Helper method to remove the PID file written on start, logging rather than failing since we're shutting down anyway
+func RemovePIDFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Warnf("removing pid file failed: %v", err)
+	}
+}
+
+// Helper method to check whether a process with the provided ID is alive
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// Signal 0 performs the existence check without actually delivering anything
+	return process.Signal(syscall.Signal(0)) == nil
+}
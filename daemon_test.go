@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v4/dns"
+)
+
+func TestWritePIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "go-dns-update.pid")
+
+	if err := WritePIDFile(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error reading pid file: %v", err)
+	}
+	if strings.TrimSpace(string(contents)) != fmt.Sprint(os.Getpid()) {
+		t.Errorf("Expected pid %d, got %s", os.Getpid(), contents)
+	}
+
+	RemovePIDFile(path)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected pid file to be removed, got: %v", err)
+	}
+}
+
+func TestWritePIDFile_StaleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "go-dns-update.pid")
+	// A pid that can't belong to a running process
+	if err := os.WriteFile(path, []byte("-1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WritePIDFile(path); err != nil {
+		t.Fatalf("Expected stale pid file to be replaced, got: %v", err)
+	}
+}
+
+func TestRemovePIDFile_Missing(t *testing.T) {
+	// Should quietly do nothing
+	RemovePIDFile(filepath.Join(t.TempDir(), "missing.pid"))
+}
+
+func TestDaemon_WatchStale(t *testing.T) {
+	alerts := make(chan Event, 10)
+	d := &Daemon{
+		Status:     &DaemonStatus{},
+		Events:     NewEventBus(),
+		StaleAfter: time.Hour,
+		Alert:      func(event Event) { alerts <- event },
+	}
+	stop := make(chan struct{})
+	go d.watchStale(stop, time.Now().Add(-2*time.Hour), time.Millisecond)
+	defer close(stop)
+
+	select {
+	case event := <-alerts:
+		if event.Type != EVENT_STALE {
+			t.Errorf("Expected a %v event, got %v", EVENT_STALE, event.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a stale alert")
+	}
+
+	// The same stale spell is only alerted about once
+	select {
+	case event := <-alerts:
+		t.Errorf("Expected a single alert, got another: %v", event.Message)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestDaemon_RunCheckPanic(t *testing.T) {
+	var alerts []Event
+	d := &Daemon{
+		Status: &DaemonStatus{},
+		Events: NewEventBus(),
+		Alert:  func(event Event) { alerts = append(alerts, event) },
+		Check: func() (CheckReport, error) {
+			var records map[string]string
+			records["home.example.com"] = "203.0.113.1"
+			return CheckReport{}, nil
+		},
+	}
+
+	_, err := d.RunCheck()
+	if ErrorCode(err) != E_PANIC {
+		t.Errorf("Expected code %v, got %v", E_PANIC, ErrorCode(err))
+	}
+	if len(alerts) != 1 || alerts[0].Code != E_PANIC {
+		t.Errorf("Expected a single %v alert, got %v", E_PANIC, alerts)
+	}
+	if snapshot := d.Status.Snapshot(); snapshot.LastErrorCode != E_PANIC {
+		t.Errorf("Expected the status to record %v, got %v", E_PANIC, snapshot.LastErrorCode)
+	}
+
+	// The lock is released, so the next check still runs
+	d.Check = func() (CheckReport, error) { return CheckReport{PublicIP: "203.0.113.1"}, nil }
+	if _, err := d.RunCheck(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestDaemon_RunCheckSkipped(t *testing.T) {
+	started := time.Now().Add(-3 * time.Hour)
+	d := &Daemon{
+		Status: &DaemonStatus{ReadyWindow: time.Minute},
+		Events: NewEventBus(),
+		Check: func() (CheckReport, error) {
+			return CheckReport{Skipped: "traffic is leaving through the VPN interface wg0"}, nil
+		},
+	}
+
+	// Skipped checks don't make a daemon that never succeeded ready
+	if _, err := d.RunCheck(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if d.Status.Ready(time.Now()) {
+		t.Error("Expected a skipped check not to make the daemon ready")
+	}
+	if snapshot := d.Status.Snapshot(); snapshot.LastSuccess != nil || snapshot.LastCheck != nil || len(d.Status.History()) != 0 {
+		t.Errorf("Expected a skipped check not to be recorded, got %+v", snapshot)
+	}
+
+	// Nor do they keep one that stopped succeeding from going stale
+	succeeded := started.Add(time.Hour)
+	d.Status.Record(succeeded, CheckReport{PublicIP: "203.0.113.1"}, nil)
+	if _, err := d.RunCheck(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if snapshot := d.Status.Snapshot(); snapshot.LastSuccess == nil || !snapshot.LastSuccess.Equal(succeeded) {
+		t.Errorf("Expected the last success to stay at %v, got %v", succeeded, snapshot.LastSuccess)
+	}
+	if _, stale := d.Status.Stale(time.Now(), started, time.Hour); !stale {
+		t.Error("Expected the daemon to still be stale")
+	}
+	if d.Status.Ready(time.Now()) {
+		t.Error("Expected the daemon to still not be ready")
+	}
+}
+
+// Panics editing the records of one zone, like an unexpected response from the SDK would
+type panickingCloudflare struct {
+	*mockCloudflare
+	zoneID string
+}
+
+func (p panickingCloudflare) EditDNSRecord(zoneID string, recordID string, record dns.RecordParam) (DNSRecord, error) {
+	if zoneID == p.zoneID {
+		panic("unexpected response")
+	}
+	return p.mockCloudflare.EditDNSRecord(zoneID, recordID, record)
+}
+
+func TestRunCheck_PanicInWorker(t *testing.T) {
+	mock := &mockCloudflare{
+		zones: []Zone{{ID: "z1", Name: "example.com"}, {ID: "z2", Name: "example.net"}},
+		records: map[string][]DNSRecord{
+			"z1": {{ID: "r1", ZoneID: "z1", Name: "home.example.com", Type: RECORD_TYPE_A, Content: "198.51.100.1", TTL: TTL_AUTOMATIC}},
+			"z2": {{ID: "r2", ZoneID: "z2", Name: "lab.example.net", Type: RECORD_TYPE_A, Content: "198.51.100.1", TTL: TTL_AUTOMATIC}},
+		},
+	}
+	checker := &Checker{
+		Accounts: []Account{{Client: panickingCloudflare{mockCloudflare: mock, zoneID: "z1"}, Targets: []RecordConfig{{Name: "home.example.com"}, {Name: "lab.example.net"}}}},
+		Pool:     NewWorkerPool(DEFAULT_WORKERS, DEFAULT_ZONE_WORKERS),
+	}
+
+	// The panic fails the record it happened on, the check still returns a report for the rest
+	report, err := checker.RunCheckWithIP("203.0.113.1")
+	if ErrorCode(err) != E_PANIC {
+		t.Errorf("Expected code %v, got %v", E_PANIC, ErrorCode(err))
+	}
+	states := map[string]RecordState{}
+	for _, state := range report.Records {
+		states[state.Name] = state
+	}
+	if state := states["home.example.com"]; state.Code != E_PANIC || state.Changed {
+		t.Errorf("Expected home.example.com to fail with %v, got %+v", E_PANIC, state)
+	}
+	if state := states["lab.example.net"]; !state.Changed || state.IP != "203.0.113.1" {
+		t.Errorf("Expected lab.example.net to be updated, got %+v", state)
+	}
+}
+
+func TestDaemon_ReloadConfig(t *testing.T) {
+	var alerts []Event
+	reloadErr := errors.New("config reload.yaml: record 1 has no name")
+	d := &Daemon{
+		Status: &DaemonStatus{},
+		Events: NewEventBus(),
+		Alert:  func(event Event) { alerts = append(alerts, event) },
+		Reload: func() error { return reloadErr },
+	}
+
+	err := d.ReloadConfig()
+	if !errors.Is(err, reloadErr) || ErrorCode(err) != E_CONFIG {
+		t.Errorf("Expected the reload error with code %v, got %v", E_CONFIG, err)
+	}
+	if len(alerts) != 1 || alerts[0].Code != E_CONFIG {
+		t.Errorf("Expected a single %v alert, got %v", E_CONFIG, alerts)
+	}
+
+	reloadErr = nil
+	if err := d.ReloadConfig(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(alerts) != 1 {
+		t.Errorf("Expected no alert for a successful reload, got %v", alerts[1:])
+	}
+}
+
+func TestDaemon_Backoff(t *testing.T) {
+	daemon := &Daemon{MaxBackoff: time.Hour}
+	tests := []struct {
+		scheduled time.Duration
+		failures  int
+		expected  time.Duration
+	}{
+		{5 * time.Minute, 0, 5 * time.Minute},
+		{5 * time.Minute, 1, 5 * time.Minute},
+		{5 * time.Minute, 2, 10 * time.Minute},
+		{5 * time.Minute, 4, 40 * time.Minute},
+		{5 * time.Minute, 5, time.Hour},
+		{5 * time.Minute, 500, time.Hour},
+		// Schedules already further apart than the cap are left alone
+		{2 * time.Hour, 5, 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		if delay := daemon.Backoff(tt.scheduled, tt.failures); delay != tt.expected {
+			t.Errorf("%v after %d failures: expected %v, got %v", tt.scheduled, tt.failures, tt.expected, delay)
+		}
+	}
+
+	daemon.MaxBackoff = 0
+	if delay := daemon.Backoff(5*time.Minute, 10); delay != 5*time.Minute {
+		t.Errorf("Expected no backing off when disabled, got %v", delay)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/subtle"
+	"embed"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Path the web dashboard is served under
+const DASHBOARD_PATH = "/dashboard"
+
+//go:embed web/dashboard.html
+var dashboardFiles embed.FS
+
+var dashboardTemplate = template.Must(template.ParseFS(dashboardFiles, "web/dashboard.html"))
+
+// Browser friendly view of a running daemon, protected by basic auth using the control token as the password
+// Browsers send the credentials along with requests from any site, so the buttons only work from the dashboard's own pages
+type Dashboard struct {
+	Token  string
+	Daemon *Daemon
+}
+
+// What the dashboard template renders
+type dashboardData struct {
+	Prefix  string
+	Status  StatusSnapshot
+	History []CheckResult
+}
+
+// Method to add the dashboard's routes to the provided mux
+func (d *Dashboard) Register(mux *http.ServeMux) {
+	mux.Handle("GET "+DASHBOARD_PATH, d.authenticate(d.handleIndex))
+	mux.Handle("POST "+DASHBOARD_PATH+"/check", d.authenticate(sameOrigin(d.handleCheck)))
+	mux.Handle("POST "+DASHBOARD_PATH+"/pause", d.authenticate(sameOrigin(d.handlePause)))
+	mux.Handle("POST "+DASHBOARD_PATH+"/resume", d.authenticate(sameOrigin(d.handleResume)))
+	mux.Handle("POST "+DASHBOARD_PATH+"/records/{name}/pause", d.authenticate(sameOrigin(d.handlePauseRecord)))
+	mux.Handle("POST "+DASHBOARD_PATH+"/records/{name}/resume", d.authenticate(sameOrigin(d.handleResumeRecord)))
+}
+
+// Helper method to refuse requests another site's page made the browser send, which would otherwise carry the dashboard's credentials
+// Browsers say where a request came from with Sec-Fetch-Site, older ones only with Origin, scripts and curl send neither and are let through
+func sameOrigin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		site := r.Header.Get("Sec-Fetch-Site")
+		crossSite := site != "" && site != "same-origin" && site != "none"
+		if origin := r.Header.Get("Origin"); site == "" && origin != "" {
+			parsed, err := url.Parse(origin)
+			crossSite = err != nil || parsed.Host != r.Host
+		}
+		if crossSite {
+			http.Error(w, "cross-site request refused", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Helper method to ask the browser for credentials, any username is accepted alongside the control token
+func (d *Dashboard) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, password, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(d.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="go-dns-update"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Handler for GET /dashboard
+func (d *Dashboard) handleIndex(w http.ResponseWriter, r *http.Request) {
+	history := d.Daemon.Status.History()
+	// Newest first reads better in a table
+	slices.Reverse(history)
+	data := dashboardData{Prefix: DASHBOARD_PATH, Status: d.Daemon.Status.Snapshot(), History: history}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		log.Warnf("rendering dashboard failed: %v", err)
+	}
+}
+
+// Handler for the "Check now" button
+func (d *Dashboard) handleCheck(w http.ResponseWriter, r *http.Request) {
+	if d.Daemon.Status.PausedUntil(time.Now()).IsZero() {
+		log.Info("Check requested through the dashboard")
+		d.Daemon.TriggerCheck()
+	}
+	http.Redirect(w, r, DASHBOARD_PATH, http.StatusSeeOther)
+}
+
+// Handler for the "Pause updates" button
+func (d *Dashboard) handlePause(w http.ResponseWriter, r *http.Request) {
+	d.Daemon.Status.Pause(time.Now().Add(DEFAULT_PAUSE_DURATION))
+	log.Info("Updates paused through the dashboard")
+	http.Redirect(w, r, DASHBOARD_PATH, http.StatusSeeOther)
+}
+
+// Handler for the "Resume updates" button
+func (d *Dashboard) handleResume(w http.ResponseWriter, r *http.Request) {
+	d.Daemon.Status.Pause(time.Time{})
+	log.Info("Updates resumed through the dashboard")
+	http.Redirect(w, r, DASHBOARD_PATH, http.StatusSeeOther)
+}
+
+// Handler for a record's "Pause" button, the other records are still updated
+func (d *Dashboard) handlePauseRecord(w http.ResponseWriter, r *http.Request) {
+	d.Daemon.Status.PauseRecord(r.PathValue("name"), time.Now().Add(DEFAULT_PAUSE_DURATION))
+	log.Infof("Updates of %v paused through the dashboard", r.PathValue("name"))
+	http.Redirect(w, r, DASHBOARD_PATH, http.StatusSeeOther)
+}
+
+// Handler for a record's "Resume" button
+func (d *Dashboard) handleResumeRecord(w http.ResponseWriter, r *http.Request) {
+	d.Daemon.Status.PauseRecord(r.PathValue("name"), time.Time{})
+	log.Infof("Updates of %v resumed through the dashboard", r.PathValue("name"))
+	http.Redirect(w, r, DASHBOARD_PATH, http.StatusSeeOther)
+}
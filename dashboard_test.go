@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboard(t *testing.T) {
+	daemon := &Daemon{ControlToken: "secret", Status: &DaemonStatus{}, trigger: make(chan struct{}, 1)}
+	daemon.Status.Record(time.Now(), CheckReport{
+		PublicIP: "203.0.113.42",
+		Records: []RecordState{
+			{Name: "example.com", IP: "203.0.113.42", Wanted: "203.0.113.42", Changed: true},
+			// A record with a source of its own
+			{Name: "vpn.example.com", IP: "10.0.0.1", Wanted: "10.0.0.1"},
+		},
+		PTR: "host-203-0-113-42.isp.example.net",
+	}, nil)
+	handler := daemon.Handler()
+
+	req := httptest.NewRequest(http.MethodGet, DASHBOARD_PATH, nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %d", rec.Code)
+	}
+
+	req.SetBasicAuth("admin", "secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "out of sync") {
+		t.Error("Expected the record with its own source to be in sync with what it detected")
+	}
+	for _, expected := range []string{"example.com", "203.0.113.42", "in sync", "records updated to 203.0.113.42 (host-203-0-113-42.isp.example.net)"} {
+		if !strings.Contains(rec.Body.String(), expected) {
+			t.Errorf("Expected dashboard to contain %q", expected)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodPost, DASHBOARD_PATH+"/pause", nil)
+	req.SetBasicAuth("admin", "secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("Expected redirect back to the dashboard, got %d", rec.Code)
+	}
+	if daemon.Status.PausedUntil(time.Now()).IsZero() {
+		t.Error("Expected updates to be paused")
+	}
+
+	daemon.Status.Pause(time.Time{})
+
+	// Another site's page can't make the browser press the buttons
+	for _, header := range [][2]string{{"Sec-Fetch-Site", "cross-site"}, {"Origin", "https://evil.example"}} {
+		req = httptest.NewRequest(http.MethodPost, DASHBOARD_PATH+"/pause", nil)
+		req.SetBasicAuth("admin", "secret")
+		req.Header.Set(header[0], header[1])
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 with %v: %v, got %d", header[0], header[1], rec.Code)
+		}
+	}
+	if !daemon.Status.PausedUntil(time.Now()).IsZero() {
+		t.Error("Expected updates not to be paused by a cross-site request")
+	}
+
+	// A single record is paused, the others are still updated
+	req = httptest.NewRequest(http.MethodPost, DASHBOARD_PATH+"/records/vpn.example.com/pause", nil)
+	req.SetBasicAuth("admin", "secret")
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther || !daemon.Status.RecordPaused("vpn.example.com", time.Now()) || daemon.Status.RecordPaused("example.com", time.Now()) {
+		t.Errorf("Expected only vpn.example.com to be paused, got %d", rec.Code)
+	}
+	req = httptest.NewRequest(http.MethodGet, DASHBOARD_PATH, nil)
+	req.SetBasicAuth("admin", "secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), "paused until") || !strings.Contains(rec.Body.String(), DASHBOARD_PATH+"/records/vpn.example.com/resume") {
+		t.Error("Expected the dashboard to show vpn.example.com paused")
+	}
+	req = httptest.NewRequest(http.MethodPost, DASHBOARD_PATH+"/records/vpn.example.com/resume", nil)
+	req.SetBasicAuth("admin", "secret")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if daemon.Status.RecordPaused("vpn.example.com", time.Now()) {
+		t.Error("Expected vpn.example.com to be resumed")
+	}
+}
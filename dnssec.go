@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/cloudflare/cloudflare-go/v4/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+// Method to check the DNSSEC status of a zone, returning a warning when validating resolvers may be failing to resolve it
+// A zone without DNSSEC is fine, it's one stuck pending or in error that makes every update pointless for those resolvers
+func CheckDNSSEC(cfClient CloudflareAPI, zone Zone) (string, error) {
+	status, err := cfClient.DNSSECStatus(zone.ID)
+	if err != nil {
+		return "", fmt.Errorf("getting DNSSEC status of %v failed: %w", zone.Name, err)
+	}
+	switch status {
+	case dns.DNSSECStatusPending:
+		return fmt.Sprintf("DNSSEC of %v is pending, check the DS record has been added at the registrar", zone.Name), nil
+	case dns.DNSSECStatusPendingDisabled:
+		return fmt.Sprintf("DNSSEC of %v is being disabled, validating resolvers will fail to resolve it until the DS record is removed at the registrar", zone.Name), nil
+	case dns.DNSSECStatusError:
+		return fmt.Sprintf("DNSSEC of %v is in an error state, validating resolvers may fail to resolve it", zone.Name), nil
+	}
+	return "", nil
+}
+
+// Helper method to check the DNSSEC status of every zone, failing to check one is only logged
+func DNSSECWarnings(cfClient CloudflareAPI, zoneGroups []ZoneGroup) []string {
+	var warnings []string
+	for _, group := range zoneGroups {
+		warning, err := CheckDNSSEC(cfClient, group.Zone)
+		if err != nil {
+			log.Warn(err.Error())
+			continue
+		}
+		if warning != "" {
+			log.Warn(warning)
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDNSSECWarnings(t *testing.T) {
+	statuses := map[string]string{"z1": "active", "z2": "pending", "z3": "disabled", "z4": "error"}
+	cfClient := newTestCloudflareAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		status, ok := statuses[parts[1]]
+		if !ok || len(parts) != 3 || parts[2] != "dnssec" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "errors": []any{}, "messages": []any{}, "result": map[string]any{"status": status}})
+	}))
+
+	var groups []ZoneGroup
+	for _, zone := range []Zone{{ID: "z1", Name: "a.com"}, {ID: "z2", Name: "b.com"}, {ID: "z3", Name: "c.com"}, {ID: "z4", Name: "d.com"}, {ID: "z5", Name: "e.com"}} {
+		groups = append(groups, ZoneGroup{Zone: zone})
+	}
+	warnings := DNSSECWarnings(cfClient, groups)
+	if len(warnings) != 2 || !strings.HasPrefix(warnings[0], "DNSSEC of b.com is pending") || !strings.HasPrefix(warnings[1], "DNSSEC of d.com is in an error state") {
+		t.Errorf("Expected warnings for the pending and failing zones only, got %v", warnings)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Keys a line of the domains file may override, those of a config file's records that fit on one line
+var DOMAINS_FILE_KEYS = []string{"www", "type", "ip", "target", "ttl", "proxied", "wwwProxied", "source", "notify", "zoneID"}
+
+// Method to read a domains file, one record name per line optionally followed by key=value overrides, e.g. "nas.lab.example.com www ttl=300 proxied=false"
+// A key without a value, e.g. www, is set to true, notify takes a comma separated list, and lines starting with # are skipped
+// The records are checked as the config's would be, sources and notifiers referring to those of the config, and every problem is reported with its line
+func LoadDomainsFile(path string, config Config) ([]RecordConfig, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading domains file failed: %w", err)
+	}
+	records, err := ParseDomainsFile(string(contents), config)
+	if err != nil {
+		return nil, fmt.Errorf("domains file %v: %w", path, err)
+	}
+	return records, nil
+}
+
+// Method to parse the contents of a domains file
+// Each line is turned into a record of a config file, so it's decoded and validated the same way and problems are found on the line they're on
+func ParseDomainsFile(contents string, config Config) ([]RecordConfig, error) {
+	problems := &configProblems{errs: &ConfigErrors{}}
+	list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for i, line := range strings.Split(contents, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		scalar := func(value string) *yaml.Node {
+			return &yaml.Node{Kind: yaml.ScalarNode, Value: value, Line: i + 1}
+		}
+		record := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: i + 1, Content: []*yaml.Node{scalar("name"), scalar(fields[0])}}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				value = "true"
+			}
+			if !slices.Contains(DOMAINS_FILE_KEYS, key) {
+				problems.addAt(record, fmt.Errorf("record %v: unknown key %q, expected one of %v", fields[0], key, strings.Join(DOMAINS_FILE_KEYS, ", "))).decoding = true
+				continue
+			}
+			valueNode := scalar(value)
+			if key == "notify" {
+				valueNode = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: i + 1}
+				for _, notifier := range strings.Split(value, ",") {
+					valueNode.Content = append(valueNode.Content, scalar(notifier))
+				}
+			}
+			record.Content = append(record.Content, scalar(key), valueNode)
+		}
+		list.Content = append(list.Content, record)
+	}
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: "records"}, list}}
+
+	var decoded struct {
+		Records []RecordConfig `yaml:"records"`
+	}
+	var typeErr *yaml.TypeError
+	if err := root.Decode(&decoded); errors.As(err, &typeErr) {
+		for _, message := range typeErr.Errors {
+			problems.addDecoding("", message)
+		}
+	}
+	problems.root = root
+	normalizeRecordNames(problems.within("", "records"), decoded.Records)
+	config.validateRecords(problems.within("", "records"), decoded.Records)
+	for i, record := range decoded.Records {
+		if record.Name != "" && slices.ContainsFunc(config.Records, func(listed RecordConfig) bool { return listed.key() == record.key() }) {
+			problems.within("", "records").add(fmt.Errorf("record %v is listed in the config already", record.Name), i, "name")
+		}
+	}
+	if err := problems.err(); err != nil {
+		return nil, err
+	}
+	return decoded.Records, nil
+}
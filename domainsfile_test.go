@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDomainsFile(t *testing.T) {
+	records, err := ParseDomainsFile(`
+# Generated by the lab inventory
+nas.lab.example.com
+grafana.lab.example.com www ttl=300 proxied=false
+mail.lab.example.com type=AAAA notify=ops,oncall
+`, Config{Notifiers: map[string]NotifierConfig{"ops": {Webhook: "https://hooks.example.com/ops"}, "oncall": {Webhook: "https://hooks.example.com/oncall"}}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+	if records[0].Name != "nas.lab.example.com" || records[0].WWW || records[0].TTL != 0 || records[0].Proxied != nil {
+		t.Errorf("Expected a plain record, got %+v", records[0])
+	}
+	if !records[1].WWW || records[1].TTL != 300 || records[1].Proxied == nil || *records[1].Proxied {
+		t.Errorf("Expected the overrides applied, got %+v", records[1])
+	}
+	if records[2].RecordType() != RECORD_TYPE_AAAA || strings.Join(records[2].Notify, ",") != "ops,oncall" {
+		t.Errorf("Expected an AAAA record notifying ops and oncall, got %+v", records[2])
+	}
+
+	tests := []struct {
+		name     string
+		contents string
+		config   Config
+		expected string
+	}{
+		{"Unknown Key", "a.example.com\nb.example.com colour=blue\n", Config{}, "line 2: record b.example.com: unknown key \"colour\""},
+		{"Wrong Type", "a.example.com ttl=soon\n", Config{}, "line 1: cannot unmarshal !!str `soon` into int"},
+		{"Invalid Record", "a.example.com\na.example.com type=CNAME\n", Config{}, "line 2: record a.example.com: CNAME records need a target"},
+		{"Listed Twice", "a.example.com\n\na.example.com\n", Config{}, "line 3: record a.example.com is listed more than once"},
+		{"Listed In Config", "a.example.com\n", Config{Records: []RecordConfig{{Name: "A.example.com"}}}, "line 1: record a.example.com is listed in the config already"},
+		{"Unknown Notifier", "a.example.com notify=ops\n", Config{}, "line 1: record a.example.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseDomainsFile(test.contents, test.config)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("Expected an error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestLoadDomainsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.txt")
+	if err := os.WriteFile(path, []byte("a.example.com\nb.example.com ttl=-5\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err := LoadDomainsFile(path, Config{})
+	if err == nil || !strings.HasPrefix(err.Error(), "domains file "+path+": line 2: ") {
+		t.Errorf("Expected the problem reported with the file and line, got %v", err)
+	}
+	if _, err := LoadDomainsFile(filepath.Join(t.TempDir(), "missing.txt"), Config{}); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Path routers send dyndns2 update requests to
+const DYNDNS_UPDATE_PATH = "/nic/update"
+
+// Accepts dyndns2 protocol update requests (as sent by most consumer routers) and applies them to Cloudflare
+type DyndnsServer struct {
+	// Basic auth credentials the router must present
+	Username string
+	Password string
+	// Only hostnames within this domain can be updated
+	DomainName string
+	// Points the hostname's A record at the IP address, reporting whether anything changed
+	Update func(hostname string, ip string) (bool, error)
+}
+
+// Handles GET /nic/update?hostname=home.example.com&myip=203.0.113.42
+// Responds with the standard dyndns2 return codes, one line per requested hostname
+func (s *DyndnsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	username, password, ok := r.BasicAuth()
+	if !ok || subtle.ConstantTimeCompare([]byte(username), []byte(s.Username)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(password), []byte(s.Password)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="go-dns-update"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, "badauth")
+		return
+	}
+
+	hostnames := r.URL.Query().Get("hostname")
+	if hostnames == "" {
+		fmt.Fprintln(w, "notfqdn")
+		return
+	}
+
+	// Routers usually send their WAN address, fall back to the address the request came from like other dyndns2 services do
+	myIP := r.URL.Query().Get("myip")
+	if myIP == "" {
+		myIP, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+	ip, err := netip.ParseAddr(myIP)
+	if err != nil || !ip.Is4() {
+		// Only A records are managed, so anything but an IPv4 address can't be applied
+		log.Warnf("dyndns2 request with unusable address %q", myIP)
+		fmt.Fprintln(w, "911")
+		return
+	}
+
+	for _, hostname := range strings.Split(hostnames, ",") {
+		fmt.Fprintln(w, s.updateHostname(strings.TrimSpace(hostname), ip.String()))
+	}
+}
+
+// Helper method to apply a single hostname's update and turn the outcome into a dyndns2 return code
+func (s *DyndnsServer) updateHostname(hostname string, ip string) string {
+	hostname, err := NormalizeName(hostname)
+	if err != nil || !strings.Contains(hostname, ".") {
+		return "notfqdn"
+	}
+	if hostname != s.DomainName && !strings.HasSuffix(hostname, "."+s.DomainName) {
+		return "nohost"
+	}
+	changed, err := s.Update(hostname, ip)
+	if err != nil {
+		log.Errorf("dyndns2 update of %v failed: %v", DisplayName(hostname), err)
+		return "911"
+	}
+	if !changed {
+		return "nochg " + ip
+	}
+	log.Infof("dyndns2 update pointed %v at %v", DisplayName(hostname), ip)
+	return "good " + ip
+}
+
+// Method to serve dyndns2 update requests until the process receives SIGINT or SIGTERM
+func RunDyndnsServer(addr string, dyndns *DyndnsServer) error {
+	mux := http.NewServeMux()
+	mux.Handle(DYNDNS_UPDATE_PATH, dyndns)
+	server, err := StartHTTPServer(addr, mux)
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	sig := <-stop
+	log.Infof("Received %v, shutting down", sig)
+	return nil
+}
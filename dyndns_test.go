@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDyndnsServer(t *testing.T) {
+	current := map[string]string{
+		"example.com":      "198.51.100.1",
+		"home.example.com": "203.0.113.42",
+	}
+	server := &DyndnsServer{
+		Username:   "router",
+		Password:   "hunter2",
+		DomainName: "example.com",
+		Update: func(hostname string, ip string) (bool, error) {
+			existing, ok := current[hostname]
+			if !ok {
+				return false, errors.New("couldn't obtain A Record ID")
+			}
+			return existing != ip, nil
+		},
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		username string
+		password string
+		expected string
+		code     int
+	}{
+		{"Bad Auth", "hostname=home.example.com&myip=203.0.113.42", "router", "wrong", "badauth\n", http.StatusUnauthorized},
+		{"No Change", "hostname=home.example.com&myip=203.0.113.42", "router", "hunter2", "nochg 203.0.113.42\n", http.StatusOK},
+		{"Good", "hostname=example.com&myip=203.0.113.42", "router", "hunter2", "good 203.0.113.42\n", http.StatusOK},
+		{"Multiple Hosts", "hostname=example.com,home.example.com&myip=203.0.113.42", "router", "hunter2", "good 203.0.113.42\nnochg 203.0.113.42\n", http.StatusOK},
+		{"Remote Address", "hostname=example.com", "router", "hunter2", "good 192.0.2.1\n", http.StatusOK},
+		{"Other Domain", "hostname=example.net&myip=203.0.113.42", "router", "hunter2", "nohost\n", http.StatusOK},
+		{"Missing Hostname", "myip=203.0.113.42", "router", "hunter2", "notfqdn\n", http.StatusOK},
+		{"IPv6", "hostname=example.com&myip=2001:db8::1", "router", "hunter2", "911\n", http.StatusOK},
+		{"Update Failure", "hostname=missing.example.com&myip=203.0.113.42", "router", "hunter2", "911\n", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, DYNDNS_UPDATE_PATH+"?"+tt.query, nil)
+			req.SetBasicAuth(tt.username, tt.password)
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+			if rec.Code != tt.code {
+				t.Errorf("Expected status %d, got %d", tt.code, rec.Code)
+			}
+			if rec.Body.String() != tt.expected {
+				t.Errorf("Expected body %q, got %q", tt.expected, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// Environment variable holding an age identity to decrypt the config with, e.g. AGE-SECRET-KEY-1...
+const AGE_KEY_ENV = ENV_FLAG_PREFIX + "AGE_KEY"
+
+// How files encrypted with age start, binary and ASCII armored
+const AGE_HEADER = "age-encryption.org/v1"
+const AGE_ARMOR_HEADER = armor.Header
+
+// Method to gather the age identities the config may be encrypted to, those in the identity file (as written by age-keygen) and the one in AGE_KEY_ENV
+// Neither being given is fine, an encrypted config then fails to load
+func LoadAgeIdentities(path string) ([]age.Identity, error) {
+	var identities []age.Identity
+	if path != "" {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading age identity file failed: %w", err)
+		}
+		parsed, err := age.ParseIdentities(bytes.NewReader(contents))
+		if err != nil {
+			return nil, fmt.Errorf("age identity file %v: %w", path, err)
+		}
+		identities = append(identities, parsed...)
+	}
+	if key := strings.TrimSpace(os.Getenv(AGE_KEY_ENV)); key != "" {
+		parsed, err := age.ParseIdentities(strings.NewReader(key))
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", AGE_KEY_ENV, err)
+		}
+		identities = append(identities, parsed...)
+	}
+	return identities, nil
+}
+
+// Helper method to report whether the contents are encrypted with age, binary or ASCII armored
+func IsAgeEncrypted(contents []byte) bool {
+	trimmed := bytes.TrimLeft(contents, " \t\r\n")
+	return bytes.HasPrefix(trimmed, []byte(AGE_HEADER)) || bytes.HasPrefix(trimmed, []byte(AGE_ARMOR_HEADER))
+}
+
+// Method to decrypt a config encrypted with age, anything else is returned as is
+// sops keeps the keys in the clear and only encrypts the values, which isn't supported, so such files are refused rather than read with encrypted tokens
+func DecryptConfig(contents []byte, identities []age.Identity) ([]byte, error) {
+	if bytes.Contains(contents, []byte("ENC[AES256_GCM,")) {
+		return nil, fmt.Errorf("values encrypted with sops aren't supported, encrypt the whole file with age instead")
+	}
+	if !IsAgeEncrypted(contents) {
+		return contents, nil
+	}
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("encrypted with age, give the identity to decrypt it with -ageIdentity or %v", AGE_KEY_ENV)
+	}
+	var src io.Reader = bytes.NewReader(contents)
+	if bytes.HasPrefix(bytes.TrimLeft(contents, " \t\r\n"), []byte(AGE_ARMOR_HEADER)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimLeft(contents, " \t\r\n")))
+	}
+	decrypted, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting failed: %w", err)
+	}
+	plain, err := io.ReadAll(decrypted)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting failed: %w", err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// Helper method to encrypt the contents to the identity's recipient, ASCII armored when asked
+func encryptForTest(t *testing.T, identity *age.X25519Identity, contents string, armored bool) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	var dst io.Writer = &out
+	var armorWriter io.WriteCloser
+	if armored {
+		armorWriter = armor.NewWriter(&out)
+		dst = armorWriter
+	}
+	w, err := age.Encrypt(dst, identity.Recipient())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	io.WriteString(w, contents)
+	w.Close()
+	if armorWriter != nil {
+		armorWriter.Close()
+	}
+	return out.Bytes()
+}
+
+func TestLoadConfig_Encrypted(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dir := t.TempDir()
+	identityPath := filepath.Join(dir, "key.txt")
+	os.WriteFile(identityPath, []byte("# created: 2026-10-17T00:00:00Z\n"+identity.String()+"\n"), 0600)
+	identities, err := LoadAgeIdentities(identityPath)
+	if err != nil || len(identities) != 1 {
+		t.Fatalf("Expected 1 identity, got %v, %v", identities, err)
+	}
+
+	plain := "token: secret-token\nrecords:\n  - name: home.example.com\n"
+	for _, armored := range []bool{false, true} {
+		path := filepath.Join(dir, "config.yaml.age")
+		os.WriteFile(path, encryptForTest(t, identity, plain, armored), 0600)
+		config, err := LoadConfigs([]string{path}, identities)
+		if err != nil {
+			t.Fatalf("Armored %v: unexpected error: %v", armored, err)
+		}
+		if config.Token != "secret-token" || len(config.Records) != 1 {
+			t.Errorf("Armored %v: unexpected config %+v", armored, config)
+		}
+		if _, err := LoadConfigs([]string{path}, nil); err == nil || !strings.Contains(err.Error(), AGE_KEY_ENV) {
+			t.Errorf("Armored %v: expected error asking for an identity, got %v", armored, err)
+		}
+	}
+
+	// The identity from the environment works as well, another one doesn't
+	other, _ := age.GenerateX25519Identity()
+	t.Setenv(AGE_KEY_ENV, other.String())
+	identities, err = LoadAgeIdentities("")
+	if err != nil || len(identities) != 1 {
+		t.Fatalf("Expected the identity from the environment, got %v, %v", identities, err)
+	}
+	if _, err := LoadConfigs([]string{filepath.Join(dir, "config.yaml.age")}, identities); err == nil || !strings.Contains(err.Error(), "decrypting failed") {
+		t.Errorf("Expected decrypting with another identity to fail, got %v", err)
+	}
+}
+
+func TestDecryptConfig(t *testing.T) {
+	plain := []byte("token: a\n")
+	if contents, err := DecryptConfig(plain, nil); err != nil || !bytes.Equal(contents, plain) {
+		t.Errorf("Expected a plain config as is, got %q, %v", contents, err)
+	}
+	sops := []byte("token: ENC[AES256_GCM,data:abc=,iv:def=,tag:ghi=,type:str]\nsops:\n  version: 3.9.0\n")
+	if _, err := DecryptConfig(sops, nil); err == nil || !strings.Contains(err.Error(), "sops") {
+		t.Errorf("Expected sops values to be refused, got %v", err)
+	}
+}
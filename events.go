@@ -0,0 +1,67 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published by the daemon
+const EVENT_CHANGE = "change"
+const EVENT_ERROR = "error"
+const EVENT_WARNING = "warning"
+const EVENT_STALE = "stale"
+
+// Sent to the notification channels once checks succeed again after failing
+const EVENT_RECOVERED = "recovered"
+
+// How many events a slow subscriber can fall behind by before further events are dropped for it
+const EVENT_BUFFER_SIZE = 16
+
+// Something noteworthy that happened while the daemon was running
+type Event struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	// Code of the failure for error and stale events, e.g. E_ZONE_NOT_FOUND
+	Code string `json:"code,omitempty"`
+	// ID of the check the event came out of, to find its log lines by
+	CheckID string `json:"checkId,omitempty"`
+}
+
+// Fans out published events to every current subscriber
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[chan Event]struct{})}
+}
+
+// Method to start receiving events, the returned function must be called to stop
+func (b *EventBus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, EVENT_BUFFER_SIZE)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Method to send an event to all subscribers without ever blocking the daemon on a slow one
+func (b *EventBus) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
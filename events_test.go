@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	first, cancelFirst := bus.Subscribe()
+	second, cancelSecond := bus.Subscribe()
+	defer cancelSecond()
+
+	event := Event{Type: EVENT_CHANGE, Time: time.Now(), Message: "updated"}
+	bus.Publish(event)
+	for _, ch := range []<-chan Event{first, second} {
+		if got := <-ch; got != event {
+			t.Errorf("Expected %v, got %v", event, got)
+		}
+	}
+
+	// Cancelled subscribers stop receiving, and cancelling twice is harmless
+	cancelFirst()
+	cancelFirst()
+	if _, ok := <-first; ok {
+		t.Error("Expected channel to be closed after cancelling")
+	}
+
+	// A full subscriber must not block publishing
+	for i := 0; i < EVENT_BUFFER_SIZE+5; i++ {
+		bus.Publish(event)
+	}
+	if len(second) != EVENT_BUFFER_SIZE {
+		t.Errorf("Expected %d buffered events, got %d", EVENT_BUFFER_SIZE, len(second))
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Method to write the records of the zone holding domainName to out in BIND zone file format
+// Cloudflare's export endpoint does the formatting, so every record type and setting comes out the way the dashboard exports it
+func ExportZone(cfClient CloudflareAPI, domainName string, out io.Writer) error {
+	zoneID, err := GetZoneID(cfClient, domainName)
+	if err != nil {
+		return err
+	}
+	zoneFile, err := cfClient.ExportDNSRecords(zoneID)
+	if err != nil {
+		return fmt.Errorf("exporting zone failed: %w", err)
+	}
+	if _, err := io.WriteString(out, zoneFile); err != nil {
+		return fmt.Errorf("writing zone file failed: %w", err)
+	}
+	return nil
+}
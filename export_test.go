@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExportZone(t *testing.T) {
+	const zoneFile = ";; Domain:     example.com.\nexample.com.\t1\tIN\tA\t203.0.113.1\n"
+	fake := &fakeCloudflare{zones: []map[string]any{{"id": "z1", "name": "example.com"}}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /zones/z1/dns_records/export", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(zoneFile))
+	})
+	mux.Handle("/", fake)
+	cfClient := newTestCloudflareAPI(t, mux)
+
+	var out strings.Builder
+	if err := ExportZone(cfClient, "www.example.com", &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if out.String() != zoneFile {
+		t.Errorf("Expected the exported zone file, got %q", out.String())
+	}
+	if err := ExportZone(cfClient, "example.org", &out); err == nil {
+		t.Error("Expected error for a domain in no zone but got none")
+	}
+}
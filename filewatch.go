@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// How often watched files are checked for changes, cheap enough for small routers
+const FILE_WATCH_POLL_INTERVAL = 2 * time.Second
+
+// Method to build a Watcher triggering a check whenever the file at path is written, created or removed
+// Meant for DHCP lease files and pppd status files which get rewritten when the WAN address changes
+func FileWatcher(path string, pollInterval time.Duration) Watcher {
+	return FilesWatcher([]string{path}, pollInterval)
+}
+
+// Method to build a Watcher triggering once whenever any of the files at paths is written, created or removed
+func FilesWatcher(paths []string, pollInterval time.Duration) Watcher {
+	return func(stop <-chan struct{}, trigger func()) error {
+		log.Infof("Watching %v for changes", strings.Join(paths, ", "))
+		last := make([]fileState, len(paths))
+		for i, path := range paths {
+			last[i] = statFile(path)
+		}
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return nil
+			case <-ticker.C:
+			}
+			changed := false
+			for i, path := range paths {
+				if current := statFile(path); current != last[i] {
+					last[i] = current
+					log.Infof("%v changed", path)
+					changed = true
+				}
+			}
+			if changed {
+				trigger()
+			}
+		}
+	}
+}
+
+// Enough of a file's metadata to notice it being rewritten
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// Helper method to snapshot the state of the file at path
+func statFile(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
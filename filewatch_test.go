@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dhcp.leases")
+	triggered := make(chan struct{}, 10)
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- FileWatcher(path, 10*time.Millisecond)(stop, func() { triggered <- struct{}{} })
+	}()
+
+	expectTrigger := func(action string) {
+		t.Helper()
+		select {
+		case <-triggered:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected a trigger after the file was %v", action)
+		}
+	}
+
+	// Give the watcher a moment to take its initial snapshot of the missing file
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("lease 203.0.113.42"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectTrigger("created")
+
+	if err := os.WriteFile(path, []byte("lease 198.51.100.7 renewed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectTrigger("rewritten")
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	expectTrigger("removed")
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Service looking up where an address is, queried as <endpoint>/<ip>/json
+const GEO_SERVICE_ENDPOINT = "https://ipinfo.io"
+
+// Modes of the geoCheck flag
+const GEO_CHECK_WARN = "warn"
+const GEO_CHECK_BLOCK = "block"
+
+// Where an address is, as reported by the geo service
+type GeoInfo struct {
+	// Two letter country code, e.g. NL
+	Country string `json:"country"`
+	// Network the address belongs to, e.g. "AS1136 KPN B.V."
+	Org string `json:"org"`
+}
+
+// Method to get the AS number of the network, e.g. AS1136
+func (g GeoInfo) ASN() string {
+	asn, _, _ := strings.Cut(g.Org, " ")
+	return asn
+}
+
+func (g GeoInfo) String() string {
+	return fmt.Sprintf("%v, %v", g.Country, g.ASN())
+}
+
+// Looks up where addresses are with the geo service, remembering the answers
+type GeoLookup struct {
+	Endpoint string
+	Client   *http.Client
+	mu       sync.Mutex
+	lookups  map[string]GeoInfo
+}
+
+// Checks an address change stays in the same country and network
+// A change to somewhere else entirely is a strong sign detection went through a VPN or a hijacked endpoint
+type GeoGuard struct {
+	*GeoLookup
+	// Refuse changes failing the check rather than only warning about them
+	Block bool
+	// Addresses changes to are never checked, e.g. the failover address
+	Trusted []string
+}
+
+// Method to look up where an address is, each address is only looked up once
+func (g *GeoLookup) Lookup(ip string) (GeoInfo, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if info, ok := g.lookups[ip]; ok {
+		return info, nil
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, strings.TrimSuffix(g.Endpoint, "/")+"/"+ip+"/json", nil)
+	if err != nil {
+		return GeoInfo{}, fmt.Errorf("request creation failed: %w", err)
+	}
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return GeoInfo{}, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return GeoInfo{}, fmt.Errorf("server returned status: %d", resp.StatusCode)
+	}
+	var info GeoInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return GeoInfo{}, fmt.Errorf("parsing response failed: %w", err)
+	}
+	if g.lookups == nil {
+		g.lookups = map[string]GeoInfo{}
+	}
+	g.lookups[ip] = info
+	return info, nil
+}
+
+// Method to check a record moving from previous to current stays in the same country and network
+// Only errors when blocking, a failing lookup never holds up the change
+func (g *GeoGuard) Check(name string, previous string, current string) error {
+	if g == nil || slices.Contains(g.Trusted, current) || !isPublicAddress(previous) || !isPublicAddress(current) {
+		return nil
+	}
+	before, err := g.Lookup(previous)
+	if err != nil {
+		log.Warnf("Looking up where %v is failed, not checking the change of %v: %v", previous, name, err)
+		return nil
+	}
+	after, err := g.Lookup(current)
+	if err != nil {
+		log.Warnf("Looking up where %v is failed, not checking the change of %v: %v", current, name, err)
+		return nil
+	}
+	if before.Country == after.Country && before.ASN() == after.ASN() {
+		return nil
+	}
+	if g.Block {
+		return WithCode(E_GEO_BLOCKED, fmt.Errorf("refusing to move %v from %v (%v) to %v (%v), run with -force if the change is expected", name, previous, before, current, after))
+	}
+	log.Warnf("%v moves from %v (%v) to %v (%v), check the detection didn't go through a VPN", name, previous, before, current, after)
+	return nil
+}
+
+// Method to describe the network an address belongs to, e.g. "AS7922 Comcast Cable Communications, LLC"
+// Empty for addresses the geo service can't tell anything about
+func (g *GeoLookup) Network(ip string) string {
+	if g == nil || !isPublicAddress(ip) {
+		return ""
+	}
+	info, err := g.Lookup(ip)
+	if err != nil {
+		log.Warnf("Looking up the network of %v failed: %v", ip, err)
+		return ""
+	}
+	return info.Org
+}
+
+// Helper method to report whether an address is a public one the geo service knows about
+func isPublicAddress(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Helper method to serve lookups the way ipinfo.io does, counting them
+func newGeoServer(t *testing.T, infos map[string]GeoInfo, lookups *int) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*lookups++
+		ip := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/json")
+		info, ok := infos[ip]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(info)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestGeoGuard_Check(t *testing.T) {
+	lookups := 0
+	ts := newGeoServer(t, map[string]GeoInfo{
+		"203.0.113.1":  {Country: "NL", Org: "AS1136 KPN B.V."},
+		"203.0.113.2":  {Country: "NL", Org: "AS1136 KPN B.V."},
+		"198.51.100.7": {Country: "US", Org: "AS9009 M247 Europe SRL"},
+	}, &lookups)
+	warn := &GeoGuard{GeoLookup: &GeoLookup{Endpoint: ts.URL, Client: ts.Client()}}
+	block := &GeoGuard{GeoLookup: &GeoLookup{Endpoint: ts.URL, Client: ts.Client()}, Block: true, Trusted: []string{"192.0.2.50"}}
+
+	if err := block.Check("example.com", "203.0.113.1", "203.0.113.2"); err != nil {
+		t.Errorf("Expected a change within the network to pass, got %v", err)
+	}
+	err := block.Check("example.com", "203.0.113.1", "198.51.100.7")
+	if err == nil || !strings.Contains(err.Error(), "(NL, AS1136) to 198.51.100.7 (US, AS9009)") {
+		t.Errorf("Expected the change to another country to be refused, got %v", err)
+	}
+	if lookups != 3 {
+		t.Errorf("Expected each address to be looked up once, got %d lookups", lookups)
+	}
+	if err := warn.Check("example.com", "203.0.113.1", "198.51.100.7"); err != nil {
+		t.Errorf("Expected only a warning, got %v", err)
+	}
+	// Trusted and private addresses, and failing lookups, never hold up a change
+	for _, ip := range []string{"192.0.2.50", "10.0.0.2", "203.0.113.99"} {
+		if err := block.Check("example.com", "203.0.113.1", ip); err != nil {
+			t.Errorf("Expected the change to %v to pass, got %v", ip, err)
+		}
+	}
+	var disabled *GeoGuard
+	if err := disabled.Check("example.com", "203.0.113.1", "198.51.100.7"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestUpdateZones_GeoBlock(t *testing.T) {
+	lookups := 0
+	ts := newGeoServer(t, map[string]GeoInfo{
+		"203.0.113.1":  {Country: "NL", Org: "AS1136 KPN B.V."},
+		"198.51.100.7": {Country: "US", Org: "AS9009 M247 Europe SRL"},
+	}, &lookups)
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+				{"id": "r2", "name": "static.example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+			},
+		},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+
+	targets := []RecordConfig{{Name: "example.com"}, {Name: "static.example.com", IP: "198.51.100.7"}}
+	groups, err := ResolveZones(cfClient, targets)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	options := RecordOptions{Geo: &GeoGuard{GeoLookup: &GeoLookup{Endpoint: ts.URL, Client: ts.Client()}, Block: true}}
+	states, err := UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, options, nil)
+	if err == nil || !strings.Contains(states[0].Error, "refusing to move example.com") {
+		t.Errorf("Expected the change to be refused, got %v", states)
+	}
+	if fake.records["z1"][0]["content"] != "203.0.113.1" || fake.records["z1"][1]["content"] != "198.51.100.7" {
+		t.Errorf("Expected only the pinned record to change, got %v", fake.records["z1"])
+	}
+}
+
+func TestGeoLookup_Network(t *testing.T) {
+	lookups := 0
+	ts := newGeoServer(t, map[string]GeoInfo{"198.51.100.7": {Country: "US", Org: "AS7922 Comcast Cable Communications, LLC"}}, &lookups)
+	geo := &GeoLookup{Endpoint: ts.URL, Client: ts.Client()}
+
+	if network := geo.Network("198.51.100.7"); network != "AS7922 Comcast Cable Communications, LLC" {
+		t.Errorf("Expected the address's network, got %q", network)
+	}
+	if network := geo.Network("198.51.100.8"); network != "" {
+		t.Errorf("Expected nothing for an unknown address, got %q", network)
+	}
+	if network := geo.Network("192.168.1.10"); network != "" || lookups != 2 {
+		t.Errorf("Expected private addresses not to be looked up, got %q after %d lookups", network, lookups)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	dnsupdatepb "github.com/TheSilverBulet/go-dns-update/proto"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//go:generate protoc -I proto --go_out=proto --go_opt=paths=source_relative --go-grpc_out=proto --go-grpc_opt=paths=source_relative proto/dnsupdate.proto
+
+// Implementation of the DNSUpdate gRPC service defined in proto/dnsupdate.proto
+type GRPCService struct {
+	dnsupdatepb.UnimplementedDNSUpdateServer
+	Daemon *Daemon
+}
+
+// Runs a check right away and waits for the outcome
+// A failed check is reported in the response rather than as an RPC error
+func (s *GRPCService) Sync(ctx context.Context, req *dnsupdatepb.SyncRequest) (*dnsupdatepb.SyncResponse, error) {
+	if pausedUntil := s.Daemon.Status.PausedUntil(time.Now()); !pausedUntil.IsZero() {
+		return nil, status.Errorf(codes.FailedPrecondition, "updates are paused until %v", pausedUntil)
+	}
+	log.Info("Check requested through the gRPC API")
+	report, err := s.Daemon.RunCheck()
+	resp := &dnsupdatepb.SyncResponse{Time: timestamppb.Now(), Changed: report.Changed()}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp, nil
+}
+
+// Streams events until the client goes away
+func (s *GRPCService) WatchEvents(req *dnsupdatepb.WatchEventsRequest, stream grpc.ServerStreamingServer[dnsupdatepb.Event]) error {
+	events, cancel := s.Daemon.Events.Subscribe()
+	defer cancel()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-events:
+			if err := stream.Send(EventToProto(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Helper method to convert a daemon Event to its protobuf form
+func EventToProto(event Event) *dnsupdatepb.Event {
+	eventType := dnsupdatepb.EventType_EVENT_TYPE_UNSPECIFIED
+	switch event.Type {
+	case EVENT_CHANGE:
+		eventType = dnsupdatepb.EventType_EVENT_TYPE_CHANGE
+	case EVENT_ERROR, EVENT_STALE:
+		eventType = dnsupdatepb.EventType_EVENT_TYPE_ERROR
+	case EVENT_WARNING:
+		eventType = dnsupdatepb.EventType_EVENT_TYPE_WARNING
+	}
+	return &dnsupdatepb.Event{Type: eventType, Time: timestamppb.New(event.Time), Message: event.Message, Code: event.Code, CheckId: event.CheckID}
+}
+
+// Helper method to start serving the gRPC API in the background
+func StartGRPCServer(addr string, daemon *Daemon) (*grpc.Server, error) {
+	if daemon.ControlToken == "" {
+		return nil, fmt.Errorf("the gRPC API requires a control token")
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("grpc server failed to listen: %w", err)
+	}
+	server := NewGRPCServer(daemon)
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.Errorf("grpc server stopped: %v", err)
+		}
+	}()
+	log.Infof("Serving gRPC API on %v", listener.Addr())
+	return server, nil
+}
+
+// Helper method to build a gRPC server with the DNSUpdate service registered behind token authentication
+func NewGRPCServer(daemon *Daemon) *grpc.Server {
+	authenticate := func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, value := range md.Get("authorization") {
+			token, found := strings.CutPrefix(value, "Bearer ")
+			if found && subtle.ConstantTimeCompare([]byte(token), []byte(daemon.ControlToken)) == 1 {
+				return nil
+			}
+		}
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := authenticate(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := authenticate(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+	dnsupdatepb.RegisterDNSUpdateServer(server, &GRPCService{Daemon: daemon})
+	return server
+}
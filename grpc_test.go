@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	dnsupdatepb "github.com/TheSilverBulet/go-dns-update/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestGRPCClient(t *testing.T, daemon *Daemon) dnsupdatepb.DNSUpdateClient {
+	t.Helper()
+	listener := bufconn.Listen(1024 * 1024)
+	server := NewGRPCServer(daemon)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return dnsupdatepb.NewDNSUpdateClient(conn)
+}
+
+func TestGRPCService_Unauthenticated(t *testing.T) {
+	daemon := &Daemon{ControlToken: "secret", Status: &DaemonStatus{}, Events: NewEventBus()}
+	client := newTestGRPCClient(t, daemon)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer wrong")
+	_, err := client.Sync(ctx, &dnsupdatepb.SyncRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated, got: %v", err)
+	}
+}
+
+func TestGRPCService_SyncAndWatch(t *testing.T) {
+	checkErr := errors.New("could not retrieve initial values")
+	daemon := &Daemon{
+		ControlToken: "secret",
+		Status:       &DaemonStatus{},
+		Events:       NewEventBus(),
+		Check:        func() (CheckReport, error) { return CheckReport{}, checkErr },
+	}
+	client := newTestGRPCClient(t, daemon)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+
+	stream, err := client.WatchEvents(ctx, &dnsupdatepb.WatchEventsRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Wait for the subscription to be in place before syncing
+	for {
+		daemon.Events.mu.Lock()
+		subscribed := len(daemon.Events.subscribers) > 0
+		daemon.Events.mu.Unlock()
+		if subscribed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resp, err := client.Sync(ctx, &dnsupdatepb.SyncRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.Changed || resp.Error != checkErr.Error() {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if event.Type != dnsupdatepb.EventType_EVENT_TYPE_ERROR || event.Message != checkErr.Error() {
+		t.Errorf("Unexpected event: %v", event)
+	}
+}
+
+func TestEventToProto(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		event    Event
+		expected dnsupdatepb.EventType
+	}{
+		{Event{Type: EVENT_CHANGE, Time: now}, dnsupdatepb.EventType_EVENT_TYPE_CHANGE},
+		{Event{Type: EVENT_ERROR, Time: now, Code: E_ZONE_NOT_FOUND, CheckID: "abc123"}, dnsupdatepb.EventType_EVENT_TYPE_ERROR},
+		{Event{Type: EVENT_STALE, Time: now, Code: E_STALE}, dnsupdatepb.EventType_EVENT_TYPE_ERROR},
+		{Event{Type: EVENT_WARNING, Time: now, CheckID: "abc123"}, dnsupdatepb.EventType_EVENT_TYPE_WARNING},
+	}
+
+	for _, tt := range tests {
+		got := EventToProto(tt.event)
+		if got.Type != tt.expected {
+			t.Errorf("%v: expected %v, got %v", tt.event.Type, tt.expected, got.Type)
+		}
+		if got.Code != tt.event.Code || got.CheckId != tt.event.CheckID {
+			t.Errorf("%v: expected code %q and check ID %q, got %q and %q", tt.event.Type, tt.event.Code, tt.event.CheckID, got.Code, got.CheckId)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// How many check results are kept for the control API's history
+const HISTORY_LIMIT = 100
+
+// How long a check may run, or the loop may oversleep its next activation, before the daemon is considered wedged
+const LIVENESS_GRACE = 10 * time.Minute
+
+// Tracks the outcome of the daemon's checks so it can be reported over HTTP
+type DaemonStatus struct {
+	// How recently a check must have succeeded for the daemon to be ready
+	ReadyWindow time.Duration
+
+	mu           sync.Mutex
+	lastCheck    time.Time
+	lastSuccess  time.Time
+	lastError    string
+	lastCode     string
+	checkStarted time.Time
+	nextCheck    time.Time
+	pausedUntil  time.Time
+	history      []CheckResult
+	detectedIP   string
+	records      []RecordState
+	// When the records paused on their own resume, by lower cased name
+	pausedRecords map[string]time.Time
+}
+
+// The outcome of a single check
+type CheckResult struct {
+	Time    time.Time `json:"time"`
+	Changed bool      `json:"changed"`
+	// The address records were updated to and its reverse DNS name, when they changed
+	IP    string `json:"ip,omitempty"`
+	PTR   string `json:"ptr,omitempty"`
+	Error string `json:"error,omitempty"`
+	Code  string `json:"code,omitempty"`
+}
+
+// Method to describe a check that changed records, e.g. "records updated to 198.51.100.7 (c-198-51-100-7.example.net)"
+func (r CheckResult) ChangeDescription() string {
+	description := "records updated"
+	if r.IP != "" {
+		description += " to " + r.IP
+	}
+	if r.PTR != "" {
+		description += " (" + r.PTR + ")"
+	}
+	return description
+}
+
+// Point in time copy of the DaemonStatus, this is what gets served as JSON
+type StatusSnapshot struct {
+	LastCheck   *time.Time `json:"lastCheck,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	// Code of the last error, e.g. E_RATE_LIMITED
+	LastErrorCode string        `json:"lastErrorCode,omitempty"`
+	NextCheck     *time.Time    `json:"nextCheck,omitempty"`
+	PausedUntil   *time.Time    `json:"pausedUntil,omitempty"`
+	DetectedIP    string        `json:"detectedIP,omitempty"`
+	Records       []RecordState `json:"records,omitempty"`
+	Healthy       bool          `json:"healthy"`
+	// When each record paused on its own resumes, by name
+	PausedRecords map[string]time.Time `json:"pausedRecords,omitempty"`
+}
+
+// Method to note that a check has started, used to spot checks that never finish
+func (s *DaemonStatus) StartCheck(at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkStarted = at
+}
+
+// Method to note when the loop intends to wake up for the next check
+func (s *DaemonStatus) SetNextCheck(at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextCheck = at
+}
+
+// Method to record the result of a check that finished at the provided time
+func (s *DaemonStatus) Record(at time.Time, report CheckReport, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkStarted = time.Time{}
+	// Nothing was checked, so neither the history nor the last success should suggest otherwise
+	if report.Skipped != "" {
+		return
+	}
+	s.lastCheck = at
+	result := CheckResult{Time: at, Changed: report.Changed()}
+	if result.Changed {
+		result.IP, result.PTR = report.PublicIP, report.PTR
+	}
+	if report.PublicIP != "" {
+		s.detectedIP = report.PublicIP
+		s.records = report.Records
+	}
+	if err != nil {
+		result.Error, result.Code = err.Error(), ErrorCode(err)
+	}
+	s.history = append(s.history, result)
+	if len(s.history) > HISTORY_LIMIT {
+		s.history = s.history[len(s.history)-HISTORY_LIMIT:]
+	}
+	if err != nil {
+		s.lastError, s.lastCode = err.Error(), result.Code
+		return
+	}
+	s.lastSuccess = at
+	s.lastError, s.lastCode = "", ""
+}
+
+// Method to carry the last success over from a previous run, so a restart doesn't make a recently working daemon look like it never worked
+func (s *DaemonStatus) Restore(state State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state.LastSuccess != nil && state.LastSuccess.After(s.lastSuccess) {
+		s.lastSuccess = *state.LastSuccess
+	}
+}
+
+// Method to get a consistent copy of the current status
+func (s *DaemonStatus) Snapshot() StatusSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := StatusSnapshot{
+		LastError:     s.lastError,
+		LastErrorCode: s.lastCode,
+		DetectedIP:    s.detectedIP,
+		Records:       append([]RecordState(nil), s.records...),
+	}
+	if !s.lastCheck.IsZero() {
+		lastCheck := s.lastCheck
+		snapshot.LastCheck = &lastCheck
+	}
+	if !s.lastSuccess.IsZero() {
+		lastSuccess := s.lastSuccess
+		snapshot.LastSuccess = &lastSuccess
+	}
+	if !s.nextCheck.IsZero() {
+		nextCheck := s.nextCheck
+		snapshot.NextCheck = &nextCheck
+	}
+	if time.Now().Before(s.pausedUntil) {
+		pausedUntil := s.pausedUntil
+		snapshot.PausedUntil = &pausedUntil
+	}
+	for name, until := range s.pausedRecords {
+		if time.Now().Before(until) {
+			if snapshot.PausedRecords == nil {
+				snapshot.PausedRecords = map[string]time.Time{}
+			}
+			snapshot.PausedRecords[name] = until
+		}
+	}
+	// Healthy once a check has run and the most recent one didn't fail
+	snapshot.Healthy = snapshot.LastCheck != nil && s.lastError == ""
+	return snapshot
+}
+
+// Handler for /healthz, responds 200 when the last check succeeded and 503 otherwise
+func HealthHandler(status *DaemonStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snapshot := status.Snapshot()
+		code := http.StatusOK
+		if !snapshot.Healthy {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, snapshot)
+	}
+}
+
+// Handler for /metrics, the status in the Prometheus text format
+// Timestamps are 0 until the first check, so e.g. time() - go_dns_update_last_success_timestamp_seconds > 3600 alerts when nothing has worked for an hour
+func MetricsHandler(status *DaemonStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snapshot := status.Snapshot()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WriteStatusMetrics(w, snapshot.LastCheck, snapshot.LastSuccess, snapshot.Healthy)
+	}
+}
+
+// Method to write the metrics the daemon and the textfile share in the Prometheus text format
+func WriteStatusMetrics(w io.Writer, lastCheck *time.Time, lastSuccess *time.Time, healthy bool) {
+	healthyValue := 0
+	if healthy {
+		healthyValue = 1
+	}
+	fmt.Fprintln(w, "# HELP go_dns_update_last_check_timestamp_seconds When the last check finished.")
+	fmt.Fprintln(w, "# TYPE go_dns_update_last_check_timestamp_seconds gauge")
+	fmt.Fprintf(w, "go_dns_update_last_check_timestamp_seconds %d\n", unixOrZero(lastCheck))
+	fmt.Fprintln(w, "# HELP go_dns_update_last_success_timestamp_seconds When the last successful check finished.")
+	fmt.Fprintln(w, "# TYPE go_dns_update_last_success_timestamp_seconds gauge")
+	fmt.Fprintf(w, "go_dns_update_last_success_timestamp_seconds %d\n", unixOrZero(lastSuccess))
+	fmt.Fprintln(w, "# HELP go_dns_update_healthy Whether the last check succeeded.")
+	fmt.Fprintln(w, "# TYPE go_dns_update_healthy gauge")
+	fmt.Fprintf(w, "go_dns_update_healthy %d\n", healthyValue)
+}
+
+// Helper method to get a time as seconds since the epoch, 0 when not set
+func unixOrZero(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+// Method to get the recorded check results, oldest first
+func (s *DaemonStatus) History() []CheckResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]CheckResult(nil), s.history...)
+}
+
+// Method to pause checks until the provided time, a zero time resumes them
+func (s *DaemonStatus) Pause(until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pausedUntil = until
+}
+
+// Method to get when a pause in effect at the provided time ends, zero when not paused
+func (s *DaemonStatus) PausedUntil(now time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.pausedUntil.IsZero() && !now.Before(s.pausedUntil) {
+		s.pausedUntil = time.Time{}
+	}
+	return s.pausedUntil
+}
+
+// Method to leave the record of the name as it is until the provided time, while the others are still updated. A zero time resumes it
+func (s *DaemonStatus) PauseRecord(name string, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if until.IsZero() {
+		delete(s.pausedRecords, name)
+		return
+	}
+	if s.pausedRecords == nil {
+		s.pausedRecords = map[string]time.Time{}
+	}
+	s.pausedRecords[name] = until
+}
+
+// Method to report whether the record of the name is paused at the provided time
+func (s *DaemonStatus) RecordPaused(name string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	until, ok := s.pausedRecords[name]
+	if ok && !now.Before(until) {
+		delete(s.pausedRecords, name)
+		return false
+	}
+	return ok
+}
+
+// Method to report whether the daemon loop is still making progress
+// Fails only when a check has hung or the loop overslept its next activation, never because a check failed
+func (s *DaemonStatus) Live(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.checkStarted.IsZero() && now.Sub(s.checkStarted) > LIVENESS_GRACE {
+		return false
+	}
+	if s.checkStarted.IsZero() && !s.nextCheck.IsZero() && now.Sub(s.nextCheck) > LIVENESS_GRACE {
+		return false
+	}
+	return true
+}
+
+// Method to report whether a check has succeeded within the ready window
+func (s *DaemonStatus) Ready(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastSuccess.IsZero() {
+		return false
+	}
+	return s.ReadyWindow <= 0 || now.Sub(s.lastSuccess) <= s.ReadyWindow
+}
+
+// Method to report how long the daemon has gone without a successful check, counting from started when none has succeeded yet
+// Stale once that's longer than the window, a window of 0 never goes stale
+func (s *DaemonStatus) Stale(now time.Time, started time.Time, window time.Duration) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	since := started
+	if s.lastSuccess.After(since) {
+		since = s.lastSuccess
+	}
+	age := now.Sub(since)
+	return age, window > 0 && age > window
+}
+
+// Handler for /livez, restarting the process is the right response to this failing
+func LivenessHandler(status *DaemonStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !status.Live(time.Now()) {
+			writeJSON(w, http.StatusServiceUnavailable, status.Snapshot())
+			return
+		}
+		writeJSON(w, http.StatusOK, status.Snapshot())
+	}
+}
+
+// Handler for /readyz, a failing check only makes this fail once the ready window has passed without a success
+func ReadinessHandler(status *DaemonStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !status.Ready(time.Now()) {
+			writeJSON(w, http.StatusServiceUnavailable, status.Snapshot())
+			return
+		}
+		writeJSON(w, http.StatusOK, status.Snapshot())
+	}
+}
+
+// Helper method to work out a sensible ready window for a schedule when one isn't configured
+// Allows a few consecutive failed checks before the daemon stops reporting ready
+func DefaultReadyWindow(schedule Schedule, now time.Time) time.Duration {
+	first := schedule.Next(now)
+	second := schedule.Next(first)
+	if first.IsZero() || second.IsZero() {
+		return 0
+	}
+	return 3 * second.Sub(first)
+}
+
+// Helper method to start serving the daemon's HTTP endpoints in the background
+// Listening happens up front so a bad address or port in use fails the daemon on start
+func StartHTTPServer(addr string, handler http.Handler) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("http server failed to listen: %w", err)
+	}
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("http server stopped: %v", err)
+		}
+	}()
+	log.Infof("Serving HTTP endpoints on %v", listener.Addr())
+	return server, nil
+}
+
+// Helper method to write a JSON response body with the provided status code
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Warnf("writing response failed: %v", err)
+	}
+}
+
+// Method to probe a running daemon's /readyz endpoint, used by the -healthcheck flag
+// Returns an error unless the daemon reports itself ready, so a single failed check within the ready window doesn't mark the container unhealthy
+func Healthcheck(baseURL string) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(baseURL + "/readyz")
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("daemon reported not ready, status: %d", resp.StatusCode)
+	}
+	return nil
+}
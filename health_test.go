@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthHandler(t *testing.T) {
+	status := &DaemonStatus{}
+	handler := HealthHandler(status)
+
+	// Nothing has run yet
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before the first check, got %d", rec.Code)
+	}
+
+	success := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	status.Record(success, CheckReport{}, nil)
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 after a successful check, got %d", rec.Code)
+	}
+
+	status.Record(success.Add(time.Minute), CheckReport{}, errors.New("could not retrieve initial values"))
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 after a failed check, got %d", rec.Code)
+	}
+
+	var snapshot StatusSnapshot
+	if err := json.NewDecoder(rec.Body).Decode(&snapshot); err != nil {
+		t.Fatalf("Unexpected error decoding body: %v", err)
+	}
+	if snapshot.LastSuccess == nil || !snapshot.LastSuccess.Equal(success) {
+		t.Errorf("Expected last success %v, got %v", success, snapshot.LastSuccess)
+	}
+	if snapshot.LastCheck == nil || !snapshot.LastCheck.Equal(success.Add(time.Minute)) {
+		t.Errorf("Expected last check %v, got %v", success.Add(time.Minute), snapshot.LastCheck)
+	}
+	if snapshot.LastError != "could not retrieve initial values" {
+		t.Errorf("Expected last error to be reported, got %q", snapshot.LastError)
+	}
+	if snapshot.LastErrorCode != E_UNKNOWN {
+		t.Errorf("Expected last error code %v, got %q", E_UNKNOWN, snapshot.LastErrorCode)
+	}
+}
+
+func TestDaemonStatus_Live(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	status := &DaemonStatus{}
+	if !status.Live(now) {
+		t.Error("Expected a fresh daemon to be live")
+	}
+
+	// A failing check doesn't affect liveness
+	status.StartCheck(now)
+	status.Record(now, CheckReport{}, errors.New("cloudflare blip"))
+	status.SetNextCheck(now.Add(5 * time.Minute))
+	if !status.Live(now.Add(time.Minute)) {
+		t.Error("Expected daemon to be live after a failed check")
+	}
+
+	// The loop overslept its next activation
+	if status.Live(now.Add(5*time.Minute + LIVENESS_GRACE + time.Second)) {
+		t.Error("Expected daemon to not be live after missing its next check")
+	}
+
+	// A check that never finishes
+	status.StartCheck(now.Add(5 * time.Minute))
+	if status.Live(now.Add(5*time.Minute + LIVENESS_GRACE + time.Second)) {
+		t.Error("Expected daemon to not be live while a check hangs")
+	}
+}
+
+func TestDaemonStatus_Ready(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	status := &DaemonStatus{ReadyWindow: 15 * time.Minute}
+	if status.Ready(now) {
+		t.Error("Expected daemon to not be ready before any successful check")
+	}
+
+	status.Record(now, CheckReport{}, nil)
+	status.Record(now.Add(5*time.Minute), CheckReport{}, errors.New("cloudflare blip"))
+	if !status.Ready(now.Add(10 * time.Minute)) {
+		t.Error("Expected daemon to stay ready within the window after a failed check")
+	}
+	if status.Ready(now.Add(16 * time.Minute)) {
+		t.Error("Expected daemon to not be ready once the window has passed")
+	}
+}
+
+func TestDaemonStatus_Restore(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	status := &DaemonStatus{ReadyWindow: 15 * time.Minute}
+	previous := now.Add(-5 * time.Minute)
+	status.Restore(State{LastSuccess: &previous})
+	if !status.Ready(now) {
+		t.Error("Expected a success from the previous run to count towards readiness")
+	}
+	if status.Snapshot().Healthy {
+		t.Error("Expected the daemon to not be healthy before its own first check")
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	status := &DaemonStatus{}
+	success := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	status.Record(success, CheckReport{}, nil)
+	status.Record(success.Add(time.Minute), CheckReport{}, errors.New("cloudflare blip"))
+
+	rec := httptest.NewRecorder()
+	MetricsHandler(status)(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, expected := range []string{
+		"go_dns_update_last_check_timestamp_seconds 1714564860\n",
+		"go_dns_update_last_success_timestamp_seconds 1714564800\n",
+		"go_dns_update_healthy 0\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected metrics to contain %q, got %q", expected, body)
+		}
+	}
+}
+
+func TestDefaultReadyWindow(t *testing.T) {
+	window := DefaultReadyWindow(IntervalSchedule{Interval: 5 * time.Minute}, time.Now())
+	if window != 15*time.Minute {
+		t.Errorf("Expected 15m, got %v", window)
+	}
+}
+
+func TestHealthcheck(t *testing.T) {
+	status := &DaemonStatus{ReadyWindow: time.Hour}
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", HealthHandler(status))
+	mux.Handle("/readyz", ReadinessHandler(status))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	baseURL := ts.URL
+
+	if err := Healthcheck(baseURL); err == nil {
+		t.Error("Expected error before the first check")
+	}
+	status.Record(time.Now(), CheckReport{}, nil)
+	if err := Healthcheck(baseURL); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// A single failed check within the ready window keeps the container healthy
+	status.Record(time.Now(), CheckReport{}, errors.New("cloudflare unreachable"))
+	if err := Healthcheck(baseURL); err != nil {
+		t.Errorf("Unexpected error after a single failed check: %v", err)
+	}
+	if err := Healthcheck("http://127.0.0.1:1"); err == nil {
+		t.Error("Expected error when the daemon isn't running")
+	}
+}
+
+func TestDaemonStatus_Stale(t *testing.T) {
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	status := &DaemonStatus{}
+	if _, stale := status.Stale(started.Add(30*time.Minute), started, time.Hour); stale {
+		t.Error("Expected a daemon started within the window to not be stale")
+	}
+	if age, stale := status.Stale(started.Add(90*time.Minute), started, time.Hour); !stale || age != 90*time.Minute {
+		t.Errorf("Expected a daemon without any success for 90m to be stale, got %v %v", age, stale)
+	}
+	status.Record(started.Add(80*time.Minute), CheckReport{}, nil)
+	if _, stale := status.Stale(started.Add(90*time.Minute), started, time.Hour); stale {
+		t.Error("Expected a recent success to end the stale spell")
+	}
+	if _, stale := status.Stale(started.Add(48*time.Hour), started, 0); stale {
+		t.Error("Expected a window of 0 to never be stale")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Conversion of internationalized domain names, mapped the way browsers look names up
+// Underscores are allowed, as in the _acme-challenge and SRV names records may have
+var idnaProfile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false), idna.Transitional(false))
+
+// Method to turn an internationalized domain name into the punycode form Cloudflare keeps it in, e.g. bücher.example into xn--bcher-kva.example
+// Names that are ASCII already are returned as they are
+func ToASCIIName(name string) (string, error) {
+	if isASCII(name) {
+		return name, nil
+	}
+	encoded, err := idnaProfile.ToASCII(name)
+	if err != nil {
+		return name, fmt.Errorf("%q is not a valid internationalized domain name", name)
+	}
+	return encoded, nil
+}
+
+// Method to bring a name into the form Cloudflare returns names in, lower case, without the trailing dot and in punycode
+// Users type e.g. Example.COM. or bücher.example, both would otherwise never match the record Cloudflare has
+func NormalizeName(name string) (string, error) {
+	encoded, err := ToASCIIName(name)
+	if err != nil {
+		return name, err
+	}
+	return strings.ToLower(strings.TrimSuffix(encoded, ".")), nil
+}
+
+// Method to report whether two names are the same once normalized, e.g. Example.COM. and example.com
+func SameName(a string, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+// Method to show a name in both forms when it has punycode labels, e.g. "bücher.example (xn--bcher-kva.example)"
+func DisplayName(name string) string {
+	if !strings.Contains(strings.ToLower(name), "xn--") {
+		return name
+	}
+	decoded, err := idnaProfile.ToUnicode(name)
+	if err != nil || decoded == name {
+		return name
+	}
+	return fmt.Sprintf("%v (%v)", decoded, name)
+}
+
+// Helper method to report whether the name is plain ASCII
+func isASCII(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// Helper method to normalize the names of the config's records and its heartbeat
+func (c *Config) normalizeNames(problems *configProblems) {
+	if normalized, err := NormalizeName(c.Heartbeat); err != nil {
+		problems.add(fmt.Errorf("heartbeat %w", err), "heartbeat")
+	} else {
+		c.Heartbeat = normalized
+	}
+	normalizeRecordNames(problems.within("", "records"), c.Records)
+	for i := range c.Accounts {
+		normalizeRecordNames(problems.within("account "+c.Accounts[i].Name, "accounts", i, "records"), c.Accounts[i].Records)
+	}
+}
+
+// Helper method to normalize the names and CNAME targets of the records, in place
+func normalizeRecordNames(problems *configProblems, records []RecordConfig) {
+	for i := range records {
+		if normalized, err := NormalizeName(records[i].Name); err != nil {
+			problems.add(fmt.Errorf("record %w", err), i, "name")
+		} else {
+			records[i].Name = normalized
+		}
+		if normalized, err := NormalizeName(records[i].Target); err != nil {
+			problems.add(fmt.Errorf("record %v: target %w", records[i].Name, err), i, "target")
+		} else {
+			records[i].Target = normalized
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import "testing"
+
+func TestToASCIIName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		wantErr  bool
+	}{
+		{"bücher.example", "xn--bcher-kva.example", false},
+		{"Bücher.Example", "xn--bcher-kva.example", false},
+		{"nas.bücher.example.", "nas.xn--bcher-kva.example.", false},
+		{"_acme-challenge.bücher.example", "_acme-challenge.xn--bcher-kva.example", false},
+		// ASCII names are left as they are
+		{"Home.Example.com", "Home.Example.com", false},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example", false},
+		{"", "", false},
+		{"bü‍cher.example", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ToASCIIName(tt.name)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%v: expected error but got none", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tt.name, err)
+		}
+		if got != tt.expected {
+			t.Errorf("%v: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"Example.COM.", "example.com"},
+		{"home.example.com", "home.example.com"},
+		{"Bücher.example.", "xn--bcher-kva.example"},
+		{"_DMARC.Example.com", "_dmarc.example.com"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeName(tt.name)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tt.name, err)
+		}
+		if got != tt.expected {
+			t.Errorf("%v: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestFindDNSRecords_NameCase(t *testing.T) {
+	records := []DNSRecord{
+		{ID: "1", Name: "example.com", Type: RECORD_TYPE_A},
+		{ID: "2", Name: "www.example.com", Type: RECORD_TYPE_A},
+	}
+	domainRecord, wwwRecord := FindDNSRecords(records, RecordConfig{Name: "Example.COM.", WWW: true})
+	if domainRecord.ID != "1" || wwwRecord.ID != "2" {
+		t.Errorf("Expected records 1 and 2, got %q and %q", domainRecord.ID, wwwRecord.ID)
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"xn--bcher-kva.example", "bücher.example (xn--bcher-kva.example)"},
+		{"nas.XN--bcher-kva.example", "nas.bücher.example (nas.XN--bcher-kva.example)"},
+		{"home.example.com", "home.example.com"},
+	}
+
+	for _, tt := range tests {
+		if got := DisplayName(tt.name); got != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, got)
+		}
+	}
+}
+
+func TestParseConfig_NormalizedNames(t *testing.T) {
+	config, err := ParseConfig([]byte("heartbeat: heartbeat.bücher.example\nrecords:\n  - name: bücher.example\n  - name: shop.example.com\n    type: CNAME\n    target: läden.example\naccounts:\n  - name: client\n    token: abc123\n    records:\n      - name: straße.example\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.Heartbeat != "heartbeat.xn--bcher-kva.example" || config.Records[0].Name != "xn--bcher-kva.example" || config.Records[1].Target != "xn--lden-loa.example" || config.Accounts[0].Records[0].Name != "xn--strae-oqa.example" {
+		t.Errorf("Expected the names in punycode, got %+v", config)
+	}
+
+	config, err = ParseConfig([]byte("heartbeat: Heartbeat.Example.com.\nrecords:\n  - name: Example.COM.\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.Heartbeat != "heartbeat.example.com" || config.Records[0].Name != "example.com" {
+		t.Errorf("Expected the names in lower case without the trailing dot, got %+v", config)
+	}
+	if _, err := ParseConfig([]byte("records:\n  - name: example.com\n  - name: Example.com.\n")); err == nil {
+		t.Error("Expected error for a record listed twice but got none")
+	}
+
+	// Both forms are the same record
+	if _, err := ParseConfig([]byte("records:\n  - name: bücher.example\n  - name: xn--bcher-kva.example\n")); err == nil {
+		t.Error("Expected error for a record listed in both forms but got none")
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Where Kubernetes mounts the pod's service account credentials
+const KUBE_SERVICE_ACCOUNT_DIR = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Leader election timings, the same defaults client-go uses
+const KUBE_LEASE_DURATION = 15 * time.Second
+const KUBE_LEASE_RETRY_PERIOD = 2 * time.Second
+
+// Timestamp format used by Lease objects
+const KUBE_MICRO_TIME_FORMAT = "2006-01-02T15:04:05.000000Z07:00"
+
+// Returned by Daemon.RunCheck on replicas that don't hold the lease
+var ErrNotLeader = errors.New("not the leader, another replica is handling updates")
+
+// Minimal client for the few Kubernetes API calls the controller mode needs
+type KubeClient struct {
+	BaseURL   string
+	Token     string
+	Namespace string
+	HTTP      *http.Client
+}
+
+// Method to build a client from the service account Kubernetes mounts into every pod
+func InClusterKubeClient() (*KubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running inside a Kubernetes cluster")
+	}
+	token, err := os.ReadFile(KUBE_SERVICE_ACCOUNT_DIR + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("reading service account token failed: %w", err)
+	}
+	namespace, err := os.ReadFile(KUBE_SERVICE_ACCOUNT_DIR + "/namespace")
+	if err != nil {
+		return nil, fmt.Errorf("reading service account namespace failed: %w", err)
+	}
+	ca, err := os.ReadFile(KUBE_SERVICE_ACCOUNT_DIR + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("reading cluster CA failed: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("cluster CA contains no certificates")
+	}
+	return &KubeClient{
+		BaseURL:   "https://" + net.JoinHostPort(host, port),
+		Token:     strings.TrimSpace(string(token)),
+		Namespace: strings.TrimSpace(string(namespace)),
+		HTTP: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+// Helper method to make a JSON request against the Kubernetes API, returning the status code
+// out is only decoded for successful responses
+func (c *KubeClient) do(method string, path string, body any, out any) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, c.BaseURL+path, reader)
+	if err != nil {
+		return 0, fmt.Errorf("request creation failed: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 && out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("reading response failed: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// The parts of a coordination.k8s.io/v1 Lease used for leader election
+type kubeLease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int    `json:"leaseTransitions"`
+	} `json:"spec"`
+}
+
+// Keeps a Lease so that only one of several replicas performs updates
+type LeaderElector struct {
+	Client    *KubeClient
+	LeaseName string
+	// Unique name of this replica, usually the pod name
+	Identity string
+	// How long a lease is valid without being renewed
+	LeaseDuration time.Duration
+	// How often the lease is renewed, or acquisition retried
+	RetryPeriod time.Duration
+
+	leader    atomic.Bool
+	lastRenew time.Time
+}
+
+// Method to report whether this replica currently holds the lease
+func (e *LeaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Method to keep trying to acquire or renew the lease every RetryPeriod until stop is closed, then release it if held
+// Callers wanting to know the outcome of the first round straight away should call Elect before starting this
+func (e *LeaderElector) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(e.RetryPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			if e.IsLeader() {
+				e.release()
+			}
+			return
+		case <-ticker.C:
+			e.Elect(time.Now())
+		}
+	}
+}
+
+// Method to run a single election round, dropping leadership if the lease couldn't be renewed in time
+func (e *LeaderElector) Elect(now time.Time) {
+	acquired, err := e.TryAcquireOrRenew(now)
+	if err != nil {
+		log.Warnf("leader election failed: %v", err)
+	}
+	if acquired {
+		e.lastRenew = now
+	}
+	// A failed renewal isn't fatal until the lease would have expired for the other replicas
+	leader := acquired || (err != nil && e.IsLeader() && now.Sub(e.lastRenew) < e.LeaseDuration)
+	if leader != e.IsLeader() {
+		if leader {
+			log.Infof("Acquired lease %v, this replica now handles updates", e.LeaseName)
+		} else {
+			log.Infof("Lost lease %v, standing by", e.LeaseName)
+		}
+	}
+	e.leader.Store(leader)
+}
+
+// Method to take the lease if it's free or expired, or renew it if we already hold it
+// Reports whether we hold the lease afterwards
+func (e *LeaderElector) TryAcquireOrRenew(now time.Time) (bool, error) {
+	path := fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%v/leases/%v", e.Client.Namespace, e.LeaseName)
+	var lease kubeLease
+	code, err := e.Client.do(http.MethodGet, path, nil, &lease)
+	if err != nil {
+		return false, err
+	}
+
+	nowString := now.UTC().Format(KUBE_MICRO_TIME_FORMAT)
+	switch code {
+	case http.StatusNotFound:
+		lease = kubeLease{APIVersion: "coordination.k8s.io/v1", Kind: "Lease"}
+		lease.Metadata.Name = e.LeaseName
+		lease.Metadata.Namespace = e.Client.Namespace
+		lease.Spec.HolderIdentity = e.Identity
+		lease.Spec.LeaseDurationSeconds = int(e.LeaseDuration.Seconds())
+		lease.Spec.AcquireTime = nowString
+		lease.Spec.RenewTime = nowString
+		createPath := fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%v/leases", e.Client.Namespace)
+		code, err = e.Client.do(http.MethodPost, createPath, lease, nil)
+		if err != nil {
+			return false, err
+		}
+		// Conflict means another replica created it first
+		return code == http.StatusCreated || code == http.StatusOK, nil
+	case http.StatusOK:
+	default:
+		return false, fmt.Errorf("reading lease returned status: %d", code)
+	}
+
+	if lease.Spec.HolderIdentity != e.Identity {
+		renewTime, err := time.Parse(KUBE_MICRO_TIME_FORMAT, lease.Spec.RenewTime)
+		expired := err != nil || now.After(renewTime.Add(time.Duration(lease.Spec.LeaseDurationSeconds)*time.Second))
+		if lease.Spec.HolderIdentity != "" && !expired {
+			return false, nil
+		}
+		lease.Spec.HolderIdentity = e.Identity
+		lease.Spec.AcquireTime = nowString
+		lease.Spec.LeaseTransitions++
+	}
+	lease.Spec.LeaseDurationSeconds = int(e.LeaseDuration.Seconds())
+	lease.Spec.RenewTime = nowString
+	// The resourceVersion makes this fail with a conflict if someone else updated the lease in the meantime
+	code, err = e.Client.do(http.MethodPut, path, lease, nil)
+	if err != nil {
+		return false, err
+	}
+	return code == http.StatusOK, nil
+}
+
+// Helper method to hand the lease back on shutdown so another replica can take over without waiting for it to expire
+func (e *LeaderElector) release() {
+	path := fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%v/leases/%v", e.Client.Namespace, e.LeaseName)
+	var lease kubeLease
+	if code, err := e.Client.do(http.MethodGet, path, nil, &lease); err != nil || code != http.StatusOK {
+		return
+	}
+	if lease.Spec.HolderIdentity != e.Identity {
+		return
+	}
+	lease.Spec.HolderIdentity = ""
+	if _, err := e.Client.do(http.MethodPut, path, lease, nil); err != nil {
+		log.Warnf("releasing lease failed: %v", err)
+	}
+	e.leader.Store(false)
+}
+
+// Turns daemon events into Kubernetes Events on the pod so they show up in kubectl describe/get events
+type KubeEventRecorder struct {
+	Client  *KubeClient
+	PodName string
+}
+
+// Method to record daemon events until the channel is closed
+func (r *KubeEventRecorder) Run(events <-chan Event) {
+	for event := range events {
+		if err := r.Record(event); err != nil {
+			log.Warnf("recording kubernetes event failed: %v", err)
+		}
+	}
+}
+
+// Method to create a single core/v1 Event for a daemon event
+func (r *KubeEventRecorder) Record(event Event) error {
+	reason, eventType := "DNSRecordsUpdated", "Normal"
+	switch event.Type {
+	case EVENT_ERROR:
+		reason, eventType = "CheckFailed", "Warning"
+	case EVENT_WARNING:
+		reason, eventType = "CheckWarning", "Warning"
+	case EVENT_STALE:
+		reason, eventType = "UpdaterStale", "Warning"
+	}
+	timestamp := event.Time.UTC().Format(time.RFC3339)
+	body := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Event",
+		"metadata":   map[string]any{"generateName": "go-dns-update.", "namespace": r.Client.Namespace},
+		"involvedObject": map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"name":       r.PodName,
+			"namespace":  r.Client.Namespace,
+		},
+		"reason":         reason,
+		"message":        event.Message,
+		"type":           eventType,
+		"count":          1,
+		"firstTimestamp": timestamp,
+		"lastTimestamp":  timestamp,
+		"source":         map[string]any{"component": "go-dns-update"},
+	}
+	code, err := r.Client.do(http.MethodPost, fmt.Sprintf("/api/v1/namespaces/%v/events", r.Client.Namespace), body, nil)
+	if err != nil {
+		return err
+	}
+	if code >= 300 {
+		return fmt.Errorf("creating event returned status: %d", code)
+	}
+	return nil
+}
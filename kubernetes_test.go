@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Stores a single Lease in memory, enough of the API server for leader election
+type fakeLeaseServer struct {
+	mu      sync.Mutex
+	lease   *kubeLease
+	version int
+}
+
+func (f *fakeLeaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		if f.lease == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(f.lease)
+	case http.MethodPost, http.MethodPut:
+		var lease kubeLease
+		json.NewDecoder(r.Body).Decode(&lease)
+		if r.Method == http.MethodPost && f.lease != nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if r.Method == http.MethodPut && lease.Metadata.ResourceVersion != f.lease.Metadata.ResourceVersion {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.version++
+		lease.Metadata.ResourceVersion = string(rune('0' + f.version))
+		f.lease = &lease
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+	}
+}
+
+func TestLeaderElector(t *testing.T) {
+	ts := httptest.NewServer(&fakeLeaseServer{})
+	defer ts.Close()
+	client := &KubeClient{BaseURL: ts.URL, Namespace: "default", HTTP: ts.Client()}
+	first := &LeaderElector{Client: client, LeaseName: "go-dns-update", Identity: "pod-a", LeaseDuration: 15 * time.Second, RetryPeriod: 2 * time.Second}
+	second := &LeaderElector{Client: client, LeaseName: "go-dns-update", Identity: "pod-b", LeaseDuration: 15 * time.Second, RetryPeriod: 2 * time.Second}
+	now := time.Now()
+
+	first.Elect(now)
+	second.Elect(now)
+	if !first.IsLeader() || second.IsLeader() {
+		t.Fatalf("Expected only the first replica to lead, got %v and %v", first.IsLeader(), second.IsLeader())
+	}
+
+	// Renewing keeps the lease
+	first.Elect(now.Add(2 * time.Second))
+	second.Elect(now.Add(2 * time.Second))
+	if !first.IsLeader() || second.IsLeader() {
+		t.Fatal("Expected the first replica to keep the lease")
+	}
+
+	// Once the first replica stops renewing the lease expires and the second takes over
+	second.Elect(now.Add(20 * time.Second))
+	if !second.IsLeader() {
+		t.Fatal("Expected the second replica to take over an expired lease")
+	}
+	first.Elect(now.Add(21 * time.Second))
+	if first.IsLeader() {
+		t.Fatal("Expected the first replica to notice it lost the lease")
+	}
+
+	// Releasing on shutdown hands the lease over straight away
+	second.release()
+	first.Elect(now.Add(22 * time.Second))
+	if !first.IsLeader() {
+		t.Fatal("Expected the first replica to take over a released lease")
+	}
+}
+
+func TestKubeEventRecorder(t *testing.T) {
+	var received map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/default/events" {
+			t.Errorf("Unexpected path %v", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	recorder := KubeEventRecorder{Client: &KubeClient{BaseURL: ts.URL, Namespace: "default", HTTP: ts.Client()}, PodName: "pod-a"}
+	err := recorder.Record(Event{Type: EVENT_ERROR, Time: time.Now(), Message: "could not retrieve initial values"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if received["reason"] != "CheckFailed" || received["type"] != "Warning" {
+		t.Errorf("Unexpected event: %v", received)
+	}
+	if involved := received["involvedObject"].(map[string]any); involved["name"] != "pod-a" {
+		t.Errorf("Expected event on pod-a, got %v", involved)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Name of the command printing when each managed record last changed
+const LAST_CHANGE_COMMAND = "last-change"
+
+// Where the time of a record's last change comes from
+const CHANGE_SOURCE_CLOUDFLARE = "cloudflare"
+const CHANGE_SOURCE_HISTORY = "local history"
+
+// When a managed record last changed
+type LastChange struct {
+	Name    string
+	Type    string
+	Content string
+	// The later of Cloudflare's modified time and the last change in the state file, nil when neither knows
+	At *time.Time
+	// CHANGE_SOURCE_CLOUDFLARE or CHANGE_SOURCE_HISTORY, whichever At comes from
+	Source string
+	// Why the record couldn't be looked up, empty when it was
+	Error string
+}
+
+// Method to look up when every account's managed records last changed, the www ones included
+// Cloudflare's modified time covers changes made by anyone, the state file's history the ones this program made, the later one wins
+func LastChanges(accounts []Account, state State) []LastChange {
+	var changes []LastChange
+	for _, account := range accounts {
+		groups, err := ResolveZones(account.Client, account.Targets)
+		if err != nil {
+			for _, failure := range TargetFailures(account.Targets, account.wrapError(err)) {
+				changes = append(changes, LastChange{Name: failure.Name, Error: failure.Error})
+			}
+		}
+		for _, group := range groups {
+			records, err := ListFilteredRecords(account.Client, group.Zone.ID, group.Filter(""))
+			for _, target := range group.Records {
+				if err != nil {
+					changes = append(changes, LastChange{Name: target.Name, Error: account.wrapError(err).Error()})
+					continue
+				}
+				domainRecord, wwwRecord := FindDNSRecords(records, target)
+				changes = append(changes, lastChange(records, domainRecord, target.Name, target, state))
+				if target.WWW {
+					changes = append(changes, lastChange(records, wwwRecord, "www."+target.Name, target, state))
+				}
+			}
+		}
+	}
+	return changes
+}
+
+// Helper method to work out the last change of a target's record, found being empty when it wasn't
+func lastChange(records []DNSRecord, found DNSRecord, name string, target RecordConfig, state State) LastChange {
+	if found.ID == "" {
+		return LastChange{Name: name, Error: MissingTargetError(records, name, target).Error()}
+	}
+	change := LastChange{Name: found.Name, Type: found.Type, Content: RecordPresentation(found)}
+	if !found.ModifiedOn.IsZero() {
+		modifiedOn := found.ModifiedOn
+		change.At, change.Source = &modifiedOn, CHANGE_SOURCE_CLOUDFLARE
+	}
+	if local, ok := state.Changes[found.Name]; ok && (change.At == nil || local.At.After(*change.At)) {
+		change.At, change.Source = &local.At, CHANGE_SOURCE_HISTORY
+	}
+	return change
+}
+
+// Method to run the last-change command, printing when each managed record last changed
+// Records that couldn't be looked up are printed too, and fail the command once the rest are
+func RunLastChange(accounts []Account, state State, now time.Time, out io.Writer) error {
+	var errs []error
+	for _, change := range LastChanges(accounts, state) {
+		if change.Error != "" {
+			fmt.Fprintf(out, "%-40s %v\n", change.Name, Colorize(out, ANSI_RED, change.Error))
+			errs = append(errs, fmt.Errorf("%v: %v", change.Name, change.Error))
+			continue
+		}
+		source := ""
+		if change.Source != "" {
+			source = Colorize(out, ANSI_DIM, "  ("+change.Source+")")
+		}
+		fmt.Fprintf(out, "%-40s %-5s %-16s %v%v\n", change.Name, change.Type, change.Content, formatStateTime(change.At, now), source)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunLastChange(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "home.example.com", "type": "A", "content": "198.51.100.7", "ttl": 1, "modified_on": "2026-10-15T08:00:00Z"},
+				{"id": "r2", "name": "www.home.example.com", "type": "A", "content": "198.51.100.7", "ttl": 1, "modified_on": "2026-10-01T08:00:00Z"},
+			},
+		},
+	}
+	accounts := []Account{{Client: newTestCloudflareAPI(t, fake), Targets: []RecordConfig{{Name: "home.example.com", WWW: true}, {Name: "gone.example.com"}}}}
+	// The program's own history knows of a later change to the www record than Cloudflare, e.g. from a clock that's ahead
+	state := State{Changes: map[string]RecordChange{
+		"www.home.example.com": {At: time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC), IP: "198.51.100.7"},
+		"home.example.com":     {At: time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC), IP: "198.51.100.7"},
+	}}
+
+	changes := LastChanges(accounts, state)
+	if len(changes) != 3 {
+		t.Fatalf("Expected 3 records, got %+v", changes)
+	}
+	if changes[0].At == nil || !changes[0].At.Equal(time.Date(2026, 10, 15, 8, 0, 0, 0, time.UTC)) || changes[0].Source != CHANGE_SOURCE_CLOUDFLARE {
+		t.Errorf("Expected home.example.com to go by Cloudflare, got %+v", changes[0])
+	}
+	if changes[1].At == nil || !changes[1].At.Equal(time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)) || changes[1].Source != CHANGE_SOURCE_HISTORY {
+		t.Errorf("Expected www.home.example.com to go by the local history, got %+v", changes[1])
+	}
+	if changes[2].Name != "gone.example.com" || changes[2].Error == "" {
+		t.Errorf("Expected gone.example.com to fail, got %+v", changes[2])
+	}
+
+	var out strings.Builder
+	err := RunLastChange(accounts, state, time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC), &out)
+	if err == nil || !strings.Contains(err.Error(), "gone.example.com") {
+		t.Errorf("Expected error for gone.example.com, got %v", err)
+	}
+	if !strings.Contains(out.String(), "2026-10-15T08:00:00Z (48h0m0s ago)  (cloudflare)") {
+		t.Errorf("Expected when home.example.com changed, got %q", out.String())
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Path external systems POST to for an immediate check
+const TRIGGER_PATH = "/trigger"
+
+// Largest request body accepted, it only ever holds an IP address
+const TRIGGER_MAX_BODY = 1024
+
+// Runs a check whenever an external system (a router script, CI, monitoring) asks for one
+type TriggerServer struct {
+	// Bearer token every request must present
+	Token string
+	// Runs the check, with the public IP given in the request or "" to detect it
+	Check func(ip string) (CheckReport, error)
+
+	// Keeps requests arriving together from running overlapping checks
+	mu sync.Mutex
+}
+
+// Handles POST /trigger, the body may hold the new public IP, either on its own or as {"ip": "203.0.113.42"}
+// Responds with the check's report once it has run
+func (s *TriggerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, TRIGGER_MAX_BODY))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "reading body failed"})
+		return
+	}
+	ip, ok := TriggerIP(body)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "body must be empty or hold an IPv4 address"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ip == "" {
+		log.Info("Check requested through the trigger endpoint")
+	} else {
+		log.Infof("Check requested through the trigger endpoint with the public IP %v", ip)
+	}
+	report, err := s.Check(ip)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]any{"error": err.Error(), "report": report})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// Helper method to read the public IP out of a trigger request's body, reporting whether the body was usable
+// An empty body means the IP should be detected, IPv6 addresses aren't usable
+func TriggerIP(body []byte) (string, bool) {
+	text := strings.TrimSpace(string(body))
+	if text == "" {
+		return "", true
+	}
+	if strings.HasPrefix(text, "{") {
+		var request struct {
+			IP string `json:"ip"`
+		}
+		if err := json.Unmarshal([]byte(text), &request); err != nil {
+			return "", false
+		}
+		text = request.IP
+		if text == "" {
+			return "", true
+		}
+	}
+	ip, err := netip.ParseAddr(text)
+	if err != nil || !ip.Is4() {
+		// Only A records take the detected address, so anything but an IPv4 address can't be applied
+		return "", false
+	}
+	return ip.String(), true
+}
+
+// Method to serve trigger requests until the process receives SIGINT or SIGTERM
+func RunTriggerServer(addr string, trigger *TriggerServer) error {
+	mux := http.NewServeMux()
+	mux.Handle(TRIGGER_PATH, trigger)
+	server, err := StartHTTPServer(addr, mux)
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	sig := <-stop
+	log.Infof("Received %v, shutting down", sig)
+	return nil
+}
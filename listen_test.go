@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTriggerServer(t *testing.T) {
+	var requested []string
+	server := &TriggerServer{
+		Token: "s3cret",
+		Check: func(ip string) (CheckReport, error) {
+			if ip == "192.0.2.99" {
+				return CheckReport{}, errors.New("update failed")
+			}
+			requested = append(requested, ip)
+			return CheckReport{PublicIP: ip}, nil
+		},
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		token    string
+		body     string
+		code     int
+		expected []string
+	}{
+		{"Wrong Method", http.MethodGet, "s3cret", "", http.StatusMethodNotAllowed, nil},
+		{"Missing Token", http.MethodPost, "", "", http.StatusUnauthorized, nil},
+		{"Wrong Token", http.MethodPost, "wrong", "", http.StatusUnauthorized, nil},
+		{"Detect", http.MethodPost, "s3cret", "", http.StatusOK, []string{""}},
+		{"Plain IP", http.MethodPost, "s3cret", "203.0.113.42\n", http.StatusOK, []string{"203.0.113.42"}},
+		{"JSON IP", http.MethodPost, "s3cret", `{"ip": "203.0.113.43"}`, http.StatusOK, []string{"203.0.113.43"}},
+		{"IPv6", http.MethodPost, "s3cret", "2001:db8::1", http.StatusBadRequest, nil},
+		{"JSON IPv6", http.MethodPost, "s3cret", `{"ip": "2001:db8::1"}`, http.StatusBadRequest, nil},
+		{"JSON Without IP", http.MethodPost, "s3cret", `{}`, http.StatusOK, []string{""}},
+		{"Invalid IP", http.MethodPost, "s3cret", "not an ip", http.StatusBadRequest, nil},
+		{"Invalid JSON", http.MethodPost, "s3cret", `{"ip": `, http.StatusBadRequest, nil},
+		{"Check Failure", http.MethodPost, "s3cret", "192.0.2.99", http.StatusBadGateway, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requested = nil
+			req := httptest.NewRequest(tt.method, TRIGGER_PATH, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+			if rec.Code != tt.code {
+				t.Errorf("Expected status %d, got %d", tt.code, rec.Code)
+			}
+			if strings.Join(requested, ",") != strings.Join(tt.expected, ",") || len(requested) != len(tt.expected) {
+				t.Errorf("Expected checks for %q, got %q", tt.expected, requested)
+			}
+		})
+	}
+}
@@ -1,161 +1,1632 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"maps"
+	"net"
 	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/cache"
 	"github.com/cloudflare/cloudflare-go/v4/dns"
 	"github.com/cloudflare/cloudflare-go/v4/option"
-	"github.com/cloudflare/cloudflare-go/v4/zones"
 	log "github.com/sirupsen/logrus"
 )
 
 // Other Endpoints
 const PUB_IP_SERVICE_ENDPOINT = "https://api.ipify.org"
+const PUB_IPV6_SERVICE_ENDPOINT = "https://api6.ipify.org"
+
+// Services replying with the public IPv4 address, selectable by name with the ipService flag or a record's source
+var IP_SERVICES = map[string]string{
+	"ipify":       PUB_IP_SERVICE_ENDPOINT,
+	"icanhazip":   "https://ipv4.icanhazip.com",
+	"ifconfig.me": "https://ifconfig.me/ip",
+	"seeip":       "https://api.seeip.org",
+}
 
 // HTTP Method Constants
 const GET_METHOD_KEY = "GET"
 
+// Largest response accepted from an IP detection service, an address with some whitespace is all it should ever send
+const DETECTION_MAX_BODY = 256
+
 func main() {
 	// required vars for application run
 	var apiToken string
 	var logLevel string
+	var noColor bool
+	var checkOnly bool
 	var domainName string
+	var domainsFile string
 	var handleWWW bool
+	var interval time.Duration
+	var pidFile string
+	var stateFile string
+	var auditLog string
+	var metricsFile string
+	var summaryFile string
+	var reportFormat string
+	var reportFile string
+	var historyRetention time.Duration
+	var cacheTTL time.Duration
+	var cronExpression string
+	var jitter time.Duration
+	var healthAddr string
+	var readyWindow time.Duration
+	var staleAfter time.Duration
+	var maxBackoff time.Duration
+	var notifyReminder time.Duration
+	var controlToken string
+	var grpcAddr string
+	var dyndnsAddr string
+	var dyndnsUsername string
+	var dyndnsPassword string
+	var tokenFile string
+	var kubernetesMode bool
+	var leaseName string
+	var healthcheck bool
+	var watchNetlink bool
+	var wanInterface string
+	var watchFile string
+	var watchConfig bool
+	var zoneID string
+	var accountID string
+	var ttl int
+	var proxied string
+	var managedComment bool
+	var tag string
+	var applyTag string
+	var heartbeat string
+	var proxy string
+	var geoCheck string
+	var geoService string
+	var force bool
+	var enrich bool
+	var reverseLookup bool
+	var skipOnVPN bool
+	var listenAddr string
+	var listenToken string
+	var simulate bool
+	var apiBase string
+	var vpnInterfaces string
+	var ipService string
+	var userAgent string
+	var detectTimeout time.Duration
+	var apiTimeout time.Duration
+	var apiRetries int
+	var caBundle string
+	var clientCert string
+	var clientKey string
+	var dnssecCheck bool
+	var purge string
+	var failoverIP string
+	var failoverAfter time.Duration
+	var configValues repeatedFlag
+	var ageIdentity string
+	var workers int
+	var zoneWorkers int
+	var detectIdleTimeout time.Duration
+	var detectMaxIdleConns int
 	// CLI flags for application run
 	flag.StringVar(&apiToken, "token", "", "Required. API Token for requests.")
-	flag.StringVar(&logLevel, "logLevel", "Warn", "Log level to set. Defaults to Warn.")
+	flag.StringVar(&tokenFile, "tokenFile", "", "Path of a file containing the API Token, e.g. a mounted Kubernetes Secret. Used when token isn't provided.")
+	flag.Var(&configValues, "config", "Path of a YAML config file listing the records to update, which may span several zones. Given more than once, or as a directory, the files are merged in order, later ones overriding earlier ones. Disabled by default.")
+	flag.StringVar(&ageIdentity, "ageIdentity", "", "Path of an age identity file, as written by age-keygen, to decrypt a config file encrypted with age with. The identity can also be given in the GO_DNS_UPDATE_AGE_KEY environment variable. Disabled by default.")
+	flag.StringVar(&logLevel, "logLevel", "Warn", "Log level to set, one of Debug, Info, Warn, Error and Fatal. Defaults to Warn.")
+	flag.BoolVar(&noColor, "no-color", false, "Don't color the console output, as does setting the NO_COLOR environment variable. Output is only colored on a terminal to begin with. Defaults to false.")
 	flag.StringVar(&domainName, "domainName", "", "Required. The domain name to update.")
+	flag.StringVar(&domainsFile, "domainsFile", "", "Path of a file listing records to update, one name per line optionally followed by overrides, e.g. nas.lab.example.com www ttl=300. Read along with the config file. Disabled by default.")
+	flag.StringVar(&zoneID, "zoneID", "", "ID of the zone domainName is in, so zones aren't listed to find it and the API Token needs no Zone:Read permission. Defaults to looking the zone up.")
+	flag.BoolVar(&checkOnly, "check", false, "Only detect the public IP and compare the records with it, exiting non-zero when any is out of sync instead of updating it. Needs only read access to the zones. Defaults to false.")
+	flag.IntVar(&ttl, "ttl", 0, "TTL in seconds to set on the records, 1 means automatic. Defaults to 0, which keeps each record's existing TTL.")
+	flag.StringVar(&proxied, "proxied", "", "Set to true or false to turn Cloudflare proxying on or off for the records. Defaults to empty, which keeps each record's existing setting.")
+	flag.BoolVar(&managedComment, "comment", false, "Write a comment noting the time and previous IP address on every record this program changes. Defaults to false.")
+	flag.StringVar(&tag, "tag", "", "Also manage every A record in the zone carrying this Cloudflare tag, e.g. ddns. Defaults to empty.")
+	flag.StringVar(&applyTag, "applyTag", "", "Tag to add to every record this program manages, e.g. ddns. Defaults to empty.")
+	flag.StringVar(&heartbeat, "heartbeat", "", "Name of a TXT record (e.g. _ddns.example.com) to write the time, host and IP address of every successful check to, so it can be looked up with dig. Disabled by default.")
+	flag.BoolVar(&dnssecCheck, "dnssecCheck", false, "Check the DNSSEC status of every zone on each check and notify when it's pending or in error, as validating resolvers then can't resolve the records. Defaults to false.")
+	flag.StringVar(&failoverIP, "failoverIP", "", "Address (e.g. of a cloud relay) to point the records at once detecting the public IP has failed for failoverAfter, they're pointed back when detection recovers. Disabled by default.")
+	flag.DurationVar(&failoverAfter, "failoverAfter", 10*time.Minute, "How long detecting the public IP must keep failing before the records are pointed at failoverIP, 0 fails over straight away. Defaults to 10m.")
+	flag.StringVar(&purge, "purge", "", "Purge the Cloudflare cache after records change, hosts purges what's cached for the changed hostnames and everything the whole zone. Disabled by default.")
+	flag.IntVar(&workers, "workers", DEFAULT_WORKERS, fmt.Sprintf("How many Cloudflare API calls may run at once when many records or zones are updated. Defaults to %d.", DEFAULT_WORKERS))
+	flag.IntVar(&zoneWorkers, "zoneWorkers", DEFAULT_ZONE_WORKERS, fmt.Sprintf("How many Cloudflare API calls may run at once within a single zone. Defaults to %d.", DEFAULT_ZONE_WORKERS))
+	flag.DurationVar(&detectIdleTimeout, "detectIdleTimeout", 90*time.Second, "How long connections to the IP detection service are kept open for reuse by the next check, 0 disables keep-alives. Defaults to 90s.")
+	flag.IntVar(&detectMaxIdleConns, "detectMaxIdleConns", 2, "How many idle connections to each IP detection service are kept for reuse. Defaults to 2.")
+	flag.DurationVar(&detectTimeout, "detectTimeout", DEFAULT_TIMEOUT, "How long detecting the public IP may take, raise it on slow links. Defaults to 5s.")
+	flag.DurationVar(&apiTimeout, "apiTimeout", DEFAULT_TIMEOUT, "How long each Cloudflare API request may take. Defaults to 5s.")
+	flag.IntVar(&apiRetries, "apiRetries", DEFAULT_API_RETRIES, fmt.Sprintf("How often a failed Cloudflare API request is retried. Defaults to %d.", DEFAULT_API_RETRIES))
+	flag.StringVar(&userAgent, "userAgent", "", "User-Agent sent with the requests to Cloudflare and the IP detection services. Defaults to go-dns-update/<version>.")
+	flag.StringVar(&ipService, "ipService", "", "Service detecting the public IP address, one of ipify, icanhazip, ifconfig.me and seeip or the URL of another one replying with just the address. Defaults to ipify.")
+	flag.StringVar(&geoCheck, "geoCheck", "", "Look up the country and network of a new public IP address and warn, or with block refuse the change, when they differ from the previous address's. Disabled by default.")
+	flag.StringVar(&geoService, "geoService", GEO_SERVICE_ENDPOINT, "Service looking up where an address is for geoCheck, queried as <geoService>/<ip>/json like ipinfo.io. Defaults to https://ipinfo.io.")
+	flag.BoolVar(&enrich, "enrich", false, "Look up the network of changed records' new addresses with geoService and include it in logs and notifications, e.g. 198.51.100.7 (AS7922 Comcast). Defaults to false.")
+	flag.BoolVar(&reverseLookup, "reverseLookup", false, "Look up the reverse DNS name of the public IP when records change and include it in the logs and the daemon's history, showing e.g. a move onto another ISP pool or CGNAT range. Defaults to false.")
+	flag.BoolVar(&skipOnVPN, "skipOnVPN", false, "Skip checks while traffic to the internet leaves through a VPN interface, so the records aren't pointed at the VPN's exit address. Defaults to false.")
+	flag.StringVar(&vpnInterfaces, "vpnInterfaces", DEFAULT_VPN_INTERFACES, "Comma separated names or patterns of the interfaces skipOnVPN treats as VPNs. Defaults to wg*,tun*,tap*.")
+	flag.BoolVar(&force, "force", false, "Make changes geoCheck=block would refuse. Defaults to false.")
+	flag.BoolVar(&simulate, "simulate", false, "Run against a built-in fake of the Cloudflare API holding a stale record for every target instead of the real one, to try the program out without touching a real zone. Can't be combined with a token. Disabled by default.")
+	flag.StringVar(&accountID, "accountID", "", "ID of the Cloudflare account zones are looked up in, for API Tokens with access to more than one. Defaults to every account the API Token has access to.")
+	flag.StringVar(&apiBase, "apiBase", "", "Base URL of the Cloudflare API, e.g. of an internal API gateway, a sandbox or a recording proxy. Defaults to Cloudflare's.")
+	flag.StringVar(&proxy, "proxy", "", "Proxy for the requests to Cloudflare and the IP detection services, e.g. http://proxy.corp:3128 or socks5://127.0.0.1:1080. Defaults to the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.")
+	flag.StringVar(&caBundle, "caBundle", "", "Path of a PEM file of certificate authorities to trust besides the system ones, e.g. a TLS-intercepting proxy's or a self-hosted IP detection service's. Disabled by default.")
+	flag.StringVar(&clientCert, "clientCert", "", "Path of a PEM client certificate presented to IP detection services asking for one, requires clientKey. Disabled by default.")
+	flag.StringVar(&clientKey, "clientKey", "", "Path of the PEM private key of clientCert.")
 	flag.BoolVar(&handleWWW, "handleWWW", false, "Sometimes a separate www domain is available for the same root domain name, if this flag is set, it will update both the root domain name and the www domain name values with the same IP address. Defaults to false.")
+	flag.DurationVar(&interval, "interval", 0, "Run as a daemon, checking the public IP address on this interval (e.g. 5m). Defaults to 0, which performs a single check and exits.")
+	flag.StringVar(&cronExpression, "schedule", "", "Run as a daemon, checking the public IP address according to this cron expression (e.g. \"*/5 * * * *\" or @hourly). Can't be combined with interval.")
+	flag.DurationVar(&jitter, "jitter", 0, "Daemon mode only. Delay each check by a random amount up to this duration (e.g. 30s) so many devices on the same schedule don't all check at once. Defaults to 0.")
+	flag.StringVar(&metricsFile, "metricsFile", "", "Path of a file to write metrics to after every check in the format of node_exporter's textfile collector, e.g. /var/lib/node_exporter/textfile/go_dns_update.prom. Use with stateFile for the totals to add up across runs. Disabled by default.")
+	flag.StringVar(&summaryFile, "summaryFile", "", "Path of a file to replace with a JSON summary of every check, e.g. its duration, detection source and how many records were checked, changed and failed, for monitoring scripts to read. Disabled by default.")
+	flag.StringVar(&reportFormat, "report", "", "Write a report of what every check did to each record for CI pipelines, junit for JUnit XML or json. Disabled by default.")
+	flag.StringVar(&reportFile, "reportFile", "", "Path of the file the report flag writes. Defaults to report.xml for junit and report.json for json.")
+	flag.StringVar(&auditLog, "auditLog", "", "Path of a file to append what every check did to each record to, one JSON line per record, queried by the history command. A path ending in .db, .sqlite or .sqlite3 is an SQLite database instead. Disabled by default.")
+	flag.DurationVar(&historyRetention, "historyRetention", 0, "Drop audit log entries older than this (e.g. 720h for 30 days) whenever a check is added, needs an SQLite auditLog. Defaults to 0, which keeps every entry.")
+	flag.StringVar(&stateFile, "stateFile", "", "Path of a file to record when checks last ran and last succeeded in, read back by the status command and carried over daemon restarts. A path ending in .db, .sqlite or .sqlite3 is an SQLite database instead. Disabled by default.")
+	flag.StringVar(&pidFile, "pidFile", "", "Daemon mode only. Path of a file to write the process ID to on start, removed again on shutdown.")
+	flag.StringVar(&healthAddr, "healthAddr", "", "Daemon mode only. Address (e.g. :8080) for the daemon's HTTP server, serving the /healthz, /livez and /readyz endpoints and the control API if enabled. Disabled by default.")
+	flag.DurationVar(&staleAfter, "staleAfter", 0, "Daemon mode only. Send an updater stale notification when no check has succeeded within this duration (e.g. 1h). Disabled by default.")
+	flag.DurationVar(&notifyReminder, "notifyReminder", DEFAULT_NOTIFY_REMINDER, "While checks keep failing, only the first failure, a different failure and one every this long are sent to the notification channels, and once checks succeed again that's sent too. Set to 0 to only send the first. Defaults to 6h.")
+	flag.DurationVar(&maxBackoff, "maxBackoff", DEFAULT_MAX_BACKOFF, "Daemon mode only. While checks keep failing, e.g. during a Cloudflare outage, the time until the next one is doubled with each failure up to this long, going back to the schedule once one succeeds. Set to 0 to disable. Defaults to 1h.")
+	flag.DurationVar(&cacheTTL, "cacheTTL", 0, "Daemon mode only. Keep the zones and records listed for this long (e.g. 30m) instead of listing them on every check, changes made outside the program are then only seen once it's up. Records that turn out to be gone are listed again straight away. Disabled by default.")
+	flag.DurationVar(&readyWindow, "readyWindow", 0, "Daemon mode only. /readyz reports ready while a check has succeeded within this window. Defaults to three times the gap between checks.")
+	flag.StringVar(&controlToken, "controlToken", "", "Daemon mode only. Token enabling the control API under /api and the web dashboard under /dashboard on the daemon's HTTP server. Disabled by default.")
+	flag.StringVar(&grpcAddr, "grpcAddr", "", "Daemon mode only. Address (e.g. :9090) to serve the gRPC API on, requires controlToken. Disabled by default.")
+	flag.StringVar(&dyndnsAddr, "dyndnsAddr", "", "Run as a dyndns2 compatible server on this address (e.g. :8245), applying update requests from routers to records within domainName. Can't be combined with interval or schedule.")
+	flag.StringVar(&listenAddr, "listenAddr", "", "Listen on this address (e.g. :8246) for POST /trigger requests running a check straight away, optionally with the public IP in the body. Can't be combined with interval, schedule or dyndnsAddr.")
+	flag.StringVar(&listenToken, "listenToken", "", "Bearer token requests to the listenAddr trigger endpoint must present.")
+	flag.StringVar(&dyndnsUsername, "dyndnsUsername", "", "Username routers must use to authenticate with the dyndns2 server.")
+	flag.StringVar(&dyndnsPassword, "dyndnsPassword", "", "Password routers must use to authenticate with the dyndns2 server.")
+	flag.BoolVar(&kubernetesMode, "kubernetes", false, "Daemon mode only. Run as a Kubernetes controller, using a Lease for leader election so only one replica updates records and recording changes as Kubernetes Events. Defaults to false.")
+	flag.StringVar(&leaseName, "leaseName", "go-dns-update", "Name of the Lease used for leader election in Kubernetes mode.")
+	flag.BoolVar(&healthcheck, "healthcheck", false, "Probe the /readyz endpoint of the daemon running with the same healthAddr and exit 0 if it is ready, 1 otherwise. Without healthAddr, reads stateFile instead and requires a check to have succeeded within readyWindow. Meant for Docker's HEALTHCHECK.")
+	flag.BoolVar(&watchNetlink, "watchNetlink", false, "Daemon mode only, Linux only. Check immediately when the default route or an interface address changes instead of waiting for the next scheduled check. Defaults to false.")
+	flag.StringVar(&wanInterface, "wanInterface", "", "Only react to address changes on this interface (e.g. ppp0) when watching netlink. Defaults to any interface.")
+	flag.StringVar(&watchFile, "watchFile", "", "Daemon mode only. Check immediately whenever this file changes, e.g. a DHCP lease file or pppd status file. Disabled by default.")
+	flag.BoolVar(&watchConfig, "watchConfig", false, "Daemon mode only. Reload the config file whenever it changes, as sending the daemon SIGHUP does, so changes made by configuration management apply without a restart. Defaults to false.")
 	flag.Parse()
 
+	// Any flag not given on the command line can come from the environment instead, e.g. GO_DNS_UPDATE_DOMAINNAME
+	// This lets a Kubernetes ConfigMap provide the configuration through envFrom
+	if err := ApplyEnvironmentFlags(flag.CommandLine, ENV_FLAG_PREFIX); err != nil {
+		log.Fatal(err.Error())
+	}
+
 	// Configure log-level
 	SetLogLevel(logLevel)
+	log.AddHook(CheckIDHook{})
+	if noColor {
+		DisableColor()
+	} else {
+		SetLogColors()
+	}
 
-	// No point in continuing execution if these flags are not provided
-	if apiToken == "" || domainName == "" {
-		log.Fatal("No values provided for apiToken flag, nor domainName flag. Aborting...")
+	// Answer the probe and get out of the way, nothing else is needed for it
+	if healthcheck {
+		probe := func() error { return Healthcheck(DaemonBaseURL(healthAddr)) }
+		// Without a health endpoint the state file tells whether checks keep succeeding
+		if healthAddr == "" {
+			if stateFile == "" {
+				log.Fatal("The healthcheck flag needs the healthAddr or stateFile flag of the running daemon. Aborting...")
+			}
+			maxAge := readyWindow
+			if maxAge <= 0 && interval > 0 {
+				maxAge = DefaultReadyWindow(IntervalSchedule{Interval: interval}, time.Now())
+			}
+			if maxAge <= 0 && cronExpression != "" {
+				if cronSchedule, err := ParseCronSchedule(cronExpression); err == nil {
+					maxAge = DefaultReadyWindow(cronSchedule, time.Now())
+				}
+			}
+			probe = func() error { return RunStatus(stateFile, maxAge, time.Now(), os.Stdout) }
+		}
+		if err := probe(); err != nil {
+			fmt.Fprintln(os.Stderr, Colorize(os.Stderr, ANSI_RED, err.Error()))
+			os.Exit(1)
+		}
 		return
 	}
 
-	// create Cloudflare client
-	// pass in the provided api token
-	// set the request timeout to 5 seconds
-	// the default retry amount is 2
-	cfClient := cloudflare.NewClient(
-		option.WithAPIToken(apiToken),
-		option.WithRequestTimeout(5*time.Second),
-	)
+	// Commands which talk to an already running daemon or read local state rather than talking to Cloudflare
+	switch flag.Arg(0) {
+	case "":
+	case "status":
+		if stateFile == "" {
+			log.Fatal("The status command needs the stateFile flag. Aborting...")
+		}
+		statusFlags := flag.NewFlagSet("status", flag.ExitOnError)
+		maxAge := statusFlags.Duration("maxAge", 0, "Optional. Exit with an error unless a check has succeeded within this duration (e.g. 1h). Disabled by default.")
+		statusFlags.Parse(flag.Args()[1:])
+		if err := RunStatus(stateFile, *maxAge, time.Now(), os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, Colorize(os.Stderr, ANSI_RED, err.Error()))
+			os.Exit(1)
+		}
+		return
+	case HISTORY_COMMAND:
+		if auditLog == "" {
+			log.Fatal("The history command needs the auditLog flag. Aborting...")
+		}
+		if err := RunHistory(auditLog, flag.Args()[1:], time.Now(), os.Stdout); err != nil {
+			log.Fatalf("%v. Aborting...", err)
+		}
+		return
+	case "tui":
+		if healthAddr == "" || controlToken == "" {
+			log.Fatal("The tui command needs the healthAddr and controlToken flags of the running daemon. Aborting...")
+		}
+		if err := RunTUI(DaemonBaseURL(healthAddr), controlToken, os.Stdout); err != nil {
+			log.Fatal(err.Error())
+		}
+		return
+	default:
+		// Zone commands need the token and last-change and audit the accounts too, they're run once those are set up
+		if !slices.Contains(ZONE_COMMANDS, flag.Arg(0)) && flag.Arg(0) != LAST_CHANGE_COMMAND && flag.Arg(0) != AUDIT_COMMAND {
+			log.Fatalf("Unknown command %q. Aborting...", flag.Arg(0))
+		}
+	}
 
-	//create channels for async calls to communicate via
-	zoneIDChan := make(chan string, 1)
-	publicIPChan := make(chan string, 1)
+	// The records to update with the main token, from the domainName flag and/or the config file
+	configTargets := func(config Config) []RecordConfig {
+		var targets []RecordConfig
+		if domainName != "" {
+			targets = append(targets, RecordConfig{Name: domainName, WWW: handleWWW, ZoneID: zoneID})
+		}
+		return append(targets, config.Records...)
+	}
+	ageIdentities, err := LoadAgeIdentities(ageIdentity)
+	if err != nil {
+		log.Fatalf("%v. Aborting...", err)
+	}
+	configFiles, err := ConfigFiles(configValues)
+	if err != nil {
+		log.Fatalf("%v. Aborting...", err)
+	}
+	var config Config
+	if len(configFiles) > 0 {
+		loaded, err := LoadConfigs(configFiles, ageIdentities)
+		if err != nil {
+			// Printed as is so each problem stays on a line of its own
+			fmt.Fprintln(os.Stderr, Colorize(os.Stderr, ANSI_RED, err.Error()))
+			os.Exit(1)
+		}
+		config = *loaded
+		// The flags win over the config file
+		if apiToken == "" && tokenFile == "" {
+			apiToken, tokenFile = config.Token, config.TokenFile
+		}
+		if heartbeat == "" {
+			heartbeat = config.Heartbeat
+		}
+		if ipService == "" {
+			ipService = config.IPService
+		}
+		if apiBase == "" {
+			apiBase = config.APIBase
+		}
+		if accountID == "" {
+			accountID = config.AccountID
+		}
+		// These flags have defaults, so only ones left unset give way
+		setFlags := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+		if !setFlags["detectTimeout"] && config.DetectTimeout > 0 {
+			detectTimeout = config.DetectTimeout
+		}
+		if !setFlags["apiTimeout"] && config.APITimeout > 0 {
+			apiTimeout = config.APITimeout
+		}
+		if !setFlags["apiRetries"] && config.APIRetries != nil {
+			apiRetries = *config.APIRetries
+		}
+	}
 
-	// anonymous function for the goroutine for GetZoneID
-	go func() {
-		zoneID, err := GetZoneID(*cfClient, domainName)
+	if domainsFile != "" {
+		records, err := LoadDomainsFile(domainsFile, config)
 		if err != nil {
-			log.Fatal(err.Error())
-			zoneIDChan <- ""
+			fmt.Fprintln(os.Stderr, Colorize(os.Stderr, ANSI_RED, err.Error()))
+			os.Exit(1)
 		}
-		zoneIDChan <- zoneID
-		// productResponsesCh "receives" productRes
-	}()
+		config.Records = append(config.Records, records...)
+	}
 
-	// anonymous function for the goroutine for GetPublicIP
-	go func() {
-		publicIP, err := GetPublicIP(PUB_IP_SERVICE_ENDPOINT)
+	// Cloudflare returns names in lower case, without the trailing dot and internationalized ones in punycode, the flags may give them any way
+	if domainName, err = NormalizeName(domainName); err != nil {
+		log.Fatalf("The domainName flag %v. Aborting...", err)
+	}
+	if heartbeat, err = NormalizeName(heartbeat); err != nil {
+		log.Fatalf("The heartbeat flag %v. Aborting...", err)
+	}
+	if zoneID != "" {
+		if domainName == "" {
+			log.Fatal("The zoneID flag needs the domainName flag. Aborting...")
+		}
+		if err := CheckZoneID(zoneID); err != nil {
+			log.Fatalf("The zoneID flag %v. Aborting...", err)
+		}
+	}
+	if accountID != "" {
+		if err := CheckAccountID(accountID); err != nil {
+			log.Fatalf("The accountID flag %v. Aborting...", err)
+		}
+	}
+	targets := configTargets(config)
+	apiToken, err = ResolveToken(apiToken, tokenFile)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if historyRetention != 0 && (historyRetention < 0 || !IsSQLitePath(auditLog)) {
+		log.Fatal("The historyRetention flag needs to be positive and an auditLog ending in .db, .sqlite or .sqlite3. Aborting...")
+	}
+	if err := CheckReportFormat(reportFormat); err != nil {
+		log.Fatalf("The report flag %v. Aborting...", err)
+	}
+	ipServiceURL, err := ResolveIPService(ipService)
+	if err != nil {
+		log.Fatalf("The ipService flag %v. Aborting...", err)
+	}
+	if detectTimeout <= 0 || apiTimeout <= 0 || apiRetries < 0 {
+		log.Fatal("The detectTimeout and apiTimeout flags must be positive and apiRetries can't be negative. Aborting...")
+	}
+	if apiBase != "" {
+		if err := validateURL(apiBase); err != nil {
+			log.Fatalf("The apiBase flag %v. Aborting...", err)
+		}
+	}
+	transportConfig := TransportConfig{DetectTimeout: detectTimeout, APITimeout: apiTimeout, APIRetries: apiRetries, UserAgent: userAgent, APIBase: apiBase}
+	if simulate {
+		if apiBase != "" {
+			log.Fatal("The simulate flag and apiBase can't be combined. Aborting...")
+		}
+		// A token means a real setup, which mustn't end up quietly running against the fake
+		if apiToken != "" || len(config.Accounts) > 0 {
+			log.Fatal("The simulate flag can't be combined with a token, tokenFile or accounts. Aborting...")
+		}
+		if transportConfig.APIBase, err = StartSimulatedCloudflare(NewSimulatedCloudflare(targets)); err != nil {
+			log.Fatalf("%v. Aborting...", err)
+		}
+		apiToken = "simulated"
+		log.Warnf("Simulating the Cloudflare API at %v, no real zone is changed", transportConfig.APIBase)
+	}
+	if proxy != "" {
+		if transportConfig.Proxy, err = ParseProxy(proxy); err != nil {
+			log.Fatalf("The proxy flag %v. Aborting...", err)
+		}
+	}
+	if caBundle != "" {
+		if transportConfig.RootCAs, err = LoadCABundle(caBundle); err != nil {
+			log.Fatalf("%v. Aborting...", err)
+		}
+	}
+	if (clientCert == "") != (clientKey == "") {
+		log.Fatal("The clientCert and clientKey flags must be provided together. Aborting...")
+	}
+	if clientCert != "" {
+		certificate, err := LoadClientCertificate(clientCert, clientKey)
 		if err != nil {
-			log.Fatal(err.Error())
-			publicIPChan <- ""
+			log.Fatalf("%v. Aborting...", err)
 		}
-		publicIPChan <- publicIP
-	}()
+		transportConfig.ClientCertificates = []tls.Certificate{certificate}
+	}
+
+	// Zone commands only need the token
+	detectionChecker := &Checker{DetectionClient: NewDetectionClient(0, 0, transportConfig), Sources: config.Sources, IPService: ipServiceURL}
+	if slices.Contains(ZONE_COMMANDS, flag.Arg(0)) {
+		if apiToken == "" {
+			log.Fatalf("The %v command needs the token flag. Aborting...", flag.Arg(0))
+		}
+		if err := RunZoneCommand(SDKClient{Client: NewCloudflareClient(apiToken, transportConfig), AccountID: accountID}, detectionChecker.DetectSource, flag.Arg(0), flag.Args()[1:], domainName, os.Stdin, os.Stdout); err != nil {
+			log.Fatalf("%v. Aborting...", err)
+		}
+		return
+	}
 
-	// we can send these as goroutines because they don't depend on each other
-	// get the values after they're sent
-	// if either is blank, something is wrong can't continue anyway
-	publicIP := <-publicIPChan
-	zoneID := <-zoneIDChan
-	if zoneID == "" || publicIP == "" {
-		log.Fatal("Could not retrieve initial values")
+	// No point in continuing execution if these flags are not provided
+	if (apiToken == "" || (len(targets) == 0 && !config.HasResources())) && len(config.Accounts) == 0 {
+		log.Fatal("No values provided for apiToken flag, nor domainName flag or records in the config or domains file. Aborting...")
 		return
 	}
+	if apiToken == "" && len(targets) > 0 {
+		log.Fatal("No value provided for apiToken flag to update the records outside of accounts with. Aborting...")
+	}
 
-	// Get DNS Records
-	domainID, domainIP, wwwDomainID, err := GetDNSRecords(*cfClient, domainName, zoneID, handleWWW)
+	proxiedOption, err := ParseProxied(proxied)
 	if err != nil {
 		log.Fatal(err.Error())
+	}
+	recordOptions := RecordOptions{TTL: ttl, Proxied: proxiedOption, ManagedComment: managedComment, Tag: tag, ApplyTag: applyTag, Purge: purge, CheckOnly: checkOnly}
+	if checkOnly && (interval > 0 || cronExpression != "" || listenAddr != "" || dyndnsAddr != "") {
+		log.Fatal("The check flag is for single runs, it can't be combined with the interval, schedule, listenAddr or dyndnsAddr flags. Aborting...")
+	}
+	// The geo check and the enrichment share their lookups, so each address is only looked up once
+	var geoLookup *GeoLookup
+	if geoCheck != "" || enrich {
+		if err := validateURL(geoService); err != nil {
+			log.Fatalf("The geoService flag %v. Aborting...", err)
+		}
+		geoLookup = &GeoLookup{Endpoint: geoService, Client: NewDetectionClient(0, 0, transportConfig)}
+	}
+	switch geoCheck {
+	case "":
+	case GEO_CHECK_WARN, GEO_CHECK_BLOCK:
+		recordOptions.Geo = &GeoGuard{GeoLookup: geoLookup, Block: geoCheck == GEO_CHECK_BLOCK && !force}
+		if failoverIP != "" {
+			recordOptions.Geo.Trusted = []string{failoverIP}
+		}
+	default:
+		log.Fatalf("The geoCheck flag must be %v or %v, got %q. Aborting...", GEO_CHECK_WARN, GEO_CHECK_BLOCK, geoCheck)
+	}
+	if err := recordOptions.Validate(); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	notifications := NewNotifications(config)
+	notifications.Reminder = notifyReminder
+	// A run from cron carries on with the failures the previous runs notified about
+	if stateFile != "" {
+		state, err := LoadState(stateFile)
+		if err != nil {
+			log.Fatalf("%v. Aborting...", err)
+		}
+		notifications.Restore(state.Failure)
+	}
+	if failoverIP != "" {
+		if _, err := netip.ParseAddr(failoverIP); err != nil {
+			log.Fatalf("The failoverIP flag %q is not an IP address. Aborting...", failoverIP)
+		}
+	}
+	if heartbeat != "" {
+		if err := CheckHostname(heartbeat); err != nil {
+			log.Fatalf("The heartbeat flag %v. Aborting...", err)
+		}
+	}
+	if workers < 1 || zoneWorkers < 1 {
+		log.Fatal("The workers and zoneWorkers flags must be at least 1. Aborting...")
+	}
+
+	// One client per API Token, the flags' own token first when there's anything to use it for
+	var cfClient *cloudflare.Client
+	if apiToken != "" {
+		cfClient = NewCloudflareClient(apiToken, transportConfig)
+	}
+	// The clients are new on every reload, so is what they keep
+	cached := func(client CloudflareAPI) CloudflareAPI {
+		if cacheTTL <= 0 {
+			return client
+		}
+		return NewCachingClient(client, cacheTTL)
+	}
+	newAccounts := func(config Config) ([]Account, map[string]*cloudflare.Client, error) {
+		var accounts []Account
+		clients := map[string]*cloudflare.Client{}
+		if targets := configTargets(config); cfClient != nil {
+			clients[""] = cfClient
+			if len(targets) > 0 {
+				accounts = append(accounts, Account{Client: cached(SDKClient{Client: cfClient, AccountID: accountID}), Targets: targets})
+			}
+		} else if len(targets) > 0 {
+			return nil, nil, fmt.Errorf("no API Token to update the records outside of accounts with")
+		}
+		for _, accountConfig := range config.Accounts {
+			token, err := ResolveToken(accountConfig.Token, accountConfig.TokenFile)
+			if err != nil {
+				return nil, nil, fmt.Errorf("account %v: %w", accountConfig.Name, err)
+			}
+			clients[accountConfig.Name] = NewCloudflareClient(token, transportConfig)
+			if len(accountConfig.Records) > 0 {
+				accounts = append(accounts, Account{Name: accountConfig.Name, Client: cached(SDKClient{Client: clients[accountConfig.Name], AccountID: accountConfig.AccountID}), Targets: accountConfig.Records})
+			}
+		}
+		return accounts, clients, nil
+	}
+	accounts, clients, err := newAccounts(config)
+	if err != nil {
+		log.Fatalf("%v. Aborting...", err)
+	}
+
+	// When each managed record last changed, going by Cloudflare and the state file when there is one
+	if flag.Arg(0) == LAST_CHANGE_COMMAND {
+		var state State
+		if stateFile != "" {
+			if state, err = LoadState(stateFile); err != nil {
+				log.Fatalf("%v. Aborting...", err)
+			}
+		}
+		if err := RunLastChange(accounts, state, time.Now(), os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, Colorize(os.Stderr, ANSI_RED, err.Error()))
+			os.Exit(1)
+		}
 		return
 	}
 
-	// If for some reason this comes back blank, fail
-	if domainID == "" {
-		log.Fatal("Couldn't obtain A Record ID")
+	// The changes Cloudflare logged to the managed records, checked against the local audit log for ones made outside this program
+	if flag.Arg(0) == AUDIT_COMMAND {
+		if auditLog == "" {
+			log.Fatal("The audit command needs the auditLog flag. Aborting...")
+		}
+		if err := RunAuditCheck(accounts, auditLog, flag.Args()[1:], time.Now(), os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, Colorize(os.Stderr, ANSI_RED, err.Error()))
+			os.Exit(1)
+		}
 		return
 	}
-	// If for some reason this comes back blank, fail
-	if handleWWW && wwwDomainID == "" {
-		log.Fatal(`Couldn't obtain 'www' A Record ID`)
+
+	resources, err := BuildResources(config, clients)
+	if err != nil {
+		log.Fatalf("%v. Aborting...", err)
+	}
+
+	checker := &Checker{
+		Accounts:        accounts,
+		Options:         recordOptions,
+		Pool:            NewWorkerPool(workers, zoneWorkers),
+		DetectionClient: NewDetectionClient(detectIdleTimeout, detectMaxIdleConns, transportConfig),
+		IPService:       ipServiceURL,
+		Heartbeat:       heartbeat,
+		DNSSECCheck:     dnssecCheck,
+		ReverseLookup:   reverseLookup,
+		Sources:         config.Sources,
+		Resources:       resources,
+		Failover:        failoverIP,
+		FailoverAfter:   failoverAfter,
+	}
+	if enrich {
+		checker.Enrich = geoLookup
+	}
+	if skipOnVPN {
+		if checker.VPNInterfaces, err = ParseVPNInterfaces(vpnInterfaces); err != nil {
+			log.Fatalf("The vpnInterfaces flag %v. Aborting...", err)
+		}
+	}
+
+	// Reading the config file again applies its records, accounts, sources, notifiers and resources
+	// What's only taken from it on start, e.g. the token and the heartbeat, needs a restart, as do the flags
+	reloadConfig := func() error {
+		// A directory is listed again, so files added to it are read too
+		paths, err := ConfigFiles(configValues)
+		if err != nil {
+			return err
+		}
+		loaded, err := LoadConfigs(paths, ageIdentities)
+		if err != nil {
+			return err
+		}
+		if domainsFile != "" {
+			records, err := LoadDomainsFile(domainsFile, *loaded)
+			if err != nil {
+				return err
+			}
+			loaded.Records = append(loaded.Records, records...)
+		}
+		if len(configTargets(*loaded)) == 0 && len(loaded.Accounts) == 0 && !loaded.HasResources() {
+			return fmt.Errorf("config %v: nothing to update", strings.Join(paths, ", "))
+		}
+		accounts, clients, err := newAccounts(*loaded)
+		if err != nil {
+			return err
+		}
+		resources, err := BuildResources(*loaded, clients)
+		if err != nil {
+			return err
+		}
+		checker.Accounts, checker.Sources, checker.Resources = accounts, loaded.Sources, resources
+		notifications.Replace(NewNotifications(*loaded))
+		return nil
+	}
+
+	// Every finished check is notified about and, when asked, noted in the state file, the metrics file, the summary file, the report and the audit log
+	// A skipped check didn't update anything, so it's neither notified about nor recorded as a success
+	finishCheck := func(report CheckReport, err error) {
+		if report.Skipped != "" {
+			return
+		}
+		now := time.Now()
+		notifications.Dispatch(now, report, err)
+		if stateFile != "" || metricsFile != "" {
+			state, stateErr := SaveCheckState(stateFile, now, report, err, notifications.Failure())
+			if stateErr != nil {
+				log.Warn(stateErr.Error())
+			}
+			if metricsFile != "" {
+				if metricsErr := WriteMetricsFile(metricsFile, state); metricsErr != nil {
+					log.Warn(metricsErr.Error())
+				}
+			}
+		}
+		if summaryFile != "" {
+			if summaryErr := WriteSummaryFile(summaryFile, now, report, err); summaryErr != nil {
+				log.Warn(summaryErr.Error())
+			}
+		}
+		if reportFormat != "" {
+			if reportErr := WriteReport(cmp.Or(reportFile, DefaultReportFile(reportFormat)), reportFormat, now, report, err); reportErr != nil {
+				log.Warn(reportErr.Error())
+			}
+		}
+		if auditLog != "" {
+			if auditErr := AppendAudit(auditLog, now, report, err, historyRetention); auditErr != nil {
+				log.Warn(auditErr.Error())
+			}
+		}
+	}
+
+	if dyndnsAddr != "" && listenAddr != "" {
+		log.Fatal("The dyndnsAddr and listenAddr flags can't be combined. Aborting...")
+	}
+
+	// Server mode, routers tell us their IP address rather than us detecting it
+	if dyndnsAddr != "" {
+		if interval > 0 || cronExpression != "" {
+			log.Fatal("The dyndnsAddr flag can't be combined with the interval or schedule flags. Aborting...")
+		}
+		if domainName == "" || cfClient == nil {
+			log.Fatal("The dyndnsAddr flag needs the domainName and token flags. Aborting...")
+		}
+		if dyndnsUsername == "" || dyndnsPassword == "" {
+			log.Fatal("No values provided for dyndnsUsername flag, nor dyndnsPassword flag. Aborting...")
+		}
+		err := RunDyndnsServer(dyndnsAddr, &DyndnsServer{
+			Username:   dyndnsUsername,
+			Password:   dyndnsPassword,
+			DomainName: domainName,
+			Update: func(hostname string, ip string) (bool, error) {
+				return UpdateHostname(SDKClient{Client: cfClient, AccountID: accountID}, domainName, hostname, ip, recordOptions)
+			},
+		})
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		return
+	}
+
+	// Listen mode, checks run when an external system asks for one rather than on a schedule
+	if listenAddr != "" {
+		if interval > 0 || cronExpression != "" {
+			log.Fatal("The listenAddr flag can't be combined with the interval or schedule flags. Aborting...")
+		}
+		if listenToken == "" {
+			log.Fatal("No value provided for listenToken flag. Aborting...")
+		}
+		err := RunTriggerServer(listenAddr, &TriggerServer{
+			Token: listenToken,
+			Check: func(ip string) (CheckReport, error) {
+				report, err := checker.RunCheckWithIP(ip)
+				finishCheck(report, err)
+				return report, err
+			},
+		})
+		if err != nil {
+			log.Fatal(err.Error())
+		}
 		return
 	}
 
-	// If the publicly obtained IP matches our current DNS A Record IP, all set
-	if publicIP == domainIP {
-		// Straight up print this line to console so we can see that it is effectively doing something without increasing log granularity
-		fmt.Println(`DNS Record IP Address matches external IP address, nothing to do`)
+	// Without an interval or schedule this is a single run, which is how the program is typically used from cron
+	if interval <= 0 && cronExpression == "" {
+		checker.Progress = os.Stderr
+		report, err := checker.RunCheck()
+		finishCheck(report, err)
+		if err != nil {
+			log.WithField(CHECK_ID_FIELD, report.CheckID).Error(err.Error())
+			os.Exit(ExitCode(err))
+		}
 		return
 	}
 
-	// Only ends up here in the event that the DNS Records needs to be updated
-	err = UpdateDNSRecord(*cfClient, domainName, zoneID, publicIP, domainID, wwwDomainID, handleWWW)
-	if err != nil {
+	// Daemon mode, keep checking on the provided interval or schedule until told to stop
+	var schedule Schedule = IntervalSchedule{Interval: interval}
+	if cronExpression != "" {
+		if interval > 0 {
+			log.Fatal("Only one of the interval and schedule flags can be provided. Aborting...")
+		}
+		cronSchedule, err := ParseCronSchedule(cronExpression)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		schedule = cronSchedule
+	}
+	if jitter > 0 {
+		schedule = JitterSchedule{Schedule: schedule, Jitter: jitter}
+	}
+	if readyWindow <= 0 {
+		readyWindow = DefaultReadyWindow(schedule, time.Now())
+	}
+	status := &DaemonStatus{ReadyWindow: readyWindow}
+	checker.Options.Paused = func(name string) bool {
+		return status.RecordPaused(name, time.Now())
+	}
+	if stateFile != "" {
+		state, err := LoadState(stateFile)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		status.Restore(state)
+	}
+	daemon := Daemon{
+		Schedule:     schedule,
+		PIDFile:      pidFile,
+		HealthAddr:   healthAddr,
+		ControlToken: controlToken,
+		GRPCAddr:     grpcAddr,
+		Status:       status,
+		StaleAfter:   staleAfter,
+		MaxBackoff:   maxBackoff,
+		Alert:        notifications.Alert,
+		Check: func() (CheckReport, error) {
+			report, err := checker.RunCheck()
+			finishCheck(report, err)
+			return report, err
+		},
+	}
+	if watchNetlink {
+		daemon.Watchers = append(daemon.Watchers, NetlinkWatcher(wanInterface))
+	}
+	if watchFile != "" {
+		daemon.Watchers = append(daemon.Watchers, FileWatcher(watchFile, FILE_WATCH_POLL_INTERVAL))
+	}
+	if len(configFiles) > 0 || domainsFile != "" {
+		daemon.Reload = reloadConfig
+	}
+	if watchConfig {
+		if len(configFiles) == 0 && domainsFile == "" {
+			log.Fatal("The watchConfig flag needs the config or domainsFile flag. Aborting...")
+		}
+		// Directories are watched along with their files, for files being added or removed, and the included files too
+		watched := slices.Concat(configValues, config.Files)
+		if domainsFile != "" {
+			watched = append(watched, domainsFile)
+		}
+		slices.Sort(watched)
+		daemon.ConfigWatcher = FilesWatcher(slices.Compact(watched), FILE_WATCH_POLL_INTERVAL)
+	}
+	if kubernetesMode {
+		kubeClient, err := InClusterKubeClient()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		podName := os.Getenv("POD_NAME")
+		if podName == "" {
+			podName, _ = os.Hostname()
+		}
+		daemon.Leader = &LeaderElector{
+			Client:        kubeClient,
+			LeaseName:     leaseName,
+			Identity:      podName,
+			LeaseDuration: KUBE_LEASE_DURATION,
+			RetryPeriod:   KUBE_LEASE_RETRY_PERIOD,
+		}
+		daemon.Events = NewEventBus()
+		events, cancel := daemon.Events.Subscribe()
+		defer cancel()
+		recorder := KubeEventRecorder{Client: kubeClient, PodName: podName}
+		go recorder.Run(events)
+	}
+	if err := daemon.Run(); err != nil {
 		log.Fatal(err.Error())
 	}
+}
 
+// The state of a managed DNS record after a check
+type RecordState struct {
+	Name    string `json:"name"`
+	IP      string `json:"ip"`
+	Changed bool   `json:"changed"`
+	// What the record pointed at before the check changed it, empty when it didn't
+	Previous string `json:"previous,omitempty"`
+	// Network the new address belongs to, e.g. "AS7922 Comcast Cable Communications, LLC", when looked up
+	Network string `json:"network,omitempty"`
+	// Why the record couldn't be brought in line, empty when it was
+	Error string `json:"error,omitempty"`
+	// Code of the failure, e.g. E_RECORD_NOT_FOUND, empty when the record didn't fail
+	Code string `json:"code,omitempty"`
+	// Ray ID of the Cloudflare response the record failed with, for support tickets
+	RayID string `json:"rayId,omitempty"`
+	// What the record should point at, the IP its source detected or its fixed ip, empty when it failed before that was known
+	Wanted string `json:"wanted,omitempty"`
+	// Whether the record was left as it is because it's paused
+	Paused bool `json:"paused,omitempty"`
+	// Notification channels to tell about changes, empty for the default ones
+	Notify []string `json:"-"`
+}
+
+// Method to describe the record's change, e.g. "example.com updated to 198.51.100.7 (AS7922 Comcast)"
+func (r RecordState) ChangeMessage() string {
+	if r.Network == "" {
+		return fmt.Sprintf("%v updated to %v", r.Name, r.IP)
+	}
+	return fmt.Sprintf("%v updated to %v (%v)", r.Name, r.IP, r.Network)
+}
+
+// What a single check found and did
+type CheckReport struct {
+	PublicIP string        `json:"publicIP"`
+	Records  []RecordState `json:"records"`
+	// Reverse DNS name of the public IP, looked up when the check changed records
+	PTR string `json:"ptr,omitempty"`
+	// Problems that don't fail the check but need looking into, e.g. a zone's DNSSEC being broken
+	Warnings []string `json:"warnings,omitempty"`
+	// ID the check's log lines, notifications and audit entries are marked with
+	CheckID string `json:"checkId,omitempty"`
+	// Where the public IP came from, the detection service's URL, "given" when it was handed to the check or "failover"
+	Source string `json:"source,omitempty"`
+	// How long the check took
+	Duration time.Duration `json:"-"`
+	// Why the check was skipped without detecting the IP or touching a record, e.g. traffic leaving through a VPN
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// Method to report whether the check changed any record
+func (r CheckReport) Changed() bool {
+	for _, record := range r.Records {
+		if record.Changed {
+			return true
+		}
+	}
+	return false
+}
+
+// Method to summarise the check, e.g. "2 changed, 5 unchanged, 1 failed" followed by a line per failed record
+func (r CheckReport) Summary() string {
+	return r.summary(false)
+}
+
+// Method to summarise the check for out, coloring the changes and failures when it's a terminal
+func (r CheckReport) ConsoleSummary(out io.Writer) string {
+	return r.summary(ColorEnabled(out))
+}
+
+// Helper method to write the summary, in color when enabled
+func (r CheckReport) summary(color bool) string {
+	var changed, unchanged int
+	var failures []string
+	for _, record := range r.Records {
+		switch {
+		case record.Error != "":
+			failures = append(failures, colorize(color, ANSI_RED, fmt.Sprintf("  %v: %v", DisplayName(record.Name), record.Error)))
+		case record.Changed:
+			changed++
+		default:
+			unchanged++
+		}
+	}
+	summary := colorize(color && changed > 0, ANSI_GREEN, fmt.Sprintf("%d changed", changed)) +
+		fmt.Sprintf(", %d unchanged, ", unchanged) +
+		colorize(color && len(failures) > 0, ANSI_RED, fmt.Sprintf("%d failed", len(failures)))
+	if len(failures) > 0 {
+		summary += "\n" + strings.Join(failures, "\n")
+	}
+	return summary
+}
+
+// A Cloudflare account, or rather API Token, and the records it's used for
+type Account struct {
+	// Used to tell accounts apart in errors, empty for the account given by the flags
+	Name    string
+	Client  CloudflareAPI
+	Targets []RecordConfig
+}
+
+// Everything a check needs, kept for the life of the process so a daemon reuses its clients between checks
+type Checker struct {
+	Accounts []Account
+	Options  RecordOptions
+	// Bounds the concurrent Cloudflare API calls, nil runs them without a limit
+	Pool *WorkerPool
+	// Client used to detect the Public IP address
+	DetectionClient *http.Client
+	// URL of the service detecting the public IP for records without a source, PUB_IP_SERVICE_ENDPOINT when empty
+	IPService string
+	// Named IP address sources from the config, records refer to them by name
+	Sources map[string]SourceConfig
+	// Things besides DNS records kept pointed at the public IP, e.g. Load Balancer origins
+	Resources []Resource
+	// Name of a TXT record noting when and where the last successful check ran, written with the first account. Disabled when empty
+	Heartbeat string
+	// Looks up the network of changed records' new addresses for logs and notifications, nil when disabled
+	Enrich *GeoLookup
+	// Where the progress of a check is shown while it runs, only a terminal gets it. Not shown when nil
+	Progress io.Writer
+	// Checks are skipped while traffic to the internet leaves through an interface matching one of these, e.g. wg*. Disabled when empty
+	VPNInterfaces []string
+	// Finds the interface traffic to the internet leaves through, RouteInterface when nil
+	routeInterface func() (string, error)
+	// Whether to look up the reverse DNS name of the public IP when records change, showing e.g. a move to another ISP pool or CGNAT
+	ReverseLookup bool
+	// Resolves reverse DNS names, net.DefaultResolver.LookupAddr when nil
+	lookupAddr func(ctx context.Context, addr string) ([]string, error)
+	// Whether to check the DNSSEC status of every zone, warning about ones pending or in error
+	DNSSECCheck bool
+	// Address records are pointed at once detecting their IP has failed for FailoverAfter, disabled when empty
+	Failover      string
+	FailoverAfter time.Duration
+	// When each source started failing, reset by its next successful detection
+	failingSince map[string]time.Time
+}
+
+// Method to perform a single check of the public IP against the DNS records, updating the records that differ
+// Each IP source is asked once and its answer applied to every account, a failing account doesn't stop the others
+// Reports the detected IP address and the state of each record after the check
+func (c *Checker) RunCheck() (CheckReport, error) {
+	return c.RunCheckWithIP("")
+}
+
+// Method to perform a check with the public IP given rather than detected, e.g. by a router's script
+// Records with a source of their own still detect it, an empty givenIP detects the default one as usual
+// The check gets an ID of its own, which the lines logged during it and the report carry
+// A panic fails the check with E_PANIC rather than skipping it, so it's still notified about and recorded
+func (c *Checker) RunCheckWithIP(givenIP string) (report CheckReport, err error) {
+	checkID := NewCheckID()
+	defer StartCheckID(checkID)()
+	started := time.Now()
+	defer func() {
+		report.CheckID, report.Duration = checkID, time.Since(started)
+	}()
+	defer recoverPanic(&err)
+	return c.runCheck(givenIP)
+}
+
+// Helper method to perform the check, see RunCheckWithIP
+func (c *Checker) runCheck(givenIP string) (CheckReport, error) {
+	accounts, options, pool := c.Accounts, c.Options, c.Pool
+	// Detecting now would see the VPN's exit address, not ours
+	if givenIP == "" {
+		if vpn := c.activeVPN(); vpn != "" {
+			fmt.Println(Colorize(os.Stdout, ANSI_YELLOW, fmt.Sprintf("Traffic is leaving through the VPN interface %v, skipping the check", vpn)))
+			return CheckReport{Skipped: fmt.Sprintf("traffic is leaving through the VPN interface %v", vpn)}, nil
+		}
+	}
+	// every source a record asks for, the default one is always needed for the report
+	sources := []string{""}
+	for _, account := range accounts {
+		for _, target := range account.Targets {
+			if !slices.Contains(sources, target.Source) {
+				sources = append(sources, target.Source)
+			}
+		}
+	}
+
+	// detect the public IP from every source and resolve the zones of every account at the same time, they don't depend on each other
+	publicIPs := make(map[string]string, len(sources))
+	// Why the default source failed, its code is the check's when there's no IP to go on
+	var defaultErr error
+	var ipMu sync.Mutex
+	zoneGroups := make([][]ZoneGroup, len(accounts))
+	zoneErrs := make([]error, len(accounts))
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		if source == "" && givenIP != "" {
+			publicIPs[source] = givenIP
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			publicIP, err := func() (publicIP string, err error) {
+				defer recoverPanic(&err)
+				return c.DetectSource(source)
+			}()
+			if err != nil {
+				log.Error(err.Error())
+			}
+			ipMu.Lock()
+			publicIPs[source] = c.applyFailover(source, publicIP, err, time.Now())
+			if source == "" {
+				defaultErr = err
+			}
+			ipMu.Unlock()
+		}()
+	}
+	for i, account := range accounts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer recoverPanic(&zoneErrs[i])
+			zoneGroups[i], zoneErrs[i] = ResolveZones(account.Client, account.Targets)
+		}()
+	}
+	wg.Wait()
+
+	// if the IP is blank, something is wrong can't continue anyway
+	publicIP := publicIPs[""]
+	source := c.defaultService()
+	switch {
+	case givenIP != "":
+		source = "given"
+	case c.Failover != "" && publicIP == c.Failover && defaultErr != nil:
+		source = "failover"
+	}
+	if publicIP == "" {
+		return CheckReport{Source: source}, WithCode(cmp.Or(ErrorCode(defaultErr), E_DETECT_FAILED), fmt.Errorf("could not retrieve initial values"))
+	}
+
+	// the accounts are independent of each other, their calls share the pool
+	// a target that can't be resolved or updated doesn't stop the rest
+	accountRecords := make([][]RecordState, len(accounts))
+	accountErrs := make([]error, len(accounts))
+	accountWarnings := make([][]string, len(accounts))
+	progress := NewProgress(c.Progress)
+	options.Progress = progress
+	for i, account := range accounts {
+		if zoneErrs[i] != nil {
+			accountRecords[i] = TargetFailures(account.Targets, fmt.Errorf("could not retrieve initial values: %w", zoneErrs[i]))
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer recoverPanic(&accountErrs[i])
+			states, err := UpdateZones(account.Client, zoneGroups[i], publicIPs, options, pool)
+			accountRecords[i] = append(accountRecords[i], states...)
+			accountErrs[i] = errors.Join(zoneErrs[i], err)
+			if c.DNSSECCheck {
+				accountWarnings[i] = DNSSECWarnings(account.Client, zoneGroups[i])
+			}
+		}()
+	}
+	wg.Wait()
+	progress.Finish()
+
+	report := CheckReport{PublicIP: publicIP, Source: source}
+	var errs []error
+	for i, account := range accounts {
+		report.Records = append(report.Records, accountRecords[i]...)
+		report.Warnings = append(report.Warnings, accountWarnings[i]...)
+		if accountErrs[i] != nil {
+			errs = append(errs, account.wrapError(accountErrs[i]))
+		}
+	}
+	// Resources can't be checked without syncing them, so a check only run leaves them out
+	if !options.CheckOnly {
+		resourceStates := SyncResources(c.Resources, publicIP)
+		report.Records = append(report.Records, resourceStates...)
+		if err := StatesError(resourceStates); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.Enrich != nil {
+		for i, record := range report.Records {
+			if record.Changed {
+				report.Records[i].Network = c.Enrich.Network(record.IP)
+				log.Info(report.Records[i].ChangeMessage())
+			}
+		}
+	}
+	if c.ReverseLookup && report.Changed() {
+		report.PTR = c.reverseName(publicIP)
+		if report.PTR != "" {
+			log.Infof("The public IP %v resolves back to %v", publicIP, report.PTR)
+		}
+	}
+
+	// Straight up print this line to console so we can see that it is effectively doing something without increasing log granularity
+	if len(errs) == 0 && !report.Changed() {
+		fmt.Println(Colorize(os.Stdout, ANSI_DIM, `DNS Record IP Address matches external IP address, nothing to do`))
+	} else {
+		fmt.Println(report.ConsoleSummary(os.Stdout))
+	}
+	// The heartbeat only records successful checks, failing to write it doesn't fail the check itself
+	if len(errs) == 0 && c.Heartbeat != "" && len(accounts) > 0 && !options.CheckOnly {
+		host, _ := os.Hostname()
+		if err := WriteHeartbeat(accounts[0].Client, c.Heartbeat, HeartbeatContent(time.Now(), host, publicIP)); err != nil {
+			log.Warnf("Updating heartbeat record %v failed: %v", c.Heartbeat, err)
+		}
+	}
+	return report, errors.Join(errs...)
+}
+
+// Helper method to get the VPN interface traffic to the internet currently leaves through, empty when it isn't a VPN's
+func (c *Checker) activeVPN() string {
+	if len(c.VPNInterfaces) == 0 {
+		return ""
+	}
+	routeInterface := c.routeInterface
+	if routeInterface == nil {
+		routeInterface = func() (string, error) { return RouteInterface(ROUTE_PROBE_ADDRESS) }
+	}
+	name, err := routeInterface()
+	if err != nil {
+		// Better to check than to silently stop updating
+		log.Warnf("Checking for an active VPN failed: %v", err)
+		return ""
+	}
+	if IsVPNInterface(name, c.VPNInterfaces) {
+		return name
+	}
+	return ""
+}
+
+// Helper method to look up the reverse DNS name of an address, empty when it has none
+func (c *Checker) reverseName(ip string) string {
+	lookupAddr := c.lookupAddr
+	if lookupAddr == nil {
+		lookupAddr = net.DefaultResolver.LookupAddr
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DEFAULT_TIMEOUT)
+	defer cancel()
+	names, err := lookupAddr(ctx, ip)
+	if err != nil || len(names) == 0 {
+		log.Warnf("Looking up the reverse DNS name of %v failed: %v", ip, err)
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
+
+// Helper method to swap in the failover address once a source has been failing for long enough
+// The detected address is used again as soon as the source recovers
+func (c *Checker) applyFailover(source string, publicIP string, err error, now time.Time) string {
+	if err == nil && publicIP != "" {
+		if _, failing := c.failingSince[source]; failing {
+			log.Warnf("IP detection from %v recovered, pointing records at %v again", c.sourceName(source), publicIP)
+			delete(c.failingSince, source)
+		}
+		return publicIP
+	}
+	if c.Failover == "" {
+		return publicIP
+	}
+	if c.failingSince == nil {
+		c.failingSince = map[string]time.Time{}
+	}
+	since, failing := c.failingSince[source]
+	if !failing {
+		since = now
+		c.failingSince[source] = now
+	}
+	if now.Sub(since) < c.FailoverAfter {
+		return publicIP
+	}
+	log.Warnf("IP detection from %v has failed since %v, pointing records at the failover address %v", c.sourceName(source), since.Format(time.RFC3339), c.Failover)
+	return c.Failover
+}
+
+// Helper method to name a source in log messages
+func (c *Checker) sourceName(source string) string {
+	if source == "" {
+		return c.defaultService()
+	}
+	return source
+}
+
+// Helper method to get the URL of the service detecting the public IP for records without a source
+func (c *Checker) defaultService() string {
+	if c.IPService == "" {
+		return PUB_IP_SERVICE_ENDPOINT
+	}
+	return c.IPService
+}
+
+// Method to turn the ipService flag into a URL, it's either the name of a built-in service or a URL already
+func ResolveIPService(service string) (string, error) {
+	if service == "" {
+		return PUB_IP_SERVICE_ENDPOINT, nil
+	}
+	if endpoint, ok := IP_SERVICES[service]; ok {
+		return endpoint, nil
+	}
+	if err := validateURL(service); err != nil {
+		return "", fmt.Errorf("must be one of %v or a URL, but %w", slices.Sorted(maps.Keys(IP_SERVICES)), err)
+	}
+	return service, nil
+}
+
+// Helper method to name the account an error came from, when it has a name
+func (a Account) wrapError(err error) error {
+	if a.Name == "" {
+		return err
+	}
+	return fmt.Errorf("account %v: %w", a.Name, err)
+}
+
+// Helper method to find the zone every target lives in
+// Zones are only looked up when a target has no zone ID of its own, so a token scoped to a single zone can do without Zone:Read
+// Each registrable domain is looked up once, however many targets live in it, cheaper than listing every zone of a token with access to hundreds
+func ResolveZones(cfClient CloudflareAPI, targets []RecordConfig) ([]ZoneGroup, error) {
+	var domains []string
+	var zoneList []Zone
+	for _, target := range targets {
+		domain := RegistrableDomain(target.Name)
+		if target.ZoneID != "" || slices.Contains(domains, domain) {
+			continue
+		}
+		domains = append(domains, domain)
+		within, err := cfClient.ZonesWithin(domain)
+		if err != nil {
+			return nil, fmt.Errorf("looking up zone failed: %w", err)
+		}
+		zoneList = append(zoneList, within...)
+	}
+	return GroupByZone(zoneList, targets)
+}
+
+// A record and what it should look like
+type recordPlan struct {
+	record  DNSRecord
+	content string
+	options RecordOptions
+	notify  []string
+	// Plans of the same batch, a root and its www record, are edited at the same moment
+	batch int
+}
+
+// Method to bring the records of each zone in line with the public IP
+// publicIPs holds the IP detected by each source, keyed by the source URL with the default source under ""
+// Only the targets' records and the tagged ones are listed of each zone, and the API calls run through the pool
+// Reports the state of each record afterwards, a record that fails is reported as such without stopping the others
+func UpdateZones(cfClient CloudflareAPI, zoneGroups []ZoneGroup, publicIPs map[string]string, options RecordOptions, pool *WorkerPool) ([]RecordState, error) {
+	// Get DNS Records of every zone
+	zoneRecords := make([][]DNSRecord, len(zoneGroups))
+	listErrs := make([]error, len(zoneGroups))
+	options.Progress.AddZones(len(zoneGroups))
+	var wg sync.WaitGroup
+	for i, group := range zoneGroups {
+		// Zones that can't be edited are reported below without listing their records
+		if group.Zone.EditableError() != nil && !options.CheckOnly {
+			options.Progress.ZoneListed()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer recoverPanic(&listErrs[i])
+			pool.Run(group.Zone.ID, func() {
+				zoneRecords[i], listErrs[i] = ListFilteredRecords(cfClient, group.Zone.ID, group.Filter(options.Tag))
+				options.Progress.ZoneListed()
+			})
+		}()
+	}
+	wg.Wait()
+
+	var plans []recordPlan
+	var failures []RecordState
+	for z, group := range zoneGroups {
+		// Checking only reads the records, which works whatever the zone's status
+		if err := group.Zone.EditableError(); err != nil && !options.CheckOnly {
+			failures = append(failures, TargetFailures(group.Records, err)...)
+			continue
+		}
+		if listErrs[z] != nil {
+			failures = append(failures, TargetFailures(group.Records, listErrs[z])...)
+			continue
+		}
+		for _, target := range group.Records {
+			if !target.Pinned() && publicIPs[target.Source] == "" {
+				message := fmt.Sprintf("could not detect the public IP from %v", target.Source)
+				if target.RecordType() == RECORD_TYPE_CNAME {
+					message = fmt.Sprintf("could not get the CNAME target from %v", target.Source)
+				}
+				failures = append(failures, RecordState{Name: target.Name, Error: message, Code: E_DETECT_FAILED})
+				continue
+			}
+			content, err := target.DesiredContent(publicIPs[target.Source])
+			if err != nil {
+				failures = append(failures, RecordState{Name: target.Name, Error: err.Error(), Code: E_INVALID_CONTENT})
+				continue
+			}
+			if err := CheckContent(target.RecordType(), content); err != nil {
+				failures = append(failures, RecordState{Name: target.Name, Error: err.Error(), Code: E_INVALID_CONTENT})
+				continue
+			}
+			domainRecord, wwwRecord := FindDNSRecords(zoneRecords[z], target)
+			// If for some reason this comes back blank, fail
+			if domainRecord.ID == "" {
+				err := MissingTargetError(zoneRecords[z], target.Name, target)
+				failures = append(failures, RecordState{Name: target.Name, Error: err.Error(), Code: ErrorCode(err)})
+				continue
+			}
+			batch := len(plans)
+			plans = append(plans, recordPlan{record: domainRecord, content: content, options: options.For(target), notify: target.Notify, batch: batch})
+			// If for some reason this comes back blank, fail
+			if target.WWW {
+				if wwwRecord.ID == "" {
+					err := MissingTargetError(zoneRecords[z], "www."+target.Name, target)
+					failures = append(failures, RecordState{Name: "www." + target.Name, Error: err.Error(), Code: ErrorCode(err)})
+					continue
+				}
+				plans = append(plans, recordPlan{record: wwwRecord, content: content, options: options.ForWWW(target), notify: target.Notify, batch: batch})
+			}
+		}
+		// Anything tagged in Cloudflare as managed by us is kept up to date too, with the global settings
+		for _, record := range TaggedRecords(zoneRecords[z], options.Tag) {
+			if !slices.ContainsFunc(plans, func(plan recordPlan) bool { return plan.record.ID == record.ID }) {
+				plans = append(plans, recordPlan{record: record, content: publicIPs[""], options: options, batch: len(plans)})
+			}
+		}
+	}
+
+	states := make([]RecordState, 0, len(plans))
+	for _, plan := range plans {
+		states = append(states, RecordState{Name: plan.record.Name, IP: plan.record.Content, Wanted: plan.content, Notify: plan.notify})
+	}
+
+	// Only records whose IP doesn't match (or whose settings aren't as requested) get updated
+	// A batch takes a single slot in the pool and its edits are issued together, so the root and www don't disagree for longer than needed
+	needed := make([]bool, len(plans))
+	batches := map[int][]int{}
+	for i, plan := range plans {
+		needed[i] = RecordNeedsUpdate(plan.record, plan.content, plan.options)
+		if options.Paused != nil && options.Paused(plan.record.Name) {
+			states[i].Paused, needed[i] = true, false
+		}
+		if needed[i] && options.CheckOnly {
+			states[i].Error, states[i].Code = OutOfSyncMessage(plan.record, plan.content), E_OUT_OF_SYNC
+			needed[i] = false
+		}
+		if needed[i] && plan.record.Content != plan.content {
+			if err := plan.options.Geo.Check(plan.record.Name, plan.record.Content, plan.content); err != nil {
+				states[i].Error, states[i].Code = err.Error(), ErrorCode(err)
+				needed[i] = false
+			}
+		}
+		if needed[i] {
+			batches[plan.batch] = append(batches[plan.batch], i)
+			options.Progress.AddRecords(1)
+		}
+	}
+	editErrs := make([]error, len(plans))
+	for _, batch := range batches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.Run(plans[batch[0]].record.ZoneID, func() {
+				var batchWG sync.WaitGroup
+				for _, i := range batch {
+					batchWG.Add(1)
+					go func() {
+						defer batchWG.Done()
+						defer recoverPanic(&editErrs[i])
+						editErrs[i] = UpdateDNSRecord(cfClient, plans[i].content, plans[i].record, plans[i].options)
+						options.Progress.RecordUpdated()
+					}()
+				}
+				batchWG.Wait()
+			})
+		}()
+	}
+	wg.Wait()
+
+	// The edits that went through in a zone where another failed are undone so the zone doesn't end up half updated
+	applied := map[string][]int{}
+	failedZones := map[string]bool{}
+	for i, plan := range plans {
+		if !needed[i] {
+			continue
+		}
+		if editErrs[i] != nil {
+			states[i].Error, states[i].Code, states[i].RayID = fmt.Sprintf("updating failed: %v", editErrs[i]), ErrorCode(editErrs[i]), RayID(editErrs[i])
+			failedZones[plan.record.ZoneID] = true
+			continue
+		}
+		states[i].Previous, states[i].IP = states[i].IP, plan.content
+		states[i].Changed = true
+		applied[plan.record.ZoneID] = append(applied[plan.record.ZoneID], i)
+	}
+	for zoneID := range failedZones {
+		rollBack(cfClient, plans, applied[zoneID], states)
+	}
+	// With the records switched over the cache can be purged, so proxied traffic reaches the new origin straight away
+	if options.Purge != "" {
+		for zoneID, changed := range applied {
+			if failedZones[zoneID] {
+				continue
+			}
+			var hosts []string
+			for _, i := range changed {
+				hosts = append(hosts, plans[i].record.Name)
+			}
+			if err := PurgeCache(cfClient, zoneID, hosts, options.Purge == PURGE_EVERYTHING); err != nil {
+				log.Warnf("Purging the cache of %v failed: %v", strings.Join(hosts, ", "), err)
+			}
+		}
+	}
+
+	states = append(states, failures...)
+	return states, StatesError(states)
+}
+
+// Helper method to describe how a record is out of sync, e.g. "out of sync, points at 203.0.113.1 instead of 198.51.100.7"
+func OutOfSyncMessage(record DNSRecord, content string) string {
+	current := RecordPresentation(record)
+	if ContentMatches(record.Type, current, content) {
+		return "out of sync, its settings differ from the ones asked for"
+	}
+	return fmt.Sprintf("out of sync, points at %v instead of %v", current, content)
+}
+
+// Method to purge a zone's cache, either everything or only what's cached for the hostnames
+func PurgeCache(cfClient CloudflareAPI, zoneID string, hosts []string, everything bool) error {
+	var body cache.CachePurgeParamsBodyUnion = cache.CachePurgeParamsBodyCachePurgeFlexPurgeByHostnames{Hosts: cloudflare.F(hosts)}
+	if everything {
+		body = cache.CachePurgeParamsBodyCachePurgeEverything{PurgeEverything: cloudflare.F(true)}
+	}
+	if err := cfClient.Purge(zoneID, body); err != nil {
+		return fmt.Errorf("purging cache failed: %w", err)
+	}
+	log.Infof("Purged the cache of %v", zoneID)
+	return nil
+}
+
+// Helper method to undo the applied edits after another edit in their zone failed
+// Each record is restored to its own previous content, so the order the concurrent edits went through in doesn't matter
+// The states say which records were restored and which couldn't be
+func rollBack(cfClient CloudflareAPI, plans []recordPlan, applied []int, states []RecordState) {
+	var restored []string
+	for _, i := range applied {
+		record := plans[i].record
+		if err := RestoreDNSRecord(cfClient, record); err != nil {
+			states[i].Error, states[i].Code = fmt.Sprintf("rolling back failed, it's left pointing at %v: %v", plans[i].content, err), E_ROLLBACK_FAILED
+			continue
+		}
+		states[i].Previous, states[i].IP = "", record.Content
+		states[i].Changed = false
+		states[i].Error, states[i].Code = "rolled back because another record in the zone failed to update", E_ROLLED_BACK
+		restored = append(restored, record.Name)
+	}
+	if len(restored) > 0 {
+		log.Warnf("Rolled back %v", strings.Join(restored, ", "))
+	}
+}
+
+// Helper method to turn the failed states into a single error, nil when nothing failed
+func StatesError(states []RecordState) error {
+	var errs []error
+	for _, state := range states {
+		switch {
+		case state.Error == "":
+		case state.RayID != "":
+			errs = append(errs, WithCode(state.Code, fmt.Errorf("%v: %v (Cloudflare ray %v)", state.Name, state.Error, state.RayID)))
+		default:
+			errs = append(errs, WithCode(state.Code, fmt.Errorf("%v: %v", state.Name, state.Error)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Helper method to report targets as failed because of err
+// When err names the targets it's about only those are reported, otherwise all of them are
+func TargetFailures(targets []RecordConfig, err error) []RecordState {
+	var failures []RecordState
+	for _, targetErr := range targetErrors(err) {
+		failures = append(failures, RecordState{Name: targetErr.Name, Error: targetErr.Err.Error(), Code: ErrorCode(targetErr.Err), RayID: RayID(targetErr.Err)})
+	}
+	if len(failures) > 0 {
+		return failures
+	}
+	for _, target := range targets {
+		failures = append(failures, RecordState{Name: target.Name, Error: err.Error(), Code: ErrorCode(err), RayID: RayID(err)})
+	}
+	return failures
+}
+
+// Helper method to collect every TargetError in the error's tree, however deep it's wrapped, e.g. a joined error given context with %w
+func targetErrors(err error) []*TargetError {
+	if targetErr, ok := err.(*TargetError); ok {
+		return []*TargetError{targetErr}
+	}
+	switch wrapped := err.(type) {
+	case interface{ Unwrap() []error }:
+		var found []*TargetError
+		for _, e := range wrapped.Unwrap() {
+			found = append(found, targetErrors(e)...)
+		}
+		return found
+	case interface{ Unwrap() error }:
+		return targetErrors(wrapped.Unwrap())
+	}
+	return nil
+}
+
+// Method to point a single hostname's A record within the domain's zone at the provided IP address
+// Reports whether the record was changed
+func UpdateHostname(cfClient CloudflareAPI, domainName string, hostname string, ip string, options RecordOptions) (bool, error) {
+	zoneID, err := GetEditableZoneID(cfClient, domainName)
+	if err != nil {
+		return false, err
+	}
+	filter := RecordFilter{}
+	filter.Add(hostname, RECORD_TYPE_A)
+	records, err := ListFilteredRecords(cfClient, zoneID, filter)
+	if err != nil {
+		return false, err
+	}
+	record, _ := FindDNSRecords(records, RecordConfig{Name: hostname})
+	if record.ID == "" {
+		return false, fmt.Errorf("%v: %w", hostname, MissingRecordError(records, hostname, RECORD_TYPE_A))
+	}
+	if !RecordNeedsUpdate(record, ip, options) {
+		return false, nil
+	}
+	if err := UpdateDNSRecord(cfClient, ip, record, options); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // Helper method to get the Zone ID associated with the provided API Token
-func GetZoneID(cfClient cloudflare.Client, domainName string) (string, error) {
-	// Get the zone information associated with the provided API Token
-	zone, err := cfClient.Zones.List(context.Background(), zones.ZoneListParams{
-		Name: cloudflare.String(domainName),
-	})
+// The domain name may be the zone itself or any name within it, e.g. home.example.com in example.com
+func GetZoneID(cfClient CloudflareAPI, domainName string) (string, error) {
+	zone, err := getZone(cfClient, domainName)
+	return zone.ID, err
+}
+
+// Helper method to get the Zone ID to make changes in, failing when the zone's records can't be edited
+func GetEditableZoneID(cfClient CloudflareAPI, domainName string) (string, error) {
+	zone, err := getZone(cfClient, domainName)
 	if err != nil {
-		log.Fatal(err.Error())
 		return "", err
 	}
-	// Could be multiple Zones associated to this one token so make sure we are dealing with the one that matches our domain name
-	for i := range zone.Result {
-		item := zone.Result[i]
-		if item.Name == domainName {
-			return item.ID, nil
-		}
+	if err := zone.EditableError(); err != nil {
+		return "", err
 	}
-	return "", fmt.Errorf("could not match a Zone ID to the provided domain name")
+	return zone.ID, nil
 }
 
-// Method to reach out to the ipify web service and get the value of the running machine's Public IP address
-func GetPublicIP(PubIPServiceEndpoint string) (string, error) {
-	// Create a context which enables a 5s timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// Helper method to find the zone the domain name belongs to
+func getZone(cfClient CloudflareAPI, domainName string) (Zone, error) {
+	zone, ok, err := LookupZone(cfClient, domainName)
+	if err != nil {
+		return Zone{}, err
+	}
+	if !ok {
+		return Zone{}, WithCode(E_ZONE_NOT_FOUND, fmt.Errorf("could not match a Zone ID to the provided domain name"))
+	}
+	return zone, nil
+}
 
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+// Helper method to get every zone the API Token has access to
+func ListZones(cfClient CloudflareAPI) ([]Zone, error) {
+	// Across every page for tokens with access to many zones
+	zoneList, err := cfClient.Zones()
+	if err != nil {
+		return nil, fmt.Errorf("listing zones failed: %w", err)
+	}
+	return zoneList, nil
+}
+
+// Method to put a record back the way it was when it was listed
+func RestoreDNSRecord(cfClient CloudflareAPI, record DNSRecord) error {
+	_, err := cfClient.EditDNSRecord(record.ZoneID, record.ID, RestoreRecordParam(record))
+	return err
+}
+
+// Helper method to create a Cloudflare client for the provided api token
+func NewCloudflareClient(apiToken string, transportConfig TransportConfig) *cloudflare.Client {
+	opts := []option.RequestOption{
+		option.WithAPIToken(apiToken),
+		option.WithRequestTimeout(timeoutOrDefault(transportConfig.APITimeout)),
+		option.WithMaxRetries(transportConfig.APIRetries),
+		option.WithHeader("User-Agent", transportConfig.GetUserAgent()),
+		// the client certificates are meant for the detection services, Cloudflare never asks for them
+		option.WithHTTPClient(&http.Client{Transport: rayTransport{base: TransportConfig{Proxy: transportConfig.Proxy, RootCAs: transportConfig.RootCAs}.NewTransport()}}),
 	}
+	if transportConfig.APIBase != "" {
+		opts = append(opts, option.WithBaseURL(transportConfig.APIBase))
+	}
+	return cloudflare.NewClient(opts...)
+}
+
+// Method to get the Public IP address sending the given headers along, e.g. credentials of a self-hosted service
+func GetPublicIPWithHeader(client *http.Client, PubIPServiceEndpoint string, header http.Header) (string, error) {
+	// Create a context which enables the client's timeout, 5s for clients without one
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutOrDefault(client.Timeout))
+	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, GET_METHOD_KEY, PubIPServiceEndpoint, nil)
 	if err != nil {
 		return "", fmt.Errorf("request creation failed: %w", err)
 	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -168,74 +1639,212 @@ func GetPublicIP(PubIPServiceEndpoint string) (string, error) {
 		return "", fmt.Errorf("server returned status: %d", resp.StatusCode)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, DETECTION_MAX_BODY+1))
 	if err != nil {
 		return "", fmt.Errorf("reading response failed: %w", err)
 	}
+	if len(body) > DETECTION_MAX_BODY {
+		return "", fmt.Errorf("response is larger than %d bytes, not an IP address", DETECTION_MAX_BODY)
+	}
 
-	return string(body), nil
+	return ParseDetectedIP(body)
 }
 
-// Helper method to get the current DNS Record information
-// return expects this order: domainID, domainIP, wwwDomainID, error
-func GetDNSRecords(cfClient cloudflare.Client, domainName string, zoneID string, handleWWW bool) (string, string, string, error) {
-	// Get the list of DNS records associated with this Zone ID
-	dnsRecordList, err := cfClient.DNS.Records.List(context.Background(), dns.RecordListParams{
-		ZoneID: cloudflare.String(zoneID),
-	})
+// Helper method to get the address out of an IP detection service's response, in its canonical form
+// Anything but a single plain IPv4 or IPv6 address is refused, so an error page or captive portal can't end up in a record
+func ParseDetectedIP(body []byte) (string, error) {
+	text := strings.TrimSpace(string(body))
+	ip, err := netip.ParseAddr(text)
+	if err != nil || ip.Zone() != "" {
+		if len(text) > 64 {
+			text = text[:64] + "..."
+		}
+		return "", fmt.Errorf("response %q is not an IP address", text)
+	}
+	return ip.Unmap().String(), nil
+}
+
+// Method to get the address of a local network interface, e.g. a WireGuard one, its first global IPv4 address or IPv6 when asked
+func InterfaceAddress(name string, ipv6 bool) (string, error) {
+	iface, err := net.InterfaceByName(name)
 	if err != nil {
-		log.Fatal(err.Error())
-		return "", "", "", err
+		return "", fmt.Errorf("looking up interface %v failed: %w", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("listing addresses of %v failed: %w", name, err)
 	}
-	var domainID string
-	var domainIP string
-	var wwwDomainID string
-	// For every returned record see which one's 'Name' member matches our domainName, grab the ID and the Content of that record
-	// If handling www record, look for the record whose 'Name' member matches our domainName with 'www.' prepended and store that ID
-	for i := range dnsRecordList.Result {
-		if dnsRecordList.Result[i].Name == domainName {
-			domainID = dnsRecordList.Result[i].ID
-			domainIP = dnsRecordList.Result[i].Content
+	return PickInterfaceAddress(addrs, ipv6, name)
+}
+
+// Helper method to pick the address to use out of an interface's addresses, link-local and loopback ones never are
+func PickInterfaceAddress(addrs []net.Addr, ipv6 bool, name string) (string, error) {
+	for _, addr := range addrs {
+		prefix, err := netip.ParsePrefix(addr.String())
+		if err != nil {
+			continue
 		}
-		if handleWWW && dnsRecordList.Result[i].Name == fmt.Sprintf("www.%v", domainName) {
-			wwwDomainID = dnsRecordList.Result[i].ID
+		ip := prefix.Addr().Unmap()
+		if ip.Is6() == ipv6 && ip.IsGlobalUnicast() {
+			return ip.String(), nil
 		}
 	}
-	// Once searching is complete return what we have
-	return domainID, domainIP, wwwDomainID, nil
+	family := "IPv4"
+	if ipv6 {
+		family = "IPv6"
+	}
+	return "", fmt.Errorf("interface %v has no global %v address", name, family)
 }
 
-func UpdateDNSRecord(cfClient cloudflare.Client, domainName string, zoneID string, publicIP string, domainID string, wwwDomainID string, handleWWW bool) error {
-	message, err := cfClient.DNS.Records.Edit(context.Background(), domainID, dns.RecordEditParams{
-		ZoneID: cloudflare.String(zoneID),
-		Record: dns.ARecordParam{Content: cloudflare.String(publicIP)},
-	})
+// Method to detect the IP address a source reports, a source named in the config, a built-in service, a URL or "" for the default service
+func (c *Checker) DetectSource(source string) (string, error) {
+	named, ok := c.Sources[source]
+	if ok && named.Interface != "" {
+		publicIP, err := InterfaceAddress(named.Interface, named.IPv6)
+		return publicIP, detectionError(err)
+	}
+	if ok && named.Tailscale {
+		publicIP, err := TailscaleAddress(named.TailscaleSocket, named.IPv6)
+		return publicIP, detectionError(err)
+	}
+	endpoint := source
+	if ok {
+		endpoint = named.URL
+	} else if builtIn, isBuiltIn := IP_SERVICES[source]; isBuiltIn {
+		endpoint = builtIn
+	}
+	if endpoint == "" {
+		endpoint = c.defaultService()
+	}
+	publicIP, err := GetPublicIPWithHeader(c.DetectionClient, endpoint, named.RequestHeader())
+	return strings.TrimSpace(publicIP), detectionError(err)
+}
+
+// Helper method to create the HTTP client used to detect the Public IP address
+// Idle connections are kept for idleTimeout so the next check can skip the TCP and TLS handshakes, 0 disables keep-alives
+// maxIdleConns caps the idle connections kept per IP source, 0 leaves Go's default
+func NewDetectionClient(idleTimeout time.Duration, maxIdleConns int, transportConfig TransportConfig) *http.Client {
+	transport := transportConfig.NewTransport()
+	transport.IdleConnTimeout = idleTimeout
+	transport.DisableKeepAlives = idleTimeout <= 0
+	if maxIdleConns > 0 {
+		transport.MaxIdleConnsPerHost = maxIdleConns
+	}
+	return &http.Client{
+		Transport: userAgentTransport{base: transport, userAgent: transportConfig.GetUserAgent()},
+		Timeout:   timeoutOrDefault(transportConfig.DetectTimeout),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Helper method to get every DNS record in the zone
+// Walks through all the pages, large zones don't fit in the first one
+func ListDNSRecords(cfClient CloudflareAPI, zoneID string) ([]DNSRecord, error) {
+	records, err := cfClient.DNSRecords(zoneID)
+	if err != nil {
+		return nil, fmt.Errorf("listing dns records failed: %w", err)
+	}
+	return records, nil
+}
+
+// Helper method to get the records of the zone the filter wants
+func ListFilteredRecords(cfClient CloudflareAPI, zoneID string, filter RecordFilter) ([]DNSRecord, error) {
+	records, err := cfClient.FilteredDNSRecords(zoneID, filter)
+	if err != nil {
+		return nil, fmt.Errorf("listing dns records failed: %w", err)
+	}
+	return records, nil
+}
+
+// Method to set the content of the heartbeat TXT record, creating it when it doesn't exist yet
+func WriteHeartbeat(cfClient CloudflareAPI, name string, content string) error {
+	zoneID, err := GetEditableZoneID(cfClient, name)
 	if err != nil {
-		log.Fatal(err.Error())
 		return err
 	}
-	if message.Content == publicIP {
-		log.Info(`Main domain A record updated successfully`)
+	filter := RecordFilter{}
+	filter.Add(name, RECORD_TYPE_TXT)
+	records, err := ListFilteredRecords(cfClient, zoneID, filter)
+	if err != nil {
+		return err
 	}
-	if handleWWW {
-		wwwMessage, err := cfClient.DNS.Records.Edit(context.Background(), wwwDomainID, dns.RecordEditParams{
-			ZoneID: cloudflare.String(zoneID),
-			Record: dns.ARecordParam{Content: cloudflare.String(publicIP)},
-		})
-		if err != nil {
-			log.Fatal(err.Error())
-			return err
-		}
-		if wwwMessage.Content == publicIP {
-			log.Info("www domain A record updated successfully")
+	param := dns.RecordParam{
+		Name:    cloudflare.F(name),
+		Type:    cloudflare.F(dns.RecordType(RECORD_TYPE_TXT)),
+		Content: cloudflare.F(content),
+		TTL:     cloudflare.F(dns.TTL(TTL_AUTOMATIC)),
+	}
+	for _, record := range records {
+		if SameName(record.Name, name) && record.Type == RECORD_TYPE_TXT {
+			if _, err := cfClient.EditDNSRecord(zoneID, record.ID, param); err != nil {
+				return fmt.Errorf("updating heartbeat record failed: %w", err)
+			}
+			return nil
 		}
 	}
+	if err := cfClient.CreateDNSRecord(zoneID, param); err != nil {
+		return fmt.Errorf("creating heartbeat record failed: %w", err)
+	}
 	return nil
 }
 
+// Method to set the provided record's content, the public IP for A/AAAA records, applying the record options
+func UpdateDNSRecord(cfClient CloudflareAPI, content string, record DNSRecord, options RecordOptions) error {
+	// Address parameters must never be sent to e.g. a CNAME that happens to have the same name
+	if err := CheckContent(record.Type, content); err != nil {
+		return fmt.Errorf("refusing to edit %v record %v: %w", record.Type, record.Name, err)
+	}
+	edited, err := cfClient.EditDNSRecord(record.ZoneID, record.ID, BuildRecordParam(record, content, options))
+	if err != nil {
+		return err
+	}
+	if ContentMatches(record.Type, RecordPresentation(edited), content) {
+		log.Infof("%v %v record updated successfully", DisplayName(record.Name), record.Type)
+	}
+	return nil
+}
+
+// Prefix of the environment variables flags can be provided through
+const ENV_FLAG_PREFIX = "GO_DNS_UPDATE_"
+
+// Helper method to set any flag not given on the command line from its environment variable, named prefix + upper cased flag name
+func ApplyEnvironmentFlags(flags *flag.FlagSet, prefix string) error {
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if given[f.Name] || err != nil {
+			return
+		}
+		if value, ok := os.LookupEnv(prefix + strings.ToUpper(f.Name)); ok {
+			if setErr := flags.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid value for %v%v: %w", prefix, strings.ToUpper(f.Name), setErr)
+			}
+		}
+	})
+	return err
+}
+
+// Helper method to turn the daemon's listen address into a URL clients on the same machine can use
+func DaemonBaseURL(addr string) string {
+	if strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://") {
+		return strings.TrimSuffix(addr, "/")
+	}
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	return "http://" + addr
+}
+
 // Helper method to set the log level for the program, defaults to Warn
 func SetLogLevel(logLevel string) {
 	switch logLevel {
+	case "Debug":
+		log.SetLevel(log.DebugLevel)
 	case "Info":
 		log.SetLevel(log.InfoLevel)
 	case "Warn":
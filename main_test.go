@@ -3,9 +3,15 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -41,7 +47,7 @@ func TestGetPublicIP_Success(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	ip, err := GetPublicIP(ts.URL)
+	ip, err := GetPublicIPWithHeader(NewDetectionClient(0, 0, TransportConfig{}), ts.URL, nil)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -56,7 +62,7 @@ func TestGetPublicIP_ServerError(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	_, err := GetPublicIP(ts.URL)
+	_, err := GetPublicIPWithHeader(NewDetectionClient(0, 0, TransportConfig{}), ts.URL, nil)
 	if err == nil {
 		t.Fatal("Expected error but got none")
 	}
@@ -73,7 +79,7 @@ func TestGetPublicIP_Timeout(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	_, err := GetPublicIP(ts.URL)
+	_, err := GetPublicIPWithHeader(NewDetectionClient(0, 0, TransportConfig{}), ts.URL, nil)
 	if err == nil {
 		t.Error("Expected timeout error but got none")
 	}
@@ -84,8 +90,1093 @@ func TestGetPublicIP_Timeout(t *testing.T) {
 }
 
 func TestGetPublicIP_InvalidURL(t *testing.T) {
-	_, err := GetPublicIP("http://invalid.url")
+	_, err := GetPublicIPWithHeader(NewDetectionClient(0, 0, TransportConfig{}), "http://invalid.url", nil)
 	if err == nil {
 		t.Error("Expected error for invalid URL but got none")
 	}
 }
+
+func TestDaemonBaseURL(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected string
+	}{
+		{":8080", "http://localhost:8080"},
+		{"192.168.1.2:8080", "http://192.168.1.2:8080"},
+		{"https://nas.lan:8443/", "https://nas.lan:8443"},
+	}
+
+	for _, tt := range tests {
+		if got := DaemonBaseURL(tt.addr); got != tt.expected {
+			t.Errorf("Expected %v for %v, got %v", tt.expected, tt.addr, got)
+		}
+	}
+}
+
+func TestApplyEnvironmentFlags(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	domainName := flags.String("domainName", "", "")
+	handleWWW := flags.Bool("handleWWW", false, "")
+	logLevel := flags.String("logLevel", "Warn", "")
+	if err := flags.Parse([]string{"-logLevel=Info"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_DOMAINNAME", "example.com")
+	t.Setenv("TEST_HANDLEWWW", "true")
+	t.Setenv("TEST_LOGLEVEL", "Error")
+
+	if err := ApplyEnvironmentFlags(flags, "TEST_"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if *domainName != "example.com" || !*handleWWW {
+		t.Errorf("Expected flags from the environment, got %v and %v", *domainName, *handleWWW)
+	}
+	// The command line wins over the environment
+	if *logLevel != "Info" {
+		t.Errorf("Expected command line value Info, got %v", *logLevel)
+	}
+
+}
+
+func TestApplyEnvironmentFlags_Invalid(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Bool("handleWWW", false, "")
+	t.Setenv("TEST_HANDLEWWW", "maybe")
+
+	if err := ApplyEnvironmentFlags(flags, "TEST_"); err == nil {
+		t.Error("Expected error for an invalid boolean")
+	}
+}
+
+func TestListDNSRecords_Pagination(t *testing.T) {
+	var records []map[string]any
+	for i := range DNS_RECORDS_PER_PAGE + 5 {
+		records = append(records, map[string]any{
+			"id":      strconv.Itoa(i),
+			"name":    fmt.Sprintf("host%d.example.com", i),
+			"type":    "A",
+			"content": "203.0.113.42",
+			"ttl":     1,
+		})
+	}
+	// The record we're after is on the second page
+	records[len(records)-1]["name"] = "example.com"
+
+	cfClient := newTestCloudflareAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/zones/zone-id/dns_records" {
+			http.NotFound(w, r)
+			return
+		}
+		writeCloudflarePage(w, r, records)
+	}))
+
+	result, err := ListDNSRecords(cfClient, "zone-id")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result) != len(records) {
+		t.Errorf("Expected %d records, got %d", len(records), len(result))
+	}
+	filter := RecordFilter{}
+	filter.Add("example.com", RECORD_TYPE_A)
+	found, err := cfClient.FilteredDNSRecords("zone-id", filter)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	domainRecord, _ := FindDNSRecords(found, RecordConfig{Name: "example.com"})
+	if domainRecord.ID != strconv.Itoa(len(records)-1) {
+		t.Errorf("Expected the record from the second page, got %q", domainRecord.ID)
+	}
+}
+
+func TestMatchZone(t *testing.T) {
+	zoneList := []Zone{
+		{ID: "parent", Name: "example.com", Status: ZONE_STATUS_ACTIVE},
+		{ID: "lab", Name: "lab.example.com", Status: ZONE_STATUS_ACTIVE},
+		{ID: "ample", Name: "ample.com", Status: ZONE_STATUS_ACTIVE},
+		// The same zone added to another account, never activated there
+		{ID: "pending", Name: "example.net", Status: "pending"},
+		{ID: "net", Name: "example.net", Status: ZONE_STATUS_ACTIVE},
+	}
+
+	tests := []struct {
+		domain   string
+		expected string
+	}{
+		{"example.com", "parent"},
+		{"home.example.com", "parent"},
+		{"home.lab.example.com", "lab"},
+		{"Home.LAB.example.com.", "lab"},
+		{"lab.example.com", "lab"},
+		{"lab2.example.com", "parent"},
+		{"home.ample.com", "ample"},
+		{"home.example.net", "net"},
+		{"home.example.org", ""},
+		{"com", ""},
+	}
+
+	for _, tt := range tests {
+		zone, ok := MatchZone(zoneList, tt.domain)
+		if ok != (tt.expected != "") || zone.ID != tt.expected {
+			t.Errorf("%v: expected %q, got %q", tt.domain, tt.expected, zone.ID)
+		}
+	}
+}
+
+func TestGetZoneID_Pagination(t *testing.T) {
+	var zoneList []map[string]any
+	for i := range ZONES_PER_PAGE + 3 {
+		zoneList = append(zoneList, map[string]any{"id": strconv.Itoa(i), "name": fmt.Sprintf("client%d.example", i)})
+	}
+	// The zone we're after is on the second page, alongside its parent
+	zoneList = append(zoneList,
+		map[string]any{"id": "parent", "name": "example.net"},
+		map[string]any{"id": "lab", "name": "lab.example.net"},
+	)
+
+	cfClient := newTestCloudflareAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/zones" {
+			http.NotFound(w, r)
+			return
+		}
+		writeCloudflarePage(w, r, zoneList)
+	}))
+
+	zoneID, err := GetZoneID(cfClient, "nas.lab.example.net")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if zoneID != "lab" {
+		t.Errorf("Expected the most specific zone, got %q", zoneID)
+	}
+	if _, err := GetZoneID(cfClient, "example.org"); err == nil {
+		t.Error("Expected error for a domain in no zone but got none")
+	}
+}
+
+func TestUpdateZones(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}, {"id": "z2", "name": "example.net"}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "home.example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+				{"id": "r2", "name": "www.home.example.com", "type": "A", "content": "198.51.100.7", "ttl": 1},
+			},
+			"z2": {
+				{"id": "r3", "name": "lab.example.net", "type": "A", "content": "203.0.113.1", "ttl": 1},
+			},
+		},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+	targets := []RecordConfig{{Name: "home.example.com", WWW: true}, {Name: "lab.example.net"}}
+
+	groups, err := ResolveZones(cfClient, targets)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	states, err := UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{}, NewWorkerPool(DEFAULT_WORKERS, DEFAULT_ZONE_WORKERS))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(states) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(states))
+	}
+	for _, state := range states {
+		if state.IP != "198.51.100.7" {
+			t.Errorf("Expected %v to point at 198.51.100.7, got %v", state.Name, state.IP)
+		}
+		if state.Changed != (state.Name != "www.home.example.com") {
+			t.Errorf("Unexpected changed state for %v: %v", state.Name, state.Changed)
+		}
+	}
+	if len(fake.edits) != 2 {
+		t.Errorf("Expected 2 edits, got %v", fake.edits)
+	}
+
+	// A missing record fails on its own, the others are still updated
+	fake.records["z2"][0]["content"] = "203.0.113.1"
+	group := ZoneGroup{Zone: Zone{ID: "z2"}, Records: []RecordConfig{{Name: "gone.example.net"}, {Name: "lab.example.net"}}}
+	states, err = UpdateZones(cfClient, []ZoneGroup{group}, map[string]string{"": "198.51.100.7"}, RecordOptions{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "gone.example.net: couldn't obtain A Record ID") {
+		t.Errorf("Expected error for the missing record, got %v", err)
+	}
+	if len(states) != 2 || !states[0].Changed || states[1].Error == "" {
+		t.Errorf("Expected lab.example.net changed and gone.example.net failed, got %+v", states)
+	}
+}
+
+func TestUpdateZones_CheckOnly(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "home.example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+				{"id": "r2", "name": "www.home.example.com", "type": "A", "content": "198.51.100.7", "ttl": 1},
+			},
+		},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+	group := ZoneGroup{Zone: Zone{ID: "z1"}, Records: []RecordConfig{{Name: "home.example.com", WWW: true}}}
+
+	states, err := UpdateZones(cfClient, []ZoneGroup{group}, map[string]string{"": "198.51.100.7"}, RecordOptions{CheckOnly: true}, nil)
+	if ErrorCode(err) != E_OUT_OF_SYNC {
+		t.Errorf("Expected an %v error, got %v", E_OUT_OF_SYNC, err)
+	}
+	if len(fake.edits) != 0 {
+		t.Errorf("Expected no edits, got %v", fake.edits)
+	}
+	if len(states) != 2 || states[0].Changed || states[0].Error != "out of sync, points at 203.0.113.1 instead of 198.51.100.7" || states[1].Error != "" {
+		t.Errorf("Expected only home.example.com out of sync, got %+v", states)
+	}
+
+	// In sync is no error at all
+	fake.records["z1"][0]["content"] = "198.51.100.7"
+	if _, err := UpdateZones(cfClient, []ZoneGroup{group}, map[string]string{"": "198.51.100.7"}, RecordOptions{CheckOnly: true}, nil); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestResolveZones_ZoneID(t *testing.T) {
+	fake := &fakeCloudflare{zones: []map[string]any{{"id": "z1", "name": "example.com"}, {"id": "z2", "name": "example.net"}}}
+	cfClient := newTestCloudflareAPI(t, fake)
+
+	// Every target has its zone ID, so zones aren't listed at all
+	groups, err := ResolveZones(cfClient, []RecordConfig{{Name: "home.example.com", ZoneID: "z1"}, {Name: "nas.example.com", ZoneID: "z1"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fake.requests != 0 {
+		t.Errorf("Expected no requests, got %d", fake.requests)
+	}
+	if len(groups) != 1 || groups[0].Zone.ID != "z1" || len(groups[0].Records) != 2 {
+		t.Errorf("Unexpected groups: %+v", groups)
+	}
+
+	// Looked up by name for the others
+	groups, err = ResolveZones(cfClient, []RecordConfig{{Name: "home.example.com", ZoneID: "z1"}, {Name: "lab.example.net"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(groups) != 2 || groups[0].Zone.ID != "z1" || groups[1].Zone.ID != "z2" || groups[1].Zone.Name != "example.net" {
+		t.Errorf("Unexpected groups: %+v", groups)
+	}
+
+	// A single lookup covers every target in a registrable domain, the given zone ID then picks up its zone's name
+	fake.requests = 0
+	targets := []RecordConfig{{Name: "home.example.com", ZoneID: "z1"}, {Name: "example.com"}}
+	for i := range 8 {
+		targets = append(targets, RecordConfig{Name: fmt.Sprintf("host%d.example.net", i)})
+	}
+	groups, err = ResolveZones(cfClient, targets)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fake.requests != 2 {
+		t.Errorf("Expected a request for each of the 2 domains, got %d", fake.requests)
+	}
+	if len(groups) != 2 || groups[0].Zone.Name != "example.com" || groups[1].Zone.ID != "z2" || len(groups[1].Records) != 8 {
+		t.Errorf("Unexpected groups: %+v", groups)
+	}
+}
+
+func TestLookupZone(t *testing.T) {
+	fake := &fakeCloudflare{zones: []map[string]any{
+		{"id": "z1", "name": "example.com", "account": map[string]any{"id": "a1"}},
+		{"id": "z2", "name": "lab.example.com", "account": map[string]any{"id": "a1"}},
+		{"id": "z3", "name": "example.net", "account": map[string]any{"id": "a2"}},
+		{"id": "z4", "name": "myexample.com", "account": map[string]any{"id": "a1"}},
+		{"id": "z5", "name": "example.co.uk", "account": map[string]any{"id": "a1"}},
+	}}
+	cfClient := SDKClient{Client: newTestCloudflareClient(t, fake)}
+
+	tests := []struct {
+		name      string
+		accountID string
+		expected  string
+	}{
+		{"example.com", "", "z1"},
+		{"home.example.com", "", "z1"},
+		// The delegated sub-zone beats its parent
+		{"nas.lab.example.com", "", "z2"},
+		{"LAB.Example.com.", "", "z2"},
+		{"home.example.net", "", "z3"},
+		{"home.myexample.com", "", "z4"},
+		{"nas.home.example.co.uk", "", "z5"},
+		{"home.example.org", "", ""},
+		{"com", "", ""},
+		// Zones of other accounts are left out
+		{"home.example.net", "a1", ""},
+		{"home.example.com", "a1", "z1"},
+	}
+
+	for _, tt := range tests {
+		cfClient.AccountID = tt.accountID
+		zone, found, err := LookupZone(cfClient, tt.name)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if found != (tt.expected != "") || zone.ID != tt.expected {
+			t.Errorf("%v in account %q: expected %q, got %q", tt.name, tt.accountID, tt.expected, zone.ID)
+		}
+	}
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"example.com", "example.com"},
+		{"nas.lab.Example.com.", "example.com"},
+		{"nas.example.co.uk", "example.co.uk"},
+		// Suffixes run by companies can be zones of their own
+		{"blog.example.github.io", "github.io"},
+		{"nas.home.lan", "home.lan"},
+		{"com", "com"},
+	}
+
+	for _, tt := range tests {
+		if got := RegistrableDomain(tt.name); got != tt.expected {
+			t.Errorf("%v: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestUpdateZones_ZoneNotEditable(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com", "status": "pending"}, {"id": "z2", "name": "example.net", "status": "active"}},
+		records: map[string][]map[string]any{
+			"z1": {{"id": "r1", "name": "home.example.com", "type": "A", "content": "203.0.113.1", "ttl": 1}},
+			"z2": {{"id": "r2", "name": "lab.example.net", "type": "A", "content": "203.0.113.1", "ttl": 1}},
+		},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+	groups, err := ResolveZones(cfClient, []RecordConfig{{Name: "home.example.com"}, {Name: "lab.example.net"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	states, err := UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{}, nil)
+	if ErrorCode(err) != E_ZONE_NOT_EDITABLE || ExitCode(err) != EXIT_ZONE_NOT_EDITABLE {
+		t.Errorf("Expected code %v, got %v", E_ZONE_NOT_EDITABLE, err)
+	}
+	if len(states) != 2 || states[0].Name != "lab.example.net" || !states[0].Changed || states[1].Code != E_ZONE_NOT_EDITABLE {
+		t.Errorf("Expected lab.example.net changed and home.example.com failed, got %+v", states)
+	}
+	// The pending zone's records aren't even listed
+	if fake.listings != 1 {
+		t.Errorf("Expected 1 listing, got %d", fake.listings)
+	}
+
+	// Checking only reads, so it goes ahead
+	states, _ = UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{CheckOnly: true}, nil)
+	if len(states) != 2 || states[0].Code != E_OUT_OF_SYNC {
+		t.Errorf("Expected home.example.com out of sync, got %+v", states)
+	}
+}
+
+func TestUpdateZones_LargeZone(t *testing.T) {
+	var records []map[string]any
+	for i := range 10 * DNS_RECORDS_PER_PAGE {
+		records = append(records, map[string]any{"id": strconv.Itoa(i), "name": fmt.Sprintf("host%d.example.com", i), "type": "A", "content": "203.0.113.1", "ttl": 1})
+	}
+	records = append(records,
+		map[string]any{"id": "home", "name": "home.example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+		map[string]any{"id": "nas", "name": "nas.example.com", "type": "A", "content": "203.0.113.1", "ttl": 1, "tags": []string{"ddns"}},
+	)
+	fake := &fakeCloudflare{
+		zones:   []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{"z1": records},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+	group := ZoneGroup{Zone: Zone{ID: "z1"}, Records: []RecordConfig{{Name: "home.example.com"}}}
+
+	states, err := UpdateZones(cfClient, []ZoneGroup{group}, map[string]string{"": "198.51.100.7"}, RecordOptions{Tag: "ddns"}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(states) != 2 || !states[0].Changed || !states[1].Changed {
+		t.Errorf("Expected home.example.com and the tagged nas.example.com changed, got %+v", states)
+	}
+	if slices.Sort(fake.edits); !slices.Equal(fake.edits, []string{"home", "nas"}) {
+		t.Errorf("Expected home and nas to be edited, got %v", fake.edits)
+	}
+	// The name's A records and the tag are listed, a page each, going through the whole zone would have taken 11 pages
+	if fake.listings != 2 {
+		t.Errorf("Expected 2 listings, got %d", fake.listings)
+	}
+}
+
+func TestUpdateZones_PausedRecord(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{"z1": {
+			{"id": "home", "name": "home.example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+			{"id": "nas", "name": "nas.example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+		}},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+	group := ZoneGroup{Zone: Zone{ID: "z1"}, Records: []RecordConfig{{Name: "home.example.com"}, {Name: "nas.example.com"}}}
+	options := RecordOptions{Paused: func(name string) bool { return name == "nas.example.com" }}
+
+	states, err := UpdateZones(cfClient, []ZoneGroup{group}, map[string]string{"": "198.51.100.7"}, options, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(states) != 2 || !states[0].Changed || states[1].Changed || !states[1].Paused || states[1].Wanted != "198.51.100.7" {
+		t.Errorf("Expected home.example.com changed and nas.example.com paused, got %+v", states)
+	}
+	if !slices.Equal(fake.edits, []string{"home"}) {
+		t.Errorf("Expected only home to be edited, got %v", fake.edits)
+	}
+}
+
+func TestFilteredDNSRecords_Types(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{"z1": {
+			{"id": "a", "name": "example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+			{"id": "mx", "name": "example.com", "type": "MX", "content": "mail.example.com", "ttl": 1},
+			{"id": "www", "name": "www.example.com", "type": "CNAME", "content": "example.com", "ttl": 1},
+		}},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+	filter := ZoneGroup{Records: []RecordConfig{{Name: "example.com", WWW: true}}}.Filter("")
+
+	records, err := ListFilteredRecords(cfClient, "z1", filter)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Only the A record of the name is listed, the www name has none so it's listed again of any type to report the CNAME
+	ids := []string{}
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	if !slices.Equal(ids, []string{"a", "www"}) {
+		t.Errorf("Expected records a and www, got %v", ids)
+	}
+	if fake.listings != 3 {
+		t.Errorf("Expected 3 listings, got %d", fake.listings)
+	}
+	_, wwwRecord := FindDNSRecords(records, RecordConfig{Name: "example.com", WWW: true})
+	if err := MissingRecordError(records, "www.example.com", RECORD_TYPE_A); wwwRecord.ID != "" || ErrorCode(err) != E_RECORD_CONFLICT {
+		t.Errorf("Expected the CNAME to be reported in the way, got %v", err)
+	}
+}
+
+func TestUpdateZones_Overrides(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+				{"id": "r2", "name": "example.com", "type": "AAAA", "content": "2001:db8::1", "ttl": 1},
+			},
+		},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+	targets := []RecordConfig{
+		{Name: "example.com"},
+		{Name: "example.com", Type: "AAAA", Source: "https://api6.ipify.org"},
+	}
+	publicIPs := map[string]string{"": "198.51.100.7", "https://api6.ipify.org": "2001:db8::2"}
+
+	groups, err := ResolveZones(cfClient, targets)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	states, err := UpdateZones(cfClient, groups, publicIPs, RecordOptions{}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(states) != 2 || states[0].IP != "198.51.100.7" || states[1].IP != "2001:db8::2" {
+		t.Errorf("Expected each record to get its own source's address, got %+v", states)
+	}
+
+	// An IPv4 answer can't go into an AAAA record
+	publicIPs["https://api6.ipify.org"] = "198.51.100.7"
+	if _, err := UpdateZones(cfClient, groups, publicIPs, RecordOptions{}, nil); err == nil {
+		t.Error("Expected error for an IPv4 address in an AAAA record but got none")
+	}
+}
+
+func TestUpdateZones_RollBack(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+				{"id": "r2", "name": "www.example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+			},
+		},
+		fail: map[string]bool{"r2": true},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+
+	groups, err := ResolveZones(cfClient, []RecordConfig{{Name: "example.com", WWW: true}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	states, err := UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{}, nil)
+	if err == nil {
+		t.Fatal("Expected error but got none")
+	}
+	if !strings.Contains(err.Error(), "www.example.com: updating failed") || !strings.Contains(err.Error(), "example.com: rolled back") {
+		t.Errorf("Expected the error to report the failure and the rollback, got %q", err)
+	}
+	if content := fake.records["z1"][0]["content"]; content != "203.0.113.1" {
+		t.Errorf("Expected example.com to be restored to 203.0.113.1, got %v", content)
+	}
+	if len(fake.edits) != 2 {
+		t.Errorf("Expected the edit and its rollback, got %v", fake.edits)
+	}
+	if states[0].Changed || states[0].IP != "203.0.113.1" {
+		t.Errorf("Expected the report to show example.com unchanged, got %+v", states[0])
+	}
+}
+
+func TestUpdateZones_RootAndWWWTogether(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+				{"id": "r2", "name": "www.example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+			},
+		},
+	}
+	var inFlight, peak atomic.Int32
+	cfClient := newTestCloudflareAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			now := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			if now > peak.Load() {
+				peak.Store(now)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		fake.ServeHTTP(w, r)
+	}))
+
+	groups, err := ResolveZones(cfClient, []RecordConfig{{Name: "example.com", WWW: true}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Even with a single worker the pair goes out at the same time
+	if _, err := UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{}, NewWorkerPool(1, 1)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if peak.Load() != 2 {
+		t.Errorf("Expected the root and www edits to be in flight together, got at most %d", peak.Load())
+	}
+}
+
+func TestNewDetectionClient_KeepAlive(t *testing.T) {
+	tests := []struct {
+		name        string
+		idleTimeout time.Duration
+		expected    int32
+	}{
+		{"Reused", time.Minute, 1},
+		{"Disabled", 0, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var connections atomic.Int32
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("203.0.113.42"))
+			}))
+			ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					connections.Add(1)
+				}
+			}
+			ts.Start()
+			defer ts.Close()
+
+			client := NewDetectionClient(tt.idleTimeout, 2, TransportConfig{})
+			for range 2 {
+				if _, err := GetPublicIPWithHeader(client, ts.URL, nil); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			if connections.Load() != tt.expected {
+				t.Errorf("Expected %d connections, got %d", tt.expected, connections.Load())
+			}
+		})
+	}
+}
+
+func TestCheckReport_Summary(t *testing.T) {
+	report := CheckReport{Records: []RecordState{
+		{Name: "example.com", Changed: true},
+		{Name: "www.example.com", Changed: true},
+		{Name: "lab.example.net"},
+		{Name: "gone.example.net", Error: "couldn't obtain A Record ID"},
+	}}
+	expected := "2 changed, 1 unchanged, 1 failed\n  gone.example.net: couldn't obtain A Record ID"
+	if summary := report.Summary(); summary != expected {
+		t.Errorf("Expected %q, got %q", expected, summary)
+	}
+}
+
+func TestTargetFailures(t *testing.T) {
+	targets := []RecordConfig{{Name: "example.com"}, {Name: "example.org"}}
+
+	_, err := GroupByZone([]Zone{{ID: "z1", Name: "example.com"}}, targets)
+	failures := TargetFailures(targets, err)
+	if len(failures) != 1 || failures[0].Name != "example.org" {
+		t.Errorf("Expected only the unmatched target to fail, got %+v", failures)
+	}
+
+	// Every target is reported when the joined error is given context, as runCheck does
+	_, err = GroupByZone(nil, targets)
+	failures = TargetFailures(targets, fmt.Errorf("could not retrieve initial values: %w", err))
+	if len(failures) != 2 || failures[0].Name != "example.com" || failures[1].Name != "example.org" || failures[1].Code != E_ZONE_NOT_FOUND {
+		t.Errorf("Expected both unmatched targets to fail, got %+v", failures)
+	}
+
+	failures = TargetFailures(targets, errors.New("listing zones failed"))
+	if len(failures) != 2 || failures[1].Error != "listing zones failed" {
+		t.Errorf("Expected every target to fail, got %+v", failures)
+	}
+}
+
+func TestUpdateZones_TypeConflict(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+				{"id": "r2", "name": "www.example.com", "type": "CNAME", "content": "example.com", "ttl": 1},
+			},
+		},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+
+	groups, err := ResolveZones(cfClient, []RecordConfig{{Name: "example.com", WWW: true}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "has CNAME record(s) but no A record") {
+		t.Errorf("Expected the CNAME to be refused, got %v", err)
+	}
+	if fake.records["z1"][1]["content"] != "example.com" {
+		t.Error("Expected the CNAME to be left alone")
+	}
+}
+
+func TestUpdateZones_CNAME(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+				{"id": "r2", "name": "home.example.com", "type": "CNAME", "content": "old.dyn.example.net", "ttl": 1},
+				{"id": "r3", "name": "lab.example.com", "type": "CNAME", "content": "lab.dyn.example.net", "ttl": 1},
+			},
+		},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+
+	targets := []RecordConfig{
+		{Name: "home.example.com", Type: "cname", Target: "new.dyn.example.net."},
+		{Name: "lab.example.com", Type: "CNAME", Target: "LAB.dyn.example.net"},
+	}
+	groups, err := ResolveZones(cfClient, targets)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	states, err := UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(states) != 2 || !states[0].Changed || states[1].Changed {
+		t.Errorf("Expected only home.example.com to change, got %+v", states)
+	}
+	if len(fake.edits) != 1 || fake.edits[0] != "r2" {
+		t.Errorf("Expected only the home CNAME to be edited, got %v", fake.edits)
+	}
+	if fake.records["z1"][0]["content"] != "203.0.113.1" {
+		t.Error("Expected the A record to be left alone")
+	}
+}
+
+func TestWriteHeartbeat(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {{"id": "r1", "name": "example.com", "type": "A", "content": "203.0.113.1", "ttl": 1}},
+		},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+
+	// Created on the first write
+	if err := WriteHeartbeat(cfClient, "_ddns.example.com", "last_success=1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(fake.records["z1"]) != 2 || fake.records["z1"][1]["type"] != "TXT" || fake.records["z1"][1]["content"] != "last_success=1" {
+		t.Fatalf("Expected the heartbeat record to be created, got %v", fake.records["z1"])
+	}
+
+	// Edited in place afterwards
+	if err := WriteHeartbeat(cfClient, "_ddns.example.com", "last_success=2"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(fake.records["z1"]) != 2 || fake.records["z1"][1]["content"] != "last_success=2" {
+		t.Errorf("Expected the heartbeat record to be updated, got %v", fake.records["z1"])
+	}
+	if fake.records["z1"][0]["content"] != "203.0.113.1" {
+		t.Error("Expected the A record to be left alone")
+	}
+}
+
+func TestUpdateZones_Templated(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "example.com", "type": "TXT", "content": "\"v=spf1 ip4:203.0.113.1 -all\"", "ttl": 1},
+				{"id": "r2", "name": "example.com", "type": "MX", "content": "mail.example.com", "priority": 10, "ttl": 1},
+			},
+		},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+
+	targets := []RecordConfig{
+		{Name: "example.com", Type: "TXT", Content: "v=spf1 ip4:{{.IP}} -all"},
+		{Name: "example.com", Type: "MX", Content: "10 mail.example.com"},
+	}
+	groups, err := ResolveZones(cfClient, targets)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	states, err := UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(fake.edits) != 1 || fake.edits[0] != "r1" {
+		t.Errorf("Expected only the TXT record to be edited, got %v", fake.edits)
+	}
+	if fake.records["z1"][0]["content"] != "v=spf1 ip4:198.51.100.7 -all" {
+		t.Errorf("Unexpected TXT content: %v", fake.records["z1"][0]["content"])
+	}
+	if len(states) != 2 || !states[0].Changed || states[1].Changed {
+		t.Errorf("Expected only the TXT record to change, got %+v", states)
+	}
+}
+
+func TestUpdateZones_Member(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "example.com", "type": "A", "content": "203.0.113.1", "ttl": 1, "tags": []string{"wan:1"}},
+				{"id": "r2", "name": "example.com", "type": "A", "content": "203.0.113.2", "ttl": 1, "tags": []string{"wan:2"}},
+				{"id": "r3", "name": "example.com", "type": "A", "content": "203.0.113.3", "ttl": 1, "comment": "office link"},
+			},
+		},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+
+	targets := []RecordConfig{
+		{Name: "example.com", Member: &MemberConfig{Tag: "wan:2"}},
+		{Name: "example.com", Member: &MemberConfig{Comment: "office"}},
+	}
+	groups, err := ResolveZones(cfClient, targets)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{ManagedComment: true}, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(fake.edits) != 2 || !slices.Contains(fake.edits, "r2") || !slices.Contains(fake.edits, "r3") {
+		t.Errorf("Expected only this machine's members to be edited, got %v", fake.edits)
+	}
+	if fake.records["z1"][0]["content"] != "203.0.113.1" {
+		t.Error("Expected the other member to be left alone")
+	}
+
+	groups, _ = ResolveZones(cfClient, []RecordConfig{{Name: "example.com", Member: &MemberConfig{Tag: "wan:3"}}})
+	_, err = UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "none of the A records of example.com is tagged wan:3") {
+		t.Errorf("Expected a missing member error, got %v", err)
+	}
+}
+
+func TestUpdateZones_PinnedIP(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+				{"id": "r2", "name": "static.example.com", "type": "A", "content": "192.0.2.99", "ttl": 1},
+			},
+		},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+
+	targets := []RecordConfig{{Name: "example.com"}, {Name: "static.example.com", IP: "192.0.2.10"}}
+	groups, err := ResolveZones(cfClient, targets)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{}, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fake.records["z1"][0]["content"] != "198.51.100.7" || fake.records["z1"][1]["content"] != "192.0.2.10" {
+		t.Errorf("Expected the dynamic record at the detected IP and the static one at its own, got %v", fake.records["z1"])
+	}
+}
+
+func TestPickInterfaceAddress(t *testing.T) {
+	addrs := []net.Addr{
+		&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+		&net.IPNet{IP: net.ParseIP("10.8.0.2").To4(), Mask: net.CIDRMask(24, 32)},
+		&net.IPNet{IP: net.ParseIP("2001:db8::2"), Mask: net.CIDRMask(64, 128)},
+	}
+	if ip, err := PickInterfaceAddress(addrs, false, "wg0"); err != nil || ip != "10.8.0.2" {
+		t.Errorf("Expected the IPv4 address, got %q, %v", ip, err)
+	}
+	if ip, err := PickInterfaceAddress(addrs, true, "wg0"); err != nil || ip != "2001:db8::2" {
+		t.Errorf("Expected the global IPv6 address, got %q, %v", ip, err)
+	}
+	if _, err := PickInterfaceAddress(addrs[:1], true, "wg0"); err == nil {
+		t.Error("Expected error for an interface with only a link-local address but got none")
+	}
+}
+
+func TestDetectSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "198.51.100.7\n")
+	}))
+	defer server.Close()
+
+	checker := &Checker{DetectionClient: server.Client(), Sources: map[string]SourceConfig{"wan": {URL: server.URL}, "vpn": {Interface: "does-not-exist0"}}}
+	if ip, err := checker.DetectSource("wan"); err != nil || ip != "198.51.100.7" {
+		t.Errorf("Expected the named source's address, got %q, %v", ip, err)
+	}
+	if ip, err := checker.DetectSource(server.URL); err != nil || ip != "198.51.100.7" {
+		t.Errorf("Expected the URL source's address, got %q, %v", ip, err)
+	}
+	if _, err := checker.DetectSource("vpn"); err == nil {
+		t.Error("Expected error for a missing interface but got none")
+	}
+}
+
+func TestResolveIPService(t *testing.T) {
+	tests := []struct {
+		service  string
+		expected string
+		wantErr  bool
+	}{
+		{"", PUB_IP_SERVICE_ENDPOINT, false},
+		{"icanhazip", "https://ipv4.icanhazip.com", false},
+		{"seeip", "https://api.seeip.org", false},
+		{"https://ip.example.com/", "https://ip.example.com/", false},
+		{"whatismyip", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			endpoint, err := ResolveIPService(tt.service)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if endpoint != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, endpoint)
+			}
+		})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "198.51.100.7\n")
+	}))
+	defer server.Close()
+	checker := &Checker{DetectionClient: server.Client(), IPService: server.URL}
+	if ip, err := checker.DetectSource(""); err != nil || ip != "198.51.100.7" {
+		t.Errorf("Expected the configured service's address, got %q, %v", ip, err)
+	}
+}
+
+func TestDetectSource_Credentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+		switch {
+		case r.URL.Path == "/key" && r.Header.Get("X-Api-Key") == "secret":
+		case r.URL.Path == "/bearer" && r.Header.Get("Authorization") == "Bearer secret":
+		case r.URL.Path == "/basic" && username == "ddns" && password == "secret":
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "198.51.100.7\n")
+	}))
+	defer server.Close()
+
+	checker := &Checker{DetectionClient: server.Client(), Sources: map[string]SourceConfig{
+		"key":    {URL: server.URL + "/key", Headers: map[string]string{"X-Api-Key": "secret"}},
+		"bearer": {URL: server.URL + "/bearer", BearerToken: "secret"},
+		"basic":  {URL: server.URL + "/basic", Username: "ddns", Password: "secret"},
+		"none":   {URL: server.URL + "/basic"},
+	}}
+	for _, source := range []string{"key", "bearer", "basic"} {
+		if ip, err := checker.DetectSource(source); err != nil || ip != "198.51.100.7" {
+			t.Errorf("Expected %v to authenticate, got %q, %v", source, ip, err)
+		}
+	}
+	if _, err := checker.DetectSource("none"); err == nil {
+		t.Error("Expected error without credentials but got none")
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	checker := &Checker{lookupAddr: func(ctx context.Context, addr string) ([]string, error) {
+		if addr == "198.51.100.7" {
+			return []string{"c-198-51-100-7.hsd1.example.net."}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}}
+	if name := checker.reverseName("198.51.100.7"); name != "c-198-51-100-7.hsd1.example.net" {
+		t.Errorf("Expected c-198-51-100-7.hsd1.example.net, got %q", name)
+	}
+	if name := checker.reverseName("203.0.113.1"); name != "" {
+		t.Errorf("Expected no name, got %q", name)
+	}
+}
+
+func TestApplyFailover(t *testing.T) {
+	checker := &Checker{Failover: "192.0.2.50", FailoverAfter: 10 * time.Minute}
+	start := time.Date(2026, 1, 2, 15, 0, 0, 0, time.UTC)
+	failed := errors.New("request failed")
+
+	if ip := checker.applyFailover("", "", failed, start); ip != "" {
+		t.Errorf("Expected no address before the threshold, got %q", ip)
+	}
+	if ip := checker.applyFailover("", "", failed, start.Add(5*time.Minute)); ip != "" {
+		t.Errorf("Expected no address before the threshold, got %q", ip)
+	}
+	if ip := checker.applyFailover("", "", failed, start.Add(10*time.Minute)); ip != "192.0.2.50" {
+		t.Errorf("Expected the failover address, got %q", ip)
+	}
+	if ip := checker.applyFailover("", "198.51.100.7", nil, start.Add(11*time.Minute)); ip != "198.51.100.7" {
+		t.Errorf("Expected the detected address once detection recovers, got %q", ip)
+	}
+	// The threshold starts over after a recovery
+	if ip := checker.applyFailover("", "", failed, start.Add(12*time.Minute)); ip != "" {
+		t.Errorf("Expected no address right after failing again, got %q", ip)
+	}
+
+	disabled := &Checker{}
+	if ip := disabled.applyFailover("", "", failed, start); ip != "" {
+		t.Errorf("Expected no failover when disabled, got %q", ip)
+	}
+}
+
+func TestUpdateZones_Purge(t *testing.T) {
+	newFake := func() *fakeCloudflare {
+		return &fakeCloudflare{
+			zones: []map[string]any{{"id": "z1", "name": "example.com"}, {"id": "z2", "name": "example.net"}},
+			records: map[string][]map[string]any{
+				"z1": {
+					{"id": "r1", "name": "example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+					{"id": "r2", "name": "www.example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+				},
+				"z2": {{"id": "r3", "name": "example.net", "type": "A", "content": "198.51.100.7", "ttl": 1}},
+			},
+		}
+	}
+	targets := []RecordConfig{{Name: "example.com", WWW: true}, {Name: "example.net"}}
+
+	fake := newFake()
+	cfClient := newTestCloudflareAPI(t, fake)
+	groups, err := ResolveZones(cfClient, targets)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{Purge: PURGE_HOSTS}, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Only the zone with changes is purged
+	if len(fake.purges) != 1 || fmt.Sprint(fake.purges[0]["hosts"]) != "[example.com www.example.com]" {
+		t.Errorf("Expected the changed hostnames to be purged, got %v", fake.purges)
+	}
+
+	fake = newFake()
+	cfClient = newTestCloudflareAPI(t, fake)
+	if _, err := UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{Purge: PURGE_EVERYTHING}, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(fake.purges) != 1 || fake.purges[0]["purge_everything"] != true {
+		t.Errorf("Expected the whole zone to be purged, got %v", fake.purges)
+	}
+
+	fake = newFake()
+	cfClient = newTestCloudflareAPI(t, fake)
+	if _, err := UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{}, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(fake.purges) != 0 {
+		t.Errorf("Expected no purge unless asked for, got %v", fake.purges)
+	}
+}
+
+func TestParseDetectedIP(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected string
+		wantErr  bool
+	}{
+		{"203.0.113.42", "203.0.113.42", false},
+		{"  203.0.113.42\r\n", "203.0.113.42", false},
+		{"2001:DB8::0001\n", "2001:db8::1", false},
+		{"::ffff:203.0.113.42", "203.0.113.42", false},
+		{"fe80::1%eth0", "", true},
+		{"", "", true},
+		{"<html><body>Captive portal</body></html>", "", true},
+		{"203.0.113.42 198.51.100.1", "", true},
+		{"203.0.113.042", "", true},
+	}
+
+	for _, tt := range tests {
+		ip, err := ParseDetectedIP([]byte(tt.body))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: expected error %v, got %v", tt.body, tt.wantErr, err)
+		}
+		if ip != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.body, tt.expected, ip)
+		}
+	}
+}
+
+func TestGetPublicIP_LargeBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat(" ", 1<<20) + "203.0.113.42"))
+	}))
+	defer ts.Close()
+
+	if _, err := GetPublicIPWithHeader(NewDetectionClient(0, 0, TransportConfig{}), ts.URL, nil); err == nil {
+		t.Error("Expected error for an oversized response but got none")
+	}
+}
+
+// Whatever a detection service sends back, only an address an A or AAAA record accepts may come out
+func FuzzParseDetectedIP(f *testing.F) {
+	for _, seed := range []string{"203.0.113.42", "203.0.113.42\n", " \t2001:db8::1\r\n", "::ffff:192.0.2.1", "fe80::1%eth0", "1.2.3", "0x7f.1", "<html></html>", "\x00", ""} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		ip, err := ParseDetectedIP(body)
+		if err != nil {
+			return
+		}
+		if CheckAddress(RECORD_TYPE_A, ip) != nil && CheckAddress(RECORD_TYPE_AAAA, ip) != nil {
+			t.Errorf("%q was parsed to %q, which neither A nor AAAA records accept", body, ip)
+		}
+		if again, err := ParseDetectedIP([]byte(ip)); err != nil || again != ip {
+			t.Errorf("%q was parsed to %q, which isn't canonical", body, ip)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Netlink multicast groups for IPv4 address and route changes, see rtnetlink.h
+const (
+	RTMGRP_IPV4_IFADDR = 0x10
+	RTMGRP_IPV4_ROUTE  = 0x40
+)
+
+// Changes usually arrive in bursts while an interface comes up, wait for things to settle before checking
+const NETLINK_SETTLE_DELAY = 2 * time.Second
+
+// Method to build a Watcher triggering a check when the default route or an interface address changes
+// When wanInterface is set only address changes on that interface count
+func NetlinkWatcher(wanInterface string) Watcher {
+	return func(stop <-chan struct{}, trigger func()) error {
+		fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+		if err != nil {
+			return fmt.Errorf("opening netlink socket failed: %w", err)
+		}
+		defer syscall.Close(fd)
+		groups := uint32(RTMGRP_IPV4_IFADDR | RTMGRP_IPV4_ROUTE)
+		if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: groups}); err != nil {
+			return fmt.Errorf("subscribing to netlink events failed: %w", err)
+		}
+		// Wake up every second to notice when we're asked to stop
+		timeout := syscall.NsecToTimeval(time.Second.Nanoseconds())
+		if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+			return fmt.Errorf("setting netlink socket timeout failed: %w", err)
+		}
+
+		wanIndex := 0
+		if wanInterface != "" {
+			iface, err := net.InterfaceByName(wanInterface)
+			if err != nil {
+				return fmt.Errorf("looking up interface %v failed: %w", wanInterface, err)
+			}
+			wanIndex = iface.Index
+		}
+		log.Infof("Watching netlink for network changes")
+
+		buf := make([]byte, syscall.Getpagesize())
+		var pending <-chan time.Time
+		for {
+			select {
+			case <-stop:
+				return nil
+			case <-pending:
+				pending = nil
+				log.Info("Network change detected")
+				trigger()
+			default:
+			}
+
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("reading netlink socket failed: %w", err)
+			}
+			messages, err := syscall.ParseNetlinkMessage(buf[:n])
+			if err != nil {
+				log.Warnf("parsing netlink message failed: %v", err)
+				continue
+			}
+			for _, message := range messages {
+				if NetlinkMessageRelevant(message, wanIndex) && pending == nil {
+					pending = time.After(NETLINK_SETTLE_DELAY)
+				}
+			}
+		}
+	}
+}
+
+// Helper method to decide whether a netlink message could mean our public IP address changed
+// Address changes count when on the WAN interface (or any interface if wanIndex is 0), route changes when they touch the default route
+func NetlinkMessageRelevant(message syscall.NetlinkMessage, wanIndex int) bool {
+	switch message.Header.Type {
+	case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+		if len(message.Data) < syscall.SizeofIfAddrmsg {
+			return false
+		}
+		// struct ifaddrmsg { family, prefixlen, flags, scope uint8; index uint32 }
+		index := binary.NativeEndian.Uint32(message.Data[4:8])
+		return wanIndex == 0 || int(index) == wanIndex
+	case syscall.RTM_NEWROUTE, syscall.RTM_DELROUTE:
+		if len(message.Data) < syscall.SizeofRtMsg {
+			return false
+		}
+		// struct rtmsg { family, dst_len, ... }, a zero length destination is the default route
+		return message.Data[1] == 0
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"syscall"
+	"testing"
+)
+
+func TestNetlinkMessageRelevant(t *testing.T) {
+	addressMessage := func(messageType uint16, index uint32) syscall.NetlinkMessage {
+		data := make([]byte, syscall.SizeofIfAddrmsg)
+		binary.NativeEndian.PutUint32(data[4:8], index)
+		return syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: messageType}, Data: data}
+	}
+	routeMessage := func(messageType uint16, dstLen uint8) syscall.NetlinkMessage {
+		data := make([]byte, syscall.SizeofRtMsg)
+		data[1] = dstLen
+		return syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: messageType}, Data: data}
+	}
+
+	tests := []struct {
+		name     string
+		message  syscall.NetlinkMessage
+		wanIndex int
+		expected bool
+	}{
+		{"New Address Any Interface", addressMessage(syscall.RTM_NEWADDR, 3), 0, true},
+		{"New Address WAN Interface", addressMessage(syscall.RTM_NEWADDR, 3), 3, true},
+		{"Deleted Address Other Interface", addressMessage(syscall.RTM_DELADDR, 4), 3, false},
+		{"New Default Route", routeMessage(syscall.RTM_NEWROUTE, 0), 3, true},
+		{"New Subnet Route", routeMessage(syscall.RTM_NEWROUTE, 24), 0, false},
+		{"Link Change", syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: syscall.RTM_NEWLINK}}, 0, false},
+		{"Truncated", syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: syscall.RTM_NEWADDR}}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NetlinkMessageRelevant(tt.message, tt.wanIndex); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// Netlink only exists on Linux
+func NetlinkWatcher(wanInterface string) Watcher {
+	return func(stop <-chan struct{}, trigger func()) error {
+		return fmt.Errorf("watching for network changes is only supported on Linux")
+	}
+}
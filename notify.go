@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Somewhere to send word of changes and failures
+type Notifier interface {
+	Notify(event Event) error
+}
+
+// Notifier POSTing each event as JSON to a URL, e.g. a chat webhook or an automation service
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (n WebhookNotifier) Notify(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// How often the default channels are reminded checks are still failing, unless set otherwise
+const DEFAULT_NOTIFY_REMINDER = 6 * time.Hour
+
+// Window the notification rate limits count over
+const NOTIFY_RATE_WINDOW = time.Hour
+
+// Caps how many notifications go out within NOTIFY_RATE_WINDOW
+type rateLimiter struct {
+	max int
+	// When the notifications still in the window were sent
+	sent []time.Time
+}
+
+// Helper method to report whether the limit has been reached, a nil or unlimited limiter never is
+func (l *rateLimiter) full(at time.Time) bool {
+	if l == nil || l.max <= 0 {
+		return false
+	}
+	l.sent = slices.DeleteFunc(l.sent, func(sent time.Time) bool { return at.Sub(sent) >= NOTIFY_RATE_WINDOW })
+	return len(l.sent) >= l.max
+}
+
+// Helper method to count a notification sent
+func (l *rateLimiter) take(at time.Time) {
+	if l != nil && l.max > 0 {
+		l.sent = append(l.sent, at)
+	}
+}
+
+// Checks failing in a row, from the first failure until one succeeds again
+type FailureSpell struct {
+	Since time.Time `json:"since"`
+	// Code of the last failure, a different one is notified about straight away
+	Code string `json:"code,omitempty"`
+	// When the channels were last told about the spell
+	Notified time.Time `json:"notified"`
+	// How many checks have failed during the spell
+	Checks int `json:"checks"`
+}
+
+// The configured notification channels
+type Notifications struct {
+	Channels map[string]Notifier
+	// Channels used for records that don't list their own, and for failed checks
+	Default []string
+	// How long checks go on failing before the channels are reminded, never when zero
+	Reminder time.Duration
+
+	// Guards the channels, limits and failure spell while working out what to send, released before anything is sent
+	mu sync.RWMutex
+	// The failed checks going on, nil while checks succeed
+	failure *FailureSpell
+	// Limits of the channels that have one, by name, and the one across all channels
+	limits map[string]*rateLimiter
+	global *rateLimiter
+	// How many notifications each channel missed out on since the last one it was sent
+	suppressed map[string]int
+}
+
+// Method to build the notification channels described by the config
+func NewNotifications(config Config) *Notifications {
+	n := &Notifications{Channels: make(map[string]Notifier, len(config.Notifiers)), Default: config.Notify, limits: map[string]*rateLimiter{}}
+	for name, notifier := range config.Notifiers {
+		n.Channels[name] = WebhookNotifier{URL: notifier.Webhook}
+		if notifier.MaxPerHour > 0 {
+			n.limits[name] = &rateLimiter{max: notifier.MaxPerHour}
+		}
+	}
+	if config.NotifyMaxPerHour > 0 {
+		n.global = &rateLimiter{max: config.NotifyMaxPerHour}
+	}
+	return n
+}
+
+// An event on its way to one of the channels
+type notification struct {
+	channel  string
+	notifier Notifier
+	event    Event
+}
+
+// Method to tell the relevant channels about what a check changed and warned about, or that it failed
+// Failures are only sent when checks start failing, fail differently or have been failing for another Reminder, and checks succeeding again is sent once
+func (n *Notifications) Dispatch(at time.Time, report CheckReport, err error) {
+	if n == nil {
+		return
+	}
+	deliver(n.dispatch(at, report, err))
+}
+
+// Helper method to work out the notifications a check calls for, sent once the lock is released so a slow webhook doesn't hold up the others
+func (n *Notifications) dispatch(at time.Time, report CheckReport, err error) []notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var outgoing []notification
+	for _, record := range report.Records {
+		if !record.Changed {
+			continue
+		}
+		channels := record.Notify
+		if len(channels) == 0 {
+			channels = n.Default
+		}
+		outgoing = append(outgoing, n.send(channels, Event{Type: EVENT_CHANGE, Time: at, Message: record.ChangeMessage(), CheckID: report.CheckID})...)
+	}
+	for _, warning := range report.Warnings {
+		outgoing = append(outgoing, n.send(n.Default, Event{Type: EVENT_WARNING, Time: at, Message: warning, CheckID: report.CheckID})...)
+	}
+	if err != nil {
+		outgoing = append(outgoing, n.dispatchFailure(at, report, err)...)
+	} else if n.failure != nil {
+		message := fmt.Sprintf("Checks succeeding again after %d failed since %v", n.failure.Checks, n.failure.Since.Format(time.RFC3339))
+		outgoing = append(outgoing, n.send(n.Default, Event{Type: EVENT_RECOVERED, Time: at, Message: message, CheckID: report.CheckID})...)
+		n.failure = nil
+	}
+	return outgoing
+}
+
+// Helper method to note a failed check in the spell, sending it on when the channels haven't heard of it yet or are due a reminder
+func (n *Notifications) dispatchFailure(at time.Time, report CheckReport, err error) []notification {
+	code := ErrorCode(err)
+	event := Event{Type: EVENT_ERROR, Time: at, Message: err.Error(), Code: code, CheckID: report.CheckID}
+	switch {
+	case n.failure == nil:
+		n.failure = &FailureSpell{Since: at}
+	case n.failure.Code != code:
+	case n.Reminder > 0 && at.Sub(n.failure.Notified) >= n.Reminder:
+		event.Message = fmt.Sprintf("Still failing after %d checks since %v: %v", n.failure.Checks+1, n.failure.Since.Format(time.RFC3339), err)
+	default:
+		n.failure.Checks++
+		log.Debugf("Not notifying about the failed check, the channels were told at %v", n.failure.Notified.Format(time.RFC3339))
+		return nil
+	}
+	n.failure.Checks++
+	n.failure.Code, n.failure.Notified = code, at
+	return n.send(n.Default, event)
+}
+
+// Method to get the failure spell going on, nil while checks succeed
+func (n *Notifications) Failure() *FailureSpell {
+	if n == nil {
+		return nil
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.failure == nil {
+		return nil
+	}
+	failure := *n.failure
+	return &failure
+}
+
+// Method to carry on with a failure spell from an earlier run, so a run from cron doesn't notify about the failure the last one did
+func (n *Notifications) Restore(failure *FailureSpell) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if failure != nil {
+		restored := *failure
+		n.failure = &restored
+	}
+}
+
+// Method to tell the default channels about an event that isn't the outcome of a single check, e.g. the daemon going stale
+func (n *Notifications) Alert(event Event) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	outgoing := n.send(n.Default, event)
+	n.mu.Unlock()
+	deliver(outgoing)
+}
+
+// Method to switch to the channels of a reloaded config, carrying on with the failure spell going on
+// What was sent within the hour still counts towards the reloaded limits
+func (n *Notifications) Replace(other *Notifications) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for name, limit := range other.limits {
+		if current := n.limits[name]; current != nil {
+			limit.sent = current.sent
+		}
+	}
+	if other.global != nil && n.global != nil {
+		other.global.sent = n.global.sent
+	}
+	n.Channels, n.Default, n.limits, n.global = other.Channels, other.Default, other.limits, other.global
+}
+
+// Helper method to address an event to each of the named channels, returning the notifications to deliver
+// Channels over their own limit, and every channel once the global one is reached, miss out on it, and are told how many they missed along with the next one they're sent
+func (n *Notifications) send(channels []string, event Event) []notification {
+	var outgoing []notification
+	for _, name := range channels {
+		notifier, ok := n.Channels[name]
+		if !ok {
+			continue
+		}
+		if n.limits[name].full(event.Time) || n.global.full(event.Time) {
+			if n.suppressed == nil {
+				n.suppressed = map[string]int{}
+			}
+			n.suppressed[name]++
+			log.Debugf("Not notifying %v about %q, over the rate limit", name, event.Message)
+			continue
+		}
+		n.limits[name].take(event.Time)
+		n.global.take(event.Time)
+		if suppressed := n.suppressed[name]; suppressed > 0 {
+			delete(n.suppressed, name)
+			message := fmt.Sprintf("Suppressed %d notifications over the rate limit", suppressed)
+			if suppressed == 1 {
+				message = "Suppressed 1 notification over the rate limit"
+			}
+			summary := Event{Type: EVENT_WARNING, Time: event.Time, Message: message}
+			outgoing = append(outgoing, notification{channel: name, notifier: notifier, event: summary})
+		}
+		outgoing = append(outgoing, notification{channel: name, notifier: notifier, event: event})
+	}
+	return outgoing
+}
+
+// Helper method to send the notifications in order, failures are only logged
+func deliver(outgoing []notification) {
+	for _, notification := range outgoing {
+		if err := notification.notifier.Notify(notification.event); err != nil {
+			log.Warnf("notifying %v failed: %v", notification.channel, err)
+		}
+	}
+}
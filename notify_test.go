@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Notifier keeping the events it was given
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (n *recordingNotifier) Notify(event Event) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event)
+	return nil
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received Event
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Expected POST, got %v", r.Method)
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer ts.Close()
+
+	event := Event{Type: EVENT_CHANGE, Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Message: "example.com updated to 198.51.100.7"}
+	if err := (WebhookNotifier{URL: ts.URL}).Notify(event); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if received.Message != event.Message || received.Type != EVENT_CHANGE {
+		t.Errorf("Expected %+v, got %+v", event, received)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	if err := (WebhookNotifier{URL: failing.URL}).Notify(event); err == nil {
+		t.Error("Expected error for a failing webhook but got none")
+	}
+}
+
+func TestNotifications_Dispatch(t *testing.T) {
+	ops, lab := &recordingNotifier{}, &recordingNotifier{}
+	notifications := &Notifications{Channels: map[string]Notifier{"ops": ops, "lab": lab}, Default: []string{"ops"}}
+
+	report := CheckReport{PublicIP: "198.51.100.7", Records: []RecordState{
+		{Name: "example.com", IP: "198.51.100.7", Changed: true, Network: "AS7922 Comcast"},
+		{Name: "lab.example.com", IP: "198.51.100.7", Changed: true, Notify: []string{"lab"}},
+		{Name: "www.example.com", IP: "198.51.100.7"},
+	}, Warnings: []string{"DNSSEC of example.com is pending"}}
+	notifications.Dispatch(time.Now(), report, WithCode(E_DETECT_FAILED, errors.New("account client-b: could not retrieve initial values")))
+
+	if len(ops.events) != 3 || ops.events[0].Message != "example.com updated to 198.51.100.7 (AS7922 Comcast)" || ops.events[1].Type != EVENT_WARNING || ops.events[2].Type != EVENT_ERROR {
+		t.Errorf("Unexpected default channel events: %+v", ops.events)
+	}
+	if ops.events[len(ops.events)-1].Code != E_DETECT_FAILED {
+		t.Errorf("Expected the error event to carry %v, got %+v", E_DETECT_FAILED, ops.events[len(ops.events)-1])
+	}
+	if len(lab.events) != 1 || lab.events[0].Message != "lab.example.com updated to 198.51.100.7" {
+		t.Errorf("Unexpected record channel events: %+v", lab.events)
+	}
+
+	// Nothing configured is fine too
+	var none *Notifications
+	none.Dispatch(time.Now(), report, nil)
+}
+
+func TestNotifications_DispatchFailureSpell(t *testing.T) {
+	ops := &recordingNotifier{}
+	notifications := &Notifications{Channels: map[string]Notifier{"ops": ops}, Default: []string{"ops"}, Reminder: time.Hour}
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	apiErr := WithCode(E_API, errors.New("cloudflare is down"))
+
+	// A failure every 5 minutes for 90 minutes, then another kind of failure and a success
+	for i := 0; i <= 18; i++ {
+		notifications.Dispatch(start.Add(time.Duration(i)*5*time.Minute), CheckReport{}, apiErr)
+	}
+	notifications.Dispatch(start.Add(95*time.Minute), CheckReport{}, WithCode(E_DETECT_FAILED, errors.New("could not retrieve initial values")))
+	notifications.Dispatch(start.Add(100*time.Minute), CheckReport{}, nil)
+
+	var types []string
+	for _, event := range ops.events {
+		types = append(types, event.Type+" "+event.Code)
+	}
+	expected := []string{"error E_API", "error E_API", "error E_DETECT_FAILED", "recovered "}
+	if !slices.Equal(types, expected) {
+		t.Fatalf("Expected %v, got %v", expected, types)
+	}
+	if ops.events[1].Message != "Still failing after 13 checks since 2026-10-17T00:00:00Z: cloudflare is down" {
+		t.Errorf("Unexpected reminder: %q", ops.events[1].Message)
+	}
+	if ops.events[3].Message != "Checks succeeding again after 20 failed since 2026-10-17T00:00:00Z" {
+		t.Errorf("Unexpected recovery: %q", ops.events[3].Message)
+	}
+	if notifications.Failure() != nil {
+		t.Errorf("Expected no failure spell after recovering, got %+v", notifications.Failure())
+	}
+
+	// A later run carrying on with the spell doesn't notify about it again
+	restored := &Notifications{Channels: map[string]Notifier{"ops": ops}, Default: []string{"ops"}}
+	restored.Restore(&FailureSpell{Since: start, Code: E_API, Notified: start, Checks: 1})
+	restored.Dispatch(start.Add(5*time.Minute), CheckReport{}, apiErr)
+	if len(ops.events) != 4 {
+		t.Errorf("Expected the restored spell to keep quiet, got %+v", ops.events[4:])
+	}
+}
+
+func TestNotifications_RateLimit(t *testing.T) {
+	ops, lab := &recordingNotifier{}, &recordingNotifier{}
+	notifications := NewNotifications(Config{
+		Notifiers:        map[string]NotifierConfig{"ops": {MaxPerHour: 2}, "lab": {}},
+		Notify:           []string{"ops", "lab"},
+		NotifyMaxPerHour: 5,
+	})
+	notifications.Channels = map[string]Notifier{"ops": ops, "lab": lab}
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+
+	// Flapping detection, a warning every minute, ops hits its own limit after 2 and lab the global one after 3
+	for i := range 4 {
+		notifications.Alert(Event{Type: EVENT_WARNING, Time: start.Add(time.Duration(i) * time.Minute), Message: "flap"})
+	}
+	if len(ops.events) != 2 || len(lab.events) != 3 {
+		t.Fatalf("Expected 2 events for ops and 3 for lab, got %+v and %+v", ops.events, lab.events)
+	}
+
+	// Once the first ones are out of the window, each channel is told what it missed
+	notifications.Alert(Event{Type: EVENT_WARNING, Time: start.Add(61 * time.Minute), Message: "flap"})
+	if len(ops.events) != 4 || ops.events[2].Message != "Suppressed 2 notifications over the rate limit" || ops.events[3].Message != "flap" {
+		t.Errorf("Unexpected ops events: %+v", ops.events)
+	}
+	if len(lab.events) != 5 || lab.events[3].Message != "Suppressed 1 notification over the rate limit" {
+		t.Errorf("Unexpected lab events: %+v", lab.events)
+	}
+}
+
+// Notifier waiting to be released before it returns, like a webhook that's slow to answer
+type blockingNotifier struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (n blockingNotifier) Notify(event Event) error {
+	n.entered <- struct{}{}
+	<-n.release
+	return nil
+}
+
+func TestNotifications_SendWithoutLock(t *testing.T) {
+	slow := blockingNotifier{entered: make(chan struct{}), release: make(chan struct{})}
+	notifications := &Notifications{Channels: map[string]Notifier{"slow": slow}, Default: []string{"slow"}}
+
+	done := make(chan struct{})
+	go func() {
+		notifications.Dispatch(time.Now(), CheckReport{}, errors.New("could not retrieve initial values"))
+		close(done)
+	}()
+	<-slow.entered
+
+	// The failure spell and a reload don't wait for the webhook to answer
+	if notifications.Failure() == nil {
+		t.Error("Expected the failure spell to be noted before the webhook answered")
+	}
+	notifications.Replace(&Notifications{Channels: map[string]Notifier{}})
+	close(slow.release)
+	<-done
+}
@@ -0,0 +1,54 @@
+package main
+
+import "sync"
+
+// Default limits on how many Cloudflare API calls run at once
+const DEFAULT_WORKERS = 4
+const DEFAULT_ZONE_WORKERS = 2
+
+// Bounds how many Cloudflare API calls run at once, overall and within each zone
+// Keeps large runs fast without tripping Cloudflare's rate limits
+type WorkerPool struct {
+	workers chan struct{}
+	perZone int
+
+	mu    sync.Mutex
+	zones map[string]chan struct{}
+}
+
+// Method to create a pool running at most workers calls at once, and at most perZone within a single zone
+func NewWorkerPool(workers int, perZone int) *WorkerPool {
+	return &WorkerPool{
+		workers: make(chan struct{}, max(workers, 1)),
+		perZone: max(perZone, 1),
+		zones:   make(map[string]chan struct{}),
+	}
+}
+
+// Method to run fn once both a worker and a slot within the zone are free, blocking until it has finished
+// A nil pool runs fn straight away
+func (p *WorkerPool) Run(zoneID string, fn func()) {
+	if p == nil {
+		fn()
+		return
+	}
+	// Take the zone slot first so a call waiting on a busy zone doesn't hold up a worker others could use
+	zone := p.zone(zoneID)
+	zone <- struct{}{}
+	defer func() { <-zone }()
+	p.workers <- struct{}{}
+	defer func() { <-p.workers }()
+	fn()
+}
+
+// Helper method to get the slots of a zone, creating them on first use
+func (p *WorkerPool) zone(zoneID string) chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	zone, ok := p.zones[zoneID]
+	if !ok {
+		zone = make(chan struct{}, p.perZone)
+		p.zones[zoneID] = zone
+	}
+	return zone
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPool_Limits(t *testing.T) {
+	pool := NewWorkerPool(3, 1)
+	var running, peak atomic.Int32
+	zoneRunning := map[string]*atomic.Int32{"z1": {}, "z2": {}, "z3": {}, "z4": {}}
+	var wg sync.WaitGroup
+	for i := range 20 {
+		zoneID := []string{"z1", "z2", "z3", "z4"}[i%4]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.Run(zoneID, func() {
+				now := running.Add(1)
+				defer running.Add(-1)
+				for {
+					previous := peak.Load()
+					if now <= previous || peak.CompareAndSwap(previous, now) {
+						break
+					}
+				}
+				if zoneRunning[zoneID].Add(1) > 1 {
+					t.Errorf("Expected at most 1 call at once in %v", zoneID)
+				}
+				defer zoneRunning[zoneID].Add(-1)
+				time.Sleep(5 * time.Millisecond)
+			})
+		}()
+	}
+	wg.Wait()
+
+	if peak.Load() > 3 {
+		t.Errorf("Expected at most 3 calls at once, got %d", peak.Load())
+	}
+	if peak.Load() < 2 {
+		t.Errorf("Expected calls in different zones to run at the same time, got %d at most", peak.Load())
+	}
+}
+
+func TestWorkerPool_Nil(t *testing.T) {
+	var pool *WorkerPool
+	ran := false
+	pool.Run("z1", func() { ran = true })
+	if !ran {
+		t.Error("Expected a nil pool to run the call")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Shows how far a check has got, e.g. "2/3 zones listed, 3/17 records updated", so a long run doesn't look hung
+// Redrawn in place on a single line, and only on a terminal so cron mails and logs aren't filled with it
+// Every method can be called on a nil Progress, doing nothing
+type Progress struct {
+	mu  sync.Mutex
+	out io.Writer
+	// Counts of what's to be done and what is, several accounts add to the same ones
+	zones, zonesListed      int
+	records, recordsUpdated int
+	// Whether a line has been drawn and needs clearing
+	drawn bool
+}
+
+// Method to create a progress display on out, nil when out isn't a terminal
+func NewProgress(out io.Writer) *Progress {
+	if !IsTerminal(out) {
+		return nil
+	}
+	return &Progress{out: out}
+}
+
+// Method to count zones whose records are about to be listed
+func (p *Progress) AddZones(count int) {
+	p.update(func() { p.zones += count })
+}
+
+// Method to count a zone as listed
+func (p *Progress) ZoneListed() {
+	p.update(func() { p.zonesListed++ })
+}
+
+// Method to count records about to be updated
+func (p *Progress) AddRecords(count int) {
+	p.update(func() { p.records += count })
+}
+
+// Method to count a record update as done, whether or not it went through
+func (p *Progress) RecordUpdated() {
+	p.update(func() { p.recordsUpdated++ })
+}
+
+// Method to clear the progress line, leaving the terminal to whatever is printed next
+func (p *Progress) Finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.drawn {
+		fmt.Fprint(p.out, ANSI_CLEAR_LINE)
+		p.drawn = false
+	}
+}
+
+// Helper method to change the counts and redraw the line
+func (p *Progress) update(change func()) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	change()
+	if line := p.line(); line != "" {
+		fmt.Fprint(p.out, ANSI_CLEAR_LINE+line)
+		p.drawn = true
+	}
+}
+
+// Helper method to describe the progress, leaving out the steps with nothing to do
+// A single zone or record isn't worth showing progress for
+func (p *Progress) line() string {
+	var parts []string
+	if p.zones > 1 {
+		parts = append(parts, fmt.Sprintf("%d/%d zones listed", p.zonesListed, p.zones))
+	}
+	if p.records > 1 {
+		parts = append(parts, fmt.Sprintf("%d/%d records updated", p.recordsUpdated, p.records))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	var out bytes.Buffer
+	progress := &Progress{out: &out}
+
+	// A single zone isn't worth showing
+	progress.AddZones(1)
+	progress.ZoneListed()
+	if out.Len() != 0 {
+		t.Errorf("Expected nothing shown for a single zone, got %q", out.String())
+	}
+
+	progress.AddRecords(3)
+	progress.RecordUpdated()
+	if expected := ANSI_CLEAR_LINE + "1/3 records updated"; !strings.HasSuffix(out.String(), expected) {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+	progress.AddZones(2)
+	if expected := ANSI_CLEAR_LINE + "1/3 zones listed, 1/3 records updated"; !strings.HasSuffix(out.String(), expected) {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+
+	out.Reset()
+	progress.Finish()
+	if out.String() != ANSI_CLEAR_LINE {
+		t.Errorf("Expected the line cleared, got %q", out.String())
+	}
+	out.Reset()
+	progress.Finish()
+	if out.Len() != 0 {
+		t.Errorf("Expected nothing to clear the second time, got %q", out.String())
+	}
+}
+
+func TestProgress_NotTerminal(t *testing.T) {
+	progress := NewProgress(&bytes.Buffer{})
+	if progress != nil {
+		t.Fatal("Expected no progress for output that isn't a terminal")
+	}
+	// Nothing to show, but nothing to fail either
+	progress.AddRecords(2)
+	progress.RecordUpdated()
+	progress.Finish()
+}
+
+func TestUpdateZones_Progress(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}, {"id": "z2", "name": "example.net"}},
+		records: map[string][]map[string]any{
+			"z1": {{"id": "r1", "name": "home.example.com", "type": "A", "content": "203.0.113.1", "ttl": 1}},
+			"z2": {{"id": "r2", "name": "lab.example.net", "type": "A", "content": "203.0.113.1", "ttl": 1}},
+		},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+	groups := []ZoneGroup{
+		{Zone: Zone{ID: "z1"}, Records: []RecordConfig{{Name: "home.example.com"}}},
+		{Zone: Zone{ID: "z2"}, Records: []RecordConfig{{Name: "lab.example.net"}}},
+	}
+	var out bytes.Buffer
+	if _, err := UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{Progress: &Progress{out: &out}}, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "2/2 zones listed, 2/2 records updated"; !strings.HasSuffix(out.String(), expected) {
+		t.Errorf("Expected the progress to end on %q, got %q", expected, out.String())
+	}
+}
@@ -0,0 +1,379 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: dnsupdate.proto
+
+package dnsupdatepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type EventType int32
+
+const (
+	EventType_EVENT_TYPE_UNSPECIFIED EventType = 0
+	// DNS records were updated to a new IP address.
+	EventType_EVENT_TYPE_CHANGE EventType = 1
+	// A check failed.
+	EventType_EVENT_TYPE_ERROR EventType = 2
+	// Something needs attention although the check succeeded.
+	EventType_EVENT_TYPE_WARNING EventType = 3
+)
+
+// Enum value maps for EventType.
+var (
+	EventType_name = map[int32]string{
+		0: "EVENT_TYPE_UNSPECIFIED",
+		1: "EVENT_TYPE_CHANGE",
+		2: "EVENT_TYPE_ERROR",
+		3: "EVENT_TYPE_WARNING",
+	}
+	EventType_value = map[string]int32{
+		"EVENT_TYPE_UNSPECIFIED": 0,
+		"EVENT_TYPE_CHANGE":      1,
+		"EVENT_TYPE_ERROR":       2,
+		"EVENT_TYPE_WARNING":     3,
+	}
+)
+
+func (x EventType) Enum() *EventType {
+	p := new(EventType)
+	*p = x
+	return p
+}
+
+func (x EventType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (EventType) Descriptor() protoreflect.EnumDescriptor {
+	return file_dnsupdate_proto_enumTypes[0].Descriptor()
+}
+
+func (EventType) Type() protoreflect.EnumType {
+	return &file_dnsupdate_proto_enumTypes[0]
+}
+
+func (x EventType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use EventType.Descriptor instead.
+func (EventType) EnumDescriptor() ([]byte, []int) {
+	return file_dnsupdate_proto_rawDescGZIP(), []int{0}
+}
+
+type SyncRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SyncRequest) Reset() {
+	*x = SyncRequest{}
+	mi := &file_dnsupdate_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncRequest) ProtoMessage() {}
+
+func (x *SyncRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dnsupdate_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncRequest.ProtoReflect.Descriptor instead.
+func (*SyncRequest) Descriptor() ([]byte, []int) {
+	return file_dnsupdate_proto_rawDescGZIP(), []int{0}
+}
+
+type SyncResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// When the check finished.
+	Time *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	// Whether any DNS record was updated.
+	Changed bool `protobuf:"varint,2,opt,name=changed,proto3" json:"changed,omitempty"`
+	// Why the check failed, empty on success.
+	Error         string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SyncResponse) Reset() {
+	*x = SyncResponse{}
+	mi := &file_dnsupdate_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncResponse) ProtoMessage() {}
+
+func (x *SyncResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dnsupdate_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncResponse.ProtoReflect.Descriptor instead.
+func (*SyncResponse) Descriptor() ([]byte, []int) {
+	return file_dnsupdate_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SyncResponse) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *SyncResponse) GetChanged() bool {
+	if x != nil {
+		return x.Changed
+	}
+	return false
+}
+
+func (x *SyncResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type WatchEventsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEventsRequest) Reset() {
+	*x = WatchEventsRequest{}
+	mi := &file_dnsupdate_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEventsRequest) ProtoMessage() {}
+
+func (x *WatchEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dnsupdate_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEventsRequest.ProtoReflect.Descriptor instead.
+func (*WatchEventsRequest) Descriptor() ([]byte, []int) {
+	return file_dnsupdate_proto_rawDescGZIP(), []int{2}
+}
+
+type Event struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Type    EventType              `protobuf:"varint,1,opt,name=type,proto3,enum=dnsupdate.v1.EventType" json:"type,omitempty"`
+	Time    *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	Message string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	// Code of the failure for error events, e.g. E_ZONE_NOT_FOUND.
+	Code string `protobuf:"bytes,4,opt,name=code,proto3" json:"code,omitempty"`
+	// ID of the check the event came out of, to find its log lines by.
+	CheckId       string `protobuf:"bytes,5,opt,name=check_id,json=checkId,proto3" json:"check_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_dnsupdate_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_dnsupdate_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_dnsupdate_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Event) GetType() EventType {
+	if x != nil {
+		return x.Type
+	}
+	return EventType_EVENT_TYPE_UNSPECIFIED
+}
+
+func (x *Event) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Event) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Event) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Event) GetCheckId() string {
+	if x != nil {
+		return x.CheckId
+	}
+	return ""
+}
+
+var File_dnsupdate_proto protoreflect.FileDescriptor
+
+const file_dnsupdate_proto_rawDesc = "" +
+	"\n" +
+	"\x0fdnsupdate.proto\x12\fdnsupdate.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\r\n" +
+	"\vSyncRequest\"n\n" +
+	"\fSyncResponse\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x18\n" +
+	"\achanged\x18\x02 \x01(\bR\achanged\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"\x14\n" +
+	"\x12WatchEventsRequest\"\xad\x01\n" +
+	"\x05Event\x12+\n" +
+	"\x04type\x18\x01 \x01(\x0e2\x17.dnsupdate.v1.EventTypeR\x04type\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12\x12\n" +
+	"\x04code\x18\x04 \x01(\tR\x04code\x12\x19\n" +
+	"\bcheck_id\x18\x05 \x01(\tR\acheckId*l\n" +
+	"\tEventType\x12\x1a\n" +
+	"\x16EVENT_TYPE_UNSPECIFIED\x10\x00\x12\x15\n" +
+	"\x11EVENT_TYPE_CHANGE\x10\x01\x12\x14\n" +
+	"\x10EVENT_TYPE_ERROR\x10\x02\x12\x16\n" +
+	"\x12EVENT_TYPE_WARNING\x10\x032\x92\x01\n" +
+	"\tDNSUpdate\x12=\n" +
+	"\x04Sync\x12\x19.dnsupdate.v1.SyncRequest\x1a\x1a.dnsupdate.v1.SyncResponse\x12F\n" +
+	"\vWatchEvents\x12 .dnsupdate.v1.WatchEventsRequest\x1a\x13.dnsupdate.v1.Event0\x01B;Z9github.com/TheSilverBulet/go-dns-update/proto;dnsupdatepbb\x06proto3"
+
+var (
+	file_dnsupdate_proto_rawDescOnce sync.Once
+	file_dnsupdate_proto_rawDescData []byte
+)
+
+func file_dnsupdate_proto_rawDescGZIP() []byte {
+	file_dnsupdate_proto_rawDescOnce.Do(func() {
+		file_dnsupdate_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_dnsupdate_proto_rawDesc), len(file_dnsupdate_proto_rawDesc)))
+	})
+	return file_dnsupdate_proto_rawDescData
+}
+
+var file_dnsupdate_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_dnsupdate_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_dnsupdate_proto_goTypes = []any{
+	(EventType)(0),                // 0: dnsupdate.v1.EventType
+	(*SyncRequest)(nil),           // 1: dnsupdate.v1.SyncRequest
+	(*SyncResponse)(nil),          // 2: dnsupdate.v1.SyncResponse
+	(*WatchEventsRequest)(nil),    // 3: dnsupdate.v1.WatchEventsRequest
+	(*Event)(nil),                 // 4: dnsupdate.v1.Event
+	(*timestamppb.Timestamp)(nil), // 5: google.protobuf.Timestamp
+}
+var file_dnsupdate_proto_depIdxs = []int32{
+	5, // 0: dnsupdate.v1.SyncResponse.time:type_name -> google.protobuf.Timestamp
+	0, // 1: dnsupdate.v1.Event.type:type_name -> dnsupdate.v1.EventType
+	5, // 2: dnsupdate.v1.Event.time:type_name -> google.protobuf.Timestamp
+	1, // 3: dnsupdate.v1.DNSUpdate.Sync:input_type -> dnsupdate.v1.SyncRequest
+	3, // 4: dnsupdate.v1.DNSUpdate.WatchEvents:input_type -> dnsupdate.v1.WatchEventsRequest
+	2, // 5: dnsupdate.v1.DNSUpdate.Sync:output_type -> dnsupdate.v1.SyncResponse
+	4, // 6: dnsupdate.v1.DNSUpdate.WatchEvents:output_type -> dnsupdate.v1.Event
+	5, // [5:7] is the sub-list for method output_type
+	3, // [3:5] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_dnsupdate_proto_init() }
+func file_dnsupdate_proto_init() {
+	if File_dnsupdate_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_dnsupdate_proto_rawDesc), len(file_dnsupdate_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_dnsupdate_proto_goTypes,
+		DependencyIndexes: file_dnsupdate_proto_depIdxs,
+		EnumInfos:         file_dnsupdate_proto_enumTypes,
+		MessageInfos:      file_dnsupdate_proto_msgTypes,
+	}.Build()
+	File_dnsupdate_proto = out.File
+	file_dnsupdate_proto_goTypes = nil
+	file_dnsupdate_proto_depIdxs = nil
+}
@@ -0,0 +1,173 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: dnsupdate.proto
+
+package dnsupdatepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	DNSUpdate_Sync_FullMethodName        = "/dnsupdate.v1.DNSUpdate/Sync"
+	DNSUpdate_WatchEvents_FullMethodName = "/dnsupdate.v1.DNSUpdate/WatchEvents"
+)
+
+// DNSUpdateClient is the client API for DNSUpdate service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Control service exposed by go-dns-update in daemon mode.
+// Every call must carry an "authorization: Bearer <controlToken>" metadata entry.
+type DNSUpdateClient interface {
+	// Run a check right away and wait for its outcome.
+	Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (*SyncResponse, error)
+	// Stream change and error events as they happen.
+	WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+}
+
+type dNSUpdateClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDNSUpdateClient(cc grpc.ClientConnInterface) DNSUpdateClient {
+	return &dNSUpdateClient{cc}
+}
+
+func (c *dNSUpdateClient) Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (*SyncResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SyncResponse)
+	err := c.cc.Invoke(ctx, DNSUpdate_Sync_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dNSUpdateClient) WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &DNSUpdate_ServiceDesc.Streams[0], DNSUpdate_WatchEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchEventsRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DNSUpdate_WatchEventsClient = grpc.ServerStreamingClient[Event]
+
+// DNSUpdateServer is the server API for DNSUpdate service.
+// All implementations must embed UnimplementedDNSUpdateServer
+// for forward compatibility.
+//
+// Control service exposed by go-dns-update in daemon mode.
+// Every call must carry an "authorization: Bearer <controlToken>" metadata entry.
+type DNSUpdateServer interface {
+	// Run a check right away and wait for its outcome.
+	Sync(context.Context, *SyncRequest) (*SyncResponse, error)
+	// Stream change and error events as they happen.
+	WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[Event]) error
+	mustEmbedUnimplementedDNSUpdateServer()
+}
+
+// UnimplementedDNSUpdateServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDNSUpdateServer struct{}
+
+func (UnimplementedDNSUpdateServer) Sync(context.Context, *SyncRequest) (*SyncResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Sync not implemented")
+}
+func (UnimplementedDNSUpdateServer) WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEvents not implemented")
+}
+func (UnimplementedDNSUpdateServer) mustEmbedUnimplementedDNSUpdateServer() {}
+func (UnimplementedDNSUpdateServer) testEmbeddedByValue()                   {}
+
+// UnsafeDNSUpdateServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DNSUpdateServer will
+// result in compilation errors.
+type UnsafeDNSUpdateServer interface {
+	mustEmbedUnimplementedDNSUpdateServer()
+}
+
+func RegisterDNSUpdateServer(s grpc.ServiceRegistrar, srv DNSUpdateServer) {
+	// If the following call pancis, it indicates UnimplementedDNSUpdateServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&DNSUpdate_ServiceDesc, srv)
+}
+
+func _DNSUpdate_Sync_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SyncRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DNSUpdateServer).Sync(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DNSUpdate_Sync_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DNSUpdateServer).Sync(ctx, req.(*SyncRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DNSUpdate_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DNSUpdateServer).WatchEvents(m, &grpc.GenericServerStream[WatchEventsRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DNSUpdate_WatchEventsServer = grpc.ServerStreamingServer[Event]
+
+// DNSUpdate_ServiceDesc is the grpc.ServiceDesc for DNSUpdate service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DNSUpdate_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "dnsupdate.v1.DNSUpdate",
+	HandlerType: (*DNSUpdateServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Sync",
+			Handler:    _DNSUpdate_Sync_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _DNSUpdate_WatchEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "dnsupdate.proto",
+}
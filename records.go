@@ -0,0 +1,554 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/dns"
+	"golang.org/x/net/publicsuffix"
+)
+
+// TTL value Cloudflare treats as 'automatic'
+const TTL_AUTOMATIC = 1
+
+// Address record types that can be kept pointed at a detected IP
+const RECORD_TYPE_A = "A"
+const RECORD_TYPE_AAAA = "AAAA"
+
+// Record type of the heartbeat record
+const RECORD_TYPE_TXT = "TXT"
+
+// Alias record type, kept pointed at a target hostname instead of an IP
+const RECORD_TYPE_CNAME = "CNAME"
+
+// Page size used when listing a zone's records
+const DNS_RECORDS_PER_PAGE = 500
+
+// Page size used when listing the zones a token can access, the most the API allows
+const ZONES_PER_PAGE = 50
+
+// Page size used when reading an account's audit log
+const AUDIT_LOGS_PER_PAGE = 100
+
+// Ways of purging the cache after records change, only the changed hostnames or the whole zone
+const PURGE_HOSTS = "hosts"
+const PURGE_EVERYTHING = "everything"
+
+// Prefix of the comment written to records when -comment is set
+const MANAGED_COMMENT_PREFIX = "managed by go-dns-update"
+
+// The parts of a Cloudflare DNS record the program works with
+type DNSRecord struct {
+	ID      string
+	ZoneID  string
+	Name    string
+	Type    string
+	Content string
+	// Priority of MX and SRV records, which Cloudflare keeps apart from the content
+	Priority int
+	TTL      int
+	Proxied  bool
+	Comment  string
+	Tags     []string
+	// When Cloudflare last saw the record modified, by this program or anyone else
+	ModifiedOn time.Time
+}
+
+// A Cloudflare zone the API Token has access to
+type Zone struct {
+	ID   string
+	Name string
+	// e.g. active or pending, empty when not known
+	Status string
+	// ID of the account the zone is in, empty when not known
+	AccountID string
+}
+
+// Status of a zone whose records can be edited
+const ZONE_STATUS_ACTIVE = "active"
+
+// Method to report why the zone's records can't be edited, nil when they can
+// Pending and initializing zones aren't set up on Cloudflare yet and moved ones have left it, edits to them only fail with a less helpful API error
+func (z Zone) EditableError() error {
+	if z.Status == "" || z.Status == ZONE_STATUS_ACTIVE {
+		return nil
+	}
+	return WithCode(E_ZONE_NOT_EDITABLE, fmt.Errorf("zone %v is %v rather than active, so its records can't be edited", z.Name, z.Status))
+}
+
+// The targets living in a single zone
+type ZoneGroup struct {
+	Zone    Zone
+	Records []RecordConfig
+}
+
+// The records of a zone a check needs, rather than all of them
+type RecordFilter struct {
+	// Names of the records wanted, of any type so a name taken by another type can still be reported
+	Names []string
+	// Types wanted of each name, by lower cased name, the API is asked for only these and for the others when none of them exists
+	Types map[string][]string
+	// A records carrying the tag are wanted as well, none when empty
+	Tag string
+}
+
+// Method to want the record of the name and type
+func (f *RecordFilter) Add(name string, recordType string) {
+	if !slices.ContainsFunc(f.Names, func(listed string) bool { return SameName(listed, name) }) {
+		f.Names = append(f.Names, name)
+	}
+	if f.Types == nil {
+		f.Types = map[string][]string{}
+	}
+	key := strings.ToLower(strings.TrimSuffix(name, "."))
+	if !slices.Contains(f.Types[key], recordType) {
+		f.Types[key] = append(f.Types[key], recordType)
+	}
+}
+
+// Method to get the filter listing the records of the group's targets, with the tagged ones
+func (g ZoneGroup) Filter(tag string) RecordFilter {
+	filter := RecordFilter{Tag: tag}
+	for _, target := range g.Records {
+		filter.Add(target.Name, target.RecordType())
+		if target.WWW {
+			filter.Add("www."+target.Name, target.RecordType())
+		}
+	}
+	return filter
+}
+
+// Method to report whether the filter wants the record
+func (f RecordFilter) Matches(record DNSRecord) bool {
+	if slices.ContainsFunc(f.Names, func(name string) bool { return SameName(name, record.Name) }) {
+		return true
+	}
+	return f.Tag != "" && record.Type == RECORD_TYPE_A && record.HasTag(f.Tag)
+}
+
+// Helper method to find the zone a domain name lives in
+// The names it could have are tried from the domain name's own up through its parents, so a delegated sub-zone, e.g. lab.example.com, beats its parent
+func MatchZone(zoneList []Zone, domainName string) (Zone, bool) {
+	for _, candidate := range ZoneCandidates(domainName) {
+		if zone, ok := pickZone(zoneList, candidate); ok {
+			return zone, true
+		}
+	}
+	return Zone{}, false
+}
+
+// Method to list the names the zone a domain name lives in could have, most specific first, e.g. nas.lab.example.com, lab.example.com and example.com
+func ZoneCandidates(domainName string) []string {
+	labels := strings.Split(strings.TrimSuffix(domainName, "."), ".")
+	var candidates []string
+	// A zone is at least a name and its TLD
+	for i := 0; i < len(labels)-1; i++ {
+		candidates = append(candidates, strings.Join(labels[i:], "."))
+	}
+	return candidates
+}
+
+// Helper method to pick the zone of the name from the list
+// An editable zone beats others of the same name, e.g. a pending copy of it added to another account
+func pickZone(zoneList []Zone, name string) (Zone, bool) {
+	var match Zone
+	for _, zone := range zoneList {
+		if SameName(zone.Name, name) && (match.ID == "" || match.EditableError() != nil && zone.EditableError() == nil) {
+			match = zone
+		}
+	}
+	return match, match.ID != ""
+}
+
+// Method to find the zone a domain name lives in with a single lookup of the zones within its registrable domain, e.g. example.com for nas.lab.example.com
+// The zones are asked for by name, so the most specific zone is found without listing every zone the API Token has access to
+func LookupZone(cfClient CloudflareAPI, domainName string) (Zone, bool, error) {
+	zoneList, err := cfClient.ZonesWithin(RegistrableDomain(domainName))
+	if err != nil {
+		return Zone{}, false, fmt.Errorf("looking up zone failed: %w", err)
+	}
+	zone, found := MatchZone(zoneList, domainName)
+	return zone, found, nil
+}
+
+// Method to get the registrable domain of a name, e.g. example.co.uk for nas.example.co.uk, the least specific zone it can be in
+// Only ICANN's suffixes count, ones run by companies, e.g. github.io, can be zones of their own
+func RegistrableDomain(domainName string) string {
+	name := strings.ToLower(strings.TrimSuffix(domainName, "."))
+	suffix, icann := publicsuffix.PublicSuffix(name)
+	for !icann {
+		_, parent, found := strings.Cut(suffix, ".")
+		if !found {
+			break
+		}
+		suffix, icann = publicsuffix.PublicSuffix(parent)
+	}
+	rest, found := strings.CutSuffix(name, "."+suffix)
+	if !found {
+		return name
+	}
+	return rest[strings.LastIndex(rest, ".")+1:] + "." + suffix
+}
+
+// A target that couldn't be handled, and why
+type TargetError struct {
+	Name string
+	Err  error
+}
+
+func (e *TargetError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Name, e.Err)
+}
+
+func (e *TargetError) Unwrap() error {
+	return e.Err
+}
+
+// Helper method to sort the targets by the zone they live in, keeping the order they were given in
+// Targets in no zone are left out and reported in the error, one TargetError each
+func GroupByZone(zoneList []Zone, targets []RecordConfig) ([]ZoneGroup, error) {
+	var groups []ZoneGroup
+	var errs []error
+	for _, target := range targets {
+		zone, ok := MatchZone(zoneList, target.Name)
+		// A zone ID given in the config is used as is, with the zone's name and status when it was listed anyway
+		if target.ZoneID != "" {
+			zone, ok = Zone{ID: target.ZoneID, Name: target.ZoneID}, true
+			if i := slices.IndexFunc(zoneList, func(listed Zone) bool { return listed.ID == target.ZoneID }); i >= 0 {
+				zone = zoneList[i]
+			}
+		}
+		if !ok {
+			errs = append(errs, &TargetError{Name: target.Name, Err: WithCode(E_ZONE_NOT_FOUND, fmt.Errorf("could not match a Zone ID"))})
+			continue
+		}
+		i := slices.IndexFunc(groups, func(group ZoneGroup) bool { return group.Zone.ID == zone.ID })
+		if i < 0 {
+			groups = append(groups, ZoneGroup{Zone: zone})
+			i = len(groups) - 1
+		}
+		groups[i].Records = append(groups[i].Records, target)
+	}
+	return groups, errors.Join(errs...)
+}
+
+// Helper method to convert a record returned by the Cloudflare API
+func NewDNSRecord(record dns.RecordResponse) DNSRecord {
+	return DNSRecord{
+		ID:         record.ID,
+		Name:       record.Name,
+		Type:       string(record.Type),
+		Content:    record.Content,
+		Priority:   int(record.Priority),
+		TTL:        int(record.TTL),
+		Proxied:    record.Proxied,
+		Comment:    record.Comment,
+		Tags:       recordTags(record.Tags),
+		ModifiedOn: record.ModifiedOn,
+	}
+}
+
+// Helper method to read the tags off a record response, the SDK leaves their type open
+func recordTags(value any) []string {
+	switch tags := value.(type) {
+	case []string:
+		return tags
+	case []any:
+		var result []string
+		for _, tag := range tags {
+			if s, ok := tag.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// Settings applied to records when they're updated, zero values keep whatever the record already has
+type RecordOptions struct {
+	// TTL in seconds, TTL_AUTOMATIC for automatic
+	TTL int
+	// Whether records are proxied through Cloudflare, nil keeps the existing setting
+	Proxied *bool
+	// Whether to stamp each edited record with a comment saying when and from which IP it last changed
+	ManagedComment bool
+	// A records carrying this Cloudflare tag are managed in addition to the domain itself
+	Tag string
+	// Tag added to every managed record that doesn't have it yet
+	ApplyTag string
+	// Cache purged in zones whose records changed, PURGE_HOSTS, PURGE_EVERYTHING or empty to leave the cache alone
+	Purge string
+	// Checks address changes stay in the same country and network, nil when disabled
+	Geo *GeoGuard
+	// Shows how far the listing and updating has got, nil when not shown
+	Progress *Progress
+	// Only report the records that are out of sync as failed rather than updating them, so a read-only API Token will do
+	CheckOnly bool
+	// Reports whether the record of the name is left as it is for now, e.g. paused from the dashboard. None are when nil
+	Paused func(name string) bool
+}
+
+// Method to check the options hold values Cloudflare will accept
+func (o RecordOptions) Validate() error {
+	if o.TTL != 0 && o.TTL != TTL_AUTOMATIC && (o.TTL < 30 || o.TTL > 86400) {
+		return fmt.Errorf("ttl must be 1 (automatic) or between 30 and 86400 seconds, got %d", o.TTL)
+	}
+	if o.Purge != "" && o.Purge != PURGE_HOSTS && o.Purge != PURGE_EVERYTHING {
+		return fmt.Errorf("purge must be %v or %v, got %q", PURGE_HOSTS, PURGE_EVERYTHING, o.Purge)
+	}
+	return nil
+}
+
+// Helper method to decide whether a record differs from what it should be
+func RecordNeedsUpdate(record DNSRecord, publicIP string, options RecordOptions) bool {
+	if !ContentMatches(record.Type, RecordPresentation(record), publicIP) {
+		return true
+	}
+	if options.TTL != 0 && record.TTL != options.TTL {
+		return true
+	}
+	if options.Proxied != nil && IsProxiableType(record.Type) && record.Proxied != *options.Proxied {
+		return true
+	}
+	return options.ApplyTag != "" && !record.HasTag(options.ApplyTag)
+}
+
+// Method to report whether the record carries the tag
+// Cloudflare tags are either "name" or "name:value", a bare name matches either form
+func (r DNSRecord) HasTag(tag string) bool {
+	for _, recordTag := range r.Tags {
+		if recordTag == tag || (!strings.Contains(tag, ":") && strings.HasPrefix(recordTag, tag+":")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper method to pick the target's record, and the www one if requested, out of the zone's records
+// Only records of the target's type are considered, A unless configured otherwise, and only this machine's member of a multi-value set
+// return expects this order: domainRecord, wwwDomainRecord
+func FindDNSRecords(records []DNSRecord, target RecordConfig) (DNSRecord, DNSRecord) {
+	var domainRecord DNSRecord
+	var wwwDomainRecord DNSRecord
+	// For every record see which one's 'Name' member matches our domainName, grab that record
+	// If handling www record, look for the record whose 'Name' member matches our domainName with 'www.' prepended and store that too
+	for _, record := range records {
+		if record.Type != target.RecordType() || !target.Member.Matches(record) {
+			continue
+		}
+		if SameName(record.Name, target.Name) {
+			domainRecord = record
+		}
+		if target.WWW && SameName(record.Name, fmt.Sprintf("www.%v", target.Name)) {
+			wwwDomainRecord = record
+		}
+	}
+	return domainRecord, wwwDomainRecord
+}
+
+// Helper method to explain why the target's record, or its www one, wasn't found
+func MissingTargetError(records []DNSRecord, name string, target RecordConfig) error {
+	if target.Member != nil && slices.ContainsFunc(records, func(record DNSRecord) bool { return SameName(record.Name, name) && record.Type == target.RecordType() }) {
+		return WithCode(E_RECORD_CONFLICT, fmt.Errorf("none of the %v records of %v is %v, refusing to touch the other members", target.RecordType(), name, target.Member))
+	}
+	return MissingRecordError(records, name, target.RecordType())
+}
+
+// Helper method to explain why no record of the wanted type was found for the name
+// A name already used by a record of another type (e.g. a CNAME) is called out, editing that with address parameters would be wrong
+func MissingRecordError(records []DNSRecord, name string, recordType string) error {
+	var others []string
+	for _, record := range records {
+		if SameName(record.Name, name) && !slices.Contains(others, record.Type) {
+			others = append(others, record.Type)
+		}
+	}
+	if len(others) > 0 {
+		return WithCode(E_RECORD_CONFLICT, fmt.Errorf("%v has %v record(s) but no %v record, refusing to touch them", name, strings.Join(others, ", "), recordType))
+	}
+	return WithCode(E_RECORD_NOT_FOUND, fmt.Errorf("couldn't obtain %v Record ID", recordType))
+}
+
+// Helper method to pick out the A records carrying the tag, none when tag is empty
+func TaggedRecords(records []DNSRecord, tag string) []DNSRecord {
+	if tag == "" {
+		return nil
+	}
+	var tagged []DNSRecord
+	for _, record := range records {
+		if record.Type == RECORD_TYPE_A && record.HasTag(tag) {
+			tagged = append(tagged, record)
+		}
+	}
+	return tagged
+}
+
+// Helper method to build the comment marking a record as managed by this program
+func ManagedComment(at time.Time, previousIP string) string {
+	comment := fmt.Sprintf("%v; last change %v", MANAGED_COMMENT_PREFIX, at.UTC().Format("2006-01-02T15:04Z"))
+	if previousIP != "" {
+		comment += " from " + previousIP
+	}
+	return comment
+}
+
+// Method to apply a record's own settings from the config over the global ones
+func (o RecordOptions) For(target RecordConfig) RecordOptions {
+	if target.TTL != 0 {
+		o.TTL = target.TTL
+	}
+	if target.Proxied != nil {
+		o.Proxied = target.Proxied
+	}
+	// A pinned address is chosen on purpose, wherever it is
+	if target.Pinned() {
+		o.Geo = nil
+	}
+	// The managed comment would replace the one the member is recognised by
+	if target.Member != nil && target.Member.Comment != "" {
+		o.ManagedComment = false
+	}
+	return o
+}
+
+// Method to get the settings the target's www record is updated with, those of the target unless its proxied status is set apart
+func (o RecordOptions) ForWWW(target RecordConfig) RecordOptions {
+	o = o.For(target)
+	if target.WWWProxied != nil {
+		o.Proxied = target.WWWProxied
+	}
+	return o
+}
+
+// Helper method to check the detected address suits the record type, an IPv4 address can't go in an AAAA record
+func CheckAddress(recordType string, address string) error {
+	if recordType != "" && recordType != RECORD_TYPE_A && recordType != RECORD_TYPE_AAAA {
+		return fmt.Errorf("%v records don't hold an IP address", recordType)
+	}
+	ip, err := netip.ParseAddr(address)
+	if err != nil {
+		return fmt.Errorf("%q is not an IP address", address)
+	}
+	if recordType == RECORD_TYPE_AAAA && !ip.Is6() {
+		return fmt.Errorf("%v is not an IPv6 address, which AAAA records need", address)
+	}
+	if recordType != RECORD_TYPE_AAAA && !ip.Is4() {
+		return fmt.Errorf("%v is not an IPv4 address, which A records need", address)
+	}
+	return nil
+}
+
+// Helper method to check content suits the record type, an address for A/AAAA records, a hostname for CNAMEs and zone file style content for the templated types
+func CheckContent(recordType string, content string) error {
+	if recordType == RECORD_TYPE_CNAME {
+		return CheckHostname(content)
+	}
+	if IsTemplatedType(recordType) {
+		return checkTemplatedContent(recordType, content)
+	}
+	return CheckAddress(recordType, content)
+}
+
+// Helper method to check a CNAME target is a plausible hostname
+func CheckHostname(name string) error {
+	trimmed := strings.TrimSuffix(name, ".")
+	if trimmed == "" || len(trimmed) > 253 {
+		return fmt.Errorf("%q is not a hostname", name)
+	}
+	if _, err := netip.ParseAddr(trimmed); err == nil {
+		return fmt.Errorf("%v is an IP address, CNAME records need a hostname", name)
+	}
+	for _, label := range strings.Split(trimmed, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return fmt.Errorf("%q is not a hostname", name)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return fmt.Errorf("%q is not a hostname", name)
+			}
+		}
+	}
+	return nil
+}
+
+// Helper method to build the heartbeat record's content, e.g. "last_success=2026-01-02T15:04:05Z host=nas ip=203.0.113.5"
+func HeartbeatContent(at time.Time, host string, publicIP string) string {
+	content := "last_success=" + at.UTC().Format(time.RFC3339)
+	if host != "" {
+		content += " host=" + host
+	}
+	return content + " ip=" + publicIP
+}
+
+// Helper method to parse the -proxied flag, an empty value keeps the existing setting
+func ParseProxied(value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	proxied, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("proxied must be true or false, got %q", value)
+	}
+	return &proxied, nil
+}
+
+// Helper method to build the edit parameters for an address record, A unless the record says otherwise
+// Every setting is sent explicitly so an edit never resets what it isn't meant to change
+func BuildRecordParam(record DNSRecord, publicIP string, options RecordOptions) dns.RecordParam {
+	ttl := record.TTL
+	if options.TTL != 0 {
+		ttl = options.TTL
+	}
+	proxied := record.Proxied
+	if options.Proxied != nil {
+		proxied = *options.Proxied
+	}
+	recordType := record.Type
+	if recordType == "" {
+		recordType = RECORD_TYPE_A
+	}
+	param := dns.RecordParam{
+		Name: cloudflare.F(record.Name),
+		Type: cloudflare.F(dns.RecordType(recordType)),
+	}
+	if IsTemplatedType(recordType) {
+		applyTemplatedContent(&param, recordType, publicIP)
+	} else {
+		param.Content = cloudflare.String(publicIP)
+	}
+	// Always sent when the type can be proxied, dropping the proxy on an update would silently expose the origin IP
+	if IsProxiableType(recordType) {
+		param.Proxied = cloudflare.F(proxied)
+	}
+	if options.ApplyTag != "" && !record.HasTag(options.ApplyTag) {
+		// Tags are replaced as a whole, so send the existing ones along with the new one
+		param.Tags = cloudflare.F[any](append(slices.Clone(record.Tags), options.ApplyTag))
+	}
+	if options.ManagedComment {
+		param.Comment = cloudflare.F(ManagedComment(time.Now(), record.Content))
+	}
+	// A record without a TTL (e.g. one we didn't look up) is left for Cloudflare to keep as is
+	if ttl != 0 {
+		param.TTL = cloudflare.F(dns.TTL(ttl))
+	}
+	return param
+}
+
+// Helper method to build the edit parameters putting every setting we might have changed back to the listed record's
+func RestoreRecordParam(record DNSRecord) dns.RecordParam {
+	param := BuildRecordParam(record, RecordPresentation(record), RecordOptions{})
+	param.Comment = cloudflare.F(record.Comment)
+	tags := record.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	param.Tags = cloudflare.F[any](tags)
+	return param
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v4/dns"
+)
+
+func TestRecordOptions_Validate(t *testing.T) {
+	tests := []struct {
+		ttl   int
+		valid bool
+	}{
+		{0, true},
+		{1, true},
+		{30, true},
+		{300, true},
+		{86400, true},
+		{2, false},
+		{86401, false},
+		{-5, false},
+	}
+
+	for _, tt := range tests {
+		err := RecordOptions{TTL: tt.ttl}.Validate()
+		if (err == nil) != tt.valid {
+			t.Errorf("TTL %d: expected valid %v, got error %v", tt.ttl, tt.valid, err)
+		}
+	}
+	for _, purge := range []string{"", PURGE_HOSTS, PURGE_EVERYTHING} {
+		if err := (RecordOptions{Purge: purge}).Validate(); err != nil {
+			t.Errorf("Purge %q: unexpected error: %v", purge, err)
+		}
+	}
+	if err := (RecordOptions{Purge: "all"}).Validate(); err == nil {
+		t.Error("Expected error for an unknown purge mode but got none")
+	}
+}
+
+func TestRecordNeedsUpdate(t *testing.T) {
+	record := DNSRecord{ID: "1", Name: "example.com", Content: "203.0.113.42", TTL: 300}
+	tests := []struct {
+		name     string
+		ip       string
+		options  RecordOptions
+		expected bool
+	}{
+		{"In Sync", "203.0.113.42", RecordOptions{}, false},
+		{"New IP", "198.51.100.7", RecordOptions{}, true},
+		{"Same TTL", "203.0.113.42", RecordOptions{TTL: 300}, false},
+		{"Different TTL", "203.0.113.42", RecordOptions{TTL: 60}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RecordNeedsUpdate(record, tt.ip, tt.options); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestBuildRecordParam_TTL(t *testing.T) {
+	record := DNSRecord{ID: "1", Name: "example.com", Content: "203.0.113.42", TTL: 300}
+
+	// Existing TTL is preserved
+	param := BuildRecordParam(record, "198.51.100.7", RecordOptions{})
+	if param.TTL.Value != dns.TTL(300) {
+		t.Errorf("Expected TTL 300 to be preserved, got %v", param.TTL.Value)
+	}
+	if param.Content.Value != "198.51.100.7" {
+		t.Errorf("Expected content 198.51.100.7, got %v", param.Content.Value)
+	}
+
+	// Configured TTL wins
+	param = BuildRecordParam(record, "198.51.100.7", RecordOptions{TTL: 60})
+	if param.TTL.Value != dns.TTL(60) {
+		t.Errorf("Expected TTL 60, got %v", param.TTL.Value)
+	}
+}
+
+func TestParseProxied(t *testing.T) {
+	if proxied, err := ParseProxied(""); err != nil || proxied != nil {
+		t.Errorf("Expected nil for an empty value, got %v, %v", proxied, err)
+	}
+	if proxied, err := ParseProxied("true"); err != nil || proxied == nil || !*proxied {
+		t.Errorf("Expected true, got %v, %v", proxied, err)
+	}
+	if proxied, err := ParseProxied("false"); err != nil || proxied == nil || *proxied {
+		t.Errorf("Expected false, got %v, %v", proxied, err)
+	}
+	if _, err := ParseProxied("orange"); err == nil {
+		t.Error("Expected error for an invalid value but got none")
+	}
+}
+
+func TestBuildRecordParam_Proxied(t *testing.T) {
+	record := DNSRecord{ID: "1", Name: "example.com", Content: "203.0.113.42", TTL: 1, Proxied: true}
+
+	// Existing proxy status is kept rather than dropped
+	param := BuildRecordParam(record, "198.51.100.7", RecordOptions{})
+	if !param.Proxied.Value {
+		t.Error("Expected proxied to be preserved")
+	}
+
+	off := false
+	options := RecordOptions{Proxied: &off}
+	param = BuildRecordParam(record, "198.51.100.7", options)
+	if param.Proxied.Value {
+		t.Error("Expected proxied to be turned off")
+	}
+	if !RecordNeedsUpdate(record, "203.0.113.42", options) {
+		t.Error("Expected a proxied mismatch to need an update")
+	}
+}
+
+func TestManagedComment(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 30, 0, time.FixedZone("CEST", 2*60*60))
+	expected := "managed by go-dns-update; last change 2024-05-01T10:00Z from 203.0.113.5"
+	if comment := ManagedComment(at, "203.0.113.5"); comment != expected {
+		t.Errorf("Expected %q, got %q", expected, comment)
+	}
+
+	record := DNSRecord{ID: "1", Name: "example.com", Content: "203.0.113.5", Comment: "hand written"}
+	if param := BuildRecordParam(record, "198.51.100.7", RecordOptions{}); param.Comment.Present {
+		t.Errorf("Expected the comment to be left alone, got %q", param.Comment.Value)
+	}
+	if param := BuildRecordParam(record, "198.51.100.7", RecordOptions{ManagedComment: true}); !strings.HasPrefix(param.Comment.Value, MANAGED_COMMENT_PREFIX) {
+		t.Errorf("Expected a managed comment, got %q", param.Comment.Value)
+	}
+}
+
+func TestDNSRecord_HasTag(t *testing.T) {
+	record := DNSRecord{Tags: []string{"ddns", "owner:alice"}}
+	tests := []struct {
+		tag      string
+		expected bool
+	}{
+		{"ddns", true},
+		{"owner", true},
+		{"owner:alice", true},
+		{"owner:bob", false},
+		{"dd", false},
+	}
+
+	for _, tt := range tests {
+		if got := record.HasTag(tt.tag); got != tt.expected {
+			t.Errorf("Tag %q: expected %v, got %v", tt.tag, tt.expected, got)
+		}
+	}
+}
+
+func TestRecordFilter_Matches(t *testing.T) {
+	group := ZoneGroup{Records: []RecordConfig{{Name: "home.example.com", WWW: true}, {Name: "lab.example.com"}}}
+	filter := group.Filter("ddns")
+	tests := []struct {
+		record   DNSRecord
+		expected bool
+	}{
+		{DNSRecord{Name: "home.example.com", Type: "A"}, true},
+		{DNSRecord{Name: "WWW.home.example.com", Type: "CNAME"}, true},
+		{DNSRecord{Name: "lab.example.com", Type: "AAAA"}, true},
+		{DNSRecord{Name: "www.lab.example.com", Type: "A"}, false},
+		{DNSRecord{Name: "nas.example.com", Type: "A", Tags: []string{"ddns"}}, true},
+		{DNSRecord{Name: "nas.example.com", Type: "AAAA", Tags: []string{"ddns"}}, false},
+		{DNSRecord{Name: "nas.example.com", Type: "A"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := filter.Matches(tt.record); got != tt.expected {
+			t.Errorf("%v %v: expected %v, got %v", tt.record.Type, tt.record.Name, tt.expected, got)
+		}
+	}
+}
+
+func TestFindDNSRecords(t *testing.T) {
+	records := []DNSRecord{
+		{ID: "1", Name: "example.com", Type: "AAAA"},
+		{ID: "2", Name: "example.com", Type: "A"},
+		{ID: "3", Name: "www.example.com", Type: "A"},
+		{ID: "4", Name: "nas.example.com", Type: "A", Tags: []string{"ddns"}},
+		{ID: "5", Name: "mail.example.com", Type: "MX", Tags: []string{"ddns"}},
+	}
+
+	domainRecord, wwwRecord := FindDNSRecords(records, RecordConfig{Name: "example.com", WWW: true})
+	if domainRecord.ID != "2" {
+		t.Errorf("Expected the A record for the domain, got %q", domainRecord.ID)
+	}
+	if wwwRecord.ID != "3" {
+		t.Errorf("Expected the www record, got %q", wwwRecord.ID)
+	}
+	if _, wwwRecord = FindDNSRecords(records, RecordConfig{Name: "example.com"}); wwwRecord.ID != "" {
+		t.Errorf("Expected no www record, got %q", wwwRecord.ID)
+	}
+
+	tagged := TaggedRecords(records, "ddns")
+	if len(tagged) != 1 || tagged[0].ID != "4" {
+		t.Errorf("Expected only the tagged A record, got %v", tagged)
+	}
+	if tagged = TaggedRecords(records, ""); len(tagged) != 0 {
+		t.Errorf("Expected no records without a tag, got %v", tagged)
+	}
+}
+
+func TestBuildRecordParam_ApplyTag(t *testing.T) {
+	record := DNSRecord{ID: "1", Name: "example.com", Content: "203.0.113.42", Tags: []string{"owner:alice"}}
+	options := RecordOptions{ApplyTag: "ddns"}
+
+	if !RecordNeedsUpdate(record, "203.0.113.42", options) {
+		t.Error("Expected a missing tag to need an update")
+	}
+	param := BuildRecordParam(record, "203.0.113.42", options)
+	if tags, _ := param.Tags.Value.([]string); !slices.Equal(tags, []string{"owner:alice", "ddns"}) {
+		t.Errorf("Expected existing tags to be kept, got %v", param.Tags.Value)
+	}
+
+	record.Tags = append(record.Tags, "ddns")
+	if param = BuildRecordParam(record, "203.0.113.42", options); param.Tags.Present {
+		t.Errorf("Expected tags to be left alone, got %v", param.Tags.Value)
+	}
+}
+
+func TestNewDNSRecord_Tags(t *testing.T) {
+	var response dns.RecordResponse
+	body := `{"id":"1","name":"nas.example.com","type":"A","content":"203.0.113.42","ttl":300,"proxied":true,"tags":["ddns","owner:alice"]}`
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	record := NewDNSRecord(response)
+	if record.Type != "A" || record.TTL != 300 || !record.Proxied {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+	if !slices.Equal(record.Tags, []string{"ddns", "owner:alice"}) {
+		t.Errorf("Expected tags [ddns owner:alice], got %v", record.Tags)
+	}
+}
+
+func TestGroupByZone(t *testing.T) {
+	zoneList := []Zone{{ID: "z1", Name: "example.com"}, {ID: "z2", Name: "example.net"}}
+	targets := []RecordConfig{
+		{Name: "home.example.com", WWW: true},
+		{Name: "lab.example.net"},
+		{Name: "nas.example.com"},
+	}
+
+	groups, err := GroupByZone(zoneList, targets)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 zones, got %d", len(groups))
+	}
+	if groups[0].Zone.ID != "z1" || len(groups[0].Records) != 2 || groups[0].Records[1].Name != "nas.example.com" {
+		t.Errorf("Unexpected first group: %+v", groups[0])
+	}
+	if groups[1].Zone.ID != "z2" || len(groups[1].Records) != 1 {
+		t.Errorf("Unexpected second group: %+v", groups[1])
+	}
+
+	if _, err := GroupByZone(zoneList, []RecordConfig{{Name: "example.org"}}); err == nil {
+		t.Error("Expected error for a record in no zone but got none")
+	}
+}
+
+func TestRecordOptions_For(t *testing.T) {
+	on, off := true, false
+	global := RecordOptions{TTL: 300, Proxied: &on, ManagedComment: true}
+
+	options := global.For(RecordConfig{Name: "vpn.example.com", TTL: 60, Proxied: &off})
+	if options.TTL != 60 || *options.Proxied || !options.ManagedComment {
+		t.Errorf("Expected the record's settings over the global ones, got %+v", options)
+	}
+	options = global.For(RecordConfig{Name: "example.com"})
+	if options.TTL != 300 || !*options.Proxied {
+		t.Errorf("Expected the global settings, got %+v", options)
+	}
+}
+
+func TestRecordOptions_ForWWW(t *testing.T) {
+	on, off := true, false
+	global := RecordOptions{TTL: 300}
+
+	// The apex proxied, its www record left DNS only
+	target := RecordConfig{Name: "example.com", WWW: true, TTL: 60, Proxied: &on, WWWProxied: &off}
+	if options := global.For(target); !*options.Proxied {
+		t.Errorf("Expected the apex to be proxied, got %+v", options)
+	}
+	if options := global.ForWWW(target); *options.Proxied || options.TTL != 60 {
+		t.Errorf("Expected the www record DNS only with the record's TTL, got %+v", options)
+	}
+	target.WWWProxied = nil
+	if options := global.ForWWW(target); !*options.Proxied {
+		t.Errorf("Expected the www record to follow the apex, got %+v", options)
+	}
+}
+
+func TestCheckAddress(t *testing.T) {
+	tests := []struct {
+		recordType string
+		address    string
+		valid      bool
+	}{
+		{"A", "203.0.113.42", true},
+		{"AAAA", "2001:db8::1", true},
+		{"A", "2001:db8::1", false},
+		{"AAAA", "203.0.113.42", false},
+		{"A", "<html>", false},
+	}
+
+	for _, tt := range tests {
+		err := CheckAddress(tt.recordType, tt.address)
+		if (err == nil) != tt.valid {
+			t.Errorf("%v %v: expected valid %v, got error %v", tt.recordType, tt.address, tt.valid, err)
+		}
+	}
+}
+
+func TestRestoreRecordParam(t *testing.T) {
+	record := DNSRecord{ID: "1", Name: "example.com", Type: "A", Content: "203.0.113.42", TTL: 300, Proxied: true}
+	param := RestoreRecordParam(record)
+	if param.Content.Value != "203.0.113.42" || param.TTL.Value != dns.TTL(300) || !param.Proxied.Value {
+		t.Errorf("Expected the listed settings, got %+v", param)
+	}
+	if !param.Comment.Present || param.Comment.Value != "" {
+		t.Errorf("Expected the empty comment to be restored, got %q", param.Comment.Value)
+	}
+	if tags, _ := param.Tags.Value.([]string); tags == nil || len(tags) != 0 {
+		t.Errorf("Expected the empty tags to be restored, got %v", param.Tags.Value)
+	}
+}
+
+func TestMissingRecordError(t *testing.T) {
+	records := []DNSRecord{
+		{ID: "1", Name: "example.com", Type: "A"},
+		{ID: "2", Name: "www.example.com", Type: "CNAME"},
+	}
+
+	err := MissingRecordError(records, "www.example.com", "A")
+	if !strings.Contains(err.Error(), "www.example.com has CNAME record(s) but no A record") {
+		t.Errorf("Expected the conflicting type to be named, got %q", err)
+	}
+	if err := MissingRecordError(records, "nas.example.com", "A"); err.Error() != "couldn't obtain A Record ID" {
+		t.Errorf("Unexpected error: %q", err)
+	}
+	if err := CheckAddress("CNAME", "203.0.113.42"); err == nil {
+		t.Error("Expected error for an address in a CNAME record but got none")
+	}
+}
+
+func TestCheckContent(t *testing.T) {
+	tests := []struct {
+		recordType string
+		content    string
+		valid      bool
+	}{
+		{"A", "203.0.113.42", true},
+		{"A", "host.example.net", false},
+		{"CNAME", "host.example.net", true},
+		{"CNAME", "host.example.net.", true},
+		{"CNAME", "_acme.example.net", true},
+		{"CNAME", "203.0.113.42", false},
+		{"CNAME", "-bad.example.net", false},
+		{"CNAME", "two..dots.example.net", false},
+		{"CNAME", "<html>", false},
+		{"CNAME", "", false},
+	}
+
+	for _, tt := range tests {
+		err := CheckContent(tt.recordType, tt.content)
+		if (err == nil) != tt.valid {
+			t.Errorf("%v %q: expected valid %v, got error %v", tt.recordType, tt.content, tt.valid, err)
+		}
+	}
+}
+
+func TestHeartbeatContent(t *testing.T) {
+	at := time.Date(2026, 1, 2, 15, 4, 5, 0, time.FixedZone("CET", 3600))
+	if content := HeartbeatContent(at, "nas", "203.0.113.5"); content != "last_success=2026-01-02T14:04:05Z host=nas ip=203.0.113.5" {
+		t.Errorf("Unexpected content: %q", content)
+	}
+	if content := HeartbeatContent(at, "", "203.0.113.5"); content != "last_success=2026-01-02T14:04:05Z ip=203.0.113.5" {
+		t.Errorf("Unexpected content without a host: %q", content)
+	}
+}
+
+func TestRecordOptions_ForMember(t *testing.T) {
+	options := RecordOptions{ManagedComment: true}
+	if !options.For(RecordConfig{Member: &MemberConfig{Tag: "wan:1"}}).ManagedComment {
+		t.Error("Expected the managed comment to be kept for a member picked by tag")
+	}
+	if options.For(RecordConfig{Member: &MemberConfig{Comment: "wan1"}}).ManagedComment {
+		t.Error("Expected the managed comment to be dropped for a member picked by comment")
+	}
+}
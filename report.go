@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+// Formats of the report written for CI pipelines after every check
+const REPORT_JUNIT = "junit"
+const REPORT_JSON = "json"
+
+// Name of the test suite the records are reported in, and of the test case standing for the check itself when it fails without a record to blame
+const REPORT_SUITE_NAME = "go-dns-update"
+const REPORT_CHECK_CASE = "check"
+
+// JUnit XML report, as read by most CI systems, each record a test case
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// Method to check the report flag names a format
+func CheckReportFormat(format string) error {
+	if format != "" && format != REPORT_JUNIT && format != REPORT_JSON {
+		return fmt.Errorf("must be %v or %v, got %q", REPORT_JUNIT, REPORT_JSON, format)
+	}
+	return nil
+}
+
+// Method to get where the report goes when no file is given, report.xml for JUnit and report.json for JSON
+func DefaultReportFile(format string) string {
+	if format == REPORT_JUNIT {
+		return "report.xml"
+	}
+	return "report." + format
+}
+
+// Method to replace the report file with the report of a check that finished at the provided time, in JUnit XML or JSON
+// The JSON report is the summary -summaryFile writes, the JUnit one has a test case per record, failing when the record did
+func WriteReport(path string, format string, at time.Time, report CheckReport, err error) error {
+	var contents []byte
+	var marshalErr error
+	switch format {
+	case REPORT_JUNIT:
+		contents, marshalErr = xml.MarshalIndent(junitReport(at, report, err), "", "  ")
+		contents = append([]byte(xml.Header), contents...)
+	default:
+		contents, marshalErr = json.MarshalIndent(NewRunSummary(at, report, err), "", "  ")
+	}
+	if marshalErr != nil {
+		return fmt.Errorf("writing report failed: %w", marshalErr)
+	}
+	if writeErr := writeFileAtomic(path, append(contents, '\n'), 0o644); writeErr != nil {
+		return fmt.Errorf("writing report failed: %w", writeErr)
+	}
+	return nil
+}
+
+// Helper method to turn the check into a JUnit test suite
+// A check failing with no failed record, e.g. as the public IP couldn't be detected, gets a failed test case of its own so the pipeline doesn't see a green suite
+func junitReport(at time.Time, report CheckReport, err error) junitTestSuites {
+	suite := junitTestSuite{Name: REPORT_SUITE_NAME, Time: report.Duration.Seconds(), Timestamp: at.UTC().Format(time.RFC3339)}
+	for _, record := range report.Records {
+		testCase := junitTestCase{Name: record.Name, ClassName: REPORT_SUITE_NAME}
+		switch {
+		case record.Error != "":
+			testCase.Failure = &junitFailure{Message: record.Error, Type: record.Code, Text: record.Error}
+			if record.RayID != "" {
+				testCase.Failure.Text += "\nCloudflare ray ID " + record.RayID
+			}
+		case record.Changed && record.Previous != "":
+			testCase.SystemOut = fmt.Sprintf("updated from %v to %v", record.Previous, record.IP)
+		case record.Changed:
+			testCase.SystemOut = fmt.Sprintf("updated to %v", record.IP)
+		default:
+			testCase.SystemOut = fmt.Sprintf("unchanged at %v", record.IP)
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	if err != nil && StatesError(report.Records) == nil {
+		suite.Cases = append(suite.Cases, junitTestCase{Name: REPORT_CHECK_CASE, ClassName: REPORT_SUITE_NAME, Failure: &junitFailure{Message: err.Error(), Type: ErrorCode(err), Text: err.Error()}})
+	}
+	suite.Tests = len(suite.Cases)
+	for _, testCase := range suite.Cases {
+		if testCase.Failure != nil {
+			suite.Failures++
+		}
+	}
+	return junitTestSuites{Suites: []junitTestSuite{suite}}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteReport_JUnit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.xml")
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	report := CheckReport{PublicIP: "198.51.100.7", Duration: 2 * time.Second, Records: []RecordState{
+		{Name: "pr-42.preview.example.com", IP: "198.51.100.7", Changed: true, Previous: "203.0.113.9"},
+		{Name: "www.pr-42.preview.example.com", IP: "198.51.100.7"},
+		{Name: "pr-43.preview.example.com", Error: "record not found", Code: E_RECORD_NOT_FOUND, RayID: "8f1e2d3c4b5a6978-AMS"},
+	}}
+	if err := WriteReport(path, REPORT_JUNIT, at, report, StatesError(report.Records)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<testsuite name="go-dns-update" tests="3" failures="1" time="2" timestamp="2024-05-01T12:00:00Z">`,
+		`<system-out>updated from 203.0.113.9 to 198.51.100.7</system-out>`,
+		`<system-out>unchanged at 198.51.100.7</system-out>`,
+		`<failure message="record not found" type="E_RECORD_NOT_FOUND">record not found&#xA;Cloudflare ray ID 8f1e2d3c4b5a6978-AMS</failure>`,
+	} {
+		if !strings.Contains(string(contents), expected) {
+			t.Errorf("Expected %q in the report, got %s", expected, contents)
+		}
+	}
+	if strings.Contains(string(contents), `name="check"`) {
+		t.Errorf("Expected no test case for the check when a record is to blame, got %s", contents)
+	}
+
+	// Failing before any record was looked at still fails the suite
+	if err := WriteReport(path, REPORT_JUNIT, at, CheckReport{}, WithCode(E_DETECT_FAILED, errors.New("could not retrieve initial values"))); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	contents, _ = os.ReadFile(path)
+	if !strings.Contains(string(contents), `tests="1" failures="1"`) || !strings.Contains(string(contents), `<testcase name="check" classname="go-dns-update">`) {
+		t.Errorf("Expected a failed check test case, got %s", contents)
+	}
+}
+
+func TestWriteReport_JSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	report := CheckReport{PublicIP: "198.51.100.7", Records: []RecordState{{Name: "pr-42.preview.example.com", IP: "198.51.100.7", Changed: true}}}
+	if err := WriteReport(path, REPORT_JSON, time.Now(), report, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var summary RunSummary
+	if err := json.Unmarshal(contents, &summary); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !summary.Success || summary.Changed != 1 || len(summary.Records) != 1 || summary.Records[0].Name != "pr-42.preview.example.com" {
+		t.Errorf("Unexpected report: %+v", summary)
+	}
+}
+
+func TestCheckReportFormat(t *testing.T) {
+	for _, format := range []string{"", REPORT_JUNIT, REPORT_JSON} {
+		if err := CheckReportFormat(format); err != nil {
+			t.Errorf("Unexpected error for %q: %v", format, err)
+		}
+	}
+	if err := CheckReportFormat("tap"); err == nil {
+		t.Errorf("Expected an error for tap")
+	}
+	if DefaultReportFile(REPORT_JUNIT) != "report.xml" || DefaultReportFile(REPORT_JSON) != "report.json" {
+		t.Errorf("Expected report.xml and report.json, got %v and %v", DefaultReportFile(REPORT_JUNIT), DefaultReportFile(REPORT_JSON))
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/load_balancers"
+	"github.com/cloudflare/cloudflare-go/v4/option"
+	"github.com/cloudflare/cloudflare-go/v4/rules"
+	"github.com/cloudflare/cloudflare-go/v4/rulesets"
+	"github.com/cloudflare/cloudflare-go/v4/zero_trust"
+)
+
+// Something other than a DNS record that's kept pointed at the public IP, e.g. a Load Balancer origin
+type Resource interface {
+	// Name of the resource in the check summary and notifications
+	Describe() string
+	// Point the resource at publicIP, reporting whether anything had to change
+	Sync(publicIP string) (bool, error)
+}
+
+// Method to build the resources listed in the config, clients holds the client of each account by name, "" for the token flag's
+func BuildResources(config Config, clients map[string]*cloudflare.Client) ([]Resource, error) {
+	var resources []Resource
+	for _, pool := range config.LoadBalancerPools {
+		client, ok := clients[pool.Account]
+		if !ok {
+			return nil, fmt.Errorf("load balancer pool %v: no API Token to update it with", pool.Pool)
+		}
+		resources = append(resources, &LoadBalancerOrigin{Client: client, AccountID: pool.AccountID, Pool: pool.Pool, Origin: pool.Origin})
+	}
+	for _, list := range config.IPLists {
+		client, ok := clients[list.Account]
+		if !ok {
+			return nil, fmt.Errorf("IP list %v: no API Token to update it with", list.List)
+		}
+		comment := list.Comment
+		if comment == "" {
+			comment = MANAGED_COMMENT_PREFIX
+		}
+		resources = append(resources, &IPListEntry{Client: client, AccountID: list.AccountID, List: list.List, Comment: comment})
+	}
+	for _, rule := range config.FirewallRules {
+		client, ok := clients[rule.Account]
+		if !ok {
+			return nil, fmt.Errorf("firewall rule %v: no API Token to update it with", rule.Rule)
+		}
+		resources = append(resources, &FirewallRule{Client: client, Zone: rule.Zone, Rule: rule.Rule, Expression: rule.Expression})
+	}
+	for _, policy := range config.AccessPolicies {
+		client, ok := clients[policy.Account]
+		if !ok {
+			return nil, fmt.Errorf("access policy %v: no API Token to update it with", policy.Policy)
+		}
+		resources = append(resources, &AccessPolicy{Client: client, AccountID: policy.AccountID, Policy: policy.Policy, Keep: policy.Keep})
+	}
+	return resources, nil
+}
+
+// Helper method to bring every resource in line with the public IP, one at a time
+func SyncResources(resources []Resource, publicIP string) []RecordState {
+	states := make([]RecordState, 0, len(resources))
+	for _, resource := range resources {
+		state := RecordState{Name: resource.Describe(), IP: publicIP}
+		changed, err := resource.Sync(publicIP)
+		if err != nil {
+			state.Error, state.Code = err.Error(), ErrorCode(err)
+		}
+		state.Changed = changed
+		states = append(states, state)
+	}
+	return states
+}
+
+// An origin of a Cloudflare Load Balancer pool
+type LoadBalancerOrigin struct {
+	Client    *cloudflare.Client
+	AccountID string
+	// Name or ID of the pool
+	Pool string
+	// Name of the origin within the pool
+	Origin string
+}
+
+// Method to name the origin in the check summary
+func (l *LoadBalancerOrigin) Describe() string {
+	return fmt.Sprintf("load balancer pool %v origin %v", l.Pool, l.Origin)
+}
+
+// Method to point the origin at publicIP, the pool's other origins and settings are left as they are
+func (l *LoadBalancerOrigin) Sync(publicIP string) (bool, error) {
+	pool, err := l.findPool()
+	if err != nil {
+		return false, err
+	}
+	found := false
+	origins := make([]load_balancers.OriginParam, 0, len(pool.Origins))
+	for _, origin := range pool.Origins {
+		address := origin.Address
+		if origin.Name == l.Origin {
+			if address == publicIP {
+				return false, nil
+			}
+			found = true
+			address = publicIP
+		}
+		// The origins are replaced as a whole, so every one is sent back with all its settings
+		param := load_balancers.OriginParam{
+			Address: cloudflare.F(address),
+			Enabled: cloudflare.F(origin.Enabled),
+			Name:    cloudflare.F(origin.Name),
+			Weight:  cloudflare.F(origin.Weight),
+		}
+		if len(origin.Header.Host) > 0 {
+			param.Header = cloudflare.F(load_balancers.HeaderParam{Host: cloudflare.F(origin.Header.Host)})
+		}
+		if origin.VirtualNetworkID != "" {
+			param.VirtualNetworkID = cloudflare.F(origin.VirtualNetworkID)
+		}
+		origins = append(origins, param)
+	}
+	if !found {
+		return false, fmt.Errorf("pool %v has no origin named %v", l.Pool, l.Origin)
+	}
+	_, err = l.Client.LoadBalancers.Pools.Edit(context.Background(), pool.ID, load_balancers.PoolEditParams{
+		AccountID: cloudflare.F(l.AccountID),
+		Origins:   cloudflare.F(origins),
+	})
+	if err != nil {
+		return false, fmt.Errorf("updating load balancer pool failed: %w", err)
+	}
+	return true, nil
+}
+
+// Helper method to look the pool up by name or ID
+func (l *LoadBalancerOrigin) findPool() (load_balancers.Pool, error) {
+	iter := l.Client.LoadBalancers.Pools.ListAutoPaging(context.Background(), load_balancers.PoolListParams{AccountID: cloudflare.F(l.AccountID)})
+	for iter.Next() {
+		pool := iter.Current()
+		if pool.ID == l.Pool || pool.Name == l.Pool {
+			return pool, nil
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return load_balancers.Pool{}, fmt.Errorf("listing load balancer pools failed: %w", err)
+	}
+	return load_balancers.Pool{}, fmt.Errorf("couldn't find load balancer pool %v", l.Pool)
+}
+
+// The entry of a Cloudflare IP List holding the public IP, told apart from the list's other entries by its comment
+type IPListEntry struct {
+	Client    *cloudflare.Client
+	AccountID string
+	// Name or ID of the list
+	List    string
+	Comment string
+}
+
+// Method to name the entry in the check summary
+func (l *IPListEntry) Describe() string {
+	return fmt.Sprintf("IP list %v entry %q", l.List, l.Comment)
+}
+
+// Method to point the entry at publicIP
+// The new entry is added before the old one is removed, so rules using the list never miss the address
+func (l *IPListEntry) Sync(publicIP string) (bool, error) {
+	entry, err := IPListItem(publicIP)
+	if err != nil {
+		return false, err
+	}
+	listID, err := l.findList()
+	if err != nil {
+		return false, err
+	}
+	var stale []string
+	current := false
+	iter := l.Client.Rules.Lists.Items.ListAutoPaging(context.Background(), listID, rules.ListItemListParams{AccountID: cloudflare.F(l.AccountID)})
+	for iter.Next() {
+		item := iter.Current()
+		if item.Comment != l.Comment {
+			continue
+		}
+		if item.IP == entry && !current {
+			current = true
+			continue
+		}
+		stale = append(stale, item.ID)
+	}
+	if err := iter.Err(); err != nil {
+		return false, fmt.Errorf("listing IP list items failed: %w", err)
+	}
+	if current && len(stale) == 0 {
+		return false, nil
+	}
+	if !current {
+		_, err := l.Client.Rules.Lists.Items.New(context.Background(), listID, rules.ListItemNewParams{
+			AccountID: cloudflare.F(l.AccountID),
+			Body:      []rules.ListItemNewParamsBody{{IP: cloudflare.F(entry), Comment: cloudflare.F(l.Comment)}},
+		})
+		if err != nil {
+			return false, fmt.Errorf("adding IP list item failed: %w", err)
+		}
+	}
+	if len(stale) > 0 {
+		// The SDK doesn't send the items to delete, so the body is built here
+		items := make([]map[string]string, 0, len(stale))
+		for _, id := range stale {
+			items = append(items, map[string]string{"id": id})
+		}
+		body, err := json.Marshal(map[string]any{"items": items})
+		if err != nil {
+			return true, err
+		}
+		_, err = l.Client.Rules.Lists.Items.Delete(context.Background(), listID, rules.ListItemDeleteParams{AccountID: cloudflare.F(l.AccountID)}, option.WithRequestBody("application/json", body))
+		if err != nil {
+			return true, fmt.Errorf("removing old IP list items failed: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// Helper method to look the list up by name or ID
+func (l *IPListEntry) findList() (string, error) {
+	iter := l.Client.Rules.Lists.ListAutoPaging(context.Background(), rules.ListListParams{AccountID: cloudflare.F(l.AccountID)})
+	for iter.Next() {
+		list := iter.Current()
+		if list.ID == l.List || list.Name == l.List {
+			return list.ID, nil
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return "", fmt.Errorf("listing IP lists failed: %w", err)
+	}
+	return "", fmt.Errorf("couldn't find IP list %v", l.List)
+}
+
+// Helper method to write an address the way IP Lists hold it, IPv6 addresses only fit in as their /64
+func IPListItem(publicIP string) (string, error) {
+	ip, err := netip.ParseAddr(publicIP)
+	if err != nil {
+		return "", fmt.Errorf("%q is not an IP address", publicIP)
+	}
+	if ip.Is6() && !ip.Is4In6() {
+		return netip.PrefixFrom(ip, 64).Masked().String(), nil
+	}
+	return ip.Unmap().String(), nil
+}
+
+// A WAF custom rule of a zone whose expression embeds the public IP
+type FirewallRule struct {
+	Client *cloudflare.Client
+	// Name of the zone, e.g. example.com
+	Zone string
+	// Description or ID of the rule
+	Rule string
+	// Template of the rule's expression, e.g. "(ip.src eq {{.IP}})"
+	Expression string
+}
+
+// Method to name the rule in the check summary
+func (f *FirewallRule) Describe() string {
+	return fmt.Sprintf("firewall rule %v of %v", f.Rule, f.Zone)
+}
+
+// Method to rewrite the rule's expression for publicIP, the rest of the rule is left as it is
+func (f *FirewallRule) Sync(publicIP string) (bool, error) {
+	expression, err := RenderContent(f.Expression, publicIP)
+	if err != nil {
+		return false, err
+	}
+	zoneID, err := GetZoneID(SDKClient{Client: f.Client}, f.Zone)
+	if err != nil {
+		return false, err
+	}
+	ruleset, err := f.Client.Rulesets.Phases.Get(context.Background(), rulesets.PhaseHTTPRequestFirewallCustom, rulesets.PhaseGetParams{ZoneID: cloudflare.F(zoneID)})
+	if err != nil {
+		return false, fmt.Errorf("getting custom rules failed: %w", err)
+	}
+	for _, rule := range ruleset.Rules {
+		if rule.ID != f.Rule && rule.Description != f.Rule {
+			continue
+		}
+		if rule.Expression == expression {
+			return false, nil
+		}
+		// Sent back whole, the API wants the action along with the expression
+		body := rulesets.RuleEditParamsBody{
+			Action:      cloudflare.F(rulesets.RuleEditParamsBodyAction(rule.Action)),
+			Description: cloudflare.F(rule.Description),
+			Enabled:     cloudflare.F(rule.Enabled),
+			Expression:  cloudflare.F(expression),
+		}
+		if rule.ActionParameters != nil {
+			body.ActionParameters = cloudflare.F(rule.ActionParameters)
+		}
+		_, err := f.Client.Rulesets.Rules.Edit(context.Background(), ruleset.ID, rule.ID, rulesets.RuleEditParams{ZoneID: cloudflare.F(zoneID), Body: body})
+		if err != nil {
+			return false, fmt.Errorf("updating firewall rule failed: %w", err)
+		}
+		return true, nil
+	}
+	return false, fmt.Errorf("%v has no custom rule %v", f.Zone, f.Rule)
+}
+
+// A reusable Zero Trust Access policy whose include rules let the public IP in
+type AccessPolicy struct {
+	Client    *cloudflare.Client
+	AccountID string
+	// Name or ID of the policy
+	Policy string
+	// Ranges whose include rules are always kept, every other IP range rule is replaced by the public IP
+	Keep []string
+}
+
+// Method to name the policy in the check summary
+func (a *AccessPolicy) Describe() string {
+	return fmt.Sprintf("access policy %v", a.Policy)
+}
+
+// Method to swap the policy's IP range include rules for the public IP, other rules and settings are kept
+// The policy is fetched and sent back as plain JSON, so settings the SDK doesn't know about survive the update
+func (a *AccessPolicy) Sync(publicIP string) (bool, error) {
+	cidr, err := AccessCIDR(publicIP)
+	if err != nil {
+		return false, err
+	}
+	policyID, err := a.findPolicy()
+	if err != nil {
+		return false, err
+	}
+	path := fmt.Sprintf("accounts/%v/access/policies/%v", a.AccountID, policyID)
+	var response struct {
+		Result map[string]any `json:"result"`
+	}
+	if err := a.Client.Get(context.Background(), path, nil, &response); err != nil {
+		return false, fmt.Errorf("getting access policy failed: %w", err)
+	}
+	policy := response.Result
+	include, _ := policy["include"].([]any)
+	var replaced []string
+	updated := make([]any, 0, len(include)+1)
+	for _, rule := range include {
+		rangeCIDR, ok := accessRuleCIDR(rule)
+		if !ok || slices.Contains(a.Keep, rangeCIDR) {
+			updated = append(updated, rule)
+			continue
+		}
+		replaced = append(replaced, rangeCIDR)
+	}
+	if len(replaced) == 1 && replaced[0] == cidr {
+		return false, nil
+	}
+	updated = append(updated, map[string]any{"ip": map[string]any{"ip": cidr}})
+	policy["include"] = updated
+	// Read only fields the API doesn't take back
+	for _, field := range []string{"id", "created_at", "updated_at", "app_count", "reusable"} {
+		delete(policy, field)
+	}
+	body, err := json.Marshal(policy)
+	if err != nil {
+		return false, err
+	}
+	if err := a.Client.Put(context.Background(), path, body, nil); err != nil {
+		return false, fmt.Errorf("updating access policy failed: %w", err)
+	}
+	return true, nil
+}
+
+// Helper method to look the policy up by name or ID
+func (a *AccessPolicy) findPolicy() (string, error) {
+	iter := a.Client.ZeroTrust.Access.Policies.ListAutoPaging(context.Background(), zero_trust.AccessPolicyListParams{AccountID: cloudflare.F(a.AccountID)})
+	for iter.Next() {
+		policy := iter.Current()
+		if policy.ID == a.Policy || policy.Name == a.Policy {
+			return policy.ID, nil
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return "", fmt.Errorf("listing access policies failed: %w", err)
+	}
+	return "", fmt.Errorf("couldn't find access policy %v", a.Policy)
+}
+
+// Helper method to read the range out of an IP range rule, e.g. {"ip": {"ip": "203.0.113.5/32"}}
+func accessRuleCIDR(rule any) (string, bool) {
+	fields, _ := rule.(map[string]any)
+	ip, _ := fields["ip"].(map[string]any)
+	cidr, ok := ip["ip"].(string)
+	return cidr, ok
+}
+
+// Helper method to write the address as the single address range Access rules take
+func AccessCIDR(publicIP string) (string, error) {
+	ip, err := netip.ParseAddr(publicIP)
+	if err != nil {
+		return "", fmt.Errorf("%q is not an IP address", publicIP)
+	}
+	ip = ip.Unmap()
+	return netip.PrefixFrom(ip, ip.BitLen()).String(), nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Fake of the Load Balancer pool endpoints, recording the origins sent with each edit
+type fakeLoadBalancers struct {
+	mu    sync.Mutex
+	pools []map[string]any
+	edits [][]any
+}
+
+func (f *fakeLoadBalancers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 4 && parts[3] == "pools":
+		writeCloudflarePage(w, r, f.pools)
+	case r.Method == http.MethodPatch && len(parts) == 5 && parts[3] == "pools":
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, pool := range f.pools {
+			if pool["id"] == parts[4] {
+				pool["origins"] = body["origins"]
+				f.edits = append(f.edits, body["origins"].([]any))
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]any{"success": true, "errors": []any{}, "messages": []any{}, "result": pool})
+				return
+			}
+		}
+		http.NotFound(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestLoadBalancerOrigin_Sync(t *testing.T) {
+	fake := &fakeLoadBalancers{pools: []map[string]any{{
+		"id":   "p1",
+		"name": "home",
+		"origins": []any{
+			map[string]any{"name": "home-server", "address": "203.0.113.1", "enabled": true, "weight": 1},
+			map[string]any{"name": "cloud", "address": "192.0.2.20", "enabled": true, "weight": 0.5, "header": map[string]any{"Host": []any{"app.example.com"}}},
+		},
+	}}}
+	origin := &LoadBalancerOrigin{Client: newTestCloudflareClient(t, fake), AccountID: "acc", Pool: "home", Origin: "home-server"}
+
+	changed, err := origin.Sync("198.51.100.7")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !changed || len(fake.edits) != 1 {
+		t.Fatalf("Expected the pool to be edited once, got %v", fake.edits)
+	}
+	origins := fake.edits[0]
+	if len(origins) != 2 || origins[0].(map[string]any)["address"] != "198.51.100.7" {
+		t.Errorf("Expected the origin to be pointed at the new address, got %v", origins)
+	}
+	other := origins[1].(map[string]any)
+	if other["address"] != "192.0.2.20" || other["weight"] != 0.5 || other["header"] == nil {
+		t.Errorf("Expected the other origin to be sent back unchanged, got %v", other)
+	}
+
+	// Nothing to do the second time around
+	if changed, err := origin.Sync("198.51.100.7"); err != nil || changed || len(fake.edits) != 1 {
+		t.Errorf("Expected no edit, got changed %v, error %v, edits %d", changed, err, len(fake.edits))
+	}
+
+	missing := &LoadBalancerOrigin{Client: origin.Client, AccountID: "acc", Pool: "home", Origin: "nope"}
+	if _, err := missing.Sync("198.51.100.7"); err == nil {
+		t.Error("Expected error for a missing origin but got none")
+	}
+}
+
+func TestSyncResources(t *testing.T) {
+	fake := &fakeLoadBalancers{}
+	states := SyncResources([]Resource{&LoadBalancerOrigin{Client: newTestCloudflareClient(t, fake), AccountID: "acc", Pool: "home", Origin: "home-server"}}, "198.51.100.7")
+	if len(states) != 1 || states[0].Name != "load balancer pool home origin home-server" || !strings.Contains(states[0].Error, "couldn't find load balancer pool home") {
+		t.Errorf("Unexpected states: %+v", states)
+	}
+}
+
+// Fake of the IP List endpoints, items are added and removed the way the API does
+type fakeIPLists struct {
+	mu      sync.Mutex
+	lists   []map[string]any
+	items   []map[string]any
+	deleted []any
+}
+
+func (f *fakeIPLists) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	ok := func(result any) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "errors": []any{}, "messages": []any{}, "result": result})
+	}
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 4 && parts[3] == "lists":
+		writeCloudflarePage(w, r, f.lists)
+	case r.Method == http.MethodGet && len(parts) == 6 && parts[5] == "items":
+		writeCloudflarePage(w, r, f.items)
+	case r.Method == http.MethodPost && len(parts) == 6 && parts[5] == "items":
+		var body []map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, item := range body {
+			item["id"] = fmt.Sprintf("i%d", len(f.items)+1)
+			f.items = append(f.items, item)
+		}
+		ok(map[string]any{"operation_id": "op1"})
+	case r.Method == http.MethodDelete && len(parts) == 6 && parts[5] == "items":
+		var body map[string][]map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, gone := range body["items"] {
+			f.deleted = append(f.deleted, gone["id"])
+			for i, item := range f.items {
+				if item["id"] == gone["id"] {
+					f.items = append(f.items[:i], f.items[i+1:]...)
+					break
+				}
+			}
+		}
+		ok(map[string]any{"operation_id": "op2"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestIPListEntry_Sync(t *testing.T) {
+	fake := &fakeIPLists{
+		lists: []map[string]any{{"id": "l1", "name": "home_ips", "kind": "ip"}},
+		items: []map[string]any{
+			{"id": "i1", "ip": "192.0.2.20", "comment": "office"},
+			{"id": "i2", "ip": "203.0.113.1", "comment": MANAGED_COMMENT_PREFIX},
+		},
+	}
+	entry := &IPListEntry{Client: newTestCloudflareClient(t, fake), AccountID: "acc", List: "home_ips", Comment: MANAGED_COMMENT_PREFIX}
+
+	changed, err := entry.Sync("198.51.100.7")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !changed || len(fake.items) != 2 || fake.items[1]["ip"] != "198.51.100.7" {
+		t.Errorf("Expected the entry to be replaced, got %v", fake.items)
+	}
+	if len(fake.deleted) != 1 || fake.deleted[0] != "i2" {
+		t.Errorf("Expected only the old entry to be removed, got %v", fake.deleted)
+	}
+
+	if changed, err := entry.Sync("198.51.100.7"); err != nil || changed {
+		t.Errorf("Expected nothing to change, got changed %v, error %v", changed, err)
+	}
+}
+
+func TestIPListItem(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected string
+	}{
+		{"203.0.113.5", "203.0.113.5"},
+		{"2001:db8:1:2:3:4:5:6", "2001:db8:1:2::/64"},
+	}
+
+	for _, tt := range tests {
+		if item, err := IPListItem(tt.address); err != nil || item != tt.expected {
+			t.Errorf("%v: expected %v, got %v, %v", tt.address, tt.expected, item, err)
+		}
+	}
+	if _, err := IPListItem("<html>"); err == nil {
+		t.Error("Expected error for a non-address but got none")
+	}
+}
+
+// Fake of a zone's custom rules, recording the body of each rule edit
+type fakeFirewall struct {
+	mu    sync.Mutex
+	rules []map[string]any
+	edits []map[string]any
+}
+
+func (f *fakeFirewall) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ok := func(result any) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "errors": []any{}, "messages": []any{}, "result": result})
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/zones":
+		writeCloudflarePage(w, r, []map[string]any{{"id": "z1", "name": "example.com"}})
+	case r.Method == http.MethodGet && r.URL.Path == "/zones/z1/rulesets/phases/http_request_firewall_custom/entrypoint":
+		ok(map[string]any{"id": "rs1", "kind": "zone", "name": "default", "phase": "http_request_firewall_custom", "version": "1", "rules": f.rules})
+	case r.Method == http.MethodPatch && len(parts) == 6 && parts[2] == "rulesets" && parts[3] == "rs1":
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, rule := range f.rules {
+			if rule["id"] == parts[5] {
+				rule["expression"] = body["expression"]
+				f.edits = append(f.edits, body)
+				ok(map[string]any{"id": "rs1", "kind": "zone", "name": "default", "phase": "http_request_firewall_custom", "version": "2", "rules": f.rules})
+				return
+			}
+		}
+		http.NotFound(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestFirewallRule_Sync(t *testing.T) {
+	fake := &fakeFirewall{rules: []map[string]any{
+		{"id": "r1", "action": "block", "description": "block bots", "enabled": true, "expression": "(cf.client.bot)"},
+		{"id": "r2", "action": "skip", "description": "home skips WAF", "enabled": true, "expression": "(ip.src eq 203.0.113.1)", "action_parameters": map[string]any{"ruleset": "current"}},
+	}}
+	rule := &FirewallRule{Client: newTestCloudflareClient(t, fake), Zone: "example.com", Rule: "home skips WAF", Expression: "(ip.src eq {{.IP}})"}
+
+	changed, err := rule.Sync("198.51.100.7")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !changed || len(fake.edits) != 1 {
+		t.Fatalf("Expected the rule to be edited once, got %v", fake.edits)
+	}
+	edit := fake.edits[0]
+	if edit["expression"] != "(ip.src eq 198.51.100.7)" || edit["action"] != "skip" || edit["action_parameters"] == nil {
+		t.Errorf("Expected the rule sent back with the new expression, got %v", edit)
+	}
+	if fake.rules[0]["expression"] != "(cf.client.bot)" {
+		t.Error("Expected the other rule to be left alone")
+	}
+
+	if changed, err := rule.Sync("198.51.100.7"); err != nil || changed || len(fake.edits) != 1 {
+		t.Errorf("Expected no edit, got changed %v, error %v", changed, err)
+	}
+
+	missing := &FirewallRule{Client: rule.Client, Zone: "example.com", Rule: "nope", Expression: "(ip.src eq {{.IP}})"}
+	if _, err := missing.Sync("198.51.100.7"); err == nil {
+		t.Error("Expected error for a missing rule but got none")
+	}
+}
+
+// Fake of the reusable Access policy endpoints, recording the bodies sent with each update
+type fakeAccess struct {
+	mu      sync.Mutex
+	policy  map[string]any
+	updates []map[string]any
+}
+
+func (f *fakeAccess) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ok := func(result any) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "errors": []any{}, "messages": []any{}, "result": result})
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/accounts/acc/access/policies":
+		writeCloudflarePage(w, r, []map[string]any{{"id": "p1", "name": "home bypass"}})
+	case r.Method == http.MethodGet && r.URL.Path == "/accounts/acc/access/policies/p1":
+		ok(f.policy)
+	case r.Method == http.MethodPut && r.URL.Path == "/accounts/acc/access/policies/p1":
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		f.updates = append(f.updates, body)
+		f.policy = map[string]any{"id": "p1"}
+		for key, value := range body {
+			f.policy[key] = value
+		}
+		ok(f.policy)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestAccessPolicy_Sync(t *testing.T) {
+	fake := &fakeAccess{policy: map[string]any{
+		"id":       "p1",
+		"name":     "home bypass",
+		"decision": "bypass",
+		"include": []any{
+			map[string]any{"ip": map[string]any{"ip": "203.0.113.1/32"}},
+			map[string]any{"ip": map[string]any{"ip": "192.0.2.0/24"}},
+			map[string]any{"email": map[string]any{"email": "me@example.com"}},
+		},
+		"session_duration": "24h",
+	}}
+	policy := &AccessPolicy{Client: newTestCloudflareClient(t, fake), AccountID: "acc", Policy: "home bypass", Keep: []string{"192.0.2.0/24"}}
+
+	changed, err := policy.Sync("198.51.100.7")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !changed || len(fake.updates) != 1 {
+		t.Fatalf("Expected the policy to be updated once, got %v", fake.updates)
+	}
+	update := fake.updates[0]
+	if _, sent := update["id"]; sent {
+		t.Error("Expected the read only id not to be sent")
+	}
+	if update["decision"] != "bypass" || update["session_duration"] != "24h" {
+		t.Errorf("Expected the policy's settings to be kept, got %v", update)
+	}
+	var cidrs []string
+	for _, rule := range update["include"].([]any) {
+		if cidr, ok := accessRuleCIDR(rule); ok {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	if len(update["include"].([]any)) != 3 || fmt.Sprint(cidrs) != "[192.0.2.0/24 198.51.100.7/32]" {
+		t.Errorf("Expected the old address swapped for the new one, got %v", update["include"])
+	}
+
+	if changed, err := policy.Sync("198.51.100.7"); err != nil || changed || len(fake.updates) != 1 {
+		t.Errorf("Expected no update, got changed %v, error %v", changed, err)
+	}
+}
+
+func TestAccessCIDR(t *testing.T) {
+	if cidr, _ := AccessCIDR("203.0.113.5"); cidr != "203.0.113.5/32" {
+		t.Errorf("Unexpected IPv4 range: %v", cidr)
+	}
+	if cidr, _ := AccessCIDR("2001:db8::1"); cidr != "2001:db8::1/128" {
+		t.Errorf("Unexpected IPv6 range: %v", cidr)
+	}
+}
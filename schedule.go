@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Schedule decides when the daemon should next run a check
+type Schedule interface {
+	// Next returns the first activation time strictly after the provided time
+	Next(after time.Time) time.Time
+}
+
+// Schedule which simply fires every fixed interval
+type IntervalSchedule struct {
+	Interval time.Duration
+}
+
+func (s IntervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(s.Interval)
+}
+
+// Schedule which delays every activation of the wrapped schedule by a random amount up to Jitter
+// Keeps a fleet of devices configured with the same interval from all hitting the APIs in the same second
+type JitterSchedule struct {
+	Schedule Schedule
+	Jitter   time.Duration
+}
+
+func (s JitterSchedule) Next(after time.Time) time.Time {
+	next := s.Schedule.Next(after)
+	if next.IsZero() || s.Jitter <= 0 {
+		return next
+	}
+	return next.Add(rand.N(s.Jitter))
+}
+
+// Schedule backed by a standard 5 field cron expression: minute hour day-of-month month day-of-week
+type CronSchedule struct {
+	minute     uint64
+	hour       uint64
+	dayOfMonth uint64
+	month      uint64
+	dayOfWeek  uint64
+	// Cron treats the two day fields as OR'd when both are restricted, AND'd otherwise
+	domStar bool
+	dowStar bool
+}
+
+// Shorthand descriptors supported in place of the 5 fields
+var CRON_DESCRIPTORS = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Method to parse a cron expression such as "*/5 * * * *" or "@hourly" into a CronSchedule
+func ParseCronSchedule(expression string) (*CronSchedule, error) {
+	expression = strings.TrimSpace(expression)
+	if descriptor, ok := CRON_DESCRIPTORS[expression]; ok {
+		expression = descriptor
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, found %d", expression, len(fields))
+	}
+
+	var s CronSchedule
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("invalid minute field: %w", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("invalid hour field: %w", err)
+	}
+	if s.dayOfMonth, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("invalid day-of-month field: %w", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("invalid month field: %w", err)
+	}
+	// Allow 7 as an alias for Sunday like most cron implementations do
+	if s.dayOfWeek, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("invalid day-of-week field: %w", err)
+	}
+	if s.dayOfWeek&(1<<7) != 0 {
+		s.dayOfWeek |= 1
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+	return &s, nil
+}
+
+// Helper method to turn a single cron field (lists, ranges and steps) into a bitmask of allowed values
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var mask uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+		}
+
+		start, end := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err1, err2 error
+			start, err1 = strconv.Atoi(bounds[0])
+			end, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("bad range %q", rangePart)
+			}
+		default:
+			value, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("bad value %q", rangePart)
+			}
+			start = value
+			// "5/10" means starting at 5 every 10, a bare "5" is just 5
+			if step == 1 {
+				end = value
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("%q is outside of %d-%d", part, min, max)
+		}
+		for v := start; v <= end; v += step {
+			mask |= 1 << uint(v)
+		}
+	}
+	return mask, nil
+}
+
+func (s *CronSchedule) Next(after time.Time) time.Time {
+	// Cron has minute granularity, start from the next whole minute
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	// Expressions like "0 0 30 2 *" never match, give up rather than looping forever
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// Helper method implementing cron's day-of-month / day-of-week matching rules
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dayOfMonth&(1<<uint(t.Day())) != 0
+	dowMatch := s.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronSchedule_Invalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	}
+
+	for _, expression := range tests {
+		if _, err := ParseCronSchedule(expression); err == nil {
+			t.Errorf("Expected error for %q but got none", expression)
+		}
+	}
+}
+
+func TestCronSchedule_Next(t *testing.T) {
+	// A Wednesday
+	start := time.Date(2024, 5, 1, 12, 3, 30, 0, time.UTC)
+	tests := []struct {
+		expression string
+		expected   time.Time
+	}{
+		{"*/5 * * * *", time.Date(2024, 5, 1, 12, 5, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+		{"30 6 * * 1-5", time.Date(2024, 5, 2, 6, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 9 15 * *", time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted means either can match
+		{"0 0 20 * 5", time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			schedule, err := ParseCronSchedule(tt.expression)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if next := schedule.Next(start); !next.Equal(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, next)
+			}
+		})
+	}
+}
+
+func TestCronSchedule_NextNeverMatches(t *testing.T) {
+	schedule, err := ParseCronSchedule("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Expected no activation time, got %v", next)
+	}
+}
+
+func TestJitterSchedule_Next(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	schedule := JitterSchedule{Schedule: IntervalSchedule{Interval: time.Minute}, Jitter: 10 * time.Second}
+
+	for i := 0; i < 100; i++ {
+		next := schedule.Next(start)
+		if next.Before(start.Add(time.Minute)) || !next.Before(start.Add(time.Minute+10*time.Second)) {
+			t.Fatalf("Expected next within jitter window, got %v", next)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Content the simulated records start with, from the documentation ranges so the first check always has something to update
+const SIMULATE_IPV4 = "192.0.2.1"
+const SIMULATE_IPV6 = "2001:db8::1"
+const SIMULATE_CNAME_TARGET = "old.example.invalid"
+
+// Account every simulated zone is in
+const SIMULATE_ACCOUNT_ID = "simulated"
+
+// In memory stand-in for the Cloudflare API, used by -simulate to try the program without touching a real zone
+// Only knows the zone and record endpoints the program uses, and forgets everything when the process exits
+type SimulatedCloudflare struct {
+	mu      sync.Mutex
+	zones   []map[string]any
+	records map[string][]map[string]any
+	nextID  int
+}
+
+// Method to create a simulated API with a zone and a stale record for every target, the www records included
+// A target's zone is taken to be its last two labels, e.g. example.com for home.example.com
+func NewSimulatedCloudflare(targets []RecordConfig) *SimulatedCloudflare {
+	s := &SimulatedCloudflare{records: map[string][]map[string]any{}}
+	for _, target := range targets {
+		names := []string{target.Name}
+		if target.WWW {
+			names = append(names, "www."+target.Name)
+		}
+		for _, name := range names {
+			s.seed(strings.ToLower(name), target.Type)
+		}
+	}
+	return s
+}
+
+// Helper method to add a record, and its zone when it's the first one in it
+// Only the address and CNAME records get one, the other types are left for the sync command to create
+func (s *SimulatedCloudflare) seed(name string, recordType string) {
+	labels := strings.Split(name, ".")
+	zoneName := strings.Join(labels[max(len(labels)-2, 0):], ".")
+	zoneID := "zone-" + zoneName
+	if !slices.ContainsFunc(s.zones, func(zone map[string]any) bool { return zone["id"] == zoneID }) {
+		s.zones = append(s.zones, map[string]any{"id": zoneID, "name": zoneName, "status": "active", "account": map[string]any{"id": SIMULATE_ACCOUNT_ID}})
+	}
+	recordType = strings.ToUpper(recordType)
+	if recordType == "" {
+		recordType = RECORD_TYPE_A
+	}
+	content := map[string]string{RECORD_TYPE_A: SIMULATE_IPV4, RECORD_TYPE_AAAA: SIMULATE_IPV6, RECORD_TYPE_CNAME: SIMULATE_CNAME_TARGET}
+	recordContent, ok := content[recordType]
+	if !ok || slices.ContainsFunc(s.records[zoneID], func(record map[string]any) bool { return record["name"] == name && record["type"] == recordType }) {
+		return
+	}
+	s.nextID++
+	s.records[zoneID] = append(s.records[zoneID], map[string]any{
+		"id":      strconv.Itoa(s.nextID),
+		"name":    name,
+		"type":    recordType,
+		"content": recordContent,
+		"ttl":     TTL_AUTOMATIC,
+		"proxied": false,
+	})
+}
+
+func (s *SimulatedCloudflare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "zones":
+		writeSimulatedPage(w, r, FilterZoneItems(s.zones, r.URL.Query()))
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[2] == "dns_records":
+		writeSimulatedPage(w, r, FilterRecordItems(s.records[parts[1]], r.URL.Query()))
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "accounts" && parts[2] == "audit_logs":
+		// Nothing changes a simulated zone from outside, so its audit log stays empty
+		writeSimulatedPage(w, r, nil)
+	case r.Method == http.MethodGet && len(parts) == 4 && parts[2] == "dns_records" && parts[3] == "export":
+		var zoneFile strings.Builder
+		for _, record := range s.records[parts[1]] {
+			fmt.Fprintf(&zoneFile, "%v.\t%v\tIN\t%v\t%v\n", record["name"], record["ttl"], record["type"], record["content"])
+		}
+		w.Write([]byte(zoneFile.String()))
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[2] == "dnssec":
+		writeSimulatedResult(w, map[string]any{"status": "disabled"})
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[2] == "purge_cache":
+		log.Infof("Simulated Cloudflare: purged the cache of %v", parts[1])
+		writeSimulatedResult(w, map[string]any{"id": parts[1]})
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[2] == "dns_records":
+		var record map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			writeSimulatedError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.nextID++
+		record["id"] = strconv.Itoa(s.nextID)
+		s.records[parts[1]] = append(s.records[parts[1]], record)
+		log.Infof("Simulated Cloudflare: created %v %v: %v", record["type"], record["name"], record["content"])
+		writeSimulatedResult(w, record)
+	case r.Method == http.MethodPatch && len(parts) == 4 && parts[2] == "dns_records":
+		record := s.find(parts[1], parts[3])
+		if record == nil {
+			writeSimulatedError(w, http.StatusNotFound, "Record not found")
+			return
+		}
+		previous := record["content"]
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			writeSimulatedError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Infof("Simulated Cloudflare: updated %v %v: %v -> %v", record["type"], record["name"], previous, record["content"])
+		writeSimulatedResult(w, record)
+	case r.Method == http.MethodDelete && len(parts) == 4 && parts[2] == "dns_records":
+		record := s.find(parts[1], parts[3])
+		if record == nil {
+			writeSimulatedError(w, http.StatusNotFound, "Record not found")
+			return
+		}
+		s.records[parts[1]] = slices.DeleteFunc(s.records[parts[1]], func(existing map[string]any) bool { return existing["id"] == parts[3] })
+		log.Infof("Simulated Cloudflare: deleted %v %v", record["type"], record["name"])
+		writeSimulatedResult(w, map[string]any{"id": parts[3]})
+	default:
+		writeSimulatedError(w, http.StatusNotFound, fmt.Sprintf("%v %v isn't simulated", r.Method, r.URL.Path))
+	}
+}
+
+// Helper method to find a record by its zone and ID, nil when there's no such record
+func (s *SimulatedCloudflare) find(zoneID string, recordID string) map[string]any {
+	for _, record := range s.records[zoneID] {
+		if record["id"] == recordID {
+			return record
+		}
+	}
+	return nil
+}
+
+// Method to serve the simulated API on a local port, returning its base URL to point the Cloudflare client at
+func StartSimulatedCloudflare(simulated *SimulatedCloudflare) (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("simulated cloudflare failed to listen: %w", err)
+	}
+	server := &http.Server{Handler: simulated}
+	go server.Serve(listener)
+	return "http://" + listener.Addr().String(), nil
+}
+
+// Helper method to apply the name and account filters of a zone listing the way Cloudflare does
+// The name is matched exactly, or by its end when given as ends_with:example.com
+func FilterZoneItems(zones []map[string]any, query url.Values) []map[string]any {
+	var filtered []map[string]any
+	for _, zone := range zones {
+		name, _ := zone["name"].(string)
+		filter := query.Get("name")
+		if suffix, found := strings.CutPrefix(filter, "ends_with:"); found {
+			if !strings.HasSuffix(strings.ToLower(name), strings.ToLower(suffix)) {
+				continue
+			}
+		} else if filter != "" && !strings.EqualFold(name, filter) {
+			continue
+		}
+		account, _ := zone["account"].(map[string]any)
+		if accountID := query.Get("account.id"); accountID != "" && account["id"] != accountID {
+			continue
+		}
+		filtered = append(filtered, zone)
+	}
+	return filtered
+}
+
+// Helper method to apply the name, type and tag filters of a record listing the way Cloudflare does
+func FilterRecordItems(records []map[string]any, query url.Values) []map[string]any {
+	var filtered []map[string]any
+	for _, record := range records {
+		name, _ := record["name"].(string)
+		if exact := query.Get("name.exact"); exact != "" && !strings.EqualFold(name, exact) {
+			continue
+		}
+		if recordType := query.Get("type"); recordType != "" && record["type"] != recordType {
+			continue
+		}
+		// Tags are []any once decoded from a request, tests may seed them as []string
+		tags, _ := record["tags"].([]string)
+		if recordTags, ok := record["tags"].([]any); ok {
+			for _, tag := range recordTags {
+				if tag, ok := tag.(string); ok {
+					tags = append(tags, tag)
+				}
+			}
+		}
+		if exact := query.Get("tag.exact"); exact != "" && !slices.ContainsFunc(tags, func(tag string) bool { return strings.EqualFold(tag, exact) }) {
+			continue
+		}
+		if present := query.Get("tag.present"); present != "" && !slices.ContainsFunc(tags, func(tag string) bool {
+			return strings.EqualFold(tag, present) || strings.HasPrefix(strings.ToLower(tag), strings.ToLower(present)+":")
+		}) {
+			continue
+		}
+		filtered = append(filtered, record)
+	}
+	return filtered
+}
+
+// Helper method to serve items the way Cloudflare's paginated list endpoints do
+func writeSimulatedPage(w http.ResponseWriter, r *http.Request, items []map[string]any) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 20
+	}
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success":     true,
+		"errors":      []any{},
+		"messages":    []any{},
+		"result":      items[start:end],
+		"result_info": map[string]any{"page": page, "per_page": perPage, "count": end - start, "total_count": len(items)},
+	})
+}
+
+// Helper method to wrap a result the way every Cloudflare API response is
+func writeSimulatedResult(w http.ResponseWriter, result any) {
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "errors": []any{}, "messages": []any{}, "result": result})
+}
+
+// Helper method to answer the way Cloudflare does when a request fails
+func writeSimulatedError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]any{"success": false, "errors": []any{map[string]any{"code": code, "message": message}}, "messages": []any{}, "result": nil})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSimulatedCloudflare(t *testing.T) {
+	targets := []RecordConfig{
+		{Name: "home.example.com", WWW: true},
+		{Name: "lab.example.net"},
+	}
+	cfClient := newTestCloudflareAPI(t, NewSimulatedCloudflare(append(targets, RecordConfig{Name: "v6.example.com", Type: RECORD_TYPE_AAAA})))
+
+	zoneList, err := ListZones(cfClient)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(zoneList) != 2 {
+		t.Errorf("Expected a zone each for example.com and example.net, got %v", zoneList)
+	}
+
+	groups, err := ResolveZones(cfClient, targets)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	publicIPs := map[string]string{"": "203.0.113.42"}
+	options := RecordOptions{}
+	states, err := UpdateZones(cfClient, groups, publicIPs, options, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	changed := 0
+	for _, state := range states {
+		if state.Changed {
+			changed++
+		}
+	}
+	if changed != 3 {
+		t.Errorf("Expected 3 records to be updated, got %+v", states)
+	}
+
+	// The changes stick for the life of the simulation
+	states, _ = UpdateZones(cfClient, groups, publicIPs, options, nil)
+	for _, state := range states {
+		if state.Changed {
+			t.Errorf("Expected no change on the second check, got %+v", state)
+		}
+	}
+
+	records, err := ListDNSRecords(cfClient, "zone-example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if record, _ := FindDNSRecords(records, RecordConfig{Name: "v6.example.com", Type: RECORD_TYPE_AAAA}); record.Content != SIMULATE_IPV6 {
+		t.Errorf("Expected the AAAA record to start out as %v, got %+v", SIMULATE_IPV6, record)
+	}
+
+	var out strings.Builder
+	if err := ExportZone(cfClient, "example.com", &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "www.home.example.com.\t1\tIN\tA\t203.0.113.42") {
+		t.Errorf("Expected the updated www record in the export, got %q", out.String())
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	// Pure Go, so the static Docker image built without cgo can use it
+	_ "modernc.org/sqlite"
+)
+
+// Extensions of the audit log and state file paths kept in an SQLite database rather than JSON
+var SQLITE_EXTENSIONS = []string{".db", ".sqlite", ".sqlite3"}
+
+// Tables of the database, created on first use, the audit log and state file may share one
+// Times are stored as nanoseconds since the Unix epoch so they're compared as numbers, e.g. datetime(time / 1e9, 'unixepoch') shows them
+const SQLITE_SCHEMA = `
+CREATE TABLE IF NOT EXISTS audit (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	time INTEGER NOT NULL,
+	record TEXT NOT NULL,
+	result TEXT NOT NULL,
+	ip TEXT NOT NULL,
+	previous TEXT NOT NULL,
+	error TEXT NOT NULL,
+	code TEXT NOT NULL,
+	ray_id TEXT NOT NULL,
+	check_id TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_time ON audit (time);
+CREATE INDEX IF NOT EXISTS audit_record_time ON audit (record COLLATE NOCASE, time);
+CREATE TABLE IF NOT EXISTS state (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	contents TEXT NOT NULL
+);
+`
+
+// Method to report whether the audit log or state file at the path is an SQLite database, going by its extension
+func IsSQLitePath(path string) bool {
+	return slices.Contains(SQLITE_EXTENSIONS, strings.ToLower(filepath.Ext(path)))
+}
+
+// Helper method to open the database, creating it and its tables when they don't exist yet
+// The daemon writes while the history command reads, so the journal is written ahead and either waits a while for the other's lock
+func openSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(SQLITE_SCHEMA); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Helper method to add audit entries to the database in one go, dropping those older than retention when it's set
+func appendAuditSQLite(path string, entries []AuditEntry, now time.Time, retention time.Duration) error {
+	db, err := openSQLite(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, entry := range entries {
+		_, err := tx.Exec("INSERT INTO audit (time, record, result, ip, previous, error, code, ray_id, check_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			entry.Time.UnixNano(), entry.Record, entry.Result, entry.IP, entry.Previous, entry.Error, entry.Code, entry.RayID, entry.CheckID)
+		if err != nil {
+			return err
+		}
+	}
+	if retention > 0 {
+		if _, err := tx.Exec("DELETE FROM audit WHERE time < ?", now.Add(-retention).UnixNano()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Helper method to read the audit entries the filter wants from the database, oldest first
+// The filter is applied by the query, so only the entries asked for are read however long the history
+func queryAuditSQLite(path string, filter AuditFilter) ([]AuditEntry, error) {
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	query := "SELECT time, record, result, ip, previous, error, code, ray_id, check_id FROM audit"
+	var conditions []string
+	var args []any
+	if filter.Record != "" {
+		conditions, args = append(conditions, "record = ? COLLATE NOCASE"), append(args, filter.Record)
+	}
+	if !filter.Since.IsZero() {
+		conditions, args = append(conditions, "time >= ?"), append(args, filter.Since.UnixNano())
+	}
+	if !filter.Until.IsZero() {
+		conditions, args = append(conditions, "time <= ?"), append(args, filter.Until.UnixNano())
+	}
+	if filter.Result != "" {
+		conditions, args = append(conditions, "result = ?"), append(args, filter.Result)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	rows, err := db.Query(query+" ORDER BY time, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var at int64
+		if err := rows.Scan(&at, &entry.Record, &entry.Result, &entry.IP, &entry.Previous, &entry.Error, &entry.Code, &entry.RayID, &entry.CheckID); err != nil {
+			return nil, err
+		}
+		entry.Time = time.Unix(0, at)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Helper method to read the state from the database, an empty state when none was saved yet
+// It's kept as a single row of JSON, the same as the state file holds, so both always have the same fields
+func loadStateSQLite(path string) (State, error) {
+	var state State
+	db, err := openSQLite(path)
+	if err != nil {
+		return state, err
+	}
+	defer db.Close()
+	var contents string
+	err = db.QueryRow("SELECT contents FROM state WHERE id = 1").Scan(&contents)
+	if errors.Is(err, sql.ErrNoRows) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal([]byte(contents), &state); err != nil {
+		return state, fmt.Errorf("parsing state in %v failed: %w", path, err)
+	}
+	return state, nil
+}
+
+// Helper method to replace the state in the database
+func saveStateSQLite(path string, state State) error {
+	contents, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	db, err := openSQLite(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec("INSERT INTO state (id, contents) VALUES (1, ?) ON CONFLICT (id) DO UPDATE SET contents = excluded.contents", string(contents))
+	return err
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsSQLitePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/var/lib/go-dns-update/history.db", true},
+		{"history.SQLite", true},
+		{"history.sqlite3", true},
+		{"/var/lib/go-dns-update/audit.log", false},
+		{"state.json", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if actual := IsSQLitePath(tt.path); actual != tt.expected {
+			t.Errorf("%q: expected %v, got %v", tt.path, tt.expected, actual)
+		}
+	}
+}
+
+func TestAppendAudit_SQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	if entries, err := ReadAudit(path); err != nil || len(entries) != 0 {
+		t.Fatalf("Expected no entries before the first check, got %v, %v", entries, err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected reading not to create the database, got %v", err)
+	}
+
+	now := time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC)
+	for i, ip := range []string{"203.0.113.1", "198.51.100.7", "198.51.100.8"} {
+		report := CheckReport{CheckID: "check" + ip, Records: []RecordState{
+			{Name: "example.com", IP: ip, Previous: "192.0.2.1", Changed: true},
+			{Name: "lab.example.com", Error: "updating failed", Code: E_RATE_LIMITED, RayID: "8f1e2d3c4b5a6978-AMS"},
+		}}
+		if err := AppendAudit(path, now.Add(time.Duration(i-2)*24*time.Hour), report, nil, 0); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	entries, err := ReadAudit(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) != 6 {
+		t.Fatalf("Expected 6 entries, got %+v", entries)
+	}
+	expected := AuditEntry{Time: now, Record: "lab.example.com", Result: AUDIT_FAILED, Error: "updating failed", Code: E_RATE_LIMITED, RayID: "8f1e2d3c4b5a6978-AMS", CheckID: "check198.51.100.8"}
+	last := entries[5]
+	if !last.Time.Equal(expected.Time) {
+		t.Errorf("Expected the entry at %v, got %v", expected.Time, last.Time)
+	}
+	last.Time = expected.Time
+	if last != expected {
+		t.Errorf("Expected %+v, got %+v", expected, last)
+	}
+
+	// The filters are applied by the query, the record name regardless of case
+	filtered, err := QueryAudit(path, AuditFilter{Record: "Example.com", Since: now.Add(-36 * time.Hour), Result: AUDIT_CHANGED})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(filtered) != 2 || filtered[0].IP != "198.51.100.7" || filtered[1].IP != "198.51.100.8" {
+		t.Errorf("Expected the last two changes, got %+v", filtered)
+	}
+
+	// Adding a check with a retention drops the entries older than it
+	if err := AppendAudit(path, now.Add(time.Hour), CheckReport{}, errors.New("could not retrieve initial values"), 12*time.Hour); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if entries, err = ReadAudit(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) != 3 || !entries[0].Time.Equal(now) || entries[2].Error != "could not retrieve initial values" {
+		t.Errorf("Expected the entries of the last day and the new one, got %+v", entries)
+	}
+
+	var out strings.Builder
+	if err := RunHistory(path, []string{"-result", "failed"}, now, &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[0], "E_RATE_LIMITED: updating failed") {
+		t.Errorf("Expected the two failures, got %q", out.String())
+	}
+}
+
+func TestSaveState_SQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "go-dns-update.sqlite")
+	state, err := LoadState(path)
+	if err != nil || state.LastCheck != nil {
+		t.Fatalf("Expected an empty state before the first check, got %+v, %v", state, err)
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 2 {
+		if _, err := SaveCheckState(path, now.Add(time.Duration(i)*time.Hour), CheckReport{PublicIP: "198.51.100.7"}, nil, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	// The audit log may share the database
+	if err := AppendAudit(path, now, CheckReport{Records: []RecordState{{Name: "example.com", IP: "198.51.100.7"}}}, nil, 0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if state, err = LoadState(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if state.ChecksTotal != 2 || state.PublicIP != "198.51.100.7" || state.LastSuccess == nil || !state.LastSuccess.Equal(now.Add(time.Hour)) {
+		t.Errorf("Unexpected state: %+v", state)
+	}
+	if entries, err := ReadAudit(path); err != nil || len(entries) != 1 {
+		t.Errorf("Expected the audit entry next to the state, got %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// What the last run left behind, kept in the file given with -stateFile so it outlives the process
+type State struct {
+	LastCheck   *time.Time `json:"lastCheck,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	// Code of the last error, e.g. E_RATE_LIMITED
+	LastErrorCode string `json:"lastErrorCode,omitempty"`
+	PublicIP      string `json:"publicIP,omitempty"`
+	// The last change of each record this program changed, by name
+	Changes map[string]RecordChange `json:"changes,omitempty"`
+	// Running totals of checks, failed checks and record changes since the state was started
+	ChecksTotal        int `json:"checksTotal,omitempty"`
+	FailuresTotal      int `json:"failuresTotal,omitempty"`
+	RecordChangesTotal int `json:"recordChangesTotal,omitempty"`
+	// The failed checks going on, kept so the next run only notifies about them when they change or are due a reminder
+	Failure *FailureSpell `json:"failure,omitempty"`
+}
+
+// When a record was last changed and what to
+type RecordChange struct {
+	At time.Time `json:"at"`
+	IP string    `json:"ip"`
+}
+
+// Method to read the state file, a missing file being an empty state as nothing has run yet
+// A path ending in .db, .sqlite or .sqlite3 is an SQLite database holding it rather than a JSON file
+func LoadState(path string) (State, error) {
+	var state State
+	if IsSQLitePath(path) {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return state, nil
+		}
+		state, err := loadStateSQLite(path)
+		if err != nil {
+			return state, fmt.Errorf("reading state file failed: %w", err)
+		}
+		return state, nil
+	}
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("reading state file failed: %w", err)
+	}
+	if err := json.Unmarshal(contents, &state); err != nil {
+		return state, fmt.Errorf("parsing state file %v failed: %w", path, err)
+	}
+	return state, nil
+}
+
+// Method to write the state file, through a temporary file so a reader never sees it half written
+func SaveState(path string, state State) error {
+	if IsSQLitePath(path) {
+		if err := saveStateSQLite(path, state); err != nil {
+			return fmt.Errorf("writing state file failed: %w", err)
+		}
+		return nil
+	}
+	contents, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, append(contents, '\n'), 0o600); err != nil {
+		return fmt.Errorf("writing state file failed: %w", err)
+	}
+	return nil
+}
+
+// Helper method to replace a file's contents through a temporary file next to it, so a reader never sees it half written
+func writeFileAtomic(path string, contents []byte, perm os.FileMode) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if err := file.Chmod(perm); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(contents); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// Summary of a single check, written as JSON for monitoring scripts that don't speak Prometheus
+type RunSummary struct {
+	Time     time.Time `json:"time"`
+	CheckID  string    `json:"checkId,omitempty"`
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+	Code     string    `json:"code,omitempty"`
+	Duration float64   `json:"durationSeconds"`
+	Source   string    `json:"source,omitempty"`
+	PublicIP string    `json:"publicIP,omitempty"`
+	Checked  int       `json:"checked"`
+	Changed  int       `json:"changed"`
+	Failed   int       `json:"failed"`
+	// Every record of the check, the failed ones with why
+	Records []RecordState `json:"records"`
+}
+
+// Method to summarise a check that finished at the provided time
+func NewRunSummary(at time.Time, report CheckReport, err error) RunSummary {
+	summary := RunSummary{
+		Time:     at.UTC(),
+		CheckID:  report.CheckID,
+		Success:  err == nil,
+		Duration: report.Duration.Seconds(),
+		Source:   report.Source,
+		PublicIP: report.PublicIP,
+		Checked:  len(report.Records),
+		Records:  report.Records,
+	}
+	if err != nil {
+		summary.Error, summary.Code = err.Error(), ErrorCode(err)
+	}
+	if summary.Records == nil {
+		summary.Records = []RecordState{}
+	}
+	for _, record := range report.Records {
+		switch {
+		case record.Error != "":
+			summary.Failed++
+		case record.Changed:
+			summary.Changed++
+		}
+	}
+	return summary
+}
+
+// Method to replace the summary file with the summary of a check, so it always holds the last one
+func WriteSummaryFile(path string, at time.Time, report CheckReport, err error) error {
+	contents, marshalErr := json.MarshalIndent(NewRunSummary(at, report, err), "", "  ")
+	if marshalErr != nil {
+		return fmt.Errorf("writing summary file failed: %w", marshalErr)
+	}
+	if writeErr := writeFileAtomic(path, append(contents, '\n'), 0o644); writeErr != nil {
+		return fmt.Errorf("writing summary file failed: %w", writeErr)
+	}
+	return nil
+}
+
+// Method to note the outcome of a check that finished at the provided time
+// A failed check keeps the previous success, that's what monitoring wants to know the age of
+func (s State) Record(at time.Time, report CheckReport, err error) State {
+	s.LastCheck = &at
+	s.ChecksTotal++
+	if report.PublicIP != "" {
+		s.PublicIP = report.PublicIP
+	}
+	// Records can change in a check that fails overall, they're noted either way
+	for _, record := range report.Records {
+		if !record.Changed {
+			continue
+		}
+		if s.Changes == nil {
+			s.Changes = map[string]RecordChange{}
+		}
+		s.Changes[record.Name] = RecordChange{At: at, IP: record.IP}
+		s.RecordChangesTotal++
+	}
+	if err != nil {
+		s.FailuresTotal++
+		s.LastError, s.LastErrorCode = err.Error(), ErrorCode(err)
+		return s
+	}
+	s.LastSuccess = &at
+	s.LastError, s.LastErrorCode = "", ""
+	return s
+}
+
+// Method to load the state file, note the check's outcome and the failure spell notifications are tracking and save it again, returning the new state
+// Without a path the state starts out empty and isn't saved, which still gives the outcome of this one check
+func SaveCheckState(path string, at time.Time, report CheckReport, err error, failure *FailureSpell) (State, error) {
+	if path == "" {
+		return State{}.Record(at, report, err), nil
+	}
+	state, loadErr := LoadState(path)
+	if loadErr != nil {
+		return state.Record(at, report, err), loadErr
+	}
+	state = state.Record(at, report, err)
+	state.Failure = failure
+	return state, SaveState(path, state)
+}
+
+// Method to run the status command, printing what the state file says about the last run
+// Fails when no check has succeeded within maxAge, so it can be used as is by monitoring, a zero maxAge never fails
+func RunStatus(path string, maxAge time.Duration, now time.Time, out io.Writer) error {
+	state, err := LoadState(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Last check    %v\n", formatStateTime(state.LastCheck, now))
+	fmt.Fprintf(out, "Last success  %v\n", formatStateTime(state.LastSuccess, now))
+	if state.LastError != "" {
+		fmt.Fprintf(out, "Last error    %v\n", Colorize(out, ANSI_RED, state.LastError))
+	}
+	if state.LastErrorCode != "" {
+		fmt.Fprintf(out, "Error code    %v\n", state.LastErrorCode)
+	}
+	if state.PublicIP != "" {
+		fmt.Fprintf(out, "Public IP     %v\n", state.PublicIP)
+	}
+	if maxAge <= 0 {
+		return nil
+	}
+	if state.LastSuccess == nil {
+		return fmt.Errorf("no check has succeeded yet")
+	}
+	if age := now.Sub(*state.LastSuccess); age > maxAge {
+		return fmt.Errorf("last success was %v ago, more than %v", age.Round(time.Second), maxAge)
+	}
+	return nil
+}
+
+// Helper method to show a time from the state file along with how long ago it was
+func formatStateTime(t *time.Time, now time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return fmt.Sprintf("%v (%v ago)", t.Format(time.RFC3339), now.Sub(*t).Round(time.Second))
+}
+
+// Method to write the state as metrics for node_exporter's textfile collector, so single runs from cron reach Prometheus without a server
+// The totals only add up across runs when the state is kept in a state file
+func WriteMetricsFile(path string, state State) error {
+	var metrics strings.Builder
+	WriteStatusMetrics(&metrics, state.LastCheck, state.LastSuccess, state.LastCheck != nil && state.LastError == "")
+	fmt.Fprintln(&metrics, "# HELP go_dns_update_checks_total Checks run.")
+	fmt.Fprintln(&metrics, "# TYPE go_dns_update_checks_total counter")
+	fmt.Fprintf(&metrics, "go_dns_update_checks_total %d\n", state.ChecksTotal)
+	fmt.Fprintln(&metrics, "# HELP go_dns_update_check_failures_total Checks that failed.")
+	fmt.Fprintln(&metrics, "# TYPE go_dns_update_check_failures_total counter")
+	fmt.Fprintf(&metrics, "go_dns_update_check_failures_total %d\n", state.FailuresTotal)
+	fmt.Fprintln(&metrics, "# HELP go_dns_update_record_changes_total Records updated to a new address.")
+	fmt.Fprintln(&metrics, "# TYPE go_dns_update_record_changes_total counter")
+	fmt.Fprintf(&metrics, "go_dns_update_record_changes_total %d\n", state.RecordChangesTotal)
+	// The collector reads the file whenever it's scraped, so it's replaced in one go and readable by node_exporter's user
+	if err := writeFileAtomic(path, []byte(metrics.String()), 0o644); err != nil {
+		return fmt.Errorf("writing metrics file failed: %w", err)
+	}
+	return nil
+}
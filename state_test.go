@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveCheckState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if state.LastCheck != nil || state.LastSuccess != nil {
+		t.Errorf("Expected an empty state before the first check, got %+v", state)
+	}
+
+	success := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	report := CheckReport{PublicIP: "203.0.113.42", Records: []RecordState{{Name: "example.com", IP: "203.0.113.42", Changed: true}, {Name: "www.example.com", IP: "203.0.113.42"}}}
+	if _, err := SaveCheckState(path, success, report, nil, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	failure := success.Add(time.Minute)
+	if _, err := SaveCheckState(path, failure, CheckReport{}, WithCode(E_API, errors.New("cloudflare blip")), nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	state, err = LoadState(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if state.LastSuccess == nil || !state.LastSuccess.Equal(success) {
+		t.Errorf("Expected last success %v, got %v", success, state.LastSuccess)
+	}
+	if state.LastCheck == nil || !state.LastCheck.Equal(failure) {
+		t.Errorf("Expected last check %v, got %v", failure, state.LastCheck)
+	}
+	if state.LastError != "cloudflare blip" {
+		t.Errorf("Expected last error %q, got %q", "cloudflare blip", state.LastError)
+	}
+	if state.LastErrorCode != E_API {
+		t.Errorf("Expected last error code %v, got %q", E_API, state.LastErrorCode)
+	}
+	if state.PublicIP != "203.0.113.42" {
+		t.Errorf("Expected public IP 203.0.113.42, got %q", state.PublicIP)
+	}
+	if change, ok := state.Changes["example.com"]; len(state.Changes) != 1 || !ok || !change.At.Equal(success) || change.IP != "203.0.113.42" {
+		t.Errorf("Expected only the change of example.com to be kept, got %+v", state.Changes)
+	}
+}
+
+func TestRunStatus(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	recent := filepath.Join(dir, "recent.json")
+	if err := SaveState(recent, State{}.Record(now.Add(-10*time.Minute), CheckReport{PublicIP: "203.0.113.42"}, nil)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		maxAge  time.Duration
+		wantErr bool
+	}{
+		{"No Max Age", recent, 0, false},
+		{"Within Max Age", recent, time.Hour, false},
+		{"Too Old", recent, 5 * time.Minute, true},
+		{"Never Run", filepath.Join(dir, "missing.json"), time.Hour, true},
+		{"Never Run Without Max Age", filepath.Join(dir, "missing.json"), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			err := RunStatus(tt.path, tt.maxAge, now, &out)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if !strings.Contains(out.String(), "Last success") {
+				t.Errorf("Expected the last success to be printed, got %q", out.String())
+			}
+		})
+	}
+}
+
+func TestWriteMetricsFile(t *testing.T) {
+	dir := t.TempDir()
+	statePath, metricsPath := filepath.Join(dir, "state.json"), filepath.Join(dir, "go_dns_update.prom")
+	first := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	changed := CheckReport{PublicIP: "198.51.100.7", Records: []RecordState{{Name: "example.com", IP: "198.51.100.7", Changed: true}, {Name: "www.example.com", IP: "198.51.100.7", Changed: true}}}
+	if _, err := SaveCheckState(statePath, first, changed, nil, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	state, err := SaveCheckState(statePath, first.Add(time.Hour), CheckReport{}, errors.New("could not retrieve initial values"), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := WriteMetricsFile(metricsPath, state); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	contents, err := os.ReadFile(metricsPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		"go_dns_update_last_check_timestamp_seconds 1714568400\n",
+		"go_dns_update_last_success_timestamp_seconds 1714564800\n",
+		"go_dns_update_healthy 0\n",
+		"go_dns_update_checks_total 2\n",
+		"go_dns_update_check_failures_total 1\n",
+		"go_dns_update_record_changes_total 2\n",
+	} {
+		if !strings.Contains(string(contents), expected) {
+			t.Errorf("Expected %q in the metrics, got %q", expected, contents)
+		}
+	}
+	if info, err := os.Stat(metricsPath); err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("Expected the metrics to be readable by node_exporter, got %v (%v)", info.Mode(), err)
+	}
+
+	// Without a state file only the one check is counted
+	if state, err := SaveCheckState("", first, changed, nil, nil); err != nil || state.ChecksTotal != 1 || state.RecordChangesTotal != 2 {
+		t.Errorf("Expected the single check counted, got %+v (%v)", state, err)
+	}
+}
+
+func TestWriteSummaryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summary.json")
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	report := CheckReport{PublicIP: "198.51.100.7", Source: PUB_IP_SERVICE_ENDPOINT, CheckID: "0123456789abcdef", Duration: 1500 * time.Millisecond, Records: []RecordState{
+		{Name: "example.com", IP: "198.51.100.7", Changed: true},
+		{Name: "www.example.com", IP: "198.51.100.7"},
+		{Name: "lab.example.net", Error: "record not found", Code: E_RECORD_NOT_FOUND},
+	}}
+	if err := WriteSummaryFile(path, at, report, WithCode(E_RECORD_NOT_FOUND, errors.New("lab.example.net: record not found"))); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var summary RunSummary
+	if err := json.Unmarshal(contents, &summary); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if summary.Success || summary.Code != E_RECORD_NOT_FOUND || summary.Error != "lab.example.net: record not found" {
+		t.Errorf("Expected the failure, got %+v", summary)
+	}
+	if summary.Checked != 3 || summary.Changed != 1 || summary.Failed != 1 {
+		t.Errorf("Expected 3 checked, 1 changed and 1 failed, got %d, %d and %d", summary.Checked, summary.Changed, summary.Failed)
+	}
+	if summary.Duration != 1.5 || summary.Source != PUB_IP_SERVICE_ENDPOINT || !summary.Time.Equal(at) || summary.CheckID != "0123456789abcdef" {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+
+	// A check without records still has a list of them, if empty, for scripts to go through
+	if err := WriteSummaryFile(path, at, CheckReport{}, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	contents, _ = os.ReadFile(path)
+	if !strings.Contains(string(contents), `"records": []`) || !strings.Contains(string(contents), `"success": true`) {
+		t.Errorf("Expected an empty list of records, got %s", contents)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Ways a live record is brought in line with the declared ones
+const SYNC_CREATE = "create"
+const SYNC_UPDATE = "update"
+const SYNC_DELETE = "delete"
+
+// Prefix the diff command marks each kind of change with
+var DIFF_SYMBOLS = map[string]string{SYNC_CREATE: "+", SYNC_UPDATE: "~", SYNC_DELETE: "-"}
+
+// A zone's records as declared in a file given to the sync command
+type SyncFile struct {
+	// Name of the zone, e.g. example.com
+	Zone string `yaml:"zone"`
+	// Every record the zone should have, the ones not listed are deleted
+	Records []SyncRecord `yaml:"records"`
+}
+
+// A declared record
+type SyncRecord struct {
+	// Name of the record, "@" or a name relative to the zone is completed with the zone's name
+	Name string `yaml:"name" json:"name"`
+	Type string `yaml:"type" json:"type"`
+	// Content as in a zone file, {{ publicIPv4 }} and {{ publicIPv6 }} are replaced with the detected addresses
+	Content string `yaml:"content" json:"content"`
+	// TTL in seconds, automatic when not set
+	TTL     int   `yaml:"ttl" json:"ttl,omitempty"`
+	Proxied *bool `yaml:"proxied" json:"proxied,omitempty"`
+}
+
+// A change needed to make the zone match the declared records
+type SyncChange struct {
+	Action string
+	// The record as declared, empty for deletes
+	Desired SyncRecord
+	// The live record, empty for creates
+	Existing DNSRecord
+}
+
+// Method to describe the change, e.g. "update A example.com: 203.0.113.1 -> 198.51.100.7"
+func (c SyncChange) String() string {
+	switch c.Action {
+	case SYNC_CREATE:
+		return fmt.Sprintf("create %v %v: %v", c.Desired.Type, c.Desired.Name, c.Desired.Content)
+	case SYNC_DELETE:
+		return fmt.Sprintf("delete %v %v: %v", c.Existing.Type, c.Existing.Name, RecordPresentation(c.Existing))
+	}
+	return fmt.Sprintf("update %v %v: %v -> %v", c.Desired.Type, c.Desired.Name, RecordPresentation(c.Existing), c.Desired.Content)
+}
+
+// Method to read a sync file, filling in the names and the dynamic addresses
+// detect is given the source to ask, "" for the default service, and is only called for the placeholders the file actually uses
+func LoadSyncFile(path string, detect func(source string) (string, error)) (*SyncFile, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading sync file failed: %w", err)
+	}
+	file, err := ParseSyncFile(contents, detect)
+	if err != nil {
+		return nil, fmt.Errorf("sync file %v: %w", path, err)
+	}
+	return file, nil
+}
+
+// Method to parse and check a sync file's contents
+func ParseSyncFile(contents []byte, detect func(source string) (string, error)) (*SyncFile, error) {
+	var file SyncFile
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing failed: %w", err)
+	}
+	if file.Zone == "" {
+		return nil, fmt.Errorf("no zone given")
+	}
+	file.Zone = strings.ToLower(strings.TrimSuffix(file.Zone, "."))
+
+	// Each address is only detected once, however many records use it
+	detected := map[string]string{}
+	address := func(source string) (string, error) {
+		if ip, ok := detected[source]; ok {
+			return ip, nil
+		}
+		ip, err := detect(source)
+		if err != nil {
+			return "", err
+		}
+		detected[source] = strings.TrimSpace(ip)
+		return detected[source], nil
+	}
+	funcs := template.FuncMap{
+		"publicIPv4": func() (string, error) { return address("") },
+		"publicIPv6": func() (string, error) { return address(PUB_IPV6_SERVICE_ENDPOINT) },
+	}
+
+	for i := range file.Records {
+		record := &file.Records[i]
+		record.Name = QualifyName(record.Name, file.Zone)
+		record.Type = strings.ToUpper(record.Type)
+		tmpl, err := template.New(record.Name).Funcs(funcs).Parse(record.Content)
+		if err != nil {
+			return nil, fmt.Errorf("record %v: parsing content failed: %w", record.Name, err)
+		}
+		var content strings.Builder
+		if err := tmpl.Execute(&content, nil); err != nil {
+			return nil, fmt.Errorf("record %v: %w", record.Name, err)
+		}
+		record.Content = content.String()
+		if !IsSyncType(record.Type) {
+			return nil, fmt.Errorf("record %v: type must be A, AAAA, CNAME, TXT, MX, SRV or CAA, got %q", record.Name, record.Type)
+		}
+		if err := CheckContent(record.Type, record.Content); err != nil {
+			return nil, fmt.Errorf("record %v: %w", record.Name, err)
+		}
+		if err := (RecordOptions{TTL: record.TTL}).Validate(); err != nil {
+			return nil, fmt.Errorf("record %v: %w", record.Name, err)
+		}
+	}
+	return &file, nil
+}
+
+// Helper method to report whether records of the type can be synced
+func IsSyncType(recordType string) bool {
+	return recordType == RECORD_TYPE_A || recordType == RECORD_TYPE_AAAA || recordType == RECORD_TYPE_CNAME || IsTemplatedType(recordType)
+}
+
+// Helper method to complete a record name relative to the zone, "@" being the zone itself
+func QualifyName(name string, zone string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == "" || name == "@" {
+		return zone
+	}
+	if name == zone || strings.HasSuffix(name, "."+zone) {
+		return name
+	}
+	return name + "." + zone
+}
+
+// Method to work out the creates, updates and deletes that make the live records match the declared ones
+// Records are matched by name and type, those with the same content first, so e.g. one of several MX records changing is a single update
+func PlanSync(live []DNSRecord, desired []SyncRecord) []SyncChange {
+	var changes []SyncChange
+	used := make([]bool, len(live))
+	var unmatched []SyncRecord
+	for _, record := range desired {
+		i := findLive(live, used, record, true)
+		if i < 0 {
+			unmatched = append(unmatched, record)
+			continue
+		}
+		used[i] = true
+		if syncNeedsUpdate(live[i], record) {
+			changes = append(changes, SyncChange{Action: SYNC_UPDATE, Desired: record, Existing: live[i]})
+		}
+	}
+	for _, record := range unmatched {
+		i := findLive(live, used, record, false)
+		if i < 0 {
+			changes = append(changes, SyncChange{Action: SYNC_CREATE, Desired: record})
+			continue
+		}
+		used[i] = true
+		changes = append(changes, SyncChange{Action: SYNC_UPDATE, Desired: record, Existing: live[i]})
+	}
+	// Types a sync file can't declare are left alone, e.g. NS records delegating a subdomain
+	for i, record := range live {
+		if !used[i] && IsSyncType(record.Type) {
+			changes = append(changes, SyncChange{Action: SYNC_DELETE, Existing: record})
+		}
+	}
+	return changes
+}
+
+// Helper method to find an unused live record of the declared name and type, with the same content when sameContent is set
+func findLive(live []DNSRecord, used []bool, record SyncRecord, sameContent bool) int {
+	for i, existing := range live {
+		if used[i] || !strings.EqualFold(existing.Name, record.Name) || existing.Type != record.Type {
+			continue
+		}
+		if sameContent && !ContentMatches(existing.Type, RecordPresentation(existing), record.Content) {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// Helper method to decide whether a live record needs its content or settings changed to match the declared one
+func syncNeedsUpdate(existing DNSRecord, record SyncRecord) bool {
+	return RecordNeedsUpdate(existing, record.Content, record.options())
+}
+
+// Helper method to get the settings the declared record asks for, automatic TTL unless given
+func (r SyncRecord) options() RecordOptions {
+	ttl := r.TTL
+	if ttl == 0 {
+		ttl = TTL_AUTOMATIC
+	}
+	options := RecordOptions{TTL: ttl}
+	if IsProxiableType(r.Type) {
+		proxied := r.Proxied != nil && *r.Proxied
+		options.Proxied = &proxied
+	}
+	return options
+}
+
+// Method to make the changes, continuing past failures so one bad record doesn't hold up the rest
+func ApplySync(cfClient CloudflareAPI, zoneID string, changes []SyncChange, out io.Writer) error {
+	var errs []error
+	for _, change := range changes {
+		var err error
+		switch change.Action {
+		case SYNC_CREATE:
+			record := DNSRecord{Name: change.Desired.Name, Type: change.Desired.Type, ZoneID: zoneID}
+			err = cfClient.CreateDNSRecord(zoneID, BuildRecordParam(record, change.Desired.Content, change.Desired.options()))
+		case SYNC_UPDATE:
+			err = UpdateDNSRecord(cfClient, change.Desired.Content, change.Existing, change.Desired.options())
+		case SYNC_DELETE:
+			err = cfClient.DeleteDNSRecord(zoneID, change.Existing.ID)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v failed: %w", change, err))
+			continue
+		}
+		fmt.Fprintln(out, Colorize(out, DIFF_COLORS[change.Action], change.String()))
+	}
+	return errors.Join(errs...)
+}
+
+// Method to load a sync file and work out the changes its zone needs, returning the zone's ID with them
+func PlanSyncFile(cfClient CloudflareAPI, path string, detect func(source string) (string, error)) (string, []SyncChange, error) {
+	file, err := LoadSyncFile(path, detect)
+	if err != nil {
+		return "", nil, err
+	}
+	zoneID, err := GetZoneID(cfClient, file.Zone)
+	if err != nil {
+		return "", nil, err
+	}
+	live, err := ListDNSRecords(cfClient, zoneID)
+	if err != nil {
+		return "", nil, err
+	}
+	return zoneID, PlanSync(live, file.Records), nil
+}
+
+// Method to run the sync command, making the zone in the file match it
+// The changes are printed first, then made only once confirmed on in, unless yes is set
+func RunSync(cfClient CloudflareAPI, path string, detect func(source string) (string, error), yes bool, in io.Reader, out io.Writer) error {
+	zoneID, changes, err := PlanSyncFile(cfClient, path, detect)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "Zone matches the sync file, nothing to do")
+		return nil
+	}
+	if !yes {
+		for _, change := range changes {
+			PrintDiffLine(out, change)
+		}
+		fmt.Fprintf(out, "\n%v\n", ChangeCounts(changes))
+		confirmed, err := Confirm(in, out, fmt.Sprintf("Make these changes to the zone in %v?", path))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			fmt.Fprintln(out, "Sync cancelled")
+			return nil
+		}
+	}
+	return ApplySync(cfClient, zoneID, changes, out)
+}
+
+// Helper method to print a change after its diff symbol, in the change's color on a terminal
+func PrintDiffLine(out io.Writer, change SyncChange) {
+	fmt.Fprintln(out, Colorize(out, DIFF_COLORS[change.Action], DIFF_SYMBOLS[change.Action]+" "+change.String()))
+}
+
+// Method to run the diff command, printing what sync would change without changing anything
+func RunDiff(cfClient CloudflareAPI, path string, detect func(source string) (string, error), out io.Writer) error {
+	_, changes, err := PlanSyncFile(cfClient, path, detect)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "No drift, the zone matches the sync file")
+		return nil
+	}
+	for _, change := range changes {
+		PrintDiffLine(out, change)
+	}
+	fmt.Fprintf(out, "\n%v\n", ChangeCounts(changes))
+	return nil
+}
+
+// Helper method to count the changes of each kind, e.g. "1 to create, 2 to update, 0 to delete"
+func ChangeCounts(changes []SyncChange) string {
+	counts := map[string]int{}
+	for _, change := range changes {
+		counts[change.Action]++
+	}
+	return fmt.Sprintf("%d to create, %d to update, %d to delete", counts[SYNC_CREATE], counts[SYNC_UPDATE], counts[SYNC_DELETE])
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseSyncFile(t *testing.T) {
+	detections := 0
+	detect := func(endpoint string) (string, error) {
+		detections++
+		if endpoint == PUB_IPV6_SERVICE_ENDPOINT {
+			return "2001:db8::7\n", nil
+		}
+		return "198.51.100.7\n", nil
+	}
+	file, err := ParseSyncFile([]byte(`
+zone: Example.com.
+records:
+  - name: "@"
+    type: a
+    content: "{{ publicIPv4 }}"
+    proxied: true
+  - name: vpn
+    type: A
+    content: "{{ publicIPv4 }}"
+  - name: vpn
+    type: AAAA
+    content: "{{ publicIPv6 }}"
+  - name: www.example.com
+    type: CNAME
+    content: example.com
+`), detect)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if detections != 2 {
+		t.Errorf("Expected each address to be detected once, got %d detections", detections)
+	}
+	expected := []SyncRecord{
+		{Name: "example.com", Type: "A", Content: "198.51.100.7"},
+		{Name: "vpn.example.com", Type: "A", Content: "198.51.100.7"},
+		{Name: "vpn.example.com", Type: "AAAA", Content: "2001:db8::7"},
+		{Name: "www.example.com", Type: "CNAME", Content: "example.com"},
+	}
+	for i, record := range file.Records {
+		if record.Name != expected[i].Name || record.Type != expected[i].Type || record.Content != expected[i].Content {
+			t.Errorf("Expected %+v, got %+v", expected[i], record)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{"No Zone", "records:\n  - name: a\n    type: A\n    content: 192.0.2.1\n"},
+		{"Unsupported Type", "zone: example.com\nrecords:\n  - name: a\n    type: PTR\n    content: host.example.com\n"},
+		{"Bad Content", "zone: example.com\nrecords:\n  - name: a\n    type: A\n    content: host.example.com\n"},
+		{"Unknown Placeholder", "zone: example.com\nrecords:\n  - name: a\n    type: A\n    content: \"{{ publicIP }}\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSyncFile([]byte(tt.contents), detect); err == nil {
+				t.Error("Expected error but got none")
+			}
+		})
+	}
+
+	failing := func(string) (string, error) { return "", errors.New("request failed") }
+	if _, err := ParseSyncFile([]byte("zone: example.com\nrecords:\n  - name: a\n    type: A\n    content: \"{{ publicIPv4 }}\"\n"), failing); err == nil {
+		t.Error("Expected error when detection fails but got none")
+	}
+}
+
+func TestPlanSync(t *testing.T) {
+	on := true
+	live := []DNSRecord{
+		{ID: "r1", Name: "example.com", Type: "A", Content: "203.0.113.1", TTL: 1, Proxied: true},
+		{ID: "r2", Name: "example.com", Type: "MX", Content: "mx1.example.com", Priority: 10, TTL: 1},
+		{ID: "r3", Name: "example.com", Type: "MX", Content: "mx2.example.com", Priority: 20, TTL: 1},
+		{ID: "r4", Name: "old.example.com", Type: "A", Content: "203.0.113.9", TTL: 1},
+		{ID: "r5", Name: "sub.example.com", Type: "NS", Content: "ns1.example.net", TTL: 1},
+	}
+	desired := []SyncRecord{
+		{Name: "example.com", Type: "A", Content: "198.51.100.7", Proxied: &on},
+		{Name: "example.com", Type: "MX", Content: "10 mx1.example.com"},
+		{Name: "example.com", Type: "MX", Content: "30 mx3.example.com"},
+		{Name: "new.example.com", Type: "CNAME", Content: "example.com"},
+	}
+
+	var got []string
+	for _, change := range PlanSync(live, desired) {
+		got = append(got, change.String())
+	}
+	expected := []string{
+		"update A example.com: 203.0.113.1 -> 198.51.100.7",
+		"update MX example.com: 20 mx2.example.com -> 30 mx3.example.com",
+		"create CNAME new.example.com: example.com",
+		"delete A old.example.com: 203.0.113.9",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected\n%v\ngot\n%v", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	// Settings alone differing is an update too
+	if changes := PlanSync(live[:1], []SyncRecord{{Name: "example.com", Type: "A", Content: "203.0.113.1"}}); len(changes) != 1 || changes[0].Action != SYNC_UPDATE {
+		t.Errorf("Expected an update turning the proxy off, got %v", changes)
+	}
+}
+
+func TestRunSync(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+				{"id": "r2", "name": "old.example.com", "type": "A", "content": "203.0.113.9", "ttl": 1},
+			},
+		},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+	path := t.TempDir() + "/records.yaml"
+	contents := "zone: example.com\nrecords:\n  - name: \"@\"\n    type: A\n    content: 203.0.113.1\n  - name: www\n    type: CNAME\n    content: example.com\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Nothing is changed without confirmation, and there's nobody to ask without input
+	var out strings.Builder
+	if err := RunZoneCommand(cfClient, nil, "sync", []string{"-f", path}, "", nil, &out); err == nil || !strings.Contains(err.Error(), "-yes") {
+		t.Errorf("Expected error asking for -yes, got %v", err)
+	}
+	out.Reset()
+	if err := RunZoneCommand(cfClient, nil, "sync", []string{"-f", path}, "", strings.NewReader("n\n"), &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "1 to create, 0 to update, 1 to delete") || !strings.Contains(out.String(), "Sync cancelled") {
+		t.Errorf("Expected a summary and the sync cancelled, got %q", out.String())
+	}
+	if len(fake.records["z1"]) != 2 || fake.records["z1"][1]["id"] != "r2" {
+		t.Errorf("Expected the zone left alone, got %v", fake.records["z1"])
+	}
+
+	out.Reset()
+	if err := RunZoneCommand(cfClient, nil, "sync", []string{"-f", path, "-yes"}, "", nil, &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	records := fake.records["z1"]
+	if len(records) != 2 || records[0]["id"] != "r1" || records[1]["name"] != "www.example.com" || records[1]["type"] != "CNAME" {
+		t.Errorf("Expected the zone to match the file, got %v", records)
+	}
+	if !strings.Contains(out.String(), "delete A old.example.com") || !strings.Contains(out.String(), "create CNAME www.example.com") {
+		t.Errorf("Expected the changes to be printed, got %q", out.String())
+	}
+
+	if err := RunZoneCommand(cfClient, nil, "sync", nil, "", nil, &out); err == nil {
+		t.Error("Expected error without a file but got none")
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {
+				{"id": "r1", "name": "example.com", "type": "A", "content": "203.0.113.1", "ttl": 1},
+				{"id": "r2", "name": "old.example.com", "type": "A", "content": "203.0.113.9", "ttl": 1},
+			},
+		},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+	path := t.TempDir() + "/records.yaml"
+	contents := "zone: example.com\nrecords:\n  - name: \"@\"\n    type: A\n    content: 203.0.113.2\n  - name: www\n    type: CNAME\n    content: example.com\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var out strings.Builder
+	if err := RunZoneCommand(cfClient, nil, "diff", []string{"-f", path}, "", nil, &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "~ update A example.com: 203.0.113.1 -> 203.0.113.2\n" +
+		"+ create CNAME www.example.com: example.com\n" +
+		"- delete A old.example.com: 203.0.113.9\n" +
+		"\n1 to create, 1 to update, 1 to delete\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+	if len(fake.edits) != 0 || len(fake.records["z1"]) != 2 {
+		t.Errorf("Expected the zone to be left alone, got edits %v and records %v", fake.edits, fake.records["z1"])
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// Where tailscaled serves its local API on Linux
+const TAILSCALE_SOCKET = "/var/run/tailscale/tailscaled.sock"
+
+// The part of tailscaled's status we need
+type tailscaleStatus struct {
+	Self struct {
+		TailscaleIPs []string `json:"TailscaleIPs"`
+	} `json:"Self"`
+}
+
+// Method to get this machine's Tailscale address from the local tailscaled, its IPv4 one (in 100.64.0.0/10) or IPv6 when asked
+// socket is the path of tailscaled's local API socket, TAILSCALE_SOCKET when empty
+func TailscaleAddress(socket string, ipv6 bool) (string, error) {
+	if socket == "" {
+		socket = TAILSCALE_SOCKET
+	}
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	// The host is ignored, every request goes to the socket, but tailscaled expects this one
+	resp, err := client.Get("http://local-tailscaled.sock/localapi/v0/status")
+	if err != nil {
+		return "", fmt.Errorf("asking tailscaled failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("tailscaled returned status: %d", resp.StatusCode)
+	}
+	var status tailscaleStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return "", fmt.Errorf("parsing tailscaled status failed: %w", err)
+	}
+	for _, address := range status.Self.TailscaleIPs {
+		ip, err := netip.ParseAddr(address)
+		if err == nil && ip.Is6() == ipv6 {
+			return ip.String(), nil
+		}
+	}
+	return "", fmt.Errorf("tailscaled reports no Tailscale address of that family, is this machine logged in?")
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestTailscaleAddress(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "tailscaled.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("Unix sockets unavailable: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/localapi/v0/status" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"Self": {"HostName": "nas", "TailscaleIPs": ["100.101.102.103", "fd7a:115c:a1e0::1"]}}`))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	if ip, err := TailscaleAddress(socket, false); err != nil || ip != "100.101.102.103" {
+		t.Errorf("Expected the Tailscale IPv4 address, got %q, %v", ip, err)
+	}
+	if ip, err := TailscaleAddress(socket, true); err != nil || ip != "fd7a:115c:a1e0::1" {
+		t.Errorf("Expected the Tailscale IPv6 address, got %q, %v", ip, err)
+	}
+	checker := &Checker{Sources: map[string]SourceConfig{"tailnet": {Tailscale: true, TailscaleSocket: socket}}}
+	if ip, err := checker.DetectSource("tailnet"); err != nil || ip != "100.101.102.103" {
+		t.Errorf("Expected the named source's address, got %q, %v", ip, err)
+	}
+	if _, err := TailscaleAddress(filepath.Join(t.TempDir(), "missing.sock"), false); err == nil {
+		t.Error("Expected error without tailscaled but got none")
+	}
+}
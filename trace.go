@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// Field the ID of the running check is logged under
+const CHECK_ID_FIELD = "check"
+
+// Header Cloudflare identifies each response with, the ID its support asks for
+const CF_RAY_HEADER = "Cf-Ray"
+
+// ID of the check running at the moment, empty in between checks
+// Checks never overlap, the daemon and the trigger endpoint both run one at a time, so a single one is enough
+var currentCheckID atomic.Value
+
+// Method to generate the ID a check's log lines, notifications and audit entries are marked with, 16 hexadecimal characters
+func NewCheckID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Method to mark every line logged from now on with the check's ID, until the returned function is called
+func StartCheckID(id string) func() {
+	currentCheckID.Store(id)
+	return func() { currentCheckID.Store("") }
+}
+
+// Logrus hook adding the running check's ID to the lines logged during it
+type CheckIDHook struct{}
+
+func (CheckIDHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (CheckIDHook) Fire(entry *log.Entry) error {
+	if id, _ := currentCheckID.Load().(string); id != "" {
+		if _, ok := entry.Data[CHECK_ID_FIELD]; !ok {
+			entry.Data[CHECK_ID_FIELD] = id
+		}
+	}
+	return nil
+}
+
+// Method to get the ray ID of the response a failed Cloudflare API call got, "" when the error didn't come from Cloudflare
+func RayID(err error) string {
+	var apiErr *cloudflare.Error
+	if errors.As(err, &apiErr) && apiErr.Response != nil {
+		return apiErr.Response.Header.Get(CF_RAY_HEADER)
+	}
+	return ""
+}
+
+// Transport logging the ray ID of every Cloudflare response at debug level, so a request can be matched up with Cloudflare's side
+type rayTransport struct {
+	base http.RoundTripper
+}
+
+func (t rayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		log.Debugf("Cloudflare %v %v: %d, ray %v", req.Method, req.URL.Path, resp.StatusCode, resp.Header.Get(CF_RAY_HEADER))
+	}
+	return resp, err
+}
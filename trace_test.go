@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestCheckIDHook(t *testing.T) {
+	var out bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&out)
+	logger.AddHook(CheckIDHook{})
+
+	id := NewCheckID()
+	if len(id) != 16 || id == NewCheckID() {
+		t.Fatalf("Expected a fresh 16 character ID, got %q", id)
+	}
+	stop := StartCheckID(id)
+	logger.Warn("during the check")
+	stop()
+	logger.Warn("after the check")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %q", out.String())
+	}
+	if !strings.Contains(lines[0], CHECK_ID_FIELD+"="+id) {
+		t.Errorf("Expected the check's ID on %q", lines[0])
+	}
+	if strings.Contains(lines[1], CHECK_ID_FIELD+"=") {
+		t.Errorf("Expected no check ID on %q", lines[1])
+	}
+}
+
+func TestRayID(t *testing.T) {
+	fake := &fakeCloudflare{
+		zones: []map[string]any{{"id": "z1", "name": "example.com"}},
+		records: map[string][]map[string]any{
+			"z1": {{"id": "r1", "name": "example.com", "type": "A", "content": "203.0.113.1", "ttl": 1}},
+		},
+		fail: map[string]bool{"r1": true},
+	}
+	cfClient := newTestCloudflareAPI(t, fake)
+	groups, err := ResolveZones(cfClient, []RecordConfig{{Name: "example.com"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	states, err := UpdateZones(cfClient, groups, map[string]string{"": "198.51.100.7"}, RecordOptions{}, nil)
+	if len(states) != 1 || states[0].RayID != TEST_RAY_ID {
+		t.Errorf("Expected the failure to carry ray %v, got %+v", TEST_RAY_ID, states)
+	}
+	if err == nil || !strings.Contains(err.Error(), "Cloudflare ray "+TEST_RAY_ID) {
+		t.Errorf("Expected the error to name the ray, got %v", err)
+	}
+	if RayID(err) != "" {
+		t.Errorf("Expected no ray ID for an error that isn't Cloudflare's, got %v", RayID(err))
+	}
+}
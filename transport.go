@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+)
+
+// Proxy schemes the proxy flag accepts, socks5h resolving hostnames through the proxy as well
+var PROXY_SCHEMES = []string{"http", "https", "socks5", "socks5h"}
+
+// Version of the program, set when building with -ldflags "-X main.VERSION=v1.2.3"
+var VERSION = "dev"
+
+// How long a request may take when no timeout is configured
+const DEFAULT_TIMEOUT = 5 * time.Second
+
+// How often a failed Cloudflare API request is retried by default
+const DEFAULT_API_RETRIES = 2
+
+// Network settings shared by the clients talking to Cloudflare and to the IP detection services
+type TransportConfig struct {
+	// How long detecting the public IP may take, DEFAULT_TIMEOUT when 0
+	DetectTimeout time.Duration
+	// How long each Cloudflare API request may take, DEFAULT_TIMEOUT when 0
+	APITimeout time.Duration
+	// How often a failed Cloudflare API request is retried
+	APIRetries int
+	// User-Agent sent with every request, DefaultUserAgent() when empty
+	UserAgent string
+	// Proxy every request goes through, nil uses HTTP_PROXY, HTTPS_PROXY and NO_PROXY from the environment
+	Proxy *url.URL
+	// Certificate authorities trusted besides the system ones, e.g. a TLS-intercepting proxy's. nil trusts just the system ones
+	RootCAs *x509.CertPool
+	// Certificates presented to servers asking for one, only used by the detection client
+	ClientCertificates []tls.Certificate
+	// Base URL of the Cloudflare API, the real one when empty
+	APIBase string
+}
+
+// Method to parse a proxy URL, e.g. http://proxy.corp:3128 or socks5://127.0.0.1:1080 for an SSH tunnel
+func ParseProxy(proxy string) (*url.URL, error) {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("parsing proxy failed: %w", err)
+	}
+	if !slices.Contains(PROXY_SCHEMES, proxyURL.Scheme) || proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy must be a URL with one of the schemes %v, got %q", PROXY_SCHEMES, proxy)
+	}
+	return proxyURL, nil
+}
+
+// Method to build a transport with the settings, starting from the default one
+func (t TransportConfig) NewTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if t.Proxy != nil {
+		transport.Proxy = http.ProxyURL(t.Proxy)
+	}
+	if t.RootCAs != nil || len(t.ClientCertificates) > 0 {
+		transport.TLSClientConfig = &tls.Config{RootCAs: t.RootCAs, Certificates: t.ClientCertificates}
+	}
+	return transport
+}
+
+// Method to get the User-Agent identifying this program, e.g. go-dns-update/v1.2.3
+// Some IP detection services throttle the generic Go one
+func DefaultUserAgent() string {
+	return "go-dns-update/" + VERSION
+}
+
+// Method to get the User-Agent to send, the configured one or the default
+func (t TransportConfig) GetUserAgent() string {
+	if t.UserAgent == "" {
+		return DefaultUserAgent()
+	}
+	return t.UserAgent
+}
+
+// Transport setting the User-Agent of every request it sends, unless the request has its own
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") != "" {
+		return t.base.RoundTrip(req)
+	}
+	// A RoundTripper mustn't modify the request it's given
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.base.RoundTrip(req)
+}
+
+// Helper method to fall back to DEFAULT_TIMEOUT for a timeout that isn't set
+func timeoutOrDefault(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return DEFAULT_TIMEOUT
+	}
+	return timeout
+}
+
+// Method to read a PEM bundle of certificate authorities, trusting them on top of the system ones
+func LoadCABundle(path string) (*x509.CertPool, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA bundle failed: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(contents) {
+		return nil, fmt.Errorf("CA bundle %v holds no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// Method to read a client certificate and its key, both PEM encoded
+func LoadClientCertificate(certFile string, keyFile string) (tls.Certificate, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("loading client certificate failed: %w", err)
+	}
+	return certificate, nil
+}
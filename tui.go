@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// How often the terminal dashboard redraws
+const TUI_REFRESH_INTERVAL = time.Second
+
+// How often the terminal dashboard polls the daemon for new data
+const TUI_POLL_INTERVAL = 5 * time.Second
+
+// How many recent checks the terminal dashboard lists
+const TUI_HISTORY_LINES = 10
+
+// Method to show a live updating view of a running daemon in the terminal until interrupted
+// Talks to the daemon's control API at baseURL (e.g. http://localhost:8080)
+func RunTUI(baseURL string, token string, out io.Writer) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	// Colors follow NO_COLOR and the no-color flag, redrawing in place only makes sense on a terminal
+	color := ColorEnabled(out)
+	redraw := ""
+	if IsTerminal(out) {
+		redraw = ANSI_CLEAR
+		fmt.Fprint(out, ANSI_HIDE_CURSOR)
+		defer fmt.Fprint(out, ANSI_SHOW_CURSOR)
+	}
+
+	var status StatusSnapshot
+	var history []CheckResult
+	var fetchErr error
+	var lastFetch time.Time
+	ticker := time.NewTicker(TUI_REFRESH_INTERVAL)
+	defer ticker.Stop()
+	for {
+		if time.Since(lastFetch) >= TUI_POLL_INTERVAL {
+			fetchErr = fetchControlAPI(client, baseURL+"/api/status", token, &status)
+			if fetchErr == nil {
+				fetchErr = fetchControlAPI(client, baseURL+"/api/history", token, &history)
+			}
+			lastFetch = time.Now()
+		}
+		fmt.Fprint(out, redraw+RenderTUI(status, history, fetchErr, time.Now(), color))
+
+		select {
+		case <-stop:
+			fmt.Fprintln(out)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Helper method to GET a control API endpoint and decode its JSON response into target
+func fetchControlAPI(client *http.Client, url string, token string, target any) error {
+	req, err := http.NewRequest(GET_METHOD_KEY, url, nil)
+	if err != nil {
+		return fmt.Errorf("request creation failed: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("server returned status: %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+// Method to render one frame of the terminal dashboard, colored only when color is set
+func RenderTUI(status StatusSnapshot, history []CheckResult, fetchErr error, now time.Time, color bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s  %s\n\n", colorize(color, ANSI_BOLD, "go-dns-update"), colorize(color, ANSI_DIM, now.Format("2006-01-02 15:04:05")))
+	if fetchErr != nil {
+		fmt.Fprintf(&b, "%s\n\n", colorize(color, ANSI_RED, fmt.Sprintf("Can't reach daemon: %v", fetchErr)))
+	}
+
+	detected := status.DetectedIP
+	if detected == "" {
+		detected = "unknown"
+	}
+	fmt.Fprintf(&b, "Detected IP   %s\n", detected)
+	fmt.Fprintf(&b, "Last check    %s\n", formatTUITime(status.LastCheck))
+	fmt.Fprintf(&b, "Last success  %s\n", formatTUITime(status.LastSuccess))
+	switch {
+	case status.PausedUntil != nil:
+		fmt.Fprintf(&b, "Next check    %s\n", colorize(color, ANSI_RED, "paused until "+status.PausedUntil.Format("15:04:05")))
+	case status.NextCheck != nil:
+		fmt.Fprintf(&b, "Next check    in %s\n", max(status.NextCheck.Sub(now).Truncate(time.Second), 0))
+	default:
+		fmt.Fprintf(&b, "Next check    unknown\n")
+	}
+	if status.LastError != "" {
+		fmt.Fprintf(&b, "Last error    %s\n", colorize(color, ANSI_RED, status.LastError))
+	}
+
+	fmt.Fprintf(&b, "\n%s\n", colorize(color, ANSI_BOLD, "Records"))
+	if len(status.Records) == 0 {
+		fmt.Fprintf(&b, "  %s\n", colorize(color, ANSI_DIM, "no successful check yet"))
+	}
+	for _, record := range status.Records {
+		// Records with a source of their own are compared to what they should hold rather than the detected IP
+		wanted := record.Wanted
+		if wanted == "" {
+			wanted = status.DetectedIP
+		}
+		state := colorize(color, ANSI_GREEN, "in sync")
+		if record.IP != wanted {
+			state = colorize(color, ANSI_RED, "out of sync")
+		}
+		fmt.Fprintf(&b, "  %-40s %-16s %s\n", record.Name, record.IP, state)
+	}
+
+	fmt.Fprintf(&b, "\n%s\n", colorize(color, ANSI_BOLD, "Recent events"))
+	if len(history) == 0 {
+		fmt.Fprintf(&b, "  %s\n", colorize(color, ANSI_DIM, "no checks yet"))
+	}
+	for i := len(history) - 1; i >= 0 && i >= len(history)-TUI_HISTORY_LINES; i-- {
+		result := history[i]
+		outcome := colorize(color, ANSI_DIM, "no change")
+		if result.Error != "" {
+			outcome = colorize(color, ANSI_RED, result.Error)
+		} else if result.Changed {
+			outcome = colorize(color, ANSI_GREEN, result.ChangeDescription())
+		}
+		fmt.Fprintf(&b, "  %s  %s\n", result.Time.Local().Format("2006-01-02 15:04:05"), outcome)
+	}
+	fmt.Fprintf(&b, "\n%s\n", colorize(color, ANSI_DIM, "Ctrl-C to quit"))
+	return b.String()
+}
+
+// Helper method to format an optional time for the terminal dashboard
+func formatTUITime(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
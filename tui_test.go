@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderTUI(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	next := now.Add(90 * time.Second)
+	status := StatusSnapshot{
+		DetectedIP: "203.0.113.42",
+		NextCheck:  &next,
+		Records: []RecordState{
+			{Name: "example.com", IP: "203.0.113.42"},
+			{Name: "www.example.com", IP: "198.51.100.1"},
+			{Name: "vpn.example.com", IP: "10.0.0.1", Wanted: "10.0.0.1"},
+		},
+	}
+	history := []CheckResult{
+		{Time: now.Add(-time.Minute), Error: "could not retrieve initial values"},
+		{Time: now, Changed: true},
+	}
+
+	frame := RenderTUI(status, history, nil, now, true)
+	for _, expected := range []string{"203.0.113.42", "in 1m30s", "in sync", "out of sync", "records updated", "could not retrieve initial values"} {
+		if !strings.Contains(frame, expected) {
+			t.Errorf("Expected frame to contain %q", expected)
+		}
+	}
+	// Newest events come first
+	if strings.Index(frame, "records updated") > strings.Index(frame, "could not retrieve initial values") {
+		t.Error("Expected the most recent event to be listed first")
+	}
+
+	if !strings.Contains(frame, "vpn.example.com                          10.0.0.1         "+ANSI_GREEN+"in sync") {
+		t.Error("Expected a record with a source of its own to be compared to the address it should hold")
+	}
+
+	// Without colors the frame holds no escape codes at all
+	if plain := RenderTUI(status, history, nil, now, false); strings.Contains(plain, "\033") {
+		t.Errorf("Expected no escape codes without colors, got %q", plain)
+	}
+
+	frame = RenderTUI(StatusSnapshot{}, nil, errors.New("request failed"), now, false)
+	if !strings.Contains(frame, "Can't reach daemon: request failed") {
+		t.Error("Expected fetch errors to be shown")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+)
+
+// Address the route to the internet is looked up for, nothing is actually sent to it
+const ROUTE_PROBE_ADDRESS = "1.1.1.1:53"
+
+// Interfaces treated as VPNs by default, as patterns like wg*
+const DEFAULT_VPN_INTERFACES = "wg*,tun*,tap*"
+
+// Method to find the interface traffic to the internet currently leaves through
+// The kernel picks the route, so policy routing like wg-quick's full tunnel is taken into account
+func RouteInterface(probe string) (string, error) {
+	// Connecting a UDP socket only picks the route and source address, no packet is sent
+	conn, err := net.Dial("udp", probe)
+	if err != nil {
+		return "", fmt.Errorf("looking up the route to %v failed: %w", probe, err)
+	}
+	defer conn.Close()
+	local := conn.LocalAddr().(*net.UDPAddr).IP
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", fmt.Errorf("listing interfaces failed: %w", err)
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(local) {
+				return iface.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no interface has the source address %v", local)
+}
+
+// Method to report whether an interface's name matches one of the VPN patterns
+func IsVPNInterface(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper method to split the vpnInterfaces flag into its patterns
+func ParseVPNInterfaces(value string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("pattern %q is malformed", pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("lists no interfaces")
+	}
+	return patterns, nil
+}
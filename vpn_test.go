@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestIsVPNInterface(t *testing.T) {
+	patterns, err := ParseVPNInterfaces(DEFAULT_VPN_INTERFACES + ", ipsec0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"wg0", true},
+		{"tun1", true},
+		{"ipsec0", true},
+		{"eth0", false},
+		{"ppp0", false},
+	}
+	for _, tt := range tests {
+		if got := IsVPNInterface(tt.name, patterns); got != tt.expected {
+			t.Errorf("Expected %v for %v, got %v", tt.expected, tt.name, got)
+		}
+	}
+
+	for _, value := range []string{"", " , ", "wg[0"} {
+		if _, err := ParseVPNInterfaces(value); err == nil {
+			t.Errorf("Expected error for %q but got none", value)
+		}
+	}
+}
+
+func TestRouteInterface(t *testing.T) {
+	name, err := RouteInterface("127.0.0.1:53")
+	if err != nil {
+		t.Skipf("No loopback route: %v", err)
+	}
+	if name == "" {
+		t.Error("Expected the loopback interface's name")
+	}
+}
+
+func TestRunCheck_SkipOnVPN(t *testing.T) {
+	route := "wg0"
+	checker := &Checker{VPNInterfaces: []string{"wg*"}, routeInterface: func() (string, error) { return route, nil }}
+	report, err := checker.RunCheck()
+	if err != nil || report.PublicIP != "" || !strings.Contains(report.Skipped, "wg0") {
+		t.Errorf("Expected the check to be skipped, got %+v, %v", report, err)
+	}
+
+	route = "eth0"
+	if vpn := checker.activeVPN(); vpn != "" {
+		t.Errorf("Expected no active VPN, got %v", vpn)
+	}
+	checker.routeInterface = func() (string, error) { return "", errors.New("network is unreachable") }
+	if vpn := checker.activeVPN(); vpn != "" {
+		t.Errorf("Expected a failed route lookup not to skip the check, got %v", vpn)
+	}
+}